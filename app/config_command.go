@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"iot-data-collection/app/internal/config"
+)
+
+// runConfigCommand 處理 `config print`：輸出合併預設值、設定檔與環境變數後生效的設定（機密欄位遮蔽），回傳 exit code
+func runConfigCommand(args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: main config print")
+		return 2
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		if verr, ok := err.(*config.ValidationError); ok {
+			fmt.Fprintln(os.Stderr, "invalid config:")
+			for _, f := range verr.Fields {
+				fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Field, f.Message)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+	if err := cfg.WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
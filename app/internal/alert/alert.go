@@ -0,0 +1,88 @@
+// Package alert 將告警事件送往外部（webhook）或日誌
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"iot-data-collection/app/internal/logger"
+)
+
+// 告警類型
+const (
+	TypeAnomaly = "anomaly"
+)
+
+// Alert 告警事件
+type Alert struct {
+	Type      string                 `json:"type"`
+	TenantID  string                 `json:"tenant_id"`
+	DeviceID  string                 `json:"device_id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier 送出告警
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// NewNotifierFromConfig webhookURL 為空時回傳只寫日誌的 Notifier
+func NewNotifierFromConfig(webhookURL string) Notifier {
+	if webhookURL == "" {
+		return LogNotifier{}
+	}
+	return NewWebhookNotifier(webhookURL, 5*time.Second)
+}
+
+// LogNotifier 將告警寫入日誌
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, a Alert) error {
+	logger.FromContext(ctx).Warn("alert",
+		slog.String("alert_type", a.Type),
+		slog.String(logger.KeyTenantID, a.TenantID),
+		slog.String(logger.KeyDeviceID, a.DeviceID),
+		slog.String("message", a.Message),
+		slog.Any("details", a.Details))
+	return nil
+}
+
+// WebhookNotifier 以 JSON POST 告警到 webhook，同時寫入日誌
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	_ = LogNotifier{}.Notify(ctx, a)
+
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("解析告警失敗: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookNotifier(srv.URL, time.Second)
+	err := n.Notify(context.Background(), Alert{Type: TypeAnomaly, TenantID: "t1", DeviceID: "d1", Message: "溫度異常"})
+	if err != nil {
+		t.Fatalf("Notify 失敗: %v", err)
+	}
+	if got.Type != TypeAnomaly || got.DeviceID != "d1" {
+		t.Errorf("webhook 收到的內容不符: %+v", got)
+	}
+
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer fail.Close()
+	if err := NewWebhookNotifier(fail.URL, time.Second).Notify(context.Background(), Alert{}); err == nil {
+		t.Error("webhook 回傳 5xx 時應回傳錯誤")
+	}
+}
@@ -0,0 +1,90 @@
+// Package anomaly 以 EWMA（指數加權移動平均與變異數）計算讀值的 z-score，偵測偏離設備自身基準的讀值
+package anomaly
+
+import "math"
+
+// 預設參數
+const (
+	DefaultAlpha      = 0.05 // 平滑係數，越小基準變化越慢
+	DefaultThreshold  = 3.0  // |z| 超過此值視為異常
+	DefaultMinSamples = 30   // 累積足夠樣本前只學習不判定
+)
+
+// minStdDev 標準差過小（例如讀值長時間固定）時不計算 z-score，避免微小變動被放大成異常
+const minStdDev = 1e-6
+
+// FieldState 單一欄位的 EWMA 狀態
+type FieldState struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"`
+}
+
+// State 設備各欄位的狀態，key 為欄位名稱
+type State map[string]*FieldState
+
+// Settings 偵測參數
+type Settings struct {
+	Alpha      float64
+	Threshold  float64
+	MinSamples int
+	Fields     []string
+}
+
+// Result 單筆讀值的偵測結果
+type Result struct {
+	Score     float64            // 各欄位 |z| 的最大值
+	Anomalous bool               // Score 超過門檻
+	Fields    map[string]float64 // 已完成暖機欄位的 z-score
+}
+
+// Score 以更新前的基準計算 x 的 z-score；樣本不足或標準差過小時 ready 為 false
+func (s *FieldState) Score(x float64, minSamples int) (z float64, ready bool) {
+	std := math.Sqrt(s.Variance)
+	if s.Count < minSamples || std < minStdDev {
+		return 0, false
+	}
+	return (x - s.Mean) / std, true
+}
+
+// Update 將 x 納入 EWMA 基準。clip > 0 時先將 x 限制在 mean ± clip×std，
+// 讓單一離群值不會把基準拉偏，但持續的偏移仍會逐漸成為新基準
+func (s *FieldState) Update(x, alpha, clip float64) {
+	if s.Count == 0 {
+		s.Mean, s.Variance, s.Count = x, 0, 1
+		return
+	}
+	if std := math.Sqrt(s.Variance); clip > 0 && std >= minStdDev {
+		x = math.Max(s.Mean-clip*std, math.Min(s.Mean+clip*std, x))
+	}
+	diff := x - s.Mean
+	incr := alpha * diff
+	s.Mean += incr
+	s.Variance = (1 - alpha) * (s.Variance + diff*incr)
+	s.Count++
+}
+
+// Detect 依序計算各欄位的 z-score 並更新狀態；values 中沒有的欄位不變
+func Detect(state State, settings Settings, values map[string]float64) Result {
+	res := Result{Fields: map[string]float64{}}
+	for _, name := range settings.Fields {
+		x, ok := values[name]
+		if !ok {
+			continue
+		}
+		fs := state[name]
+		if fs == nil {
+			fs = &FieldState{}
+			state[name] = fs
+		}
+		if z, ready := fs.Score(x, settings.MinSamples); ready {
+			res.Fields[name] = z
+			if math.Abs(z) > res.Score {
+				res.Score = math.Abs(z)
+			}
+		}
+		fs.Update(x, settings.Alpha, settings.Threshold)
+	}
+	res.Anomalous = res.Score > settings.Threshold
+	return res
+}
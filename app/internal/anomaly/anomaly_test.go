@@ -0,0 +1,43 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	settings := Settings{Alpha: DefaultAlpha, Threshold: DefaultThreshold, MinSamples: 10, Fields: []string{"temperature"}}
+	state := State{}
+
+	// 建立約 40°C、小幅波動的基準
+	for i := 0; i < 200; i++ {
+		x := 40 + 0.5*math.Sin(float64(i))
+		if res := Detect(state, settings, map[string]float64{"temperature": x}); res.Anomalous {
+			t.Fatalf("第 %d 筆基準讀值不應判定為異常，score=%v", i, res.Score)
+		}
+	}
+
+	res := Detect(state, settings, map[string]float64{"temperature": 50})
+	if !res.Anomalous || res.Fields["temperature"] <= settings.Threshold {
+		t.Errorf("高於基準 10°C 應判定為異常，得到 %+v", res)
+	}
+
+	// 單一離群值不應大幅拉高基準
+	if mean := state["temperature"].Mean; mean > 41 {
+		t.Errorf("離群值拉偏基準，mean=%v", mean)
+	}
+
+	if res := Detect(state, settings, map[string]float64{"voltage": 220}); res.Anomalous || len(res.Fields) != 0 {
+		t.Errorf("未設定偵測的欄位應忽略，得到 %+v", res)
+	}
+}
+
+func TestDetectWarmup(t *testing.T) {
+	settings := Settings{Alpha: DefaultAlpha, Threshold: DefaultThreshold, MinSamples: 5, Fields: []string{"voltage"}}
+	state := State{}
+	for i, x := range []float64{220, 221, 219, 500} {
+		if res := Detect(state, settings, map[string]float64{"voltage": x}); res.Anomalous {
+			t.Errorf("暖機期間（第 %d 筆）不應判定為異常", i)
+		}
+	}
+}
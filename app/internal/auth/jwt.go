@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrUnsupportedAlg    = errors.New("unsupported signing algorithm")
+	ErrNoVerificationKey = errors.New("no verification key configured")
+)
+
+// clockSkewLeeway 驗證 exp/nbf 時容許的時鐘誤差
+const clockSkewLeeway = 30 * time.Second
+
+// Claims JWT payload 中本服務使用的欄位
+type Claims struct {
+	Subject    string   `json:"sub"`
+	Issuer     string   `json:"iss,omitempty"`
+	Audience   audience `json:"aud,omitempty"`
+	ExpiresAt  int64    `json:"exp"`
+	NotBefore  int64    `json:"nbf,omitempty"`
+	IssuedAt   int64    `json:"iat,omitempty"`
+	Tenant     string   `json:"tenant,omitempty"`
+	Roles      []string `json:"roles"`
+	DeviceTags []string `json:"device_tags,omitempty"` // 空值表示可存取租戶內所有設備
+	Platform   bool     `json:"platform,omitempty"`    // 平台營運方，搭配 admin 角色可管理所有租戶
+}
+
+// audience JWT 的 aud 可以是字串或字串陣列
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Verifier 以本地金鑰驗證 HS256 / RS256 簽章的 JWT
+type Verifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	issuer     string
+	audience   string
+	now        func() time.Time
+}
+
+// NewVerifier 建立 Verifier；hmacSecret 與 rsaKey 至少需提供一個，
+// issuer、audience 為空時不檢查
+func NewVerifier(hmacSecret []byte, rsaKey *rsa.PublicKey, issuer, audience string) (*Verifier, error) {
+	if len(hmacSecret) == 0 && rsaKey == nil {
+		return nil, ErrNoVerificationKey
+	}
+	return &Verifier{
+		hmacSecret: hmacSecret,
+		rsaKey:     rsaKey,
+		issuer:     issuer,
+		audience:   audience,
+		now:        time.Now,
+	}, nil
+}
+
+// LoadRSAPublicKey 讀取 PEM 格式（PKIX 或 PKCS#1）的 RSA 公鑰
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("讀取 RSA 公鑰失敗: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("RSA 公鑰不是有效的 PEM 格式")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析 RSA 公鑰失敗: %w", err)
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("公鑰不是 RSA 金鑰")
+	}
+	return key, nil
+}
+
+// Verify 驗證簽章與時效，回傳 claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signingInput := parts[0] + "." + parts[1]
+
+	switch header.Alg {
+	case "HS256":
+		if len(v.hmacSecret) == 0 {
+			return nil, ErrUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case "RS256":
+		if v.rsaKey == nil {
+			return nil, ErrUnsupportedAlg
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(v.rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, ErrInvalidToken
+		}
+	default:
+		// 包含 "none"：一律拒絕
+		return nil, ErrUnsupportedAlg
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := v.now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkewLeeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkewLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, ErrInvalidToken
+	}
+	if v.audience != "" && !claims.Audience.contains(v.audience) {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewVerifierFromConfig 依設定建立 Verifier；未設定任何金鑰時回傳 nil（停用 RBAC）
+func NewVerifierFromConfig(hmacSecret, rsaPublicKeyFile, issuer, audience string) (*Verifier, error) {
+	if hmacSecret == "" && rsaPublicKeyFile == "" {
+		return nil, nil
+	}
+	var rsaKey *rsa.PublicKey
+	if rsaPublicKeyFile != "" {
+		key, err := LoadRSAPublicKey(rsaPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey = key
+	}
+	return NewVerifier([]byte(hmacSecret), rsaKey, issuer, audience)
+}
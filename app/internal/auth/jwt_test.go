@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify_HS256(t *testing.T) {
+	v, _ := NewVerifier([]byte(testSecret), nil, "", "")
+	token := signHS256(t, map[string]interface{}{
+		"sub":         "alice",
+		"tenant":      "acme",
+		"roles":       []string{"operator"},
+		"device_tags": []string{"substation-a"},
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	})
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("期望驗證成功，得到 %v", err)
+	}
+	p, err := PrincipalFromClaims(claims)
+	if err != nil || p.TenantID != "acme" || !p.HasRole(RoleViewer) || p.HasRole(RoleAdmin) {
+		t.Fatalf("principal 不符預期: %+v err=%v", p, err)
+	}
+	if p.CanAccessTags([]string{"substation-b"}) || !p.CanAccessTags([]string{"substation-a"}) {
+		t.Errorf("設備標籤限制不符預期")
+	}
+}
+
+// TestPrincipalFromClaims_TenantAndPlatform 權杖不可省略 tenant；跨租戶管理只看 platform claim
+func TestPrincipalFromClaims_TenantAndPlatform(t *testing.T) {
+	if _, err := PrincipalFromClaims(&Claims{Subject: "mallory", Roles: []string{"admin"}}); !errors.Is(err, ErrMissingTenant) {
+		t.Errorf("未帶 tenant 的 admin 權杖應被拒絕，得到 %v", err)
+	}
+	if _, err := PrincipalFromClaims(&Claims{Subject: "bob", Roles: []string{"viewer"}}); !errors.Is(err, ErrMissingTenant) {
+		t.Errorf("未帶 tenant 的一般權杖也應被拒絕，得到 %v", err)
+	}
+
+	admin, _ := PrincipalFromClaims(&Claims{Tenant: "default", Roles: []string{"admin"}})
+	if admin.PlatformAdmin() {
+		t.Errorf("預設租戶的 admin 不應自動成為平台管理者")
+	}
+	platform, _ := PrincipalFromClaims(&Claims{Tenant: "ops", Roles: []string{"admin"}, Platform: true})
+	operator, _ := PrincipalFromClaims(&Claims{Tenant: "ops", Roles: []string{"operator"}, Platform: true})
+	if !platform.PlatformAdmin() || operator.PlatformAdmin() {
+		t.Errorf("平台管理者需同時具備 platform claim 與 admin 角色")
+	}
+}
+
+func TestVerify_Expired(t *testing.T) {
+	v, _ := NewVerifier([]byte(testSecret), nil, "", "")
+	token := signHS256(t, map[string]interface{}{
+		"sub": "alice",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	if _, err := v.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("期望 ErrTokenExpired，得到 %v", err)
+	}
+}
+
+func TestVerify_RejectsNoneAndTampered(t *testing.T) {
+	v, _ := NewVerifier([]byte(testSecret), nil, "", "")
+	claims := map[string]interface{}{"sub": "mallory", "roles": []string{"admin"}, "exp": time.Now().Add(time.Hour).Unix()}
+
+	none := encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims) + "."
+	if _, err := v.Verify(none); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Errorf("alg=none 應被拒絕，得到 %v", err)
+	}
+
+	token := signHS256(t, map[string]interface{}{"sub": "mallory", "roles": []string{"viewer"}, "exp": time.Now().Add(time.Hour).Unix()})
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + encodeSegment(t, claims) + "." + parts[2]
+	if _, err := v.Verify(tampered); err == nil {
+		t.Errorf("竄改 payload 的 token 應驗證失敗")
+	}
+}
+
+func TestVerify_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewVerifier(nil, &key.PublicKey, "issuer-a", "iot-api")
+
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, map[string]interface{}{
+		"sub":   "svc-dashboard",
+		"iss":   "issuer-a",
+		"aud":   []string{"iot-api"},
+		"roles": []string{"viewer"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := input + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("期望 RS256 驗證成功，得到 %v", err)
+	}
+
+	// 只設定 RSA 公鑰時，HS256 token 不應被接受
+	if _, err := v.Verify(signHS256(t, map[string]interface{}{"sub": "x", "exp": time.Now().Add(time.Hour).Unix()})); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Errorf("期望 ErrUnsupportedAlg，得到 %v", err)
+	}
+}
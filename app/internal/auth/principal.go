@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Role 存取角色，權限由低到高為 viewer < operator < admin
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // 唯讀查詢
+	RoleOperator Role = "operator" // 可回報資料與操作設備
+	RoleAdmin    Role = "admin"    // 可管理設備設定與租戶憑證
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// 驗證方式
+const (
+	MethodJWT       = "jwt"
+	MethodAPIKey    = "api_key"
+	MethodAnonymous = "anonymous"
+)
+
+// ErrMissingTenant 權杖未帶 tenant claim；不可歸屬預設租戶，以免取得預設租戶的資料與權限
+var ErrMissingTenant = errors.New("token without tenant claim")
+
+// Principal 已驗證的呼叫者
+type Principal struct {
+	Subject    string
+	TenantID   string
+	Method     string
+	Roles      []Role
+	DeviceTags []string // 空值表示不限制設備
+	APIKeyID   int      // 以 API key 驗證時的 key ID
+	Platform   bool     // 平台營運方，admin 角色時可管理所有租戶
+}
+
+// HasRole 判斷是否具有至少 required 等級的角色
+func (p *Principal) HasRole(required Role) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if roleRank[r] >= roleRank[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessTags 判斷是否可存取帶有 deviceTags 的設備：
+// 未限制標籤的呼叫者可存取所有設備，否則至少需符合一個標籤
+func (p *Principal) CanAccessTags(deviceTags []string) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.DeviceTags) == 0 {
+		return true
+	}
+	for _, allowed := range p.DeviceTags {
+		for _, t := range deviceTags {
+			if allowed == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PlatformAdmin 判斷是否為可跨租戶管理的平台管理者
+func (p *Principal) PlatformAdmin() bool {
+	return p != nil && p.Platform && p.HasRole(RoleAdmin)
+}
+
+// PrincipalFromClaims 由 JWT claims 建立 Principal，未知角色會被忽略；
+// 權杖必須明確指定租戶，未帶 tenant claim 時回傳 ErrMissingTenant
+func PrincipalFromClaims(c *Claims) (*Principal, error) {
+	p := &Principal{
+		Subject:    c.Subject,
+		TenantID:   c.Tenant,
+		Method:     MethodJWT,
+		DeviceTags: c.DeviceTags,
+		Platform:   c.Platform,
+	}
+	for _, r := range c.Roles {
+		if _, ok := roleRank[Role(r)]; ok {
+			p.Roles = append(p.Roles, Role(r))
+		}
+	}
+	if p.TenantID == "" {
+		return nil, ErrMissingTenant
+	}
+	return p, nil
+}
+
+type ctxKey struct{}
+
+// WithPrincipal 將 Principal 放入 context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// PrincipalFromContext 取出 context 中的 Principal，沒有則回傳 nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(ctxKey{}).(*Principal)
+	return p
+}
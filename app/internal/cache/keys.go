@@ -1,13 +1,68 @@
 package cache
 
-import "time"
-
 const (
 	LatestMetricKeyPrefix = "device_metric:"
 	LatestMetricKeySuffix = ":latest"
-	LatestMetricTTL       = 60 * time.Second
 )
 
-func LatestMetricKey(deviceID string) string {
-	return LatestMetricKeyPrefix + deviceID + LatestMetricKeySuffix
+// LatestMetricKey 最新一筆 metric 的快取 key，依租戶隔離，
+// 不同租戶即使 device ID 相同也不會互相覆蓋
+func LatestMetricKey(tenantID, deviceID string) string {
+	return LatestMetricKeyPrefix + tenantID + ":" + deviceID + LatestMetricKeySuffix
+}
+
+// VersionKey 記錄 key 目前值版本（例如讀值時間戳）的 key，供 SetIfNewer 比較；
+// 以 {key} 作為 hash tag，在 Redis Cluster 下與 key 位於同一 slot
+func VersionKey(key string) string {
+	return "{" + key + "}:version"
+}
+
+const APIKeyTenantKeyPrefix = "api_key:"
+
+// APIKeyTenantKey API key（雜湊值）對應 key 資訊（ID 與租戶）的快取 key
+func APIKeyTenantKey(keyHash string) string {
+	return APIKeyTenantKeyPrefix + keyHash
+}
+
+const DeviceTypeKeyPrefix = "device_type:"
+
+// DeviceTypeKey 設備類型的快取 key（限流等熱路徑使用，避免每次查 DB）
+func DeviceTypeKey(tenantID, deviceID string) string {
+	return DeviceTypeKeyPrefix + tenantID + ":" + deviceID
+}
+
+const DeviceTypeSchemaKeyPrefix = "device_type_schema:"
+
+// DeviceTypeSchemaKey 設備類型 schema 的快取 key
+func DeviceTypeSchemaKey(tenantID, typeName string) string {
+	return DeviceTypeSchemaKeyPrefix + tenantID + ":" + typeName
+}
+
+const ValidationProfileKeyPrefix = "validation_profile:"
+
+// ValidationProfileKey 驗證設定檔的快取 key，scope 為 device-type 或 device
+func ValidationProfileKey(tenantID, scope, target string) string {
+	return ValidationProfileKeyPrefix + tenantID + ":" + scope + ":" + target
+}
+
+const (
+	AnomalySettingsKeyPrefix = "anomaly_settings:"
+	AnomalyStateKeyPrefix    = "anomaly_state:"
+)
+
+// AnomalySettingsKey 設備異常偵測設定的快取 key
+func AnomalySettingsKey(tenantID, deviceID string) string {
+	return AnomalySettingsKeyPrefix + tenantID + ":" + deviceID
+}
+
+// AnomalyStateKey 設備異常偵測 EWMA 基準狀態的 key（僅存於 Redis）
+func AnomalyStateKey(tenantID, deviceID string) string {
+	return AnomalyStateKeyPrefix + tenantID + ":" + deviceID
+}
+
+const FleetSummaryKeyPrefix = "fleet_summary:"
+
+// FleetSummaryKey 租戶車隊總覽的快取 key；variant 區分 top-N 與呼叫者的設備標籤限制
+func FleetSummaryKey(tenantID, variant string) string {
+	return FleetSummaryKeyPrefix + tenantID + ":" + variant
 }
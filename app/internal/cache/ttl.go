@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TTLs 各類快取的存活時間；可在執行期間以 SetTTLs 調整（例如收到 SIGHUP 重新載入設定）
+type TTLs struct {
+	LatestMetric      time.Duration
+	APIKeyTenant      time.Duration
+	DeviceType        time.Duration
+	DeviceTypeSchema  time.Duration
+	ValidationProfile time.Duration
+	AnomalySettings   time.Duration
+	AnomalyState      time.Duration // 設備長時間未回報時基準自動失效
+}
+
+// DefaultTTLs 未設定時使用的存活時間
+func DefaultTTLs() TTLs {
+	return TTLs{
+		LatestMetric:      60 * time.Second,
+		APIKeyTenant:      60 * time.Second,
+		DeviceType:        5 * time.Minute,
+		DeviceTypeSchema:  5 * time.Minute,
+		ValidationProfile: 5 * time.Minute,
+		AnomalySettings:   5 * time.Minute,
+		AnomalyState:      7 * 24 * time.Hour,
+	}
+}
+
+var ttls atomic.Pointer[TTLs]
+
+func init() {
+	SetTTLs(DefaultTTLs())
+}
+
+// SetTTLs 替換目前的存活時間，只影響之後寫入的 key
+func SetTTLs(t TTLs) {
+	ttls.Store(&t)
+}
+
+// CurrentTTLs 目前生效的存活時間
+func CurrentTTLs() TTLs {
+	return *ttls.Load()
+}
+
+// LatestMetricTTL 最新一筆 metric 的快取存活時間
+func LatestMetricTTL() time.Duration { return ttls.Load().LatestMetric }
+
+// APIKeyTenantTTL API key 對應租戶的快取存活時間
+func APIKeyTenantTTL() time.Duration { return ttls.Load().APIKeyTenant }
+
+// DeviceTypeTTL 設備類型的快取存活時間
+func DeviceTypeTTL() time.Duration { return ttls.Load().DeviceType }
+
+// DeviceTypeSchemaTTL 設備類型 schema 的快取存活時間
+func DeviceTypeSchemaTTL() time.Duration { return ttls.Load().DeviceTypeSchema }
+
+// ValidationProfileTTL 驗證設定檔的快取存活時間
+func ValidationProfileTTL() time.Duration { return ttls.Load().ValidationProfile }
+
+// AnomalySettingsTTL 異常偵測設定的快取存活時間
+func AnomalySettingsTTL() time.Duration { return ttls.Load().AnomalySettings }
+
+// AnomalyStateTTL 異常偵測基準狀態的存活時間
+func AnomalyStateTTL() time.Duration { return ttls.Load().AnomalyState }
@@ -0,0 +1,138 @@
+// Package clockskew 比對設備時間戳與伺服器接收時間，依政策接受、校正或拒絕，並統計各設備的時鐘偏差
+package clockskew
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 政策模式
+const (
+	ModeOff     = "off"     // 只統計偏差，不處理
+	ModeCorrect = "correct" // 超出容許範圍時以伺服器接收時間取代
+	ModeReject  = "reject"  // 超出容許範圍時拒絕
+)
+
+// 單筆讀值的處理結果
+const (
+	ActionAccept  = "accept"
+	ActionCorrect = "correct"
+	ActionReject  = "reject"
+)
+
+// Policy 時間戳容許範圍：晚於接收時間超過 MaxFuture、或早於接收時間超過 MaxPast 視為異常
+type Policy struct {
+	Mode      string
+	MaxFuture time.Duration
+	MaxPast   time.Duration
+}
+
+// NewPolicy 驗證並建立 Policy
+func NewPolicy(mode string, maxFuture, maxPast time.Duration) (*Policy, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case ModeOff, ModeCorrect, ModeReject:
+	default:
+		return nil, errors.New("clock skew mode must be off, correct or reject")
+	}
+	if maxFuture <= 0 || maxPast <= 0 {
+		return nil, errors.New("clock skew bounds must be positive")
+	}
+	return &Policy{Mode: mode, MaxFuture: maxFuture, MaxPast: maxPast}, nil
+}
+
+// PolicySource 提供目前生效的 Policy；*Policy 本身即為固定不變的來源
+type PolicySource interface {
+	Current() *Policy
+}
+
+// Current 實作 PolicySource
+func (p *Policy) Current() *Policy {
+	return p
+}
+
+// DynamicPolicy 可於執行期間替換的 Policy（例如收到 SIGHUP 重新載入設定）
+type DynamicPolicy struct {
+	p atomic.Pointer[Policy]
+}
+
+// NewDynamicPolicy 以初始 Policy 建立 DynamicPolicy
+func NewDynamicPolicy(p *Policy) *DynamicPolicy {
+	d := &DynamicPolicy{}
+	d.p.Store(p)
+	return d
+}
+
+// Current 實作 PolicySource
+func (d *DynamicPolicy) Current() *Policy {
+	return d.p.Load()
+}
+
+// Store 替換 Policy，之後的讀值立即套用
+func (d *DynamicPolicy) Store(p *Policy) {
+	d.p.Store(p)
+}
+
+// Decision 單筆讀值的判定
+type Decision struct {
+	Action    string
+	Skew      time.Duration // 接收時間 - 設備時間；正值表示設備時間落後（或傳輸延遲）
+	Timestamp time.Time     // 採用的時間戳（校正時為接收時間）
+}
+
+// Evaluate 依政策判定設備時間戳；policy 為 nil 時一律接受
+func (p *Policy) Evaluate(deviceTS, receivedAt time.Time) Decision {
+	d := Decision{Action: ActionAccept, Skew: receivedAt.Sub(deviceTS), Timestamp: deviceTS}
+	if p == nil || p.Mode == ModeOff {
+		return d
+	}
+	if d.Skew >= -p.MaxFuture && d.Skew <= p.MaxPast {
+		return d
+	}
+	if p.Mode == ModeReject {
+		d.Action = ActionReject
+		return d
+	}
+	d.Action, d.Timestamp = ActionCorrect, receivedAt
+	return d
+}
+
+// skewAlpha 偏差估計的 EWMA 平滑係數
+const skewAlpha = 0.1
+
+// Stats 設備時鐘偏差統計（毫秒）
+type Stats struct {
+	DeviceID       string    `json:"device_id"`
+	Samples        int64     `json:"samples"`
+	EstimatedSkew  float64   `json:"estimated_skew_ms"` // EWMA 估計值
+	LastSkew       float64   `json:"last_skew_ms"`
+	MinSkew        float64   `json:"min_skew_ms"`
+	MaxSkew        float64   `json:"max_skew_ms"`
+	Corrected      int64     `json:"corrected"`
+	Rejected       int64     `json:"rejected"`
+	LastReceivedAt time.Time `json:"last_received_at"`
+}
+
+// Observe 將一筆判定納入統計
+func (s *Stats) Observe(d Decision, receivedAt time.Time) {
+	ms := float64(d.Skew) / float64(time.Millisecond)
+	if s.Samples == 0 {
+		s.EstimatedSkew, s.MinSkew, s.MaxSkew = ms, ms, ms
+	} else {
+		s.EstimatedSkew += skewAlpha * (ms - s.EstimatedSkew)
+		s.MinSkew = math.Min(s.MinSkew, ms)
+		s.MaxSkew = math.Max(s.MaxSkew, ms)
+	}
+	s.Samples++
+	s.LastSkew = ms
+	s.LastReceivedAt = receivedAt
+	switch d.Action {
+	case ActionCorrect:
+		s.Corrected++
+	case ActionReject:
+		s.Rejected++
+	}
+}
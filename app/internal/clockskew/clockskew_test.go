@@ -0,0 +1,56 @@
+package clockskew
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyEvaluate(t *testing.T) {
+	received := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	correct, err := NewPolicy("correct", 5*time.Minute, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reject, _ := NewPolicy("reject", 5*time.Minute, 24*time.Hour)
+	off, _ := NewPolicy("off", 5*time.Minute, 24*time.Hour)
+
+	cases := []struct {
+		name     string
+		policy   *Policy
+		deviceTS time.Time
+		action   string
+	}{
+		{"正常", correct, received.Add(-2 * time.Second), ActionAccept},
+		{"補傳數小時前的資料", correct, received.Add(-3 * time.Hour), ActionAccept},
+		{"電池更換後回到 1970", correct, time.Unix(0, 0), ActionCorrect},
+		{"超前一小時", correct, received.Add(time.Hour), ActionCorrect},
+		{"拒絕模式", reject, received.Add(time.Hour), ActionReject},
+		{"停用", off, time.Unix(0, 0), ActionAccept},
+	}
+	for _, c := range cases {
+		d := c.policy.Evaluate(c.deviceTS, received)
+		if d.Action != c.action {
+			t.Errorf("%s: 期望 %s，得到 %s", c.name, c.action, d.Action)
+		}
+		if d.Action == ActionCorrect && !d.Timestamp.Equal(received) {
+			t.Errorf("%s: 校正後應使用接收時間，得到 %v", c.name, d.Timestamp)
+		}
+	}
+
+	if _, err := NewPolicy("ignore", time.Minute, time.Minute); err == nil {
+		t.Error("不支援的模式應回傳錯誤")
+	}
+}
+
+func TestStatsObserve(t *testing.T) {
+	var s Stats
+	now := time.Now()
+	s.Observe(Decision{Action: ActionAccept, Skew: 2 * time.Second}, now)
+	s.Observe(Decision{Action: ActionCorrect, Skew: -time.Hour}, now)
+	if s.Samples != 2 || s.Corrected != 1 || s.MinSkew != -3600000 || s.MaxSkew != 2000 || s.LastSkew != -3600000 {
+		t.Errorf("統計不符: %+v", s)
+	}
+	if s.EstimatedSkew >= 2000 || s.EstimatedSkew <= -3600000 {
+		t.Errorf("估計值應介於兩筆之間: %v", s.EstimatedSkew)
+	}
+}
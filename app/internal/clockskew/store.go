@@ -0,0 +1,93 @@
+package clockskew
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// StatsKeyPrefix 每個租戶各設備偏差統計的 Redis hash（跨 replica 共用），field 為 device ID
+const StatsKeyPrefix = "iot:clock_skew:"
+
+// Store 保存各設備的偏差統計
+type Store interface {
+	Observe(ctx context.Context, tenantID, deviceID string, update func(*Stats)) error
+	Get(ctx context.Context, tenantID, deviceID string) (*Stats, error)
+	List(ctx context.Context, tenantID string) ([]Stats, error)
+	Reset(ctx context.Context, tenantID, deviceID string) error
+}
+
+// RedisStore 以 Redis hash 實作的 Store；同一設備的並行更新以後寫入者為準，統計為估計值
+type RedisStore struct {
+	client redisdriver.Cmdable
+}
+
+// NewRedisStore 建立 Redis 版的 Store
+func NewRedisStore(client redisdriver.Cmdable) Store {
+	return &RedisStore{client: client}
+}
+
+func (r *RedisStore) Observe(ctx context.Context, tenantID, deviceID string, update func(*Stats)) error {
+	s, err := r.Get(ctx, tenantID, deviceID)
+	if err != nil {
+		return err
+	}
+	update(s)
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, StatsKeyPrefix+tenantID, deviceID, string(b)).Err()
+}
+
+// Get 尚無統計時回傳空的 Stats
+func (r *RedisStore) Get(ctx context.Context, tenantID, deviceID string) (*Stats, error) {
+	s := &Stats{DeviceID: deviceID}
+	v, err := r.client.HGet(ctx, StatsKeyPrefix+tenantID, deviceID).Result()
+	if err == redisdriver.Nil {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(v), s); err != nil {
+		return &Stats{DeviceID: deviceID}, nil
+	}
+	return s, nil
+}
+
+// List 依估計偏差絕對值由大到小排序
+func (r *RedisStore) List(ctx context.Context, tenantID string) ([]Stats, error) {
+	m, err := r.client.HGetAll(ctx, StatsKeyPrefix+tenantID).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Stats, 0, len(m))
+	for deviceID, v := range m {
+		s := Stats{DeviceID: deviceID}
+		if json.Unmarshal([]byte(v), &s) == nil {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ai, aj := abs(list[i].EstimatedSkew), abs(list[j].EstimatedSkew)
+		if ai != aj {
+			return ai > aj
+		}
+		return list[i].DeviceID < list[j].DeviceID
+	})
+	return list, nil
+}
+
+func (r *RedisStore) Reset(ctx context.Context, tenantID, deviceID string) error {
+	return r.client.HDel(ctx, StatsKeyPrefix+tenantID, deviceID).Err()
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,83 @@
+// Package command 雲端對設備指令的 Redis 佇列；指令內容與狀態存於 DB，佇列只保存待送出的指令 ID
+package command
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// QueueKeyPrefix 每個設備一條 Redis list（LPUSH 入列、RPOP 取出，先進先出）
+const QueueKeyPrefix = "iot:commands:"
+
+// QueueKey 設備的指令佇列 key
+func QueueKey(tenantID, deviceID string) string {
+	return QueueKeyPrefix + tenantID + ":" + deviceID
+}
+
+// Queue 待送出指令的佇列
+type Queue interface {
+	// Push 將指令加入設備佇列；ttl 用來延長佇列本身的存活時間，過期指令由 DB 狀態判定
+	Push(ctx context.Context, tenantID, deviceID string, id int64, ttl time.Duration) error
+	// Pop 依入列順序取出最多 n 個指令 ID；佇列為空時回傳空切片
+	Pop(ctx context.Context, tenantID, deviceID string, n int) ([]int64, error)
+	// Requeue 將取出但未能送出的指令放回佇列前端，維持原本順序
+	Requeue(ctx context.Context, tenantID, deviceID string, ids []int64) error
+}
+
+// RedisQueue 以 Redis list 實作的 Queue
+type RedisQueue struct {
+	client redisdriver.Cmdable
+}
+
+// NewRedisQueue 建立 Redis 版的 Queue
+func NewRedisQueue(client redisdriver.Cmdable) Queue {
+	return &RedisQueue{client: client}
+}
+
+func (q *RedisQueue) Push(ctx context.Context, tenantID, deviceID string, id int64, ttl time.Duration) error {
+	key := QueueKey(tenantID, deviceID)
+	if err := q.client.LPush(ctx, key, id).Err(); err != nil {
+		return err
+	}
+	// 佇列存活時間取目前與本次指令 TTL 的較大者，避免縮短其他尚未過期指令的存活時間
+	current, err := q.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if current < ttl {
+		return q.client.PExpire(ctx, key, ttl).Err()
+	}
+	return nil
+}
+
+func (q *RedisQueue) Pop(ctx context.Context, tenantID, deviceID string, n int) ([]int64, error) {
+	vals, err := q.client.RPopCount(ctx, QueueKey(tenantID, deviceID), n).Result()
+	if err == redisdriver.Nil {
+		return []int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(vals))
+	for _, v := range vals {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (q *RedisQueue) Requeue(ctx context.Context, tenantID, deviceID string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// RPOP 從右端取出，反向 RPUSH 讓 ids[0] 最先被取出
+	vals := make([]interface{}, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		vals = append(vals, ids[i])
+	}
+	return q.client.RPush(ctx, QueueKey(tenantID, deviceID), vals...).Err()
+}
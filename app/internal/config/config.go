@@ -1,63 +1,334 @@
 package config
 
 import (
-	"errors"
-	"os"
 	"strings"
+	"time"
+
+	"iot-data-collection/app/internal/models"
 )
 
+// Config 服務設定。每個欄位以 struct tag 描述來源：env 為環境變數名稱、file 為設定檔中的 key（以 . 表示巢狀）、
+// default 為預設值；secret 欄位在 config print 時遮蔽，reload 欄位可在收到 SIGHUP 時重新載入而不需重啟
 type Config struct {
-	PostgresHost     string
-	PostgresPort     string
-	PostgresUser     string
-	PostgresPassword string
-	PostgresDB       string
+	PostgresHost     string `env:"POSTGRES_HOST" file:"postgres.host" default:"database"`
+	PostgresPort     string `env:"POSTGRES_PORT" file:"postgres.port" default:"5432"`
+	PostgresUser     string `env:"POSTGRES_USER" file:"postgres.user"`
+	PostgresPassword string `env:"POSTGRES_PASSWORD" file:"postgres.password" secret:"true"`
+	PostgresDB       string `env:"POSTGRES_DB" file:"postgres.db" default:"iot_db"`
 
-	RedisHost string
-	RedisPort string
+	// PostgresSSLMode 為 lib/pq 的 sslmode（disable、require、verify-ca、verify-full）；憑證檔路徑皆為選填
+	PostgresSSLMode          string        `env:"POSTGRES_SSLMODE" file:"postgres.sslmode" default:"disable"`
+	PostgresSSLRootCert      string        `env:"POSTGRES_SSLROOTCERT" file:"postgres.sslrootcert"`
+	PostgresSSLCert          string        `env:"POSTGRES_SSLCERT" file:"postgres.sslcert"`
+	PostgresSSLKey           string        `env:"POSTGRES_SSLKEY" file:"postgres.sslkey"`
+	PostgresMaxOpenConns     int           `env:"POSTGRES_MAX_OPEN_CONNS" file:"postgres.max_open_conns" default:"25"`
+	PostgresMaxIdleConns     int           `env:"POSTGRES_MAX_IDLE_CONNS" file:"postgres.max_idle_conns" default:"5"`
+	PostgresConnMaxLifetime  time.Duration `env:"POSTGRES_CONN_MAX_LIFETIME" file:"postgres.conn_max_lifetime" default:"5m"`
+	PostgresConnMaxIdleTime  time.Duration `env:"POSTGRES_CONN_MAX_IDLE_TIME" file:"postgres.conn_max_idle_time" default:"0"`
+	PostgresStatementTimeout time.Duration `env:"POSTGRES_STATEMENT_TIMEOUT" file:"postgres.statement_timeout" default:"0"` // 0 表示不限制
 
-	AppPort string
-	AppEnv  string
-}
+	// 唯讀查詢（歷史資料、設備清單、彙總）導向的 replica；replica 無法連線或延遲超過 PostgresReplicaMaxLag 時改查 primary
+	PostgresReplicaDSN           string        `env:"POSTGRES_REPLICA_DSN" file:"postgres.replica_dsn" secret:"true"`
+	PostgresReplicaMaxLag        time.Duration `env:"POSTGRES_REPLICA_MAX_LAG" file:"postgres.replica_max_lag" default:"30s"`
+	PostgresReplicaCheckInterval time.Duration `env:"POSTGRES_REPLICA_CHECK_INTERVAL" file:"postgres.replica_check_interval" default:"5s"`
 
-func Load() (*Config, error) {
-	cfg := &Config{
-		PostgresHost:     getEnv("POSTGRES_HOST", "database"),
-		PostgresPort:     getEnv("POSTGRES_PORT", "5432"),
-		PostgresUser:     getEnv("POSTGRES_USER", ""),
-		PostgresPassword: getEnv("POSTGRES_PASSWORD", ""),
-		PostgresDB:       getEnv("POSTGRES_DB", "iot_db"),
+	// MetricStore 讀值的儲存後端：postgres，或只保存在程序記憶體的 memory（開發模式，重啟即遺失、不在 replica 間共用）。
+	// memory 模式下 Postgres 無法連線仍可啟動，只有資料回報與查詢可用，租戶、設備登記等功能會回傳錯誤
+	MetricStore string `env:"METRIC_STORE" file:"storage.metric_store" default:"postgres"`
 
-		RedisHost: getEnv("REDIS_HOST", "cache"),
-		RedisPort: getEnv("REDIS_PORT", "6379"),
+	RedisHost string `env:"REDIS_HOST" file:"redis.host" default:"cache"`
+	RedisPort string `env:"REDIS_PORT" file:"redis.port" default:"6379"`
 
-		AppPort: getEnv("APP_PORT", "8080"),
-		AppEnv:  getEnv("APP_ENV", "development"),
-	}
+	// RedisMode 為 standalone、sentinel 或 cluster；RedisAddrs 為逗號分隔的 host:port，
+	// 未設定時使用 RedisHost:RedisPort（sentinel 模式為 sentinel 節點位址）
+	RedisMode             string        `env:"REDIS_MODE" file:"redis.mode" default:"standalone"`
+	RedisAddrs            string        `env:"REDIS_ADDRS" file:"redis.addrs"`
+	RedisUsername         string        `env:"REDIS_USERNAME" file:"redis.username"` // Redis 6 ACL 使用者
+	RedisPassword         string        `env:"REDIS_PASSWORD" file:"redis.password" secret:"true"`
+	RedisDB               int           `env:"REDIS_DB" file:"redis.db" default:"0"` // cluster 模式只能為 0
+	RedisSentinelMaster   string        `env:"REDIS_SENTINEL_MASTER" file:"redis.sentinel_master"`
+	RedisSentinelUsername string        `env:"REDIS_SENTINEL_USERNAME" file:"redis.sentinel_username"`
+	RedisSentinelPassword string        `env:"REDIS_SENTINEL_PASSWORD" file:"redis.sentinel_password" secret:"true"`
+	RedisTLSEnabled       bool          `env:"REDIS_TLS_ENABLED" file:"redis.tls_enabled" default:"false"`
+	RedisTLSCAFile        string        `env:"REDIS_TLS_CA_FILE" file:"redis.tls_ca_file"` // 選填，未設定時使用系統 CA
+	RedisTLSServerName    string        `env:"REDIS_TLS_SERVER_NAME" file:"redis.tls_server_name"`
+	RedisTLSSkipVerify    bool          `env:"REDIS_TLS_INSECURE_SKIP_VERIFY" file:"redis.tls_insecure_skip_verify" default:"false"` // 僅供測試環境
+	RedisPoolSize         int           `env:"REDIS_POOL_SIZE" file:"redis.pool_size" default:"0"`                                   // 0 表示使用 go-redis 預設（每個 CPU 10 條）
+	RedisMinIdleConns     int           `env:"REDIS_MIN_IDLE_CONNS" file:"redis.min_idle_conns" default:"0"`
+	RedisDialTimeout      time.Duration `env:"REDIS_DIAL_TIMEOUT" file:"redis.dial_timeout" default:"5s"`
+	RedisReadTimeout      time.Duration `env:"REDIS_READ_TIMEOUT" file:"redis.read_timeout" default:"3s"`
+	RedisWriteTimeout     time.Duration `env:"REDIS_WRITE_TIMEOUT" file:"redis.write_timeout" default:"3s"`
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
-	}
-	return cfg, nil
+	AppPort string `env:"APP_PORT" file:"app.port" default:"8080"`
+	AppEnv  string `env:"APP_ENV" file:"app.env" default:"development"`
+
+	LogLevel  string `env:"LOG_LEVEL" file:"log.level" default:"info" reload:"true"`
+	LogFormat string `env:"LOG_FORMAT" file:"log.format" default:"json"`
+
+	// RequireAPIKey 為 true 時所有 API 皆須帶 X-API-Key；否則未帶 key 的請求歸屬預設租戶
+	RequireAPIKey bool   `env:"REQUIRE_API_KEY" file:"auth.require_api_key" default:"false"`
+	AdminToken    string `env:"ADMIN_TOKEN" file:"auth.admin_token" secret:"true"`
+
+	// JWT 驗證金鑰；設定任一金鑰即啟用角色權限控管（RBAC）
+	JWTHS256Secret      string `env:"JWT_HS256_SECRET" file:"jwt.hs256_secret" secret:"true"`
+	JWTRSAPublicKeyFile string `env:"JWT_RS256_PUBLIC_KEY_FILE" file:"jwt.rs256_public_key_file"`
+	JWTIssuer           string `env:"JWT_ISSUER" file:"jwt.issuer"`
+	JWTAudience         string `env:"JWT_AUDIENCE" file:"jwt.audience"`
+
+	// 限流設定（token bucket，rate 為每秒請求數）；overrides 格式為 name=rate:burst,...
+	RateLimitEnabled             bool    `env:"RATE_LIMIT_ENABLED" file:"rate_limit.enabled" default:"true" reload:"true"`
+	RateLimitDeviceRate          float64 `env:"RATE_LIMIT_DEVICE_RPS" file:"rate_limit.device_rps" default:"2" reload:"true"`
+	RateLimitDeviceBurst         int     `env:"RATE_LIMIT_DEVICE_BURST" file:"rate_limit.device_burst" default:"20" reload:"true"`
+	RateLimitClientRate          float64 `env:"RATE_LIMIT_CLIENT_RPS" file:"rate_limit.client_rps" default:"50" reload:"true"`
+	RateLimitClientBurst         int     `env:"RATE_LIMIT_CLIENT_BURST" file:"rate_limit.client_burst" default:"200" reload:"true"`
+	RateLimitDeviceOverrides     string  `env:"RATE_LIMIT_DEVICE_OVERRIDES" file:"rate_limit.device_overrides" reload:"true"`
+	RateLimitDeviceTypeOverrides string  `env:"RATE_LIMIT_DEVICE_TYPE_OVERRIDES" file:"rate_limit.device_type_overrides" reload:"true"`
+	RateLimitAPIKeyOverrides     string  `env:"RATE_LIMIT_API_KEY_OVERRIDES" file:"rate_limit.api_key_overrides" reload:"true"`
+
+	// 告警（例如異常偵測）以 JSON POST 到 webhook；未設定時只寫入日誌。URL 常帶有 token，視為機密
+	AlertWebhookURL string `env:"ALERT_WEBHOOK_URL" file:"alert.webhook_url" secret:"true"`
+	// worker 送出告警：最多 AlertSenders 個請求同時進行，佇列滿時丟棄新告警
+	AlertQueueSize int           `env:"ALERT_QUEUE_SIZE" file:"alert.queue_size" default:"1000"`
+	AlertSenders   int           `env:"ALERT_SENDERS" file:"alert.senders" default:"4"`
+	AlertTimeout   time.Duration `env:"ALERT_TIMEOUT" file:"alert.timeout" default:"10s"`
+
+	// 讀值時間戳早於伺服器接收時間超過此時間即標記為延遲（0 表示停用）
+	LateDataWindow time.Duration `env:"LATE_DATA_WINDOW" file:"late_data.window" default:"5m"`
+
+	// 設備時間戳與接收時間的容許差距；超出時依政策處理：off（只統計）、correct（以接收時間取代）、reject（拒絕）。
+	// 預設 off：correct 會把超過 ClockSkewMaxPast 的正當補傳資料改寫為接收時間
+	ClockSkewPolicy    string        `env:"CLOCK_SKEW_POLICY" file:"clock_skew.policy" default:"off" reload:"true"`
+	ClockSkewMaxFuture time.Duration `env:"CLOCK_SKEW_MAX_FUTURE" file:"clock_skew.max_future" default:"5m" reload:"true"`
+	ClockSkewMaxPast   time.Duration `env:"CLOCK_SKEW_MAX_PAST" file:"clock_skew.max_past" default:"168h" reload:"true"`
+
+	// 設備指令送出後等待回報結果的租約；逾時未回報的指令在下次取出時重送
+	CommandDeliveryLease time.Duration `env:"COMMAND_DELIVERY_LEASE" file:"command.delivery_lease" default:"2m"`
+
+	// 設備總覽：超過 FleetOfflineAfter 未回報視為離線；總覽結果快取 FleetSummaryTTL
+	FleetOfflineAfter time.Duration `env:"FLEET_OFFLINE_AFTER" file:"fleet.offline_after" default:"10m"`
+	FleetSummaryTTL   time.Duration `env:"FLEET_SUMMARY_TTL" file:"fleet.summary_ttl" default:"10s"`
+
+	// 最新值快取前的程序內 LRU；各 replica 以 Redis Pub/Sub 互相通知失效
+	LocalCacheEnabled bool          `env:"LOCAL_CACHE_ENABLED" file:"local_cache.enabled" default:"false"`
+	LocalCacheSize    int           `env:"LOCAL_CACHE_SIZE" file:"local_cache.size" default:"10000"`
+	LocalCacheTTL     time.Duration `env:"LOCAL_CACHE_TTL" file:"local_cache.ttl" default:"2s"`
+
+	// 佇列消費：worker 每次以 BRPOP 取任務最多阻塞 QueuePopTimeout
+	QueuePopTimeout time.Duration `env:"QUEUE_POP_TIMEOUT" file:"queue.pop_timeout" default:"5s"`
+
+	// Redis 快取的存活時間
+	CacheLatestMetricTTL      time.Duration `env:"CACHE_LATEST_METRIC_TTL" file:"cache.latest_metric_ttl" default:"60s" reload:"true"`
+	CacheAPIKeyTenantTTL      time.Duration `env:"CACHE_API_KEY_TTL" file:"cache.api_key_ttl" default:"60s" reload:"true"`
+	CacheDeviceTypeTTL        time.Duration `env:"CACHE_DEVICE_TYPE_TTL" file:"cache.device_type_ttl" default:"5m" reload:"true"`
+	CacheDeviceTypeSchemaTTL  time.Duration `env:"CACHE_DEVICE_TYPE_SCHEMA_TTL" file:"cache.device_type_schema_ttl" default:"5m" reload:"true"`
+	CacheValidationProfileTTL time.Duration `env:"CACHE_VALIDATION_PROFILE_TTL" file:"cache.validation_profile_ttl" default:"5m" reload:"true"`
+	CacheAnomalySettingsTTL   time.Duration `env:"CACHE_ANOMALY_SETTINGS_TTL" file:"cache.anomaly_settings_ttl" default:"5m" reload:"true"`
+	CacheAnomalyStateTTL      time.Duration `env:"CACHE_ANOMALY_STATE_TTL" file:"cache.anomaly_state_ttl" default:"168h" reload:"true"`
+
+	// 查詢筆數：未指定 limit 時使用 default，超過 max 時改用 default；series 為時間序列查詢
+	QueryDefaultLimit  int `env:"QUERY_DEFAULT_LIMIT" file:"limits.default" default:"100" reload:"true"`
+	QueryMaxLimit      int `env:"QUERY_MAX_LIMIT" file:"limits.max" default:"1000" reload:"true"`
+	SeriesDefaultLimit int `env:"SERIES_DEFAULT_LIMIT" file:"limits.series_default" default:"1000" reload:"true"`
+	SeriesMaxLimit     int `env:"SERIES_MAX_LIMIT" file:"limits.series_max" default:"10000" reload:"true"`
+
+	// 未設定驗證設定檔時核心欄位的預設範圍
+	ValidationVoltageMin     float64 `env:"VALIDATION_VOLTAGE_MIN" file:"validation.voltage_min" default:"100" reload:"true"`
+	ValidationVoltageMax     float64 `env:"VALIDATION_VOLTAGE_MAX" file:"validation.voltage_max" default:"240" reload:"true"`
+	ValidationCurrentMin     float64 `env:"VALIDATION_CURRENT_MIN" file:"validation.current_min" default:"0" reload:"true"`
+	ValidationCurrentMax     float64 `env:"VALIDATION_CURRENT_MAX" file:"validation.current_max" default:"100" reload:"true"`
+	ValidationTemperatureMin float64 `env:"VALIDATION_TEMPERATURE_MIN" file:"validation.temperature_min" default:"0" reload:"true"`
+	ValidationTemperatureMax float64 `env:"VALIDATION_TEMPERATURE_MAX" file:"validation.temperature_max" default:"100" reload:"true"`
+
+	// 就緒檢查（/readyz）：HealthCriticalChecks（逗號分隔）中的項目異常時整體為 down（503），其餘項目異常時為 degraded
+	HealthCriticalChecks   string        `env:"HEALTH_CRITICAL_CHECKS" file:"health.critical_checks" default:"redis"`
+	HealthCheckTimeout     time.Duration `env:"HEALTH_CHECK_TIMEOUT" file:"health.check_timeout" default:"2s"`
+	HealthQueueBacklogWarn int           `env:"HEALTH_QUEUE_BACKLOG_WARN" file:"health.queue_backlog_warn" default:"10000"`
+	HealthWorkerMaxAge     time.Duration `env:"HEALTH_WORKER_MAX_AGE" file:"health.worker_max_age" default:"30s"`
+
+	// 關閉：收到 SIGTERM 後 /readyz 先回報 down 並等待 ShutdownDrainDelay（讓負載平衡移除此 replica），
+	// 再於 ShutdownTimeout 內停止 HTTP、ShutdownWorkerTimeout 內停止 worker；兩者各自計時，HTTP 逾時不會壓縮 worker 的時間
+	ShutdownTimeout       time.Duration `env:"SHUTDOWN_TIMEOUT" file:"shutdown.timeout" default:"10s"`
+	ShutdownWorkerTimeout time.Duration `env:"SHUTDOWN_WORKER_TIMEOUT" file:"shutdown.worker_timeout" default:"15s"`
+	ShutdownDrainDelay    time.Duration `env:"SHUTDOWN_DRAIN_DELAY" file:"shutdown.drain_delay" default:"0s"`
+
+	// sources 記錄各欄位實際採用的來源（file key → default、file 或 env），供 config print 顯示
+	sources map[string]string
 }
 
+// METRIC_STORE 的值
+const (
+	MetricStorePostgres = "postgres"
+	MetricStoreMemory   = "memory"
+)
+
+// Validate 檢查所有欄位，一次回報全部不合法的設定（*ValidationError）
 func (c *Config) Validate() error {
-	var missing []string
-	if strings.TrimSpace(c.PostgresUser) == "" {
-		missing = append(missing, "POSTGRES_USER")
+	v := &ValidationError{}
+	switch c.MetricStore {
+	case MetricStorePostgres:
+		if strings.TrimSpace(c.PostgresUser) == "" {
+			v.add("POSTGRES_USER", "必填")
+		}
+		if strings.TrimSpace(c.PostgresPassword) == "" {
+			v.add("POSTGRES_PASSWORD", "必填")
+		}
+	case MetricStoreMemory:
+	default:
+		v.add("METRIC_STORE", "只能是 postgres 或 memory")
+	}
+	v.port("POSTGRES_PORT", c.PostgresPort)
+	v.port("REDIS_PORT", c.RedisPort)
+	v.port("APP_PORT", c.AppPort)
+	switch c.PostgresSSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		v.add("POSTGRES_SSLMODE", "只能是 disable、require、verify-ca 或 verify-full")
+	}
+	if (c.PostgresSSLCert == "") != (c.PostgresSSLKey == "") {
+		v.add("POSTGRES_SSLCERT", "須與 POSTGRES_SSLKEY 同時設定")
+	}
+	v.nonNegative("POSTGRES_MAX_OPEN_CONNS", c.PostgresMaxOpenConns)
+	v.nonNegative("POSTGRES_MAX_IDLE_CONNS", c.PostgresMaxIdleConns)
+	if c.PostgresMaxOpenConns > 0 && c.PostgresMaxIdleConns > c.PostgresMaxOpenConns {
+		v.add("POSTGRES_MAX_IDLE_CONNS", "不可大於 POSTGRES_MAX_OPEN_CONNS")
 	}
-	if strings.TrimSpace(c.PostgresPassword) == "" {
-		missing = append(missing, "POSTGRES_PASSWORD")
+	if c.PostgresReplicaDSN != "" {
+		v.positive("POSTGRES_REPLICA_MAX_LAG", c.PostgresReplicaMaxLag)
+		v.positive("POSTGRES_REPLICA_CHECK_INTERVAL", c.PostgresReplicaCheckInterval)
 	}
-	if len(missing) > 0 {
-		return errors.New("環境變數必填欄位缺失: " + strings.Join(missing, ", "))
+	switch strings.ToLower(strings.TrimSpace(c.LogLevel)) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		v.add("LOG_LEVEL", "只能是 debug、info、warn 或 error")
 	}
-	return nil
+	if f := strings.ToLower(c.LogFormat); f != "json" && f != "text" {
+		v.add("LOG_FORMAT", "只能是 json 或 text")
+	}
+	switch c.RedisMode {
+	case "standalone", "cluster":
+	case "sentinel":
+		if c.RedisSentinelMaster == "" {
+			v.add("REDIS_SENTINEL_MASTER", "REDIS_MODE=sentinel 時為必填")
+		}
+	default:
+		v.add("REDIS_MODE", "只能是 standalone、sentinel 或 cluster")
+	}
+	if c.RedisMode == "cluster" && c.RedisDB != 0 {
+		v.add("REDIS_DB", "Redis cluster 模式不支援")
+	}
+	v.nonNegative("REDIS_DB", c.RedisDB)
+	v.nonNegative("REDIS_POOL_SIZE", c.RedisPoolSize)
+	v.nonNegative("REDIS_MIN_IDLE_CONNS", c.RedisMinIdleConns)
+	if c.RedisTLSCAFile != "" && !c.RedisTLSEnabled {
+		v.add("REDIS_TLS_CA_FILE", "須同時啟用 REDIS_TLS_ENABLED")
+	}
+	if c.JWTHS256Secret != "" && len(c.JWTHS256Secret) < 32 {
+		v.add("JWT_HS256_SECRET", "長度至少需 32 字元")
+	}
+	if c.RateLimitEnabled {
+		v.positiveFloat("RATE_LIMIT_DEVICE_RPS", c.RateLimitDeviceRate)
+		v.positiveFloat("RATE_LIMIT_CLIENT_RPS", c.RateLimitClientRate)
+		v.atLeast("RATE_LIMIT_DEVICE_BURST", c.RateLimitDeviceBurst, 1)
+		v.atLeast("RATE_LIMIT_CLIENT_BURST", c.RateLimitClientBurst, 1)
+	}
+	if c.AlertWebhookURL != "" && !strings.HasPrefix(c.AlertWebhookURL, "http://") && !strings.HasPrefix(c.AlertWebhookURL, "https://") {
+		v.add("ALERT_WEBHOOK_URL", "必須是 http(s) URL")
+	}
+	v.atLeast("ALERT_QUEUE_SIZE", c.AlertQueueSize, 1)
+	v.atLeast("ALERT_SENDERS", c.AlertSenders, 1)
+	v.positive("ALERT_TIMEOUT", c.AlertTimeout)
+	if c.LateDataWindow < 0 {
+		v.add("LATE_DATA_WINDOW", "不可為負數")
+	}
+	switch strings.ToLower(strings.TrimSpace(c.ClockSkewPolicy)) {
+	case "off", "correct", "reject":
+	default:
+		v.add("CLOCK_SKEW_POLICY", "只能是 off、correct 或 reject")
+	}
+	v.positive("CLOCK_SKEW_MAX_FUTURE", c.ClockSkewMaxFuture)
+	v.positive("CLOCK_SKEW_MAX_PAST", c.ClockSkewMaxPast)
+	v.positive("FLEET_OFFLINE_AFTER", c.FleetOfflineAfter)
+	v.positive("FLEET_SUMMARY_TTL", c.FleetSummaryTTL)
+	if c.LocalCacheEnabled {
+		v.atLeast("LOCAL_CACHE_SIZE", c.LocalCacheSize, 1)
+		v.positive("LOCAL_CACHE_TTL", c.LocalCacheTTL)
+	}
+	// BRPOP 的逾時以秒為單位
+	if c.QueuePopTimeout < time.Second {
+		v.add("QUEUE_POP_TIMEOUT", "至少需 1s")
+	}
+	v.positive("CACHE_LATEST_METRIC_TTL", c.CacheLatestMetricTTL)
+	v.positive("CACHE_API_KEY_TTL", c.CacheAPIKeyTenantTTL)
+	v.positive("CACHE_DEVICE_TYPE_TTL", c.CacheDeviceTypeTTL)
+	v.positive("CACHE_DEVICE_TYPE_SCHEMA_TTL", c.CacheDeviceTypeSchemaTTL)
+	v.positive("CACHE_VALIDATION_PROFILE_TTL", c.CacheValidationProfileTTL)
+	v.positive("CACHE_ANOMALY_SETTINGS_TTL", c.CacheAnomalySettingsTTL)
+	v.positive("CACHE_ANOMALY_STATE_TTL", c.CacheAnomalyStateTTL)
+	v.atLeast("QUERY_DEFAULT_LIMIT", c.QueryDefaultLimit, 1)
+	if c.QueryMaxLimit < c.QueryDefaultLimit {
+		v.add("QUERY_MAX_LIMIT", "不可小於 QUERY_DEFAULT_LIMIT")
+	}
+	v.atLeast("SERIES_DEFAULT_LIMIT", c.SeriesDefaultLimit, 1)
+	if c.SeriesMaxLimit < c.SeriesDefaultLimit {
+		v.add("SERIES_MAX_LIMIT", "不可小於 SERIES_DEFAULT_LIMIT")
+	}
+	if c.ValidationVoltageMin > c.ValidationVoltageMax {
+		v.add("VALIDATION_VOLTAGE_MIN", "不可大於 VALIDATION_VOLTAGE_MAX")
+	}
+	if c.ValidationCurrentMin > c.ValidationCurrentMax {
+		v.add("VALIDATION_CURRENT_MIN", "不可大於 VALIDATION_CURRENT_MAX")
+	}
+	if c.ValidationTemperatureMin > c.ValidationTemperatureMax {
+		v.add("VALIDATION_TEMPERATURE_MIN", "不可大於 VALIDATION_TEMPERATURE_MAX")
+	}
+	known := map[string]bool{}
+	for _, name := range models.ReadinessCheckNames {
+		known[name] = true
+	}
+	for _, name := range c.HealthCriticalCheckList() {
+		if !known[name] {
+			v.add("HEALTH_CRITICAL_CHECKS", "未知的檢查項目 "+name+"，可用: "+strings.Join(models.ReadinessCheckNames, ", "))
+		}
+	}
+	v.positive("HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout)
+	v.atLeast("HEALTH_QUEUE_BACKLOG_WARN", c.HealthQueueBacklogWarn, 1)
+	// worker 每次 BRPOP 最多阻塞 QueuePopTimeout 才更新心跳
+	if c.HealthWorkerMaxAge <= c.QueuePopTimeout {
+		v.add("HEALTH_WORKER_MAX_AGE", "必須大於 QUEUE_POP_TIMEOUT")
+	}
+	v.positive("COMMAND_DELIVERY_LEASE", c.CommandDeliveryLease)
+	v.positive("SHUTDOWN_TIMEOUT", c.ShutdownTimeout)
+	// worker 停止時可能還在等待一次 BRPOP
+	if c.ShutdownWorkerTimeout <= c.QueuePopTimeout {
+		v.add("SHUTDOWN_WORKER_TIMEOUT", "必須大於 QUEUE_POP_TIMEOUT")
+	}
+	if c.ShutdownDrainDelay < 0 {
+		v.add("SHUTDOWN_DRAIN_DELAY", "不可為負數")
+	}
+	return v.err()
+}
+
+// HealthCriticalCheckList 關鍵就緒檢查項目清單
+func (c *Config) HealthCriticalCheckList() []string {
+	var names []string
+	for _, n := range strings.Split(c.HealthCriticalChecks, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// RedisAddrList Redis 節點位址清單
+func (c *Config) RedisAddrList() []string {
+	var addrs []string
+	for _, a := range strings.Split(c.RedisAddrs, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	if len(addrs) == 0 {
+		addrs = []string{c.RedisHost + ":" + c.RedisPort}
 	}
-	return defaultValue
+	return addrs
 }
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestLoadLayering(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(yamlPath, []byte(`
+postgres:
+  user: file_user
+  password: file_secret
+redis:
+  addrs: [r1:6379, r2:6379]
+cache:
+  latest_metric_ttl: 30s
+fleet:
+  summary_ttl: 20s
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readFile(yamlPath)
+	if err != nil {
+		t.Fatalf("讀取 YAML 失敗: %v", err)
+	}
+	cfg, err := load(file, envFrom(map[string]string{"FLEET_SUMMARY_TTL": "30s", "APP_PORT": ""}))
+	if err != nil {
+		t.Fatalf("載入失敗: %v", err)
+	}
+	if cfg.PostgresUser != "file_user" || cfg.CacheLatestMetricTTL != 30*time.Second {
+		t.Errorf("設定檔的值未套用: user=%q ttl=%v", cfg.PostgresUser, cfg.CacheLatestMetricTTL)
+	}
+	if cfg.FleetSummaryTTL != 30*time.Second {
+		t.Errorf("環境變數應覆寫設定檔，FleetSummaryTTL=%v", cfg.FleetSummaryTTL)
+	}
+	if cfg.AppPort != "8080" || cfg.QueuePopTimeout != 5*time.Second {
+		t.Errorf("未設定（或空字串）的欄位應使用預設值: port=%q pop=%v", cfg.AppPort, cfg.QueuePopTimeout)
+	}
+	if cfg.RedisAddrs != "r1:6379,r2:6379" {
+		t.Errorf("YAML 清單應以逗號串接，得到 %q", cfg.RedisAddrs)
+	}
+
+	tomlPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(tomlPath, []byte("[postgres]\nuser = \"u\"\npassword = \"p\"\n[limits]\nmax = 500\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err = readFile(tomlPath)
+	if err != nil {
+		t.Fatalf("讀取 TOML 失敗: %v", err)
+	}
+	if cfg, err = load(file, envFrom(nil)); err != nil || cfg.QueryMaxLimit != 500 {
+		t.Fatalf("TOML 設定未套用: %v", err)
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	file := map[string]string{"cache.latest_metric_ttl": "soon", "cache.unknown_ttl": "1m"}
+	_, err := load(file, envFrom(map[string]string{
+		"REDIS_MODE":         "replicated",
+		"QUERY_MAX_LIMIT":    "10",
+		"RATE_LIMIT_ENABLED": "maybe",
+		"ALERT_SENDERS":      "0",
+	}))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("應回傳 *ValidationError，得到 %v", err)
+	}
+	got := map[string]bool{}
+	for _, f := range verr.Fields {
+		got[f.Field] = true
+	}
+	for _, want := range []string{"POSTGRES_USER", "POSTGRES_PASSWORD", "cache.latest_metric_ttl", "cache.unknown_ttl", "REDIS_MODE", "QUERY_MAX_LIMIT", "RATE_LIMIT_ENABLED", "ALERT_SENDERS"} {
+		if !got[want] {
+			t.Errorf("缺少 %s 的錯誤，全部錯誤: %v", want, verr)
+		}
+	}
+	if got["CACHE_LATEST_METRIC_TTL"] || got["RATE_LIMIT_DEVICE_RPS"] {
+		t.Errorf("無法解析的欄位不應再以零值重複回報: %v", verr)
+	}
+}
+
+func TestWriteYAMLRedactsSecrets(t *testing.T) {
+	cfg, err := load(nil, envFrom(map[string]string{
+		"POSTGRES_USER":     "iot",
+		"POSTGRES_PASSWORD": "hunter2",
+		"LOG_LEVEL":         "debug",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.WriteYAML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "password: '"+redacted) {
+		t.Errorf("密碼應遮蔽:\n%s", out)
+	}
+	if !strings.Contains(out, "level: debug # env LOG_LEVEL") {
+		t.Errorf("應標示來源:\n%s", out)
+	}
+}
+
+func TestWithReloadable(t *testing.T) {
+	env := map[string]string{"POSTGRES_USER": "iot", "POSTGRES_PASSWORD": "secret"}
+	cur, err := load(nil, envFrom(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env["POSTGRES_HOST"] = "other-db"
+	env["CACHE_LATEST_METRIC_TTL"] = "2m"
+	env["POSTGRES_PASSWORD"] = "rotated"
+	next, err := load(nil, envFrom(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := cur.WithReloadable(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.CacheLatestMetricTTL != 2*time.Minute {
+		t.Errorf("可熱更新欄位應套用，得到 %v", merged.CacheLatestMetricTTL)
+	}
+	if merged.PostgresHost != "database" {
+		t.Errorf("連線設定需重啟才生效，得到 %q", merged.PostgresHost)
+	}
+
+	changes := cur.Diff(next)
+	if len(changes) != 3 {
+		t.Fatalf("應有 3 筆變動，得到 %+v", changes)
+	}
+	for _, ch := range changes {
+		if ch.Field == "POSTGRES_PASSWORD" && (ch.Old != redacted || ch.New != redacted) {
+			t.Errorf("變動紀錄中的密碼應遮蔽: %+v", ch)
+		}
+		if ch.Field == "CACHE_LATEST_METRIC_TTL" && !ch.Reloadable {
+			t.Errorf("CACHE_LATEST_METRIC_TTL 應可熱更新")
+		}
+	}
+}
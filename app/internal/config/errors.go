@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError 單一欄位的錯誤；Field 為環境變數名稱（設定檔錯誤時為檔案中的 key）
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError 彙整所有不合法的設定，讓部署時一次看到全部問題
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "設定不合法: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) port(field, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n <= 0 || n > 65535 {
+		e.add(field, "必須是 1 到 65535 的連接埠")
+	}
+}
+
+func (e *ValidationError) positive(field string, d time.Duration) {
+	if d <= 0 {
+		e.add(field, "必須大於 0")
+	}
+}
+
+func (e *ValidationError) positiveFloat(field string, f float64) {
+	if f <= 0 {
+		e.add(field, "必須大於 0")
+	}
+}
+
+func (e *ValidationError) nonNegative(field string, n int) {
+	if n < 0 {
+		e.add(field, "不可為負數")
+	}
+}
+
+func (e *ValidationError) atLeast(field string, n, min int) {
+	if n < min {
+		e.add(field, "至少需 "+strconv.Itoa(min))
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigFile 指定設定檔路徑的環境變數；未設定時只使用預設值與環境變數
+const EnvConfigFile = "CONFIG_FILE"
+
+// 設定值的來源，優先序由低到高
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+)
+
+// field Config 單一欄位的 tag 資訊
+type field struct {
+	index  int
+	name   string
+	env    string
+	file   string
+	def    string
+	secret bool
+	reload bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields 依宣告順序列出 Config 中帶 tag 的欄位
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	list := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		list = append(list, field{
+			index:  i,
+			name:   sf.Name,
+			env:    sf.Tag.Get("env"),
+			file:   sf.Tag.Get("file"),
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+		})
+	}
+	return list
+}
+
+// Load 依序套用預設值、設定檔（CONFIG_FILE）與環境變數，後者覆寫前者，最後驗證
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv(EnvConfigFile))
+}
+
+// LoadFile 同 Load，但指定設定檔路徑（.yaml、.yml 或 .toml）；path 為空時略過設定檔
+func LoadFile(path string) (*Config, error) {
+	var values map[string]string
+	if path != "" {
+		var err error
+		if values, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return load(values, os.LookupEnv)
+}
+
+// load 合併各來源；解析失敗、未知的設定檔 key 與驗證錯誤一併回報
+func load(file map[string]string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := &Config{sources: map[string]string{}}
+	rv := reflect.ValueOf(cfg).Elem()
+	v := &ValidationError{}
+	invalid := map[string]bool{}
+	known := map[string]bool{}
+
+	for _, f := range fields() {
+		known[f.file] = true
+		raw, source, name := f.def, SourceDefault, f.env
+		if s, ok := file[f.file]; ok {
+			raw, source, name = s, SourceFile, f.file
+		}
+		if s, ok := lookupEnv(f.env); ok && s != "" {
+			raw, source, name = s, SourceEnv, f.env
+		}
+		if err := setField(rv.Field(f.index), raw); err != nil {
+			v.add(name, err.Error())
+			invalid[f.env] = true
+			continue
+		}
+		cfg.sources[f.file] = source
+	}
+
+	unknown := make([]string, 0)
+	for key := range file {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		v.add(key, "不是可辨識的設定項目")
+	}
+
+	// 無法解析的欄位已回報，略過其零值造成的重複錯誤
+	if verr, ok := cfg.Validate().(*ValidationError); ok {
+		for _, fe := range verr.Fields {
+			if !invalid[fe.Field] {
+				v.Fields = append(v.Fields, fe)
+			}
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func setField(fv reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("無法解析為時間長度（例如 30s、5m）: %q", raw)
+		}
+		fv.SetInt(int64(d))
+	case fv.Kind() == reflect.String:
+		fv.SetString(raw)
+	case fv.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("無法解析為布林值: %q", raw)
+		}
+		fv.SetBool(b)
+	case fv.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("無法解析為整數: %q", raw)
+		}
+		fv.SetInt(int64(n))
+	case fv.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("無法解析為數字: %q", raw)
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("不支援的欄位型別 %s", fv.Type())
+	}
+	return nil
+}
+
+// readFile 讀取設定檔並攤平成 "section.key" → 字串值
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	tree := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	values := map[string]string{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, out map[string]string) {
+	for k, val := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := val.(map[string]interface{}); ok {
+			flatten(key, sub, out)
+			continue
+		}
+		out[key] = scalarString(val)
+	}
+}
+
+// scalarString 將設定檔中的值轉為字串，與環境變數走同一套解析；清單以逗號串接（例如 redis.addrs）
+func scalarString(val interface{}) string {
+	switch x := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(x))
+		for _, item := range x {
+			parts = append(parts, scalarString(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted 取代機密欄位值的字串
+const redacted = "******"
+
+// WriteYAML 以設定檔格式輸出目前生效的設定；機密欄位遮蔽，非預設值的欄位以註解標示來源
+func (c *Config) WriteYAML(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	rv := reflect.ValueOf(c).Elem()
+
+	for _, f := range fields() {
+		section, key, _ := strings.Cut(f.file, ".")
+		node, ok := sections[section]
+		if !ok {
+			node = &yaml.Node{Kind: yaml.MappingNode}
+			sections[section] = node
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, node)
+		}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: yamlTag(rv.Field(f.index)), Value: c.displayValue(f)}
+		switch src := c.sources[f.file]; src {
+		case SourceEnv:
+			value.LineComment = "env " + f.env
+		case SourceFile:
+			value.LineComment = "file"
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// displayValue 欄位值的字串形式，機密欄位有值時遮蔽
+func (c *Config) displayValue(f field) string {
+	fv := reflect.ValueOf(c).Elem().Field(f.index)
+	if f.secret && !fv.IsZero() {
+		return redacted
+	}
+	return formatValue(fv)
+}
+
+func formatValue(fv reflect.Value) string {
+	switch {
+	case fv.Type() == durationType:
+		return time.Duration(fv.Int()).String()
+	case fv.Kind() == reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, 64)
+	case fv.Kind() == reflect.Bool:
+		return strconv.FormatBool(fv.Bool())
+	case fv.Kind() == reflect.Int:
+		return strconv.FormatInt(fv.Int(), 10)
+	default:
+		return fv.String()
+	}
+}
+
+// yamlTag 字串欄位（包含時間長度）強制為字串，避免 "5432" 之類的值被當成數字；其餘交由 YAML 自行判斷
+func yamlTag(fv reflect.Value) string {
+	if fv.Kind() == reflect.String || fv.Type() == durationType {
+		return "!!str"
+	}
+	return ""
+}
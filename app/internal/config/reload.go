@@ -0,0 +1,49 @@
+package config
+
+import "reflect"
+
+// Change 兩份設定間有差異的欄位；機密欄位的值已遮蔽
+type Change struct {
+	Field      string // 環境變數名稱
+	Old        string
+	New        string
+	Reloadable bool // false 表示需重啟才會生效
+}
+
+// Diff 列出 next 相對於 c 有變動的欄位
+func (c *Config) Diff(next *Config) []Change {
+	var changes []Change
+	cur, nxt := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for _, f := range fields() {
+		if reflect.DeepEqual(cur.Field(f.index).Interface(), nxt.Field(f.index).Interface()) {
+			continue
+		}
+		changes = append(changes, Change{
+			Field:      f.env,
+			Old:        c.displayValue(f),
+			New:        next.displayValue(f),
+			Reloadable: f.reload,
+		})
+	}
+	return changes
+}
+
+// WithReloadable 以 c 為基礎，只套用 next 中可熱更新的欄位；其餘欄位（連線、埠號等）維持原值直到重啟
+func (c *Config) WithReloadable(next *Config) (*Config, error) {
+	merged := *c
+	merged.sources = make(map[string]string, len(c.sources))
+	for k, v := range c.sources {
+		merged.sources[k] = v
+	}
+	dst, src := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem()
+	for _, f := range fields() {
+		if f.reload {
+			dst.Field(f.index).Set(src.Field(f.index))
+			merged.sources[f.file] = next.sources[f.file]
+		}
+	}
+	if err := merged.Validate(); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
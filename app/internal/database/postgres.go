@@ -1,46 +1,143 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
-	"time"
+	"log/slog"
+	"strconv"
+	"strings"
 
 	"iot-data-collection/app/internal/config"
+	"iot-data-collection/app/internal/logger"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
-func NewPostgresConnection(cfg *config.Config) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.PostgresHost,
-		cfg.PostgresPort,
-		cfg.PostgresUser,
-		cfg.PostgresPassword,
-		cfg.PostgresDB,
-	)
+// NewPostgresConnection 連線 primary 並初始化資料表；設定 POSTGRES_REPLICA_DSN 時另外連線 replica 供唯讀查詢使用
+func NewPostgresConnection(cfg *config.Config) (*DB, error) {
+	primary, err := open(primaryDSN(cfg), cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("postgres", dsn)
+	if err := initTables(primary); err != nil {
+		slog.Error("init tables failed", logger.Err(err))
+	}
+
+	db := &DB{DB: primary, maxLag: cfg.PostgresReplicaMaxLag}
+	if cfg.PostgresReplicaDSN == "" {
+		return db, nil
+	}
+	// replica 連線失敗不影響啟動，唯讀查詢改走 primary，之後由 MonitorReplica 持續重試
+	replicaDB, err := sql.Open("postgres", withRuntimeParams(cfg.PostgresReplicaDSN, cfg))
 	if err != nil {
-		return nil, fmt.Errorf("無法開啟資料庫連線: %w", err)
+		primary.Close()
+		return nil, fmt.Errorf("無效的 replica 連線設定: %w", err)
+	}
+	configurePool(replicaDB, cfg)
+	db.replica = replicaDB
+	db.checkReplica(context.Background())
+	if !db.replicaHealthy.Load() {
+		slog.Warn("read replica unavailable at startup, routing reads to primary")
 	}
+	return db, nil
+}
 
-	db.SetMaxOpenConns(25)                 
-	db.SetMaxIdleConns(5)                  
-	db.SetConnMaxLifetime(5 * time.Minute)
+// ErrOffline memory store 的開發模式不連線 Postgres，所有資料庫操作都回傳此錯誤
+var ErrOffline = errors.New("database disabled in memory metric store mode")
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("無法連線到資料庫: %w", err)
+// offlineConnector 不建立任何連線，確保 memory store 模式不會與可連線的 Postgres 混用
+type offlineConnector struct{}
+
+func (offlineConnector) Connect(context.Context) (driver.Conn, error) { return nil, ErrOffline }
+func (offlineConnector) Driver() driver.Driver                        { return offlineDriver{} }
+
+type offlineDriver struct{}
+
+func (offlineDriver) Open(string) (driver.Conn, error) { return nil, ErrOffline }
+
+// NewOfflineConnection 建立不連線 Postgres 的 DB，供 memory store 的開發模式使用；
+// 讀值只存在記憶體，其餘需要 Postgres 的功能一律回傳 ErrOffline
+func NewOfflineConnection(cfg *config.Config) (*DB, error) {
+	return &DB{DB: sql.OpenDB(offlineConnector{}), maxLag: cfg.PostgresReplicaMaxLag, offline: true}, nil
+}
+
+// Offline 是否由 NewOfflineConnection 建立（memory store 模式，不連線 Postgres）
+func (db *DB) Offline() bool {
+	return db.offline
+}
+
+// primaryDSN 組出 primary 的 key=value 連線字串
+func primaryDSN(cfg *config.Config) string {
+	params := []string{
+		"host=" + dsnValue(cfg.PostgresHost),
+		"port=" + dsnValue(cfg.PostgresPort),
+		"user=" + dsnValue(cfg.PostgresUser),
+		"password=" + dsnValue(cfg.PostgresPassword),
+		"dbname=" + dsnValue(cfg.PostgresDB),
+		"sslmode=" + dsnValue(cfg.PostgresSSLMode),
+	}
+	for _, opt := range [][2]string{
+		{"sslrootcert", cfg.PostgresSSLRootCert},
+		{"sslcert", cfg.PostgresSSLCert},
+		{"sslkey", cfg.PostgresSSLKey},
+	} {
+		if opt[1] != "" {
+			params = append(params, opt[0]+"="+dsnValue(opt[1]))
+		}
+	}
+	return withRuntimeParams(strings.Join(params, " "), cfg)
+}
+
+// withRuntimeParams 附加 statement_timeout；lib/pq 會將未知的參數當作連線的 runtime parameter 送出。
+// URL 格式的 DSN 以 query string 附加
+func withRuntimeParams(dsn string, cfg *config.Config) string {
+	if cfg.PostgresStatementTimeout <= 0 {
+		return dsn
 	}
+	ms := strconv.FormatInt(cfg.PostgresStatementTimeout.Milliseconds(), 10)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "statement_timeout=" + ms
+	}
+	return dsn + " statement_timeout=" + ms
+}
+
+// dsnValue 依 libpq 規則以單引號包住含空白或特殊字元的值
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
 
-	if err := initTables(db); err != nil {
-		log.Printf("Error: 初始化資料表時發生錯誤: %v", err)
+func open(dsn string, cfg *config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("無法開啟資料庫連線: %w", err)
 	}
+	configurePool(db, cfg)
 
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("無法連線到資料庫: %w", err)
+	}
 	return db, nil
 }
 
+func configurePool(db *sql.DB, cfg *config.Config) {
+	db.SetMaxOpenConns(cfg.PostgresMaxOpenConns)
+	db.SetMaxIdleConns(cfg.PostgresMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.PostgresConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.PostgresConnMaxIdleTime)
+}
+
 // initTables 初始化資料表
 func initTables(db *sql.DB) error {
 	// 建立 IoT 設備資料表
@@ -49,9 +146,9 @@ func initTables(db *sql.DB) error {
 	CREATE TABLE IF NOT EXISTS device_metrics (
 		id SERIAL PRIMARY KEY,
 		device_id VARCHAR(255) NOT NULL,
-		voltage DECIMAL(5, 2) NOT NULL CHECK (voltage >= 100 AND voltage <= 240),  -- 電壓範圍：100-240V
-		current DECIMAL(5, 2) NOT NULL CHECK (current >= 0 AND current <= 100),    -- 電流範圍：0-100A
-		temperature DECIMAL(5, 2) NOT NULL CHECK (temperature >= 0 AND temperature <= 100), -- 溫度範圍：0-100°C
+		voltage DECIMAL(10, 2) NOT NULL,     -- 有效範圍依設備的驗證設定檔於應用層檢查
+		current DECIMAL(10, 2) NOT NULL,
+		temperature DECIMAL(10, 2) NOT NULL,
 		status VARCHAR(20) NOT NULL CHECK (status IN ('normal', 'warning', 'error')), -- 狀態限制
 		timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -62,12 +159,223 @@ func initTables(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_timestamp ON device_metrics(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_device_timestamp ON device_metrics(device_id, timestamp DESC); -- 複合索引，用於查詢單一設備的歷史資料
 	CREATE INDEX IF NOT EXISTS idx_status ON device_metrics(status);
+
+	-- 多租戶：租戶、API 憑證與租戶內的設備
+	CREATE TABLE IF NOT EXISTS tenants (
+		id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO tenants (id, name) VALUES ('default', 'Default tenant') ON CONFLICT (id) DO NOTHING;
+
+	CREATE TABLE IF NOT EXISTS tenant_api_keys (
+		id SERIAL PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		key_hash CHAR(64) NOT NULL UNIQUE, -- API key 的 SHA-256，不保存明文
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS devices (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP,
+		PRIMARY KEY (tenant_id, device_id)
+	);
+
+	-- 既有資料歸屬預設租戶
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+	-- RBAC：設備標籤，用於限制呼叫者可存取的設備
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+	CREATE INDEX IF NOT EXISTS idx_devices_tags ON devices USING GIN (tags);
+	-- 設備類型，用於依類型套用限流等設定
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS device_type VARCHAR(64) NOT NULL DEFAULT '';
+	-- 可擴充的量測欄位：設備類型宣告 schema，非核心欄位存於 JSONB
+	CREATE TABLE IF NOT EXISTS device_types (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		name VARCHAR(64) NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		fields JSONB NOT NULL DEFAULT '[]',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, name)
+	);
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS fields JSONB NOT NULL DEFAULT '{}';
+	-- 核心量測值是否必填依設備類型 schema 決定，未回報時為 NULL
+	ALTER TABLE device_metrics ALTER COLUMN voltage DROP NOT NULL;
+	ALTER TABLE device_metrics ALTER COLUMN current DROP NOT NULL;
+	ALTER TABLE device_metrics ALTER COLUMN temperature DROP NOT NULL;
+	-- 驗證設定檔：數值範圍改由設備類型 / 單一設備設定，移除寫死的 CHECK
+	ALTER TABLE device_metrics DROP CONSTRAINT IF EXISTS device_metrics_voltage_check;
+	ALTER TABLE device_metrics DROP CONSTRAINT IF EXISTS device_metrics_current_check;
+	ALTER TABLE device_metrics DROP CONSTRAINT IF EXISTS device_metrics_temperature_check;
+	CREATE TABLE IF NOT EXISTS validation_profiles (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		scope VARCHAR(20) NOT NULL CHECK (scope IN ('device-type', 'device')),
+		target VARCHAR(255) NOT NULL, -- 設備類型名稱或 device ID
+		rules JSONB NOT NULL DEFAULT '{}',
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, scope, target)
+	);
+	-- 推導欄位：視在功率與梯形積分的累積電能（energy_delta_kwh 為與上一筆之間的增量）
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS power_w DOUBLE PRECISION;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS energy_delta_kwh DOUBLE PRECISION;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS energy_kwh DOUBLE PRECISION;
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS energy_reset_at TIMESTAMP; -- 累積電能歸零時間（例如更換電表）
+	-- 異常偵測：EWMA z-score 結果與各設備的偵測設定（基準狀態存於 Redis）
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS anomaly_score DOUBLE PRECISION;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS is_anomaly BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS anomaly_fields JSONB;
+	CREATE INDEX IF NOT EXISTS idx_device_anomalies ON device_metrics(tenant_id, device_id, timestamp DESC) WHERE is_anomaly;
+	CREATE TABLE IF NOT EXISTS anomaly_settings (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		alpha DOUBLE PRECISION NOT NULL,
+		threshold DOUBLE PRECISION NOT NULL,
+		min_samples INTEGER NOT NULL,
+		fields TEXT[] NOT NULL DEFAULT '{}',
+		alert BOOLEAN NOT NULL DEFAULT TRUE,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, device_id)
+	);
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS is_late BOOLEAN NOT NULL DEFAULT FALSE; -- 超過容許延遲才到達的讀值
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS received_at TIMESTAMP; -- 伺服器接收時間
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS device_timestamp TIMESTAMP; -- 時間戳被校正時保留設備回報的原始時間
+	CREATE TABLE IF NOT EXISTS metric_quarantine (
+		id BIGSERIAL PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		source VARCHAR(20) NOT NULL CHECK (source IN ('api', 'worker')),
+		reason VARCHAR(32) NOT NULL,
+		errors JSONB NOT NULL DEFAULT '[]',
+		payload JSONB NOT NULL, -- 原始回報內容
+		request_id VARCHAR(64) NOT NULL DEFAULT '',
+		received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		corrected_payload JSONB,
+		resolved_at TIMESTAMP,
+		resolved_by VARCHAR(255) NOT NULL DEFAULT ''
+	);
+	-- reinjecting：重新注入已認領；只在既有的 CHECK 尚未包含時重建，避免每次啟動都鎖表並重新掃描
+	DO $$
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conrelid = 'metric_quarantine'::regclass AND conname = 'metric_quarantine_status_check'
+				AND pg_get_constraintdef(oid) LIKE '%reinjecting%'
+		) THEN
+			ALTER TABLE metric_quarantine DROP CONSTRAINT IF EXISTS metric_quarantine_status_check;
+			ALTER TABLE metric_quarantine ADD CONSTRAINT metric_quarantine_status_check
+				CHECK (status IN ('pending', 'reinjecting', 'reinjected', 'discarded'));
+		END IF;
+	END $$;
+	CREATE INDEX IF NOT EXISTS idx_quarantine_tenant_device ON metric_quarantine(tenant_id, device_id, received_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_quarantine_tenant_status ON metric_quarantine(tenant_id, status, received_at DESC);
+	CREATE TABLE IF NOT EXISTS device_twins (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		desired JSONB NOT NULL DEFAULT '{}',
+		desired_version BIGINT NOT NULL DEFAULT 0,
+		desired_updated_at TIMESTAMP,
+		reported JSONB NOT NULL DEFAULT '{}',
+		reported_version BIGINT NOT NULL DEFAULT 0,
+		reported_updated_at TIMESTAMP,
+		PRIMARY KEY (tenant_id, device_id)
+	);
+	CREATE TABLE IF NOT EXISTS device_commands (
+		id BIGSERIAL PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		payload JSONB,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'succeeded', 'failed', 'expired')),
+		result JSONB,
+		created_by VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMP NOT NULL,
+		delivered_at TIMESTAMP,
+		completed_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_commands_tenant_device ON device_commands(tenant_id, device_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_commands_open ON device_commands(expires_at) WHERE status IN ('pending', 'delivered');
+	-- 設備位置（固定設備由管理者設定，行動設備以最新回報的座標更新）與讀值的回報位置
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90);
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180);
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS site VARCHAR(128) NOT NULL DEFAULT '';
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS location_updated_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS idx_devices_location ON devices(tenant_id, latitude, longitude) WHERE latitude IS NOT NULL;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+	ALTER TABLE device_metrics ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+	CREATE TABLE IF NOT EXISTS device_groups (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		id VARCHAR(64) NOT NULL,
+		parent_id VARCHAR(64),
+		name VARCHAR(255) NOT NULL,
+		kind VARCHAR(32) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, id),
+		FOREIGN KEY (tenant_id, parent_id) REFERENCES device_groups(tenant_id, id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_device_groups_parent ON device_groups(tenant_id, parent_id);
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS group_id VARCHAR(64);
+	CREATE INDEX IF NOT EXISTS idx_devices_group ON devices(tenant_id, group_id) WHERE group_id IS NOT NULL;
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS current_status VARCHAR(20);
+	ALTER TABLE devices ADD COLUMN IF NOT EXISTS status_since TIMESTAMP;
+	CREATE TABLE IF NOT EXISTS device_status_events (
+		id BIGSERIAL PRIMARY KEY,
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		from_status VARCHAR(20),
+		to_status VARCHAR(20) NOT NULL,
+		changed_at TIMESTAMP NOT NULL,
+		previous_duration_ms BIGINT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_device_status_events_device ON device_status_events(tenant_id, device_id, changed_at DESC);
+	CREATE TABLE IF NOT EXISTS device_state (
+		tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+		device_id VARCHAR(255) NOT NULL,
+		metric_id INTEGER,
+		last_updated TIMESTAMP NOT NULL,
+		latest_status VARCHAR(20) NOT NULL,
+		voltage DOUBLE PRECISION,
+		current DOUBLE PRECISION,
+		temperature DOUBLE PRECISION,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, device_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_device_state_status ON device_state(tenant_id, latest_status);
+	CREATE INDEX IF NOT EXISTS idx_device_state_last_updated ON device_state(tenant_id, last_updated DESC);
+	CREATE INDEX IF NOT EXISTS idx_device_metrics_tenant_created ON device_metrics(tenant_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_tenant_device_timestamp ON device_metrics(tenant_id, device_id, timestamp DESC);
+	INSERT INTO devices (tenant_id, device_id, last_seen_at)
+		SELECT tenant_id, device_id, MAX(timestamp) FROM device_metrics
+		WHERE NOT EXISTS (SELECT 1 FROM devices) -- 僅首次導入時回填
+		GROUP BY tenant_id, device_id
+		ON CONFLICT (tenant_id, device_id) DO NOTHING;
+	INSERT INTO device_state (tenant_id, device_id, metric_id, last_updated, latest_status, voltage, current, temperature)
+		SELECT DISTINCT ON (tenant_id, device_id) tenant_id, device_id, id, timestamp, status, voltage, current, temperature
+		FROM device_metrics
+		WHERE NOT EXISTS (SELECT 1 FROM device_state) -- 僅首次導入時回填
+		ORDER BY tenant_id, device_id, timestamp DESC
+		ON CONFLICT (tenant_id, device_id) DO NOTHING;
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
 	`
 
 	if _, err := db.Exec(query); err != nil {
 		return fmt.Errorf("建立資料表失敗: %w", err)
 	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING`, SchemaVersion); err != nil {
+		return fmt.Errorf("記錄 schema 版本失敗: %w", err)
+	}
 
-	log.Println("資料表初始化完成")
+	slog.Info("tables initialized")
 	return nil
 }
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/config"
+)
+
+func TestPrimaryDSN(t *testing.T) {
+	cfg := &config.Config{
+		PostgresHost:        "db.internal",
+		PostgresPort:        "5432",
+		PostgresUser:        "iot",
+		PostgresPassword:    "p@ss word'1",
+		PostgresDB:          "iot_db",
+		PostgresSSLMode:     "verify-full",
+		PostgresSSLRootCert: "/etc/ssl/ca.pem",
+	}
+	want := `host=db.internal port=5432 user=iot password='p@ss word\'1' dbname=iot_db sslmode=verify-full sslrootcert=/etc/ssl/ca.pem`
+	if got := primaryDSN(cfg); got != want {
+		t.Errorf("連線字串不符:\n得到 %s\n期望 %s", got, want)
+	}
+
+	cfg.PostgresStatementTimeout = 30 * time.Second
+	if got := primaryDSN(cfg); got != want+" statement_timeout=30000" {
+		t.Errorf("應附加 statement_timeout: %s", got)
+	}
+	if got := withRuntimeParams("postgres://ro@replica/iot_db?sslmode=require", cfg); got != "postgres://ro@replica/iot_db?sslmode=require&statement_timeout=30000" {
+		t.Errorf("URL 格式應以 query string 附加: %s", got)
+	}
+}
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	db := &DB{}
+	if db.Reader() != db.DB {
+		t.Error("未設定 replica 時應使用 primary")
+	}
+	if enabled, _, _ := db.ReplicaStatus(); enabled {
+		t.Error("未設定 replica 時不應顯示為啟用")
+	}
+}
+
+// TestReplicaLag WAL receiver 斷線的 standby 即使兩個 LSN 相等也不視為健康
+func TestReplicaLag(t *testing.T) {
+	if _, err := replicaLag(true, false, 0); err != errReplicaNotStreaming {
+		t.Errorf("receiver 未串流時應回傳 errReplicaNotStreaming，得到 %v", err)
+	}
+	if lag, err := replicaLag(true, true, 1.5); err != nil || lag != 1500*time.Millisecond {
+		t.Errorf("串流中應回傳量測的延遲，得到 %v %v", lag, err)
+	}
+	if lag, err := replicaLag(false, false, 0); err != nil || lag != 0 {
+		t.Errorf("非 standby 應視為沒有延遲，得到 %v %v", lag, err)
+	}
+}
+
+// TestOfflineConnectionNeverConnects memory store 模式即使設定可連線的 Postgres 也不建立連線
+func TestOfflineConnectionNeverConnects(t *testing.T) {
+	db, err := NewOfflineConnection(&config.Config{PostgresHost: "localhost", PostgresPort: "5432"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.Offline() {
+		t.Error("應標示為 offline")
+	}
+	if err := db.Ping(); !errors.Is(err, ErrOffline) {
+		t.Errorf("Ping 應回傳 ErrOffline，得到 %v", err)
+	}
+	if _, err := db.Exec(`SELECT 1`); !errors.Is(err, ErrOffline) {
+		t.Errorf("查詢應回傳 ErrOffline，得到 %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+)
+
+// DB primary 連線（寫入與需要最新資料的查詢），並可選擇性地將唯讀查詢導向 replica
+type DB struct {
+	*sql.DB
+	replica        *sql.DB
+	maxLag         time.Duration
+	replicaHealthy atomic.Bool
+	replicaLag     atomic.Int64 // 最近一次量測的延遲（奈秒）
+	offline        bool         // memory store 模式不連線，見 NewOfflineConnection
+}
+
+var _ interfaces.ReadRoutingDBClient = (*DB)(nil)
+
+// Reader 回傳唯讀查詢使用的連線：replica 健康且延遲在容許範圍內時為 replica，否則為 primary
+func (db *DB) Reader() interfaces.DBClient {
+	if db.replica != nil && db.replicaHealthy.Load() {
+		return db.replica
+	}
+	return db.DB
+}
+
+// ReplicaStatus replica 是否啟用、是否正在使用與最近一次量測的延遲
+func (db *DB) ReplicaStatus() (enabled, healthy bool, lag time.Duration) {
+	return db.replica != nil, db.replicaHealthy.Load(), time.Duration(db.replicaLag.Load())
+}
+
+// MonitorReplica 定期檢查 replica 連線與複寫延遲直到 ctx 取消
+func (db *DB) MonitorReplica(ctx context.Context, interval time.Duration) {
+	if db.replica == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkReplica(ctx)
+		}
+	}
+}
+
+// replicaLagQuery 回傳是否為 standby、WAL receiver 是否正在串流，與以最後套用交易時間估計的延遲。
+// 已收到的 WAL 都已套用時延遲為 0（primary 閒置時最後套用的交易時間不會更新），
+// 但只有 receiver 仍在串流時才成立：斷線的 replica 收不到新的 WAL，兩個 LSN 相等不代表資料是新的
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(),
+		COALESCE((SELECT status = 'streaming' FROM pg_stat_wal_receiver LIMIT 1), false),
+		CASE
+			WHEN NOT pg_is_in_recovery() THEN 0
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END`
+
+// errReplicaNotStreaming standby 的 WAL receiver 未連上 primary，資料可能任意落後
+var errReplicaNotStreaming = errors.New("replica wal receiver not streaming")
+
+// replicaLag 依量測結果判定延遲；不是 standby（例如直接指向 primary）時視為沒有延遲
+func replicaLag(inRecovery, streaming bool, lagSeconds float64) (time.Duration, error) {
+	if !inRecovery {
+		return 0, nil
+	}
+	if !streaming {
+		return 0, errReplicaNotStreaming
+	}
+	return time.Duration(lagSeconds * float64(time.Second)), nil
+}
+
+func (db *DB) checkReplica(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var inRecovery, streaming bool
+	var lagSeconds float64
+	var lag time.Duration
+	err := db.replica.QueryRowContext(ctx, replicaLagQuery).Scan(&inRecovery, &streaming, &lagSeconds)
+	if err == nil {
+		lag, err = replicaLag(inRecovery, streaming, lagSeconds)
+	}
+	healthy := err == nil && (db.maxLag <= 0 || lag <= db.maxLag)
+	if err == nil {
+		db.replicaLag.Store(int64(lag))
+	}
+
+	if was := db.replicaHealthy.Swap(healthy); was != healthy {
+		if healthy {
+			slog.Info("read replica healthy, routing reads to replica", slog.Duration("lag", lag))
+		} else if err != nil {
+			slog.Warn("read replica unavailable, routing reads to primary", logger.Err(err))
+		} else {
+			slog.Warn("read replica lagging, routing reads to primary",
+				slog.Duration("lag", lag), slog.Duration("max_lag", db.maxLag))
+		}
+	}
+}
+
+// Close 關閉 primary 與 replica 連線
+func (db *DB) Close() error {
+	if db.replica != nil {
+		db.replica.Close()
+	}
+	return db.DB.Close()
+}
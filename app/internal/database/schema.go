@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+
+	"iot-data-collection/app/internal/interfaces"
+)
+
+// SchemaVersion 此版本程式的 schema 版本；initTables 新增或修改資料表時遞增，
+// 就緒檢查比對資料庫記錄的最大版本，得知 schema 是否落後（或已被較新版本升級）
+const SchemaVersion = 3
+
+var _ interfaces.MigrationStatusReporter = (*DB)(nil)
+
+// MigrationStatus 實作 interfaces.MigrationStatusReporter
+func (db *DB) MigrationStatus(ctx context.Context) (current, expected int, err error) {
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	return current, SchemaVersion, err
+}
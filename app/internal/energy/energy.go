@@ -0,0 +1,67 @@
+// Package energy 由電壓、電流推導功率與累積電能
+package energy
+
+import "time"
+
+// MaxGap 相鄰兩筆讀值的最大積分間隔；超過時視為斷線，該段不計入電能
+const MaxGap = 15 * time.Minute
+
+// Power 視在功率（W）= V × I
+func Power(voltage, current float64) float64 {
+	return voltage * current
+}
+
+// Reading 計算電能所需的上一筆讀值
+type Reading struct {
+	Timestamp time.Time
+	PowerW    float64
+	EnergyKWh float64 // 累積電能
+}
+
+// Integrate 以梯形法計算 prev 到目前讀值之間的電能增量（kWh），並回傳新的累積電能。
+// 下列情況增量為 0：沒有上一筆、時間未前進（重複或延遲到達的讀值）、間隔超過 MaxGap。
+// resetAt 落在 (prev, now] 之間時累積電能自 0 重新起算。
+func Integrate(prev *Reading, now time.Time, powerW float64, resetAt *time.Time) (deltaKWh, totalKWh float64) {
+	if prev == nil {
+		return 0, 0
+	}
+	if resetAt != nil && resetAt.After(prev.Timestamp) && !resetAt.After(now) {
+		return 0, 0
+	}
+	dt := now.Sub(prev.Timestamp)
+	if dt <= 0 || dt > MaxGap {
+		return 0, prev.EnergyKWh
+	}
+	deltaKWh = (prev.PowerW + powerW) / 2 * dt.Hours() / 1000
+	return deltaKWh, prev.EnergyKWh + deltaKWh
+}
+
+// 日曆區間
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week" // 週一起算
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// CalendarWindow 回傳 date 所在日曆區間的 [start, end)，以 date 的時區計算
+func CalendarWindow(period string, date time.Time) (start, end time.Time, ok bool) {
+	y, m, d := date.Date()
+	loc := date.Location()
+	switch period {
+	case PeriodDay:
+		start = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1), true
+	case PeriodWeek:
+		offset := (int(date.Weekday()) + 6) % 7
+		start = time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7), true
+	case PeriodMonth:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0), true
+	case PeriodYear:
+		start = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(1, 0, 0), true
+	}
+	return time.Time{}, time.Time{}, false
+}
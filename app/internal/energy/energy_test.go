@@ -0,0 +1,59 @@
+package energy
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIntegrate(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := &Reading{Timestamp: t0, PowerW: 1000, EnergyKWh: 5}
+
+	// 1000W → 3000W 持續 6 分鐘：平均 2000W × 0.1h = 0.2 kWh
+	delta, total := Integrate(prev, t0.Add(6*time.Minute), 3000, nil)
+	if math.Abs(delta-0.2) > 1e-9 || math.Abs(total-5.2) > 1e-9 {
+		t.Errorf("期望增量 0.2、累積 5.2，得到 %v %v", delta, total)
+	}
+
+	if delta, total := Integrate(nil, t0, 3000, nil); delta != 0 || total != 0 {
+		t.Errorf("第一筆讀值應自 0 起算，得到 %v %v", delta, total)
+	}
+	if delta, total := Integrate(prev, t0.Add(MaxGap+time.Second), 3000, nil); delta != 0 || total != 5 {
+		t.Errorf("超過 MaxGap 不應積分，得到 %v %v", delta, total)
+	}
+	if delta, total := Integrate(prev, t0.Add(-time.Minute), 3000, nil); delta != 0 || total != 5 {
+		t.Errorf("延遲到達的讀值不應積分，得到 %v %v", delta, total)
+	}
+
+	resetAt := t0.Add(time.Minute)
+	if delta, total := Integrate(prev, t0.Add(2*time.Minute), 3000, &resetAt); delta != 0 || total != 0 {
+		t.Errorf("歸零後應自 0 起算，得到 %v %v", delta, total)
+	}
+	earlier := t0.Add(-time.Hour)
+	if _, total := Integrate(prev, t0.Add(time.Minute), 3000, &earlier); total <= 5 {
+		t.Errorf("較早的歸零不應影響累積，得到 %v", total)
+	}
+}
+
+func TestCalendarWindow(t *testing.T) {
+	date := time.Date(2024, 2, 29, 15, 30, 0, 0, time.UTC) // 週四
+	cases := []struct {
+		period     string
+		start, end time.Time
+	}{
+		{PeriodDay, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{PeriodWeek, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{PeriodYear, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		start, end, ok := CalendarWindow(c.period, date)
+		if !ok || !start.Equal(c.start) || !end.Equal(c.end) {
+			t.Errorf("%s: 期望 [%v, %v)，得到 [%v, %v) ok=%v", c.period, c.start, c.end, start, end, ok)
+		}
+	}
+	if _, _, ok := CalendarWindow("quarter", date); ok {
+		t.Error("不支援的區間應回傳 ok=false")
+	}
+}
@@ -0,0 +1,136 @@
+// Package geo 經緯度的範圍查詢輔助：bounding box、半徑與大圓距離
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusM 地球平均半徑（公尺）
+const earthRadiusM = 6371008.8
+
+// MaxRadiusM 半徑查詢的上限
+const MaxRadiusM = 1000 * 1000
+
+// Point 經緯度（度）
+type Point struct {
+	Lat float64 `json:"latitude"`
+	Lon float64 `json:"longitude"`
+}
+
+// Valid 緯度介於 ±90、經度介於 ±180
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// BBox 矩形範圍；MinLon > MaxLon 表示跨越 180 度經線
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// CrossesAntimeridian 範圍是否跨越 180 度經線
+func (b BBox) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Contains 點是否在範圍內（含邊界）
+func (b BBox) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+}
+
+// Circle 以中心與半徑（公尺）表示的範圍
+type Circle struct {
+	Center  Point
+	RadiusM float64
+}
+
+// BBox 外接矩形，供 DB 先以索引友善的條件粗篩；涵蓋極點時經度取全範圍
+func (c Circle) BBox() BBox {
+	dLat := c.RadiusM / earthRadiusM * 180 / math.Pi
+	b := BBox{MinLat: c.Center.Lat - dLat, MaxLat: c.Center.Lat + dLat, MinLon: -180, MaxLon: 180}
+	if b.MinLat <= -90 || b.MaxLat >= 90 {
+		b.MinLat, b.MaxLat = math.Max(b.MinLat, -90), math.Min(b.MaxLat, 90)
+		return b
+	}
+	dLon := dLat / math.Cos(c.Center.Lat*math.Pi/180)
+	if dLon >= 180 {
+		return b
+	}
+	b.MinLon, b.MaxLon = wrapLon(c.Center.Lon-dLon), wrapLon(c.Center.Lon+dLon)
+	return b
+}
+
+// Contains 點與中心的大圓距離是否不超過半徑，並回傳距離
+func (c Circle) Contains(p Point) (float64, bool) {
+	d := Distance(c.Center, p)
+	return d, d <= c.RadiusM
+}
+
+// Distance 兩點的大圓距離（公尺，haversine）
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func wrapLon(lon float64) float64 {
+	for lon > 180 {
+		lon -= 360
+	}
+	for lon < -180 {
+		lon += 360
+	}
+	return lon
+}
+
+// ParseBBox 解析 "minLat,minLon,maxLat,maxLon"
+func ParseBBox(s string) (BBox, error) {
+	v, err := parseFloats(s, 4)
+	if err != nil {
+		return BBox{}, err
+	}
+	b := BBox{MinLat: v[0], MinLon: v[1], MaxLat: v[2], MaxLon: v[3]}
+	if !(Point{b.MinLat, b.MinLon}).Valid() || !(Point{b.MaxLat, b.MaxLon}).Valid() || b.MinLat > b.MaxLat {
+		return BBox{}, errors.New("bbox out of range")
+	}
+	return b, nil
+}
+
+// ParsePoint 解析 "lat,lon"
+func ParsePoint(s string) (Point, error) {
+	v, err := parseFloats(s, 2)
+	if err != nil {
+		return Point{}, err
+	}
+	p := Point{Lat: v[0], Lon: v[1]}
+	if !p.Valid() {
+		return Point{}, errors.New("point out of range")
+	}
+	return p, nil
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errors.New("expected " + strconv.Itoa(n) + " comma-separated numbers")
+	}
+	v := make([]float64, n)
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("invalid number: " + part)
+		}
+		v[i] = f
+	}
+	return v, nil
+}
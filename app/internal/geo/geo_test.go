@@ -0,0 +1,48 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// 台北車站到高雄車站約 297 公里
+	taipei := Point{Lat: 25.0478, Lon: 121.5170}
+	kaohsiung := Point{Lat: 22.6394, Lon: 120.3025}
+	if d := Distance(taipei, kaohsiung); math.Abs(d-297000) > 5000 {
+		t.Errorf("距離不符: %.0f m", d)
+	}
+	if d := Distance(taipei, taipei); d != 0 {
+		t.Errorf("同一點距離應為 0，得到 %v", d)
+	}
+}
+
+func TestCircleBBox(t *testing.T) {
+	c := Circle{Center: Point{Lat: 25.0478, Lon: 121.5170}, RadiusM: 10000}
+	b := c.BBox()
+	edge := Point{Lat: 25.0478, Lon: 121.5170 + 0.09} // 約 9 公里
+	if _, ok := c.Contains(edge); !ok || !b.Contains(edge) {
+		t.Error("半徑內的點應同時在外接矩形內")
+	}
+
+	// 跨越 180 度經線
+	c = Circle{Center: Point{Lat: 0, Lon: 179.95}, RadiusM: 20000}
+	b = c.BBox()
+	if !b.CrossesAntimeridian() || !b.Contains(Point{Lat: 0, Lon: -179.95}) {
+		t.Errorf("外接矩形應跨越 180 度經線: %+v", b)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := ParseBBox("22,120,25.5,122"); err != nil {
+		t.Errorf("合法 bbox 解析失敗: %v", err)
+	}
+	for _, s := range []string{"22,120,25.5", "95,120,96,121", "25,120,22,121", "a,b,c,d"} {
+		if _, err := ParseBBox(s); err == nil {
+			t.Errorf("%q 應解析失敗", s)
+		}
+	}
+	if p, err := ParsePoint(" 25.04, 121.51 "); err != nil || p.Lat != 25.04 {
+		t.Errorf("合法座標解析失敗: %v %v", p, err)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceAnomalies 查詢被判定為異常的讀值（含異常分數與各欄位 z-score）
+func (h *Handlers) GetDeviceAnomalies(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	list, err := h.MetricSvc.GetMetrics(c.Request.Context(), service.GetMetricsInput{
+		TenantID:      tenantID,
+		DeviceID:      deviceID,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		Limit:         limit,
+		Offset:        offset,
+		OnlyAnomalies: true,
+	})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list anomalies failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得異常資料"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"count":     len(list),
+		"data":      list,
+	})
+}
+
+// GetAnomalySettings 取得設備的異常偵測設定
+func (h *Handlers) GetAnomalySettings(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	st, err := h.AnomalySvc.GetSettings(c.Request.Context(), tenantID, deviceID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get anomaly settings failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得異常偵測設定"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": st})
+}
+
+// PutAnomalySettings 啟用 / 停用並調整設備的異常偵測
+func (h *Handlers) PutAnomalySettings(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.PutAnomalySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	st, err := h.AnomalySvc.PutSettings(c.Request.Context(), tenantID, deviceID, req)
+	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "異常偵測設定無效", "fields": verr.Errors})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("put anomaly settings failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法更新異常偵測設定"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": st})
+}
+
+// ResetAnomalyBaseline 清除設備的 EWMA 基準，重新暖機
+func (h *Handlers) ResetAnomalyBaseline(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := h.AnomalySvc.ResetBaseline(c.Request.Context(), tenantID, deviceID); err != nil {
+		logger.FromContext(c.Request.Context()).Error("reset anomaly baseline failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法重設異常偵測基準"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "異常偵測基準已重設", "device_id": deviceID})
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCacheStats 本機記憶體與 Redis 快取層的命中統計（限平台管理者；統計為此 replica 自啟動起累計）
+func (h *Handlers) GetCacheStats(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+	if h.LocalCache == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true,
+		"data":    h.LocalCache.Stats(),
+	})
+}
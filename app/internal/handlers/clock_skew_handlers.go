@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"iot-data-collection/app/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clockSkewPolicy 目前生效的時間戳政策
+func (h *Handlers) clockSkewPolicy() gin.H {
+	p := h.ClockSkewSvc.Policy()
+	return gin.H{
+		"mode":       p.Mode,
+		"max_future": p.MaxFuture.String(),
+		"max_past":   p.MaxPast.String(),
+	}
+}
+
+// GetClockSkew 列出租戶內各設備的時鐘偏差統計（依估計偏差絕對值由大到小）
+func (h *Handlers) GetClockSkew(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.ClockSkewSvc.ListStats(c.Request.Context(), tenantID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list clock skew stats failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得時鐘偏差統計"})
+		return
+	}
+
+	allowed, ok := h.allowedDevices(c, tenantID)
+	if !ok {
+		return
+	}
+	if allowed != nil {
+		visible := list[:0]
+		for _, d := range list {
+			if allowed[d.DeviceID] {
+				visible = append(visible, d)
+			}
+		}
+		list = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy":  h.clockSkewPolicy(),
+		"count":   len(list),
+		"devices": list,
+	})
+}
+
+// GetDeviceClockSkew 取得單一設備的時鐘偏差統計
+func (h *Handlers) GetDeviceClockSkew(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.ClockSkewSvc.GetStats(c.Request.Context(), tenantID, c.Param("deviceId"))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get clock skew stats failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得時鐘偏差統計"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy": h.clockSkewPolicy(),
+		"data":   stats,
+	})
+}
+
+// ResetDeviceClockSkew 清除設備的時鐘偏差統計（例如校時或更換電池後）
+func (h *Handlers) ResetDeviceClockSkew(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := h.ClockSkewSvc.ResetStats(c.Request.Context(), tenantID, c.Param("deviceId")); err != nil {
+		logger.FromContext(c.Request.Context()).Error("reset clock skew stats failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法清除時鐘偏差統計"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "時鐘偏差統計已清除"})
+}
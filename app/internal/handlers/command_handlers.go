@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDeviceCommand 建立指令並放入設備的指令佇列
+func (h *Handlers) CreateDeviceCommand(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": fieldErrs})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+		return
+	}
+
+	cmd, err := h.CommandSvc.Enqueue(c.Request.Context(), service.EnqueueCommandInput{
+		TenantID:  tenantID,
+		DeviceID:  c.Param("deviceId"),
+		Name:      req.Name,
+		Payload:   req.Payload,
+		TTL:       time.Duration(req.TTLSeconds) * time.Second,
+		CreatedBy: resolvedBy(c),
+	})
+	if err != nil {
+		h.respondCommandError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": cmd})
+}
+
+// GetDeviceCommands 查詢設備的指令歷史，可依 status 篩選
+func (h *Handlers) GetDeviceCommands(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	list, err := h.CommandSvc.ListCommands(c.Request.Context(), service.ListCommandsInput{
+		TenantID: tenantID,
+		DeviceID: c.Param("deviceId"),
+		Status:   c.Query("status"),
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		h.respondCommandError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": c.Param("deviceId"),
+		"count":     len(list),
+		"data":      list,
+	})
+}
+
+// GetDeviceCommand 取得單一指令
+func (h *Handlers) GetDeviceCommand(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+	id, ok := commandID(c)
+	if !ok {
+		return
+	}
+
+	cmd, err := h.CommandSvc.GetCommand(c.Request.Context(), tenantID, c.Param("deviceId"), id)
+	if err != nil {
+		h.respondCommandError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cmd})
+}
+
+// PullDeviceCommands 設備取出待執行的指令（取出後標記為 delivered）
+func (h *Handlers) PullDeviceCommands(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	list, err := h.CommandSvc.Pull(c.Request.Context(), tenantID, c.Param("deviceId"), limit)
+	if err != nil {
+		h.respondCommandError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(list),
+		"data":  list,
+	})
+}
+
+// AckDeviceCommand 設備回報指令執行結果
+func (h *Handlers) AckDeviceCommand(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+	id, ok := commandID(c)
+	if !ok {
+		return
+	}
+
+	var req models.AckCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": fieldErrs})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+		return
+	}
+
+	cmd, err := h.CommandSvc.Ack(c.Request.Context(), tenantID, c.Param("deviceId"), id, req)
+	if err != nil {
+		h.respondCommandError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cmd})
+}
+
+// pendingCommands 回報資料時順便取出待執行的指令（?commands=true）；失敗只記錄日誌，不影響回報結果
+func (h *Handlers) pendingCommands(c *gin.Context, tenantID, deviceID string) []models.DeviceCommand {
+	if h.CommandSvc == nil || c.Query("commands") != "true" {
+		return nil
+	}
+	list, err := h.CommandSvc.Pull(c.Request.Context(), tenantID, deviceID, 10)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Warn("pull device commands failed", logger.Err(err))
+		return nil
+	}
+	return list
+}
+
+func commandID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("commandId"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的指令 ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handlers) respondCommandError(c *gin.Context, err error) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": verr.Errors})
+	case errors.Is(err, service.ErrCommandNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該指令"})
+	case errors.Is(err, service.ErrCommandCompleted):
+		c.JSON(http.StatusConflict, gin.H{"error": "該指令已完成或已過期"})
+	default:
+		logger.FromContext(c.Request.Context()).Error("device command operation failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理設備指令"})
+	}
+}
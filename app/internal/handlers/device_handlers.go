@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/energy"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceTags 取得設備標籤
+func (h *Handlers) GetDeviceTags(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	tags, err := h.DeviceSvc.GetDeviceTags(c.Request.Context(), tenantID, deviceID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get device tags failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備標籤"})
+		return
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"tags":      tags,
+	})
+}
+
+// SetDeviceTags 覆寫設備標籤（用於依標籤限制存取）
+func (h *Handlers) SetDeviceTags(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetDeviceTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	tags, err := h.DeviceSvc.SetDeviceTags(c.Request.Context(), tenantID, deviceID, req.Tags)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("set device tags failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法更新設備標籤"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"tags":      tags,
+	})
+}
+
+// SetDeviceType 設定設備類型（決定套用的限流等設定）
+func (h *Handlers) SetDeviceType(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetDeviceTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.DeviceSvc.SetDeviceType(c.Request.Context(), tenantID, deviceID, req.DeviceType); err != nil {
+		logger.FromContext(c.Request.Context()).Error("set device type failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法更新設備類型"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_id":   deviceID,
+		"device_type": req.DeviceType,
+	})
+}
+
+// GetDeviceEnergy 查詢設備區間用電量：
+// 自訂區間使用 start_time / end_time（RFC3339，end_time 預設為現在），
+// 日曆區間使用 period=day|week|month|year，搭配 date（YYYY-MM-DD，預設今天）與 tz（IANA 時區，預設 UTC）
+func (h *Handlers) GetDeviceEnergy(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	in := service.GetEnergyInput{TenantID: tenantID, DeviceID: deviceID}
+	period := c.Query("period")
+	if period != "" {
+		loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 tz 參數", "details": err.Error()})
+			return
+		}
+		date := time.Now().In(loc)
+		if s := c.Query("date"); s != "" {
+			if date, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 date 格式，請使用 YYYY-MM-DD"})
+				return
+			}
+		}
+		if in.StartTime, in.EndTime, ok = energy.CalendarWindow(period, date); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 day、week、month 或 year"})
+			return
+		}
+	} else {
+		startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+		if err != nil || startTime == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請提供 period，或 RFC3339 格式的 start_time（end_time 選填）"})
+			return
+		}
+		in.StartTime, in.EndTime = *startTime, time.Now()
+		if endTime != nil {
+			in.EndTime = *endTime
+		}
+	}
+
+	report, err := h.MetricSvc.GetEnergy(c.Request.Context(), in)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_time 必須晚於 start_time"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("get device energy failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得用電量"})
+		return
+	}
+	report.Period = period
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// ResetDeviceEnergy 將設備累積電能歸零（例如更換電表），不影響已記錄的區間用電量
+func (h *Handlers) ResetDeviceEnergy(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	resetAt, err := h.DeviceSvc.ResetEnergy(c.Request.Context(), tenantID, deviceID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("reset device energy failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法歸零累積電能"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": models.ResetEnergyResponse{DeviceID: deviceID, ResetAt: resetAt}})
+}
+
+// GetDeviceLocation 取得設備位置與站點
+func (h *Handlers) GetDeviceLocation(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	loc, err := h.DeviceSvc.GetLocation(c.Request.Context(), tenantID, c.Param("deviceId"))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get device location failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備位置"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": loc})
+}
+
+// SetDeviceLocation 設定設備位置與站點（固定設備）
+func (h *Handlers) SetDeviceLocation(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetDeviceLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": fieldErrs})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+		return
+	}
+
+	loc, err := h.DeviceSvc.SetLocation(c.Request.Context(), tenantID, c.Param("deviceId"), req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "經緯度超出範圍"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("set device location failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法設定設備位置"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": loc})
+}
+
+// allowedDevices 以設備標籤限制的呼叫者只能看到帶有其標籤的設備；未限制時回傳 nil
+func (h *Handlers) allowedDevices(c *gin.Context, tenantID string) (map[string]bool, bool) {
+	p := auth.PrincipalFromContext(c.Request.Context())
+	if p == nil || len(p.DeviceTags) == 0 {
+		return nil, true
+	}
+	devices, err := h.DeviceSvc.DevicesWithAnyTag(c.Request.Context(), tenantID, p.DeviceTags)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list devices by tags failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法驗證設備存取權限"})
+		return nil, false
+	}
+	return devices, true
+}
+
+// requireAllDevices 租戶層級的清除會影響所有設備，以設備標籤限制的呼叫者不可使用
+func requireAllDevices(c *gin.Context) bool {
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil && len(p.DeviceTags) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "受設備標籤限制，無法清除整個租戶的統計"})
+		return false
+	}
+	return true
+}
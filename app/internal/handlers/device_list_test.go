@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListDevicesInput(t *testing.T) {
+	cases := []struct {
+		query     string
+		wantOK    bool
+		wantSort  string
+		wantDesc  bool
+		wantLimit int
+	}{
+		{"", true, "", false, 0}, // 未指定 limit 時不分頁
+		{"?sort=-last_updated&limit=50&offset=100", true, "last_updated", true, 50},
+		{"?sort=status", true, "status", false, 0},
+		{"?sort=distance&near=25.03,121.56&radius_m=5000", true, "distance", false, 0},
+		{"?sort=distance", false, "", false, 0},
+		{"?sort=voltage", false, "", false, 0},
+		{"?limit=5000", false, "", false, 0},
+		{"?limit=10&offset=-1", false, "", false, 0},
+		{"?offset=10", false, "", false, 0},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/devices"+tc.query, nil)
+
+		in, ok := listDevicesInput(c, "default")
+		if ok != tc.wantOK {
+			t.Errorf("%q: 期望 ok=%v，得到 %v（%d）", tc.query, tc.wantOK, ok, w.Code)
+			continue
+		}
+		if ok && (in.Sort != tc.wantSort || in.Desc != tc.wantDesc) {
+			t.Errorf("%q: 排序解析不符: %q desc=%v", tc.query, in.Sort, in.Desc)
+		}
+		if ok && in.Limit != tc.wantLimit {
+			t.Errorf("%q: 期望 limit=%d，得到 %d", tc.query, tc.wantLimit, in.Limit)
+		}
+		if !ok && w.Code != http.StatusBadRequest {
+			t.Errorf("%q: 期望 400，得到 %d", tc.query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceTypes 列出租戶的設備類型
+func (h *Handlers) GetDeviceTypes(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.DeviceTypeSvc.ListDeviceTypes(c.Request.Context(), tenantID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list device types failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備類型清單"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":        len(list),
+		"device_types": list,
+	})
+}
+
+// GetDeviceType 取得設備類型 schema
+func (h *Handlers) GetDeviceType(c *gin.Context) {
+	typeName := c.Param("typeName")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	t, err := h.DeviceTypeSvc.GetDeviceType(c.Request.Context(), tenantID, typeName)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceTypeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該設備類型", "device_type": typeName})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("get device type failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備類型"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// PutDeviceType 建立或更新設備類型 schema
+func (h *Handlers) PutDeviceType(c *gin.Context) {
+	typeName := c.Param("typeName")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.PutDeviceTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	t, err := h.DeviceTypeSvc.PutDeviceType(c.Request.Context(), tenantID, typeName, req.Description, req.Fields)
+	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "設備類型定義無效",
+				"fields": verr.Errors,
+			})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("put device type failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法儲存設備類型"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// DeleteDeviceType 刪除設備類型（已指定此類型的設備將不再套用 schema）
+func (h *Handlers) DeleteDeviceType(c *gin.Context) {
+	typeName := c.Param("typeName")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := h.DeviceTypeSvc.DeleteDeviceType(c.Request.Context(), tenantID, typeName); err != nil {
+		if errors.Is(err, service.ErrDeviceTypeNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該設備類型", "device_type": typeName})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("delete device type failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法刪除設備類型"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "設備類型已刪除"})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFleetSummary 租戶所有設備的總覽：狀態分布、離線數、溫度與電流排行、近期寫入量
+func (h *Handlers) GetFleetSummary(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	in := service.FleetSummaryInput{TenantID: tenantID, TopN: service.DefaultFleetTopN}
+	if v := c.Query("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "top 必須為正整數"})
+			return
+		}
+		in.TopN = n
+	}
+	// 受設備標籤限制的呼叫者只納入符合標籤的設備
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		in.AnyTags = p.DeviceTags
+	}
+
+	summary, source, err := h.FleetSvc.Summary(c.Request.Context(), in)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get fleet summary failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備總覽"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":   summary,
+		"source": source,
+	})
+}
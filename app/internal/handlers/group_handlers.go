@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceGroups 列出所有群組（含上層群組 ID，可由此組出階層）
+func (h *Handlers) GetDeviceGroups(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.GroupSvc.ListGroups(c.Request.Context(), tenantID)
+	if err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(list),
+		"data":  list,
+	})
+}
+
+// GetDeviceGroup 取得單一群組
+func (h *Handlers) GetDeviceGroup(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	g, err := h.GroupSvc.GetGroup(c.Request.Context(), tenantID, c.Param("groupId"))
+	if err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": g})
+}
+
+// PutDeviceGroup 建立或更新群組
+func (h *Handlers) PutDeviceGroup(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.PutDeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": fieldErrs})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+		return
+	}
+
+	g, err := h.GroupSvc.PutGroup(c.Request.Context(), tenantID, c.Param("groupId"), req)
+	if err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": g})
+}
+
+// DeleteDeviceGroup 刪除沒有子群組與設備的群組
+func (h *Handlers) DeleteDeviceGroup(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := h.GroupSvc.DeleteGroup(c.Request.Context(), tenantID, c.Param("groupId")); err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "群組已刪除"})
+}
+
+// GetDeviceGroupDevices 列出群組內的設備；預設包含子群組，recursive=false 時只列直接指派的設備
+func (h *Handlers) GetDeviceGroupDevices(c *gin.Context) {
+	in, ok := groupDevicesInput(c)
+	if !ok {
+		return
+	}
+
+	ids, err := h.GroupSvc.ListGroupDevices(c.Request.Context(), in)
+	if err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group_id": in.GroupID,
+		"count":    len(ids),
+		"devices":  ids,
+	})
+}
+
+// GetDeviceGroupSummary 群組內設備目前讀值的彙總：總電流、最高溫度、各狀態設備數等
+func (h *Handlers) GetDeviceGroupSummary(c *gin.Context) {
+	in, ok := groupDevicesInput(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.GroupSvc.Summary(c.Request.Context(), in)
+	if err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": summary})
+}
+
+// SetDeviceGroup 將設備指派到群組；group_id 為空時移出群組
+func (h *Handlers) SetDeviceGroup(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetDeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+		return
+	}
+
+	deviceID := c.Param("deviceId")
+	if err := h.GroupSvc.AssignDevice(c.Request.Context(), tenantID, deviceID, req.GroupID); err != nil {
+		h.respondGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"group_id":  req.GroupID,
+	})
+}
+
+func groupDevicesInput(c *gin.Context) (service.GroupDevicesInput, bool) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return service.GroupDevicesInput{}, false
+	}
+	in := service.GroupDevicesInput{
+		TenantID:  tenantID,
+		GroupID:   c.Param("groupId"),
+		Recursive: c.DefaultQuery("recursive", "true") != "false",
+	}
+	// 受設備標籤限制的呼叫者只納入符合標籤的設備
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		in.AnyTags = p.DeviceTags
+	}
+	return in, true
+}
+
+func (h *Handlers) respondGroupError(c *gin.Context, err error) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": verr.Errors})
+	case errors.Is(err, service.ErrGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該群組"})
+	case errors.Is(err, service.ErrGroupNotEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": "群組仍有子群組或設備，無法刪除"})
+	case errors.Is(err, service.ErrGroupCycle):
+		c.JSON(http.StatusConflict, gin.H{"error": "上層群組不能是此群組的子群組"})
+	default:
+		logger.FromContext(c.Request.Context()).Error("device group operation failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理設備群組"})
+	}
+}
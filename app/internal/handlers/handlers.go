@@ -2,17 +2,28 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/geo"
 	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/latedata"
+	"iot-data-collection/app/internal/localcache"
+	"iot-data-collection/app/internal/logger"
 	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/ratelimit"
 	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 )
 
 var (
@@ -21,16 +32,18 @@ var (
 )
 
 type healthHandler struct {
-	db  interfaces.DBClient
-	rdb interfaces.RedisClient
+	db   interfaces.DBClient
+	rdb  interfaces.RedisClient
+	opts HealthOptions
 }
 
-func NewHealthHandler(db interfaces.DBClient, rdb interfaces.RedisClient) interfaces.HealthHandler {
-	return &healthHandler{db: db, rdb: rdb}
+// NewHealthHandler 建立 HealthHandler；opts 提供就緒檢查（/readyz）的其他相依與門檻
+func NewHealthHandler(db interfaces.DBClient, rdb interfaces.RedisClient, opts HealthOptions) interfaces.HealthHandler {
+	return &healthHandler{db: db, rdb: rdb, opts: opts}
 }
 
 func (hh *healthHandler) Check(ctx context.Context) error {
-	if err := hh.db.Ping(); err != nil {
+	if err := pingDB(ctx, hh.db); err != nil {
 		return fmt.Errorf("%w: %v", ErrDBUnhealthy, err)
 	}
 	if err := hh.rdb.Ping(ctx); err != nil {
@@ -40,8 +53,24 @@ func (hh *healthHandler) Check(ctx context.Context) error {
 }
 
 type Handlers struct {
-	HealthHandler interfaces.HealthHandler
-	MetricSvc     service.DeviceMetricService
+	HealthHandler  interfaces.HealthHandler
+	MetricSvc      service.DeviceMetricService
+	TenantSvc      service.TenantService
+	DeviceSvc      service.DeviceService
+	DeviceTypeSvc  service.DeviceTypeService
+	ProfileSvc     service.ValidationProfileService
+	QuarantineSvc  service.QuarantineService
+	AnomalySvc     service.AnomalyService
+	Throttle       ratelimit.ThrottleCounter
+	Late           latedata.Counter
+	ClockSkewSvc   service.ClockSkewService
+	TwinSvc        service.TwinService
+	CommandSvc     service.CommandService
+	GroupSvc       service.GroupService
+	FleetSvc       service.FleetService
+	StatusEventSvc service.StatusEventService
+	LocalCache     *localcache.Tiered // 未啟用程序內快取時為 nil
+	LongPolls      context.Context    // 伺服器開始關閉時取消，提前結束長輪詢；nil 表示只隨請求結束
 }
 
 func (h *Handlers) HealthCheck(c *gin.Context) {
@@ -53,6 +82,7 @@ func (h *Handlers) HealthCheck(c *gin.Context) {
 		} else if errors.Is(err, ErrRedisUnhealthy) {
 			msg = "Redis 連線失敗"
 		}
+		logger.FromContext(c.Request.Context()).Error("health check failed", logger.Err(err))
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":  "unhealthy",
 			"message": msg,
@@ -75,31 +105,69 @@ func (h *Handlers) CreateDeviceMetric(c *gin.Context) {
 		return
 	}
 
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	// 以 ShouldBindBodyWith 綁定，保留原始內容供驗證失敗時寫入隔離區
 	var req models.CreateDeviceMetricRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		logger.FromContext(c.Request.Context()).Warn("invalid metric payload", logger.Err(err))
+		if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+			resp := gin.H{
+				"error":  "資料驗證失敗",
+				"fields": fieldErrs,
+			}
+			h.quarantineMetric(c, tenantID, deviceID, models.QuarantineReasonInvalidPayload, fieldErrs, resp)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
+		resp := gin.H{
 			"error":   "無效的請求資料",
 			"details": err.Error(),
-		})
+		}
+		h.quarantineMetric(c, tenantID, deviceID, models.QuarantineReasonInvalidPayload,
+			[]service.FieldError{{Field: "payload", Message: err.Error()}}, resp)
+		c.JSON(http.StatusBadRequest, resp)
 		return
 	}
 
 	in := service.SubmitMetricInput{
+		TenantID:    tenantID,
 		DeviceID:    deviceID,
 		Voltage:     req.Voltage,
 		Current:     req.Current,
 		Temperature: req.Temperature,
 		Status:      req.Status,
 		Timestamp:   req.Timestamp,
+		Fields:      req.Fields,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
 	}
 	err := h.MetricSvc.SubmitMetric(c.Request.Context(), in)
 	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			logger.FromContext(c.Request.Context()).Warn("metric rejected by validation", logger.Err(err))
+			resp := gin.H{
+				"error":  "資料驗證失敗",
+				"fields": verr.Errors,
+			}
+			h.quarantineMetric(c, tenantID, deviceID, models.QuarantineReasonValidation, verr.Errors, resp)
+			c.JSON(http.StatusBadRequest, resp)
+			return
+		}
 		if errors.Is(err, service.ErrInvalidTimestamp) {
-			c.JSON(http.StatusBadRequest, gin.H{
+			resp := gin.H{
 				"error": "無效的時間格式，請使用 RFC3339 格式（例如：2024-01-01T12:00:00Z）",
-			})
+			}
+			h.quarantineMetric(c, tenantID, deviceID, models.QuarantineReasonValidation,
+				[]service.FieldError{{Field: "timestamp", Message: "無效的時間格式"}}, resp)
+			c.JSON(http.StatusBadRequest, resp)
 			return
 		}
+		logger.FromContext(c.Request.Context()).Error("submit metric failed", logger.Err(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "無法加入處理佇列",
 			"details": err.Error(),
@@ -107,10 +175,14 @@ func (h *Handlers) CreateDeviceMetric(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{
+	resp := gin.H{
 		"message":   "資料已接受，將於背景處理",
 		"device_id": deviceID,
-	})
+	}
+	if cmds := h.pendingCommands(c, tenantID, deviceID); cmds != nil {
+		resp["commands"] = cmds
+	}
+	c.JSON(http.StatusAccepted, resp)
 }
 
 // GetDeviceMetrics 查詢設備歷史 metrics
@@ -121,24 +193,32 @@ func (h *Handlers) GetDeviceMetrics(c *gin.Context) {
 		return
 	}
 
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
 	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
 		return
 	}
 
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
 	in := service.GetMetricsInput{
+		TenantID:  tenantID,
 		DeviceID:  deviceID,
 		StartTime: startTime,
 		EndTime:   endTime,
 		Limit:     limit,
 		Offset:    offset,
+		Fields:    splitList(c.Query("fields")),
 	}
 	list, err := h.MetricSvc.GetMetrics(c.Request.Context(), in)
 	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("query metrics failed", logger.Err(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "無法取得資料",
 			"details": err.Error(),
@@ -161,7 +241,12 @@ func (h *Handlers) GetDeviceLatest(c *gin.Context) {
 		return
 	}
 
-	result, err := h.MetricSvc.GetLatest(c.Request.Context(), deviceID)
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.MetricSvc.GetLatest(c.Request.Context(), tenantID, deviceID)
 	if err != nil {
 		if errors.Is(err, service.ErrDeviceNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -170,6 +255,7 @@ func (h *Handlers) GetDeviceLatest(c *gin.Context) {
 			})
 			return
 		}
+		logger.FromContext(c.Request.Context()).Error("get latest metric failed", logger.Err(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得資料"})
 		return
 	}
@@ -182,8 +268,22 @@ func (h *Handlers) GetDeviceLatest(c *gin.Context) {
 
 // GetDevices 列出所有設備
 func (h *Handlers) GetDevices(c *gin.Context) {
-	list, err := h.MetricSvc.ListDevices(c.Request.Context())
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	in, ok := listDevicesInput(c, tenantID)
+	if !ok {
+		return
+	}
+	// 受設備標籤限制的呼叫者只能看到符合標籤的設備
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		in.AnyTags = p.DeviceTags
+	}
+	result, err := h.MetricSvc.ListDevices(c.Request.Context(), in)
 	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list devices failed", logger.Err(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "無法取得設備清單",
 			"details": err.Error(),
@@ -191,12 +291,150 @@ func (h *Handlers) GetDevices(c *gin.Context) {
 		return
 	}
 
+	resp := gin.H{
+		"count":   len(result.Devices),
+		"total":   result.Total,
+		"devices": result.Devices,
+	}
+	if in.Limit > 0 {
+		resp["limit"], resp["offset"] = in.Limit, in.Offset
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// listDevicesInput 解析設備清單的篩選條件：status、site、bbox=minLat,minLon,maxLat,maxLon、near=lat,lon 搭配 radius_m，
+// 以及排序 sort（前綴 - 表示遞減）與分頁 limit、offset；未指定 limit 時回傳全部符合的設備
+func listDevicesInput(c *gin.Context, tenantID string) (service.ListDevicesInput, bool) {
+	in := service.ListDevicesInput{
+		TenantID: tenantID,
+		Status:   c.Query("status"),
+		Site:     c.Query("site"),
+	}
+	in.Sort, in.Desc = strings.CutPrefix(c.Query("sort"), "-")
+	if raw, ok := c.GetQuery("limit"); ok {
+		limits := service.CurrentQueryLimits()
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > limits.Max {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit 必須為 1 到 %d 的整數", limits.Max)})
+			return in, false
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset 必須為非負整數"})
+			return in, false
+		}
+		in.Limit, in.Offset = limit, offset
+	} else if _, ok := c.GetQuery("offset"); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset 須搭配 limit 使用"})
+		return in, false
+	}
+	switch in.Status {
+	case "", "normal", "warning", "error":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 必須為下列其中之一: normal warning error"})
+		return in, false
+	}
+
+	bbox, near := c.Query("bbox"), c.Query("near")
+	if bbox != "" && near != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bbox 與 near 不能同時使用"})
+		return in, false
+	}
+	if bbox != "" {
+		b, err := geo.ParseBBox(bbox)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 bbox，格式為 minLat,minLon,maxLat,maxLon", "details": err.Error()})
+			return in, false
+		}
+		in.BBox = &b
+	}
+	if near != "" {
+		center, err := geo.ParsePoint(near)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 near，格式為 lat,lon", "details": err.Error()})
+			return in, false
+		}
+		radius, err := strconv.ParseFloat(c.Query("radius_m"), 64)
+		if err != nil || radius <= 0 || radius > geo.MaxRadiusM {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "使用 near 時須提供 radius_m（公尺，最大 1000000）"})
+			return in, false
+		}
+		in.Within = &geo.Circle{Center: center, RadiusM: radius}
+	}
+
+	switch in.Sort {
+	case "", service.DeviceSortDeviceID, service.DeviceSortLastUpdated, service.DeviceSortStatus:
+	case service.DeviceSortDistance:
+		if in.Within == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort=distance 須搭配 near 與 radius_m"})
+			return in, false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort 必須為下列其中之一: device_id last_updated status distance（前綴 - 表示遞減）"})
+		return in, false
+	}
+	return in, true
+}
+
+// GetDeviceSeries 查詢單一欄位（核心欄位或設備類型宣告的欄位）的時間序列
+func (h *Handlers) GetDeviceSeries(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	field := c.Query("field")
+	if field == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "field 參數不能為空"})
+		return
+	}
+	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	points, err := h.MetricSvc.GetSeries(c.Request.Context(), service.GetSeriesInput{
+		TenantID:  tenantID,
+		DeviceID:  deviceID,
+		Field:     field,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     limit,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的欄位名稱", "field": field})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("query series failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "無法取得資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"count":   len(list),
-		"devices": list,
+		"device_id": deviceID,
+		"field":     field,
+		"count":     len(points),
+		"data":      points,
 	})
 }
 
+// requireTenant 取出 middleware 設定的租戶 ID，缺少時回傳 401
+func requireTenant(c *gin.Context) (string, bool) {
+	tenantID, ok := tenant.FromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "無法識別租戶"})
+		return "", false
+	}
+	return tenantID, true
+}
+
 // parseTimeRange 解析 start_time、end_time，無效則回傳 error
 func parseTimeRange(startStr, endStr string) (*time.Time, *time.Time, error) {
 	var start, end *time.Time
@@ -216,3 +454,40 @@ func parseTimeRange(startStr, endStr string) (*time.Time, *time.Time, error) {
 	}
 	return start, end, nil
 }
+
+// splitList 解析以逗號分隔的查詢參數，忽略空白項目
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// bindingFieldErrors 將 gin 綁定錯誤（必填、列舉、型別錯誤）轉為逐欄位的錯誤；無法轉換時回傳 nil
+func bindingFieldErrors(err error) []service.FieldError {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		out := make([]service.FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			msg := "驗證失敗: " + fe.Tag()
+			switch fe.Tag() {
+			case "required":
+				msg = "必填欄位缺失"
+			case "oneof":
+				msg = "必須為下列其中之一: " + fe.Param()
+			case "max":
+				msg = "超過上限 " + fe.Param()
+			}
+			out = append(out, service.FieldError{Field: strings.ToLower(fe.Field()), Message: msg})
+		}
+		return out
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []service.FieldError{{Field: typeErr.Field, Message: "型別錯誤，應為 " + typeErr.Type.String()}}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"iot-data-collection/app/internal/metricstore"
 	"iot-data-collection/app/internal/mocks"
 	"iot-data-collection/app/internal/service"
 
@@ -13,14 +14,15 @@ import (
 )
 
 func TestHealthCheck_Healthy(t *testing.T) {
-	metricSvc := service.NewDeviceMetricService(&mocks.MockDB{}, &mocks.MockRedis{}, &mocks.MockMetricQueue{})
+	metricSvc := service.NewDeviceMetricService(metricstore.NewMemoryStore(), &mocks.MockRedis{}, &mocks.MockMetricQueue{}, nil, nil, nil)
 	h := &Handlers{
-		HealthHandler: NewHealthHandler(&mocks.MockDB{}, &mocks.MockRedis{}),
+		HealthHandler: NewHealthHandler(&mocks.MockDB{}, &mocks.MockRedis{}, HealthOptions{}),
 		MetricSvc:     metricSvc,
 	}
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
 
 	h.HealthCheck(c)
 
@@ -30,16 +32,17 @@ func TestHealthCheck_Healthy(t *testing.T) {
 }
 
 func TestHealthCheck_RedisDown(t *testing.T) {
-	metricSvc := service.NewDeviceMetricService(&mocks.MockDB{}, &mocks.MockRedis{}, &mocks.MockMetricQueue{})
+	metricSvc := service.NewDeviceMetricService(metricstore.NewMemoryStore(), &mocks.MockRedis{}, &mocks.MockMetricQueue{}, nil, nil, nil)
 	h := &Handlers{
 		HealthHandler: NewHealthHandler(&mocks.MockDB{}, &mocks.MockRedis{
 			PingErr: errors.New("redis連線失敗"),
-		}),
+		}, HealthOptions{}),
 		MetricSvc: metricSvc,
 	}
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
 
 	h.HealthCheck(c)
 
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthOptions 就緒檢查的選用相依與門檻；相依為 nil 時略過對應項目
+type HealthOptions struct {
+	Queue            interfaces.MetricQueueInspector
+	Worker           interfaces.Heartbeat
+	Migrations       interfaces.MigrationStatusReporter
+	Critical         []string      // 異常時整體為 down 的項目，未設定時為 redis（無法寫入佇列即無法接收資料）
+	Timeout          time.Duration // 單一項目的檢查時間上限，未設定時為 2 秒
+	QueueBacklogWarn int64         // 積壓超過此值時 queue 為 degraded，0 表示不檢查
+	WorkerMaxAge     time.Duration // 心跳超過此時間未更新時 worker 為 down，未設定時為 30 秒
+	ShuttingDown     func() bool   // 回傳 true 時直接回報 down，讓負載平衡在關閉前停止導入流量
+}
+
+// replicaStatusReporter 支援唯讀 replica 的 DBClient（*database.DB）
+type replicaStatusReporter interface {
+	ReplicaStatus() (enabled, healthy bool, lag time.Duration)
+}
+
+// contextPinger 可隨 context 取消的 Ping（*database.DB 經由內嵌的 *sql.DB 提供）；
+// 檢查逾時時連線嘗試一併中止，不會在背景佔用連線池
+type contextPinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// pingDB 優先使用 PingContext，不支援時退回 Ping
+func pingDB(ctx context.Context, db interfaces.DBClient) error {
+	if p, ok := db.(contextPinger); ok {
+		return p.PingContext(ctx)
+	}
+	return db.Ping()
+}
+
+// readinessCheck 單一檢查項目；回傳狀態、說明與附加資訊
+type readinessCheck struct {
+	name string
+	run  func(ctx context.Context) (status, message string, details map[string]interface{})
+}
+
+func (hh *healthHandler) Ready(ctx context.Context) *models.ReadinessReport {
+	if hh.opts.ShuttingDown != nil && hh.opts.ShuttingDown() {
+		return &models.ReadinessReport{
+			Status:    models.HealthDown,
+			Message:   "服務關閉中",
+			Timestamp: time.Now().UTC(),
+			Checks:    []models.DependencyCheck{},
+		}
+	}
+	checks := hh.readinessChecks()
+	results := make([]models.DependencyCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk readinessCheck) {
+			defer wg.Done()
+			results[i] = hh.runCheck(ctx, chk)
+		}(i, chk)
+	}
+	wg.Wait()
+	return &models.ReadinessReport{
+		Status:    overallStatus(results),
+		Timestamp: time.Now().UTC(),
+		Checks:    results,
+	}
+}
+
+// runCheck 執行單一項目並計時；超過時間上限視為 down（不支援 context 的相依仍可能卡住，因此另起 goroutine 等待）
+func (hh *healthHandler) runCheck(ctx context.Context, chk readinessCheck) models.DependencyCheck {
+	timeout := hh.opts.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		status, message string
+		details         map[string]interface{}
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		status, message, details := chk.run(ctx)
+		done <- outcome{status, message, details}
+	}()
+
+	res := models.DependencyCheck{Name: chk.name, Critical: hh.isCritical(chk.name)}
+	select {
+	case o := <-done:
+		res.Status, res.Message, res.Details = o.status, o.message, o.details
+	case <-ctx.Done():
+		res.Status, res.Message = models.HealthDown, "檢查逾時"
+	}
+	res.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	return res
+}
+
+func (hh *healthHandler) isCritical(name string) bool {
+	critical := hh.opts.Critical
+	if critical == nil {
+		critical = []string{models.CheckRedis}
+	}
+	for _, c := range critical {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// overallStatus 任一關鍵項目 down 時為 down，其餘任一項目不是 ok 時為 degraded
+func overallStatus(checks []models.DependencyCheck) string {
+	status := models.HealthOK
+	for _, c := range checks {
+		if c.Status == models.HealthDown && c.Critical {
+			return models.HealthDown
+		}
+		if c.Status != models.HealthOK {
+			status = models.HealthDegraded
+		}
+	}
+	return status
+}
+
+func (hh *healthHandler) readinessChecks() []readinessCheck {
+	checks := []readinessCheck{{name: models.CheckPostgres, run: hh.checkPostgres}}
+	if r, ok := hh.db.(replicaStatusReporter); ok {
+		if enabled, _, _ := r.ReplicaStatus(); enabled {
+			checks = append(checks, readinessCheck{name: models.CheckPostgresReplica, run: hh.checkReplica})
+		}
+	}
+	checks = append(checks, readinessCheck{name: models.CheckRedis, run: hh.checkRedis})
+	if hh.opts.Queue != nil {
+		checks = append(checks, readinessCheck{name: models.CheckQueue, run: hh.checkQueue})
+	}
+	if hh.opts.Worker != nil {
+		checks = append(checks, readinessCheck{name: models.CheckWorker, run: hh.checkWorker})
+	}
+	if hh.opts.Migrations != nil {
+		checks = append(checks, readinessCheck{name: models.CheckMigrations, run: hh.checkMigrations})
+	}
+	return checks
+}
+
+func (hh *healthHandler) checkPostgres(ctx context.Context) (string, string, map[string]interface{}) {
+	if err := pingDB(ctx, hh.db); err != nil {
+		return models.HealthDown, err.Error(), nil
+	}
+	return models.HealthOK, "", nil
+}
+
+// checkReplica replica 異常時唯讀查詢已自動改走 primary，因此只標示為 degraded
+func (hh *healthHandler) checkReplica(ctx context.Context) (string, string, map[string]interface{}) {
+	_, healthy, lag := hh.db.(replicaStatusReporter).ReplicaStatus()
+	details := map[string]interface{}{"lag_ms": lag.Milliseconds()}
+	if !healthy {
+		return models.HealthDegraded, "replica 無法使用或延遲過大，唯讀查詢改走 primary", details
+	}
+	return models.HealthOK, "", details
+}
+
+func (hh *healthHandler) checkRedis(ctx context.Context) (string, string, map[string]interface{}) {
+	if err := hh.rdb.Ping(ctx); err != nil {
+		return models.HealthDown, err.Error(), nil
+	}
+	return models.HealthOK, "", nil
+}
+
+func (hh *healthHandler) checkQueue(ctx context.Context) (string, string, map[string]interface{}) {
+	n, err := hh.opts.Queue.Len(ctx)
+	if err != nil {
+		return models.HealthDown, err.Error(), nil
+	}
+	details := map[string]interface{}{"backlog": n}
+	if hh.opts.QueueBacklogWarn > 0 && n > hh.opts.QueueBacklogWarn {
+		return models.HealthDegraded, "佇列積壓任務過多", details
+	}
+	return models.HealthOK, "", details
+}
+
+func (hh *healthHandler) checkWorker(ctx context.Context) (string, string, map[string]interface{}) {
+	last := hh.opts.Worker.LastHeartbeat()
+	if last.IsZero() {
+		return models.HealthDown, "worker 尚未啟動", nil
+	}
+	maxAge := hh.opts.WorkerMaxAge
+	if maxAge <= 0 {
+		maxAge = 30 * time.Second
+	}
+	age := time.Since(last)
+	details := map[string]interface{}{"heartbeat_age_ms": age.Milliseconds(), "last_heartbeat": last.UTC()}
+	if age > maxAge {
+		return models.HealthDown, "worker 心跳逾時", details
+	}
+	return models.HealthOK, "", details
+}
+
+func (hh *healthHandler) checkMigrations(ctx context.Context) (string, string, map[string]interface{}) {
+	current, expected, err := hh.opts.Migrations.MigrationStatus(ctx)
+	if err != nil {
+		return models.HealthDown, err.Error(), nil
+	}
+	details := map[string]interface{}{"current": current, "expected": expected}
+	switch {
+	case current < expected:
+		return models.HealthDown, "資料庫 schema 版本落後", details
+	case current > expected:
+		return models.HealthDegraded, "資料庫 schema 已由較新版本升級（可能正在滾動更新）", details
+	}
+	return models.HealthOK, "", details
+}
+
+// Livez 存活檢查：程序能回應即為存活，不檢查外部相依，避免相依異常時程序被重啟
+func (h *Handlers) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "alive",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// Readyz 就緒檢查：關鍵項目 down 時回傳 503；非關鍵項目異常時回傳 200 並標示 degraded
+func (h *Handlers) Readyz(c *gin.Context) {
+	report := h.HealthHandler.Ready(c.Request.Context())
+	code := http.StatusOK
+	if report.Status == models.HealthDown {
+		code = http.StatusServiceUnavailable
+	}
+	if report.Status != models.HealthOK {
+		var failing []string
+		for _, chk := range report.Checks {
+			if chk.Status != models.HealthOK {
+				failing = append(failing, chk.Name+"="+chk.Status)
+			}
+		}
+		logger.FromContext(c.Request.Context()).Warn("readiness check not ok",
+			"status", report.Status, "checks", strings.Join(failing, ","))
+	}
+	c.JSON(code, report)
+}
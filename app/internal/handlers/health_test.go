@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/mocks"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeQueueLen int64
+
+func (f fakeQueueLen) Len(ctx context.Context) (int64, error) { return int64(f), nil }
+
+type fakeHeartbeat time.Time
+
+func (f fakeHeartbeat) LastHeartbeat() time.Time { return time.Time(f) }
+
+type fakeMigrations struct{ current, expected int }
+
+func (f fakeMigrations) MigrationStatus(ctx context.Context) (int, int, error) {
+	return f.current, f.expected, nil
+}
+
+// blockingDB 的 PingContext 直到 context 取消才返回，模擬無回應的 Postgres
+type blockingDB struct {
+	mocks.MockDB
+	returned chan struct{}
+}
+
+func (b *blockingDB) PingContext(ctx context.Context) error {
+	<-ctx.Done()
+	close(b.returned)
+	return ctx.Err()
+}
+
+func TestReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	healthy := HealthOptions{
+		Queue:            fakeQueueLen(3),
+		Worker:           fakeHeartbeat(time.Now()),
+		Migrations:       fakeMigrations{1, 1},
+		QueueBacklogWarn: 100,
+	}
+
+	cases := []struct {
+		name       string
+		db         *mocks.MockDB
+		rdb        *mocks.MockRedis
+		opts       func(o *HealthOptions)
+		wantCode   int
+		wantStatus string
+		wantCheck  string // 預期非 ok 的項目
+	}{
+		{"全部正常", &mocks.MockDB{}, &mocks.MockRedis{}, nil, http.StatusOK, models.HealthOK, ""},
+		{"Postgres 非關鍵，標示 degraded", &mocks.MockDB{PingErr: errors.New("refused")}, &mocks.MockRedis{}, nil,
+			http.StatusOK, models.HealthDegraded, models.CheckPostgres},
+		{"Redis 為預設關鍵項目", &mocks.MockDB{}, &mocks.MockRedis{PingErr: errors.New("refused")}, nil,
+			http.StatusServiceUnavailable, models.HealthDown, models.CheckRedis},
+		{"設定 Postgres 為關鍵項目", &mocks.MockDB{PingErr: errors.New("refused")}, &mocks.MockRedis{},
+			func(o *HealthOptions) { o.Critical = []string{models.CheckPostgres} },
+			http.StatusServiceUnavailable, models.HealthDown, models.CheckPostgres},
+		{"佇列積壓", &mocks.MockDB{}, &mocks.MockRedis{},
+			func(o *HealthOptions) { o.Queue = fakeQueueLen(500) },
+			http.StatusOK, models.HealthDegraded, models.CheckQueue},
+		{"worker 心跳逾時", &mocks.MockDB{}, &mocks.MockRedis{},
+			func(o *HealthOptions) { o.Worker = fakeHeartbeat(time.Now().Add(-time.Minute)) },
+			http.StatusOK, models.HealthDegraded, models.CheckWorker},
+		{"schema 落後且為關鍵項目", &mocks.MockDB{}, &mocks.MockRedis{},
+			func(o *HealthOptions) {
+				o.Migrations = fakeMigrations{0, 1}
+				o.Critical = []string{models.CheckRedis, models.CheckMigrations}
+			},
+			http.StatusServiceUnavailable, models.HealthDown, models.CheckMigrations},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := healthy
+			if tc.opts != nil {
+				tc.opts(&opts)
+			}
+			h := &Handlers{HealthHandler: NewHealthHandler(tc.db, tc.rdb, opts)}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			h.Readyz(c)
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("HTTP 狀態碼應為 %d，得到 %d: %s", tc.wantCode, w.Code, w.Body.String())
+			}
+			var report models.ReadinessReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tc.wantStatus {
+				t.Errorf("整體狀態應為 %s，得到 %s", tc.wantStatus, report.Status)
+			}
+			if len(report.Checks) != 5 {
+				t.Errorf("應有 5 個檢查項目，得到 %d", len(report.Checks))
+			}
+			for _, chk := range report.Checks {
+				if (chk.Status != models.HealthOK) != (chk.Name == tc.wantCheck) {
+					t.Errorf("項目 %s 狀態為 %s（%s）", chk.Name, chk.Status, chk.Message)
+				}
+			}
+		})
+	}
+}
+
+// TestReadyPostgresHonorsTimeout Postgres 無回應時檢查在時間上限內結束，Ping 也隨 context 取消而返回
+func TestReadyPostgresHonorsTimeout(t *testing.T) {
+	db := &blockingDB{returned: make(chan struct{})}
+	hh := NewHealthHandler(db, &mocks.MockRedis{}, HealthOptions{Timeout: 20 * time.Millisecond}).(*healthHandler)
+
+	report := hh.Ready(context.Background())
+	for _, chk := range report.Checks {
+		if chk.Name == models.CheckPostgres && chk.Status != models.HealthDown {
+			t.Errorf("Postgres 無回應時應為 down，得到 %s", chk.Status)
+		}
+	}
+	select {
+	case <-db.returned:
+	case <-time.After(time.Second):
+		t.Fatal("逾時後 PingContext 應隨 context 取消返回")
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"iot-data-collection/app/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLateDataCounts 列出租戶內各設備延遲與亂序到達的累計筆數（由多到少）
+func (h *Handlers) GetLateDataCounts(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Late.List(c.Request.Context(), tenantID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list late data counters failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得延遲資料統計"})
+		return
+	}
+
+	allowed, ok := h.allowedDevices(c, tenantID)
+	if !ok {
+		return
+	}
+	if allowed != nil {
+		visible := list[:0]
+		for _, d := range list {
+			if allowed[d.DeviceID] {
+				visible = append(visible, d)
+			}
+		}
+		list = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(list),
+		"devices": list,
+	})
+}
+
+// ResetLateDataCounts 清除租戶的延遲資料統計
+func (h *Handlers) ResetLateDataCounts(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok || !requireAllDevices(c) {
+		return
+	}
+
+	if err := h.Late.Reset(c.Request.Context(), tenantID); err != nil {
+		logger.FromContext(c.Request.Context()).Error("reset late data counters failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法清除延遲資料統計"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "延遲資料統計已清除"})
+}
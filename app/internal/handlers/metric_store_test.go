@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/mocks"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMetricQueriesWithMemoryStore 以記憶體 store 經由 service 與 handler 查詢歷史、最新一筆與設備清單
+func TestMetricQueriesWithMemoryStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := metricstore.NewMemoryStore()
+	t0 := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	var seed []*models.DeviceMetric
+	for i := 0; i < 5; i++ {
+		voltage := 220 + float64(i)
+		seed = append(seed, &models.DeviceMetric{TenantID: "acme", DeviceID: "meter-1", Status: "normal",
+			Voltage: &voltage, Timestamp: t0.Add(time.Duration(i) * time.Minute)})
+	}
+	seed = append(seed, &models.DeviceMetric{TenantID: "other", DeviceID: "meter-1", Status: "error", Timestamp: t0})
+	for _, m := range seed {
+		if err := store.Insert(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handlers{MetricSvc: service.NewDeviceMetricService(store, &mocks.MockRedis{GetErr: errors.New("miss")}, &mocks.MockMetricQueue{}, nil, nil, nil)}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), "acme"))
+	})
+	r.GET("/devices", h.GetDevices)
+	r.GET("/devices/:deviceId/metrics", h.GetDeviceMetrics)
+	r.GET("/devices/:deviceId/latest", h.GetDeviceLatest)
+
+	get := func(path string, out interface{}) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return w.Code
+	}
+
+	var history struct {
+		Count int                   `json:"count"`
+		Data  []models.DeviceMetric `json:"data"`
+	}
+	if code := get("/devices/meter-1/metrics?start_time=2026-03-01T08:02:00Z&limit=2", &history); code != http.StatusOK {
+		t.Fatalf("查詢歷史資料應回傳 200，得到 %d", code)
+	}
+	if history.Count != 2 || *history.Data[0].Voltage != 224 || *history.Data[1].Voltage != 223 {
+		t.Errorf("應依時間由新到舊回傳區間內的 2 筆，得到 %+v", history.Data)
+	}
+
+	var latest struct {
+		Data   models.DeviceMetric `json:"data"`
+		Source string              `json:"source"`
+	}
+	if code := get("/devices/meter-1/latest", &latest); code != http.StatusOK || *latest.Data.Voltage != 224 || latest.Source != "database" {
+		t.Errorf("快取未命中時應由 store 取得最新一筆，得到 %d %+v", code, latest)
+	}
+	if code := get("/devices/meter-2/latest", &latest); code != http.StatusNotFound {
+		t.Errorf("沒有讀值的設備應回傳 404，得到 %d", code)
+	}
+
+	var devices struct {
+		Total   int                         `json:"total"`
+		Devices []models.DeviceListResponse `json:"devices"`
+	}
+	if code := get("/devices?status=normal", &devices); code != http.StatusOK || devices.Total != 1 || devices.Devices[0].LatestStatus != "normal" {
+		t.Errorf("設備清單只應包含此租戶的設備，得到 %d %+v", code, devices)
+	}
+
+	// 未指定 limit 時回傳全部設備，不受預設筆數限制
+	for i := 0; i < service.DefaultQueryLimits().Default; i++ {
+		m := &models.DeviceMetric{TenantID: "acme", DeviceID: fmt.Sprintf("bulk-%03d", i), Status: "warning", Timestamp: t0}
+		if err := store.Insert(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := service.DefaultQueryLimits().Default + 1
+	if code := get("/devices", &devices); code != http.StatusOK || devices.Total != want || len(devices.Devices) != want {
+		t.Errorf("未分頁時應回傳全部 %d 個設備，得到 %d total=%d count=%d", want, code, devices.Total, len(devices.Devices))
+	}
+	if code := get("/devices?limit=10&offset=500", &devices); code != http.StatusOK || devices.Total != want || len(devices.Devices) != 0 {
+		t.Errorf("超過最後一頁時 total 仍應為 %d，得到 %d total=%d count=%d", want, code, devices.Total, len(devices.Devices))
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quarantineMetric 將被拒絕的原始內容寫入隔離區，成功時在回應附上 quarantine_id；
+// 寫入失敗只記錄日誌，不影響原本的 400 回應
+func (h *Handlers) quarantineMetric(c *gin.Context, tenantID, deviceID, reason string, fieldErrs []service.FieldError, resp gin.H) {
+	if h.QuarantineSvc == nil {
+		return
+	}
+	var raw []byte
+	if v, ok := c.Get(gin.BodyBytesKey); ok {
+		raw, _ = v.([]byte)
+	}
+	id, err := h.QuarantineSvc.Quarantine(c.Request.Context(), service.QuarantineInput{
+		TenantID:  tenantID,
+		DeviceID:  deviceID,
+		Source:    models.QuarantineSourceAPI,
+		Reason:    reason,
+		Errors:    fieldErrs,
+		Payload:   raw,
+		RequestID: logger.RequestIDFromContext(c.Request.Context()),
+	})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Warn("quarantine metric failed", logger.Err(err))
+		return
+	}
+	resp["quarantine_id"] = id
+}
+
+// GetQuarantinedMetrics 查詢隔離區資料，可依 device_id、source、reason、status 與收到時間篩選
+func (h *Handlers) GetQuarantinedMetrics(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	in := service.ListQuarantineInput{
+		TenantID:  tenantID,
+		DeviceID:  c.Query("device_id"),
+		Source:    c.Query("source"),
+		Reason:    c.Query("reason"),
+		Status:    c.Query("status"),
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     limit,
+		Offset:    offset,
+	}
+	// 由 /devices/{deviceId}/quarantine 進入時只查該設備（已通過設備存取檢查）
+	if deviceID := c.Param("deviceId"); deviceID != "" {
+		in.DeviceID = deviceID
+	} else if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		in.AnyTags = p.DeviceTags
+	}
+
+	list, err := h.QuarantineSvc.ListQuarantined(c.Request.Context(), in)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list quarantined metrics failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得隔離資料"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(list),
+		"data":  list,
+	})
+}
+
+// GetQuarantinedMetric 取得單筆隔離資料
+func (h *Handlers) GetQuarantinedMetric(c *gin.Context) {
+	q, ok := h.loadQuarantined(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": q})
+}
+
+// ReinjectQuarantinedMetric 修正隔離資料後重新送入正常的處理流程
+func (h *Handlers) ReinjectQuarantinedMetric(c *gin.Context) {
+	q, ok := h.loadQuarantined(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReinjectQuarantineRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if fieldErrs := bindingFieldErrors(err); len(fieldErrs) > 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": fieldErrs})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求資料", "details": err.Error()})
+			return
+		}
+	}
+
+	resolved, err := h.QuarantineSvc.Reinject(c.Request.Context(), q.TenantID, q.ID, req.Payload, resolvedBy(c))
+	if err != nil {
+		var verr *service.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": verr.Errors})
+		case errors.Is(err, service.ErrInvalidTimestamp):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的時間格式，請使用 RFC3339 格式（例如：2024-01-01T12:00:00Z）"})
+		default:
+			h.respondQuarantineError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "資料已重新注入，將於背景處理",
+		"data":    resolved,
+	})
+}
+
+// DiscardQuarantinedMetric 捨棄隔離資料
+func (h *Handlers) DiscardQuarantinedMetric(c *gin.Context) {
+	q, ok := h.loadQuarantined(c)
+	if !ok {
+		return
+	}
+
+	resolved, err := h.QuarantineSvc.Discard(c.Request.Context(), q.TenantID, q.ID, resolvedBy(c))
+	if err != nil {
+		h.respondQuarantineError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": resolved})
+}
+
+// loadQuarantined 依路徑 id 取得隔離資料，並檢查呼叫者的設備標籤限制
+func (h *Handlers) loadQuarantined(c *gin.Context) (*models.QuarantinedMetric, bool) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的隔離資料 ID"})
+		return nil, false
+	}
+
+	q, err := h.QuarantineSvc.GetQuarantined(c.Request.Context(), tenantID, id)
+	if err != nil {
+		h.respondQuarantineError(c, err)
+		return nil, false
+	}
+
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil && len(p.DeviceTags) > 0 {
+		tags, err := h.DeviceSvc.GetDeviceTags(c.Request.Context(), tenantID, q.DeviceID)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("load device tags failed", logger.Err(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法驗證設備存取權限"})
+			return nil, false
+		}
+		if !p.CanAccessTags(tags) {
+			// 與找不到相同回應，不透露其他設備的資料是否存在
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該隔離資料"})
+			return nil, false
+		}
+	}
+	return q, true
+}
+
+func (h *Handlers) respondQuarantineError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrQuarantineNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該隔離資料"})
+	case errors.Is(err, service.ErrQuarantineResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": "該隔離資料已處理"})
+	default:
+		logger.FromContext(c.Request.Context()).Error("quarantine operation failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理隔離資料"})
+	}
+}
+
+// resolvedBy 記錄處理者；未啟用驗證時為空字串
+func resolvedBy(c *gin.Context) string {
+	if p := auth.PrincipalFromContext(c.Request.Context()); p != nil {
+		return p.Subject
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"iot-data-collection/app/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetThrottledDevices 列出租戶內各設備被限流的累計次數（由多到少）
+func (h *Handlers) GetThrottledDevices(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.Throttle.List(c.Request.Context(), tenantID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list throttle counters failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得限流統計"})
+		return
+	}
+
+	allowed, ok := h.allowedDevices(c, tenantID)
+	if !ok {
+		return
+	}
+	if allowed != nil {
+		visible := list[:0]
+		for _, d := range list {
+			if allowed[d.DeviceID] {
+				visible = append(visible, d)
+			}
+		}
+		list = visible
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(list),
+		"devices": list,
+	})
+}
+
+// ResetThrottledDevices 清除租戶的限流統計
+func (h *Handlers) ResetThrottledDevices(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok || !requireAllDevices(c) {
+		return
+	}
+
+	if err := h.Throttle.Reset(c.Request.Context(), tenantID); err != nil {
+		logger.FromContext(c.Request.Context()).Error("reset throttle counters failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法清除限流統計"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "限流統計已清除"})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceStatusEvents 列出設備的狀態轉換（新到舊），含前一個狀態的持續時間
+func (h *Handlers) GetDeviceStatusEvents(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	list, err := h.StatusEventSvc.ListEvents(c.Request.Context(), service.ListStatusEventsInput{
+		TenantID:  tenantID,
+		DeviceID:  deviceID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list status events failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得狀態轉換紀錄"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"device_id": deviceID,
+		"count":     len(list),
+		"data":      list,
+	})
+}
+
+// GetDeviceAvailability 計算區間內各狀態的停留時間與可用率（預設最近 24 小時）
+func (h *Handlers) GetDeviceAvailability(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	startTime, endTime, err := parseTimeRange(c.Query("start_time"), c.Query("end_time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 start_time 或 end_time 格式，請使用 RFC3339 格式"})
+		return
+	}
+
+	result, err := h.StatusEventSvc.Availability(c.Request.Context(), tenantID, deviceID, startTime, endTime)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_time 必須早於 end_time 與目前時間"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("compute availability failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法計算可用率"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
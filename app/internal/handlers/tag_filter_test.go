@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/ratelimit"
+	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+type taggedDevices struct {
+	service.DeviceService
+	devices map[string]bool
+}
+
+func (f taggedDevices) DevicesWithAnyTag(ctx context.Context, tenantID string, tags []string) (map[string]bool, error) {
+	return f.devices, nil
+}
+
+type fixedThrottle struct {
+	ratelimit.ThrottleCounter
+	reset bool
+}
+
+func (f *fixedThrottle) List(ctx context.Context, tenantID string) ([]ratelimit.DeviceThrottleCount, error) {
+	return []ratelimit.DeviceThrottleCount{{DeviceID: "m1", Throttled: 3}, {DeviceID: "m2", Throttled: 1}}, nil
+}
+
+func (f *fixedThrottle) Reset(ctx context.Context, tenantID string) error {
+	f.reset = true
+	return nil
+}
+
+func TestThrottledDevicesTagFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	throttle := &fixedThrottle{}
+	h := &Handlers{Throttle: throttle, DeviceSvc: taggedDevices{devices: map[string]bool{"m2": true}}}
+
+	serve := func(method string, p *auth.Principal) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			ctx := tenant.WithTenant(c.Request.Context(), "t1")
+			c.Request = c.Request.WithContext(auth.WithPrincipal(ctx, p))
+		})
+		r.GET("/throttled", h.GetThrottledDevices)
+		r.DELETE("/throttled", h.ResetThrottledDevices)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/throttled", nil))
+		return w
+	}
+	restricted := &auth.Principal{Method: auth.MethodJWT, Roles: []auth.Role{auth.RoleAdmin}, DeviceTags: []string{"site-a"}}
+
+	var body struct {
+		Devices []ratelimit.DeviceThrottleCount `json:"devices"`
+	}
+	w := serve(http.MethodGet, restricted)
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Devices) != 1 || body.Devices[0].DeviceID != "m2" {
+		t.Errorf("受標籤限制時只應列出 m2，得到 %d %s", w.Code, w.Body.String())
+	}
+	w = serve(http.MethodGet, &auth.Principal{Method: auth.MethodJWT, Roles: []auth.Role{auth.RoleViewer}})
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Devices) != 2 {
+		t.Errorf("未限制標籤時應列出所有設備，得到 %s", w.Body.String())
+	}
+
+	if w := serve(http.MethodDelete, restricted); w.Code != http.StatusForbidden || throttle.reset {
+		t.Errorf("受標籤限制時不可清除整個租戶的統計，得到 %d", w.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTenant 建立租戶（限平台管理者）
+func (h *Handlers) CreateTenant(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	var req models.CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	t, err := h.TenantSvc.CreateTenant(c.Request.Context(), req.ID, req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "租戶 ID 僅能包含小寫英數字、底線與連字號，長度 1-64"})
+		case errors.Is(err, service.ErrTenantExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "租戶已存在", "tenant_id": req.ID})
+		default:
+			logger.FromContext(c.Request.Context()).Error("create tenant failed", logger.Err(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立租戶"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": t})
+}
+
+// GetTenants 列出所有租戶（限平台管理者）
+func (h *Handlers) GetTenants(c *gin.Context) {
+	if !requirePlatformAdmin(c) {
+		return
+	}
+
+	list, err := h.TenantSvc.ListTenants(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list tenants failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得租戶清單"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(list),
+		"tenants": list,
+	})
+}
+
+// CreateTenantAPIKey 為租戶建立 API key，明文 key 只在此回應中出現一次
+func (h *Handlers) CreateTenantAPIKey(c *gin.Context) {
+	tenantID := c.Param("tenantId")
+	if !requireTenantAdmin(c, tenantID) {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	key, err := h.TenantSvc.CreateAPIKey(c.Request.Context(), tenantID, req.Name)
+	if err != nil {
+		if errors.Is(err, service.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該租戶", "tenant_id": tenantID})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("create api key failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法建立 API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": key})
+}
+
+// GetTenantAPIKeys 列出租戶的 API key（不含明文）
+func (h *Handlers) GetTenantAPIKeys(c *gin.Context) {
+	tenantID := c.Param("tenantId")
+	if !requireTenantAdmin(c, tenantID) {
+		return
+	}
+
+	list, err := h.TenantSvc.ListAPIKeys(c.Request.Context(), tenantID)
+	if err != nil {
+		if errors.Is(err, service.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該租戶", "tenant_id": tenantID})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("list api keys failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得 API key 清單"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant_id": tenantID,
+		"count":     len(list),
+		"api_keys":  list,
+	})
+}
+
+// RevokeTenantAPIKey 撤銷租戶的 API key
+func (h *Handlers) RevokeTenantAPIKey(c *gin.Context) {
+	tenantID := c.Param("tenantId")
+	if !requireTenantAdmin(c, tenantID) {
+		return
+	}
+	keyID, err := strconv.Atoi(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keyId 必須為整數"})
+		return
+	}
+
+	if err := h.TenantSvc.RevokeAPIKey(c.Request.Context(), tenantID, keyID); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到該 API key 或已撤銷"})
+			return
+		}
+		logger.FromContext(c.Request.Context()).Error("revoke api key failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法撤銷 API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key 已撤銷"})
+}
+
+// requirePlatformAdmin 租戶本身的管理只開放給平台管理者（共享管理 token 或帶 platform claim 的 admin）
+func requirePlatformAdmin(c *gin.Context) bool {
+	if auth.PrincipalFromContext(c.Request.Context()).PlatformAdmin() {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "需要平台管理權限"})
+	return false
+}
+
+// requireTenantAdmin 租戶管理者只能管理自己租戶的憑證；平台管理者可管理所有租戶
+func requireTenantAdmin(c *gin.Context, tenantID string) bool {
+	p := auth.PrincipalFromContext(c.Request.Context())
+	if p != nil && p.HasRole(auth.RoleAdmin) && (p.TenantID == tenantID || p.PlatformAdmin()) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     "無權管理該租戶",
+		"tenant_id": tenantID,
+	})
+	return false
+}
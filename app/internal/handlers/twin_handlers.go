@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeviceTwin 取得設備孿生文件（desired / reported 與各自的版本）
+func (h *Handlers) GetDeviceTwin(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	t, err := h.TwinSvc.GetTwin(c.Request.Context(), tenantID, c.Param("deviceId"))
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get device twin failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備孿生文件"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// PatchDeviceTwinDesired 以 JSON Merge Patch 更新 desired 狀態
+func (h *Handlers) PatchDeviceTwinDesired(c *gin.Context) {
+	h.patchDeviceTwin(c, h.TwinSvc.PatchDesired)
+}
+
+// PatchDeviceTwinReported 設備回報目前套用的設定
+func (h *Handlers) PatchDeviceTwinReported(c *gin.Context) {
+	h.patchDeviceTwin(c, h.TwinSvc.PatchReported)
+}
+
+func (h *Handlers) patchDeviceTwin(c *gin.Context, patch func(ctx context.Context, tenantID, deviceID string, req models.PatchTwinRequest) (*models.DeviceTwin, error)) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.PatchTwinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	t, err := patch(c.Request.Context(), tenantID, c.Param("deviceId"), req)
+	if err != nil {
+		var verr *service.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "資料驗證失敗", "fields": verr.Errors})
+		case errors.Is(err, service.ErrTwinVersionConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "版本不符，請重新取得設備孿生文件後再更新"})
+		default:
+			logger.FromContext(c.Request.Context()).Error("patch device twin failed", logger.Err(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法更新設備孿生文件"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": t})
+}
+
+// GetDeviceTwinDelta 取得尚未套用的設定；帶 wait（例如 30s）時長輪詢，
+// 直到 desired 版本大於 since_version 或逾時
+func (h *Handlers) GetDeviceTwinDelta(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+	deviceID := c.Param("deviceId")
+
+	var wait time.Duration
+	if v := c.Query("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 wait，請使用時間長度格式（例如 30s）"})
+			return
+		}
+		wait = d
+	}
+	var since int64
+	if v := c.Query("since_version"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的 since_version"})
+			return
+		}
+		since = n
+	}
+
+	var (
+		delta *models.TwinDelta
+		err   error
+	)
+	if wait > 0 {
+		ctx, cancel := h.longPollContext(c.Request.Context())
+		defer cancel()
+		delta, err = h.TwinSvc.WaitDelta(ctx, tenantID, deviceID, since, wait)
+	} else {
+		delta, err = h.TwinSvc.GetDelta(c.Request.Context(), tenantID, deviceID)
+	}
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("get device twin delta failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得設備孿生差異"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": delta})
+}
+
+// longPollContext 長輪詢使用的 context：請求結束或伺服器開始關閉時取消，
+// 讓關閉流程不必等長輪詢逾時（WaitDelta 取消時回傳目前的差異）
+func (h *Handlers) longPollContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if h.LongPolls == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(h.LongPolls, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetValidationProfiles 列出租戶的驗證設定檔
+func (h *Handlers) GetValidationProfiles(c *gin.Context) {
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.ProfileSvc.ListProfiles(c.Request.Context(), tenantID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("list validation profiles failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得驗證設定檔清單"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    len(list),
+		"profiles": list,
+		"defaults": service.DefaultValidationRules(),
+	})
+}
+
+// GetValidationProfile 取得單一驗證設定檔（scope 為 device-type 或 device）
+func (h *Handlers) GetValidationProfile(c *gin.Context) {
+	scope, target := c.Param("scope"), c.Param("target")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	p, err := h.ProfileSvc.GetProfile(c.Request.Context(), tenantID, scope, target)
+	if err != nil {
+		h.respondProfileError(c, err, scope, target)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": p})
+}
+
+// PutValidationProfile 建立或更新驗證設定檔
+func (h *Handlers) PutValidationProfile(c *gin.Context) {
+	scope, target := c.Param("scope"), c.Param("target")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.PutValidationProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "無效的請求資料",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	p, err := h.ProfileSvc.PutProfile(c.Request.Context(), tenantID, scope, target, req.Rules)
+	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "驗證設定檔無效",
+				"fields": verr.Errors,
+			})
+			return
+		}
+		h.respondProfileError(c, err, scope, target)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": p})
+}
+
+// DeleteValidationProfile 刪除驗證設定檔，設備改回套用上一層（設備類型或預設值）
+func (h *Handlers) DeleteValidationProfile(c *gin.Context) {
+	scope, target := c.Param("scope"), c.Param("target")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	if err := h.ProfileSvc.DeleteProfile(c.Request.Context(), tenantID, scope, target); err != nil {
+		h.respondProfileError(c, err, scope, target)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "驗證設定檔已刪除"})
+}
+
+// GetDeviceValidationProfile 取得設備實際套用的驗證範圍與來源
+func (h *Handlers) GetDeviceValidationProfile(c *gin.Context) {
+	deviceID := c.Param("deviceId")
+	tenantID, ok := requireTenant(c)
+	if !ok {
+		return
+	}
+
+	eff, err := h.ProfileSvc.EffectiveProfile(c.Request.Context(), tenantID, deviceID)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).Error("resolve validation profile failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法取得驗證設定"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": eff})
+}
+
+func (h *Handlers) respondProfileError(c *gin.Context, err error, scope, target string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope 只能是 device-type 或 device", "scope": scope})
+	case errors.Is(err, service.ErrProfileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "找不到該驗證設定檔", "scope": scope, "target": target})
+	default:
+		logger.FromContext(c.Request.Context()).Error("validation profile operation failed", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法處理驗證設定檔"})
+	}
+}
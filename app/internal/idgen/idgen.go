@@ -0,0 +1,18 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// New 產生 32 字元的隨機十六進位 ID，用於 request ID、任務 ID 等
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand 失敗時退回時間戳，確保仍有可辨識的 ID
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
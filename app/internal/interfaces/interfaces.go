@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"time"
 
+	"iot-data-collection/app/internal/models"
 )
 
 type DBClient interface {
@@ -14,26 +15,68 @@ type DBClient interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
+// ReadRoutingDBClient 可將唯讀查詢導向 replica 的 DBClient；Reader 在 replica 不可用時回傳 primary
+type ReadRoutingDBClient interface {
+	DBClient
+	Reader() DBClient
+}
+
 type RedisClient interface {
 	Ping(ctx context.Context) error
 	Get(ctx context.Context, key string) (string, error)
+	// GetMulti 一次讀取多個 key，回傳存在的 key 與值；不存在的 key 不列入
+	GetMulti(ctx context.Context, keys []string) (map[string]string, error)
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Del(ctx context.Context, keys ...string) error
+	// SetIfNewer 以原子操作比較版本，只有 version 不小於目前版本時才寫入；回傳是否已寫入
+	SetIfNewer(ctx context.Context, key string, value interface{}, version int64, expiration time.Duration) (bool, error)
+}
+
+// TieredRedisClient RedisClient 前方另有程序內快取層時提供，可得知值是否由本機記憶體取得
+type TieredRedisClient interface {
+	RedisClient
+	GetTiered(ctx context.Context, key string) (value string, fromMemory bool, err error)
 }
 
 type MetricTask struct {
-	DeviceID    string  `json:"device_id"`
-	Voltage     float64 `json:"voltage"`
-	Current     float64 `json:"current"`
-	Temperature float64 `json:"temperature"`
-	Status      string  `json:"status"`
-	Timestamp   string  `json:"timestamp"`
+	TaskID      string             `json:"task_id"`
+	RequestID   string             `json:"request_id,omitempty"`
+	TenantID    string             `json:"tenant_id"`
+	DeviceID    string             `json:"device_id"`
+	Voltage     *float64           `json:"voltage,omitempty"` // 未回報時為 nil
+	Current     *float64           `json:"current,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Status      string             `json:"status"`
+	Timestamp   string             `json:"timestamp"`
+	ReceivedAt  string             `json:"received_at,omitempty"`      // API 接收時間（RFC3339Nano）
+	DeviceTime  string             `json:"device_timestamp,omitempty"` // 時間戳被校正時為設備回報的原始值
+	Fields      map[string]float64 `json:"fields,omitempty"`
+	Latitude    *float64           `json:"latitude,omitempty"`
+	Longitude   *float64           `json:"longitude,omitempty"`
 }
 
 type MetricQueue interface {
 	Push(ctx context.Context, task *MetricTask) error
 }
 
+// MetricQueueInspector 可查詢積壓任務數的 MetricQueue
+type MetricQueueInspector interface {
+	Len(ctx context.Context) (int64, error)
+}
+
+// Heartbeat 背景元件（例如 worker）最近一次正常運作的時間；尚未運作時為零值
+type Heartbeat interface {
+	LastHeartbeat() time.Time
+}
+
+// MigrationStatusReporter 回報資料庫目前的 schema 版本與此版本程式預期的版本
+type MigrationStatusReporter interface {
+	MigrationStatus(ctx context.Context) (current, expected int, err error)
+}
+
 type HealthHandler interface {
+	// Check 同時檢查 Postgres 與 Redis，任一失敗即回傳錯誤（/health）
 	Check(ctx context.Context) error
+	// Ready 逐項檢查相依並依關鍵程度彙整整體狀態（/readyz）
+	Ready(ctx context.Context) *models.ReadinessReport
 }
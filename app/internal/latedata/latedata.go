@@ -0,0 +1,104 @@
+// Package latedata 判定延遲到達的讀值，並以 Redis hash 統計各設備的延遲與亂序筆數
+package latedata
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// 各租戶的統計 hash（跨 replica 共用），field 為 device ID
+const (
+	LateKeyPrefix       = "iot:late:late:"
+	OutOfOrderKeyPrefix = "iot:late:out_of_order:"
+)
+
+// IsLate 讀值時間戳早於 now - window 視為延遲；window <= 0 時停用
+func IsLate(timestamp, now time.Time, window time.Duration) bool {
+	return window > 0 && now.Sub(timestamp) > window
+}
+
+// DeviceLateCount 單一設備的延遲（超過容許時間）與亂序（早於已知最新一筆）累計筆數
+type DeviceLateCount struct {
+	DeviceID   string `json:"device_id"`
+	Late       int64  `json:"late"`
+	OutOfOrder int64  `json:"out_of_order"`
+}
+
+// Counter 記錄與查詢延遲與亂序筆數
+type Counter interface {
+	IncrLate(ctx context.Context, tenantID, deviceID string) error
+	IncrOutOfOrder(ctx context.Context, tenantID, deviceID string) error
+	List(ctx context.Context, tenantID string) ([]DeviceLateCount, error)
+	Reset(ctx context.Context, tenantID string) error
+}
+
+// RedisCounter 以 Redis hash 實作的 Counter
+type RedisCounter struct {
+	client redisdriver.Cmdable
+}
+
+// NewRedisCounter 建立 Redis 版的 Counter
+func NewRedisCounter(client redisdriver.Cmdable) Counter {
+	return &RedisCounter{client: client}
+}
+
+func (c *RedisCounter) IncrLate(ctx context.Context, tenantID, deviceID string) error {
+	return c.client.HIncrBy(ctx, LateKeyPrefix+tenantID, deviceID, 1).Err()
+}
+
+func (c *RedisCounter) IncrOutOfOrder(ctx context.Context, tenantID, deviceID string) error {
+	return c.client.HIncrBy(ctx, OutOfOrderKeyPrefix+tenantID, deviceID, 1).Err()
+}
+
+// List 依延遲加亂序筆數由多到少排序
+func (c *RedisCounter) List(ctx context.Context, tenantID string) ([]DeviceLateCount, error) {
+	late, err := c.client.HGetAll(ctx, LateKeyPrefix+tenantID).Result()
+	if err != nil {
+		return nil, err
+	}
+	outOfOrder, err := c.client.HGetAll(ctx, OutOfOrderKeyPrefix+tenantID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	byDevice := map[string]*DeviceLateCount{}
+	get := func(deviceID string) *DeviceLateCount {
+		if d, ok := byDevice[deviceID]; ok {
+			return d
+		}
+		d := &DeviceLateCount{DeviceID: deviceID}
+		byDevice[deviceID] = d
+		return d
+	}
+	for deviceID, v := range late {
+		get(deviceID).Late, _ = strconv.ParseInt(v, 10, 64)
+	}
+	for deviceID, v := range outOfOrder {
+		get(deviceID).OutOfOrder, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	list := make([]DeviceLateCount, 0, len(byDevice))
+	for _, d := range byDevice {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].Late+list[i].OutOfOrder, list[j].Late+list[j].OutOfOrder
+		if ti != tj {
+			return ti > tj
+		}
+		return list[i].DeviceID < list[j].DeviceID
+	})
+	return list, nil
+}
+
+func (c *RedisCounter) Reset(ctx context.Context, tenantID string) error {
+	// 兩個 key 在 cluster 模式下可能位於不同 slot，分開刪除
+	if err := c.client.Del(ctx, LateKeyPrefix+tenantID).Err(); err != nil {
+		return err
+	}
+	return c.client.Del(ctx, OutOfOrderKeyPrefix+tenantID).Err()
+}
@@ -0,0 +1,27 @@
+package latedata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsLate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		timestamp time.Time
+		window    time.Duration
+		want      bool
+	}{
+		{"即時", now.Add(-time.Second), 5 * time.Minute, false},
+		{"剛好在容許範圍內", now.Add(-5 * time.Minute), 5 * time.Minute, false},
+		{"超過容許範圍", now.Add(-6 * time.Minute), 5 * time.Minute, true},
+		{"未來時間", now.Add(time.Minute), 5 * time.Minute, false},
+		{"停用", now.Add(-24 * time.Hour), 0, false},
+	}
+	for _, c := range cases {
+		if got := IsLate(c.timestamp, now, c.window); got != c.want {
+			t.Errorf("%s: 期望 %v，得到 %v", c.name, c.want, got)
+		}
+	}
+}
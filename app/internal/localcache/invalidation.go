@@ -0,0 +1,57 @@
+package localcache
+
+import (
+	"context"
+	"log/slog"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel 各 replica 廣播本機快取失效的 Pub/Sub channel，訊息內容為 key
+const InvalidationChannel = "iot:local_cache:invalidate"
+
+// Invalidator 跨 replica 廣播與接收快取失效
+type Invalidator interface {
+	Publish(ctx context.Context, key string) error
+	// Subscribe 持續接收失效訊息直到 ctx 取消
+	Subscribe(ctx context.Context, onInvalidate func(key string))
+}
+
+type pubSubClient interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redisdriver.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redisdriver.PubSub
+}
+
+// RedisInvalidator 以 Redis Pub/Sub 實作的 Invalidator
+type RedisInvalidator struct {
+	client pubSubClient
+}
+
+// NewRedisInvalidator 建立 Redis 版的 Invalidator
+func NewRedisInvalidator(client pubSubClient) Invalidator {
+	return &RedisInvalidator{client: client}
+}
+
+func (i *RedisInvalidator) Publish(ctx context.Context, key string) error {
+	return i.client.Publish(ctx, InvalidationChannel, key).Err()
+}
+
+// Subscribe 連線中斷期間可能漏接訊息，此時本機快取最多保留舊值 TTL 的時間
+func (i *RedisInvalidator) Subscribe(ctx context.Context, onInvalidate func(key string)) {
+	sub := i.client.Subscribe(ctx, InvalidationChannel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("local cache invalidation subscriber stopped")
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				slog.Warn("local cache invalidation channel closed")
+				return
+			}
+			onInvalidate(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package localcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/mocks"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRU(2, time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", "1", c.Seq())
+	c.Add("b", "2", c.Seq())
+	c.Get("a")
+	c.Add("c", "3", c.Seq())
+	if _, ok := c.Get("b"); ok {
+		t.Error("超過容量時應淘汰最久未使用的 key")
+	}
+	if v, ok := c.Get("a"); !ok || v != "1" {
+		t.Errorf("最近使用的 key 不應被淘汰: %q %v", v, ok)
+	}
+
+	// 失效前開始的讀取不應把舊值寫回
+	seq := c.Seq()
+	c.Invalidate("a")
+	if c.Add("a", "stale", seq) {
+		t.Error("失效後不應寫回失效前讀到的值")
+	}
+	if !c.Add("a", "fresh", c.Seq()) {
+		t.Error("失效後開始的讀取應可寫入")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("超過 TTL 的值不應命中")
+	}
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	next := &mocks.MockRedis{GetResult: `{"device_id":"d1"}`}
+	tiered := NewTiered(next, 10, time.Minute, nil, "device_metric:")
+
+	if _, fromMemory, err := tiered.GetTiered(ctx, "device_metric:t:d1:latest"); err != nil || fromMemory {
+		t.Fatalf("第一次讀取應來自 Redis: %v %v", fromMemory, err)
+	}
+	if _, fromMemory, _ := tiered.GetTiered(ctx, "device_metric:t:d1:latest"); !fromMemory {
+		t.Error("第二次讀取應由本機命中")
+	}
+	if _, fromMemory, _ := tiered.GetTiered(ctx, "api_key:x"); fromMemory {
+		t.Error("不符合前綴的 key 不應存在本機")
+	}
+
+	if _, err := tiered.SetIfNewer(ctx, "device_metric:t:d1:latest", "{}", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, fromMemory, _ := tiered.GetTiered(ctx, "device_metric:t:d1:latest"); fromMemory {
+		t.Error("寫入後本機快取應失效")
+	}
+
+	st := tiered.Stats()
+	if st.Memory.Hits != 1 || st.Memory.Misses != 2 || st.Redis.Hits != 2 {
+		t.Errorf("命中統計不符: %+v", st)
+	}
+}
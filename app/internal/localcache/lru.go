@@ -0,0 +1,149 @@
+// Package localcache 在 Redis 快取前加上一層程序內的 LRU 快取，並透過 Redis Pub/Sub 讓各 replica 的本機快取同步失效
+package localcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU 有容量上限與 TTL 的記憶體快取，可同時使用
+//
+// 失效的 key 會留下墓碑（tombstone），讓失效前就開始的讀取不會把舊值寫回快取
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+	seq      uint64 // 每次失效遞增
+	floor    uint64 // 清空或墓碑被淘汰時的序號；早於此序號開始的讀取一律不寫回
+	now      func() time.Time
+}
+
+type entry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+	tombstone bool
+	seq       uint64 // 墓碑建立時的序號
+}
+
+// NewLRU 建立 LRU；capacity 為最多保留的 key 數（含墓碑）
+func NewLRU(capacity int, ttl time.Duration) *LRU {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRU{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get 取得未過期的值
+func (c *LRU) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		return "", false
+	}
+	if e.tombstone {
+		return "", false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Seq 目前的失效序號；讀取下一層前先取得，寫回時交給 Add 比對
+func (c *LRU) Seq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// Add 寫入值；若 key 在 since 之後被失效過則不寫入並回傳 false
+func (c *LRU) Add(key, value string, since uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if since < c.floor {
+		return false
+	}
+	expiresAt := c.now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if e.tombstone && e.seq > since {
+			return false
+		}
+		e.value, e.expiresAt, e.tombstone = value, expiresAt, false
+		c.ll.MoveToFront(el)
+		return true
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	c.evict()
+	return true
+}
+
+// Invalidate 使 key 失效並留下墓碑
+func (c *LRU) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	expiresAt := c.now().Add(c.ttl)
+	for _, key := range keys {
+		if el, ok := c.items[key]; ok {
+			e := el.Value.(*entry)
+			e.value, e.expiresAt, e.tombstone, e.seq = "", expiresAt, true, c.seq
+			c.ll.MoveToFront(el)
+			continue
+		}
+		c.items[key] = c.ll.PushFront(&entry{key: key, expiresAt: expiresAt, tombstone: true, seq: c.seq})
+	}
+	c.evict()
+}
+
+// Purge 清除所有 key；已開始的讀取都不會寫回
+func (c *LRU) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.floor = c.seq
+}
+
+// Len 目前保留的 key 數（不含墓碑）
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, el := range c.items {
+		if !el.Value.(*entry).tombstone {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *LRU) evict() {
+	for c.ll.Len() > c.capacity {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	if e.tombstone && e.seq > c.floor {
+		c.floor = e.seq
+	}
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+}
@@ -0,0 +1,208 @@
+package localcache
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+)
+
+// TierStats 單一快取層的命中統計
+type TierStats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// Stats 各快取層的統計（自程序啟動起累計）；Redis 層只計入本機未命中後的讀取
+type Stats struct {
+	Memory        TierStats `json:"memory"`
+	Redis         TierStats `json:"redis"`
+	Entries       int       `json:"entries"`
+	Capacity      int       `json:"capacity"`
+	TTL           string    `json:"ttl"`
+	Invalidations uint64    `json:"invalidations"` // 收到的失效次數（含本機寫入與其他 replica 的廣播）
+}
+
+type tierCounter struct {
+	hits, misses atomic.Uint64
+}
+
+func (c *tierCounter) stats() TierStats {
+	s := TierStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// Tiered 在 interfaces.RedisClient 前加上本機 LRU；只有符合 prefixes 的 key 會存在本機，其餘直接轉給下一層。
+// 經由 Tiered 寫入或刪除的 key 會在本機失效並廣播給其他 replica
+type Tiered struct {
+	next        interfaces.RedisClient
+	lru         *LRU
+	invalidator Invalidator
+	prefixes    []string
+
+	memory, redis tierCounter
+	invalidations atomic.Uint64
+}
+
+var _ interfaces.TieredRedisClient = (*Tiered)(nil)
+
+// NewTiered 建立 Tiered；invalidator 為 nil 時只在本機失效（單一 replica）
+func NewTiered(next interfaces.RedisClient, capacity int, ttl time.Duration, invalidator Invalidator, prefixes ...string) *Tiered {
+	return &Tiered{
+		next:        next,
+		lru:         NewLRU(capacity, ttl),
+		invalidator: invalidator,
+		prefixes:    prefixes,
+	}
+}
+
+// Start 訂閱其他 replica 的失效廣播直到 ctx 取消
+func (t *Tiered) Start(ctx context.Context) {
+	if t.invalidator == nil {
+		return
+	}
+	go t.invalidator.Subscribe(ctx, func(key string) {
+		t.invalidations.Add(1)
+		t.lru.Invalidate(key)
+	})
+}
+
+func (t *Tiered) cacheable(key string) bool {
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tiered) Ping(ctx context.Context) error {
+	return t.next.Ping(ctx)
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) (string, error) {
+	v, _, err := t.GetTiered(ctx, key)
+	return v, err
+}
+
+// GetTiered 回傳值與是否由本機記憶體取得
+func (t *Tiered) GetTiered(ctx context.Context, key string) (string, bool, error) {
+	if !t.cacheable(key) {
+		v, err := t.next.Get(ctx, key)
+		return v, false, err
+	}
+	if v, ok := t.lru.Get(key); ok {
+		t.memory.hits.Add(1)
+		return v, true, nil
+	}
+	t.memory.misses.Add(1)
+
+	seq := t.lru.Seq()
+	v, err := t.next.Get(ctx, key)
+	if err != nil {
+		t.redis.misses.Add(1)
+		return "", false, err
+	}
+	t.redis.hits.Add(1)
+	t.lru.Add(key, v, seq)
+	return v, false, nil
+}
+
+func (t *Tiered) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	var remote []string
+	for _, key := range keys {
+		if !t.cacheable(key) {
+			remote = append(remote, key)
+			continue
+		}
+		if v, ok := t.lru.Get(key); ok {
+			t.memory.hits.Add(1)
+			result[key] = v
+			continue
+		}
+		t.memory.misses.Add(1)
+		remote = append(remote, key)
+	}
+	if len(remote) == 0 {
+		return result, nil
+	}
+
+	seq := t.lru.Seq()
+	fetched, err := t.next.GetMulti(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range remote {
+		v, ok := fetched[key]
+		if !t.cacheable(key) {
+			if ok {
+				result[key] = v
+			}
+			continue
+		}
+		if !ok {
+			t.redis.misses.Add(1)
+			continue
+		}
+		t.redis.hits.Add(1)
+		t.lru.Add(key, v, seq)
+		result[key] = v
+	}
+	return result, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	err := t.next.Set(ctx, key, value, expiration)
+	t.invalidate(ctx, key)
+	return err
+}
+
+func (t *Tiered) Del(ctx context.Context, keys ...string) error {
+	err := t.next.Del(ctx, keys...)
+	t.invalidate(ctx, keys...)
+	return err
+}
+
+func (t *Tiered) SetIfNewer(ctx context.Context, key string, value interface{}, version int64, expiration time.Duration) (bool, error) {
+	stored, err := t.next.SetIfNewer(ctx, key, value, version, expiration)
+	if stored || err != nil {
+		t.invalidate(ctx, key)
+	}
+	return stored, err
+}
+
+// invalidate 本機立即失效，並廣播給其他 replica；廣播失敗時其他 replica 最多保留舊值 TTL 的時間
+func (t *Tiered) invalidate(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if !t.cacheable(key) {
+			continue
+		}
+		t.lru.Invalidate(key)
+		if t.invalidator == nil {
+			continue
+		}
+		if err := t.invalidator.Publish(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("publish local cache invalidation failed", logger.Err(err))
+		}
+	}
+}
+
+// Stats 各快取層的命中統計
+func (t *Tiered) Stats() Stats {
+	return Stats{
+		Memory:        t.memory.stats(),
+		Redis:         t.redis.stats(),
+		Entries:       t.lru.Len(),
+		Capacity:      t.lru.capacity,
+		TTL:           t.lru.ttl.String(),
+		Invalidations: t.invalidations.Load(),
+	}
+}
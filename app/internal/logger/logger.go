@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 結構化日誌中固定使用的欄位名稱，讓 log pipeline 能依欄位過濾
+const (
+	KeyRequestID = "request_id"
+	KeyTenantID  = "tenant_id"
+	KeyDeviceID  = "device_id"
+	KeyTaskID    = "task_id"
+	KeyError     = "error"
+)
+
+type ctxKey struct{}
+
+// level 由 New 建立的 logger 共用的等級，SetLevel 可於執行期間調整
+var level = new(slog.LevelVar)
+
+// New 依設定建立 logger；level 為 debug/info/warn/error，format 為 json/text。
+// 等級之後可由 SetLevel 調整
+func New(lvl, format string) *slog.Logger {
+	level.Set(ParseLevel(lvl))
+	return newLogger(os.Stdout, level, format)
+}
+
+// SetLevel 調整 New 建立的 logger 的等級（例如收到 SIGHUP 重新載入設定）
+func SetLevel(lvl string) {
+	level.Set(ParseLevel(lvl))
+}
+
+// NewWithWriter 同 New，但可指定輸出位置且等級固定（測試用）
+func NewWithWriter(w io.Writer, level, format string) *slog.Logger {
+	return newLogger(w, ParseLevel(level), format)
+}
+
+func newLogger(w io.Writer, level slog.Leveler, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if strings.EqualFold(format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(h)
+}
+
+// ParseLevel 將字串轉為 slog.Level，無法辨識時回傳 info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithContext 將 logger 放入 context，供下游（service、worker）取用
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext 取出 context 中的 logger，沒有則回傳預設 logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok && l != nil {
+			return l
+		}
+	}
+	return slog.Default()
+}
+
+// Err 產生統一欄位名稱的 error 屬性
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.String(KeyError, "")
+	}
+	return slog.String(KeyError, err.Error())
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 將 request ID 放入 context，讓 service 能帶進佇列任務
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 取出 context 中的 request ID，沒有則回傳空字串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
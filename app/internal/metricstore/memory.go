@@ -0,0 +1,298 @@
+package metricstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"iot-data-collection/app/internal/geo"
+	"iot-data-collection/app/internal/models"
+)
+
+// MemoryStore 以程序內記憶體保存讀值，供開發模式與測試使用；重啟即遺失，也不在 replica 間共用。
+// 沒有設備登記資料：清單的標籤、類型與站點為空，以標籤或站點篩選時沒有符合的設備；
+// 位置取自最近一筆附帶經緯度的讀值
+type MemoryStore struct {
+	mu      sync.RWMutex
+	nextID  int
+	devices map[deviceKey]*memoryDevice
+}
+
+type deviceKey struct{ tenantID, deviceID string }
+
+type memoryDevice struct {
+	readings []models.DeviceMetric // 依時間戳由舊到新，同時間戳依寫入順序
+	location *models.DeviceMetric  // 時間戳最新且附帶經緯度的讀值
+}
+
+// NewMemoryStore 建立記憶體版的 Store
+func NewMemoryStore() Store {
+	return &MemoryStore{devices: map[deviceKey]*memoryDevice{}}
+}
+
+func (s *MemoryStore) Insert(ctx context.Context, m *models.DeviceMetric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(m, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) InsertBatch(ctx context.Context, ms []*models.DeviceMetric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, m := range ms {
+		s.insert(m, now)
+	}
+	return nil
+}
+
+// insert 須持有寫入鎖；保存副本，呼叫端之後修改 m 不影響已保存的資料
+func (s *MemoryStore) insert(m *models.DeviceMetric, now time.Time) {
+	s.nextID++
+	m.ID, m.CreatedAt = s.nextID, now
+	stored := cloneMetric(*m)
+
+	key := deviceKey{m.TenantID, m.DeviceID}
+	dev := s.devices[key]
+	if dev == nil {
+		dev = &memoryDevice{}
+		s.devices[key] = dev
+	}
+	i := sort.Search(len(dev.readings), func(i int) bool { return dev.readings[i].Timestamp.After(stored.Timestamp) })
+	dev.readings = append(dev.readings, models.DeviceMetric{})
+	copy(dev.readings[i+1:], dev.readings[i:])
+	dev.readings[i] = stored
+	if stored.Latitude != nil && stored.Longitude != nil &&
+		(dev.location == nil || !stored.Timestamp.Before(dev.location.Timestamp)) {
+		dev.location = &models.DeviceMetric{Timestamp: stored.Timestamp, Latitude: stored.Latitude, Longitude: stored.Longitude}
+	}
+}
+
+func (s *MemoryStore) Range(ctx context.Context, q RangeQuery) ([]models.DeviceMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []models.DeviceMetric
+	if q.Limit <= 0 {
+		return list, nil
+	}
+	skipped := 0
+	s.eachNewest(q.TenantID, q.DeviceID, q.StartTime, q.EndTime, func(m *models.DeviceMetric) bool {
+		if q.OnlyAnomalies && !m.IsAnomaly {
+			return true
+		}
+		if skipped < q.Offset {
+			skipped++
+			return true
+		}
+		c := cloneMetric(*m)
+		c.Fields = projectFields(c.Fields, q.Fields)
+		list = append(list, c)
+		return len(list) < q.Limit
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) Series(ctx context.Context, q SeriesQuery) ([]models.SeriesPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []models.SeriesPoint
+	if q.Limit <= 0 {
+		return list, nil
+	}
+	s.eachNewest(q.TenantID, q.DeviceID, q.StartTime, q.EndTime, func(m *models.DeviceMetric) bool {
+		if v, ok := fieldValue(m, q.Field); ok {
+			list = append(list, models.SeriesPoint{Timestamp: m.Timestamp, Value: v})
+		}
+		return len(list) < q.Limit
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) Latest(ctx context.Context, tenantID, deviceID string) (*models.DeviceMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dev := s.devices[deviceKey{tenantID, deviceID}]
+	if dev == nil || len(dev.readings) == 0 {
+		return nil, ErrNotFound
+	}
+	m := cloneMetric(dev.readings[len(dev.readings)-1])
+	return &m, nil
+}
+
+func (s *MemoryStore) LatestByDevice(ctx context.Context, tenantID string, deviceIDs []string) (map[string]models.DeviceMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	latest := make(map[string]models.DeviceMetric, len(deviceIDs))
+	for _, id := range deviceIDs {
+		if dev := s.devices[deviceKey{tenantID, id}]; dev != nil && len(dev.readings) > 0 {
+			latest[id] = cloneMetric(dev.readings[len(dev.readings)-1])
+		}
+	}
+	return latest, nil
+}
+
+// ListDevices 與 PostgresStore 相同的篩選與排序規則
+func (s *MemoryStore) ListDevices(ctx context.Context, q DeviceQuery) ([]models.DeviceListResponse, int, error) {
+	if _, ok := sortColumns[q.Sort]; !ok {
+		return nil, 0, ErrInvalidSort
+	}
+	if len(q.AnyTags) > 0 || q.Site != "" {
+		return []models.DeviceListResponse{}, 0, nil
+	}
+
+	s.mu.RLock()
+	devices := []models.DeviceListResponse{}
+	for key, dev := range s.devices {
+		if key.tenantID != q.TenantID || len(dev.readings) == 0 {
+			continue
+		}
+		latest := cloneMetric(dev.readings[len(dev.readings)-1])
+		if q.Status != "" && latest.Status != q.Status {
+			continue
+		}
+		d := models.DeviceListResponse{
+			DeviceID:     key.deviceID,
+			LastUpdated:  latest.Timestamp,
+			LatestStatus: latest.Status,
+			Voltage:      latest.Voltage,
+			Current:      latest.Current,
+			Temperature:  latest.Temperature,
+			Tags:         []string{},
+		}
+		if dev.location != nil {
+			d.Latitude, d.Longitude = floatPtr(*dev.location.Latitude), floatPtr(*dev.location.Longitude)
+		}
+		if q.BBox != nil && (d.Latitude == nil || !q.BBox.Contains(geo.Point{Lat: *d.Latitude, Lon: *d.Longitude})) {
+			continue
+		}
+		devices = append(devices, d)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		var less, greater bool
+		switch q.Sort {
+		case SortLastUpdated:
+			less, greater = a.LastUpdated.Before(b.LastUpdated), a.LastUpdated.After(b.LastUpdated)
+		case SortStatus:
+			less, greater = a.LatestStatus < b.LatestStatus, a.LatestStatus > b.LatestStatus
+		case SortDeviceID:
+			less, greater = a.DeviceID < b.DeviceID, a.DeviceID > b.DeviceID
+		}
+		if q.Sort != "" && q.Desc {
+			less, greater = greater, less
+		}
+		if less || greater {
+			return less
+		}
+		return a.DeviceID < b.DeviceID
+	})
+
+	total := len(devices)
+	if q.Limit > 0 {
+		start, end := min(q.Offset, total), min(q.Offset+q.Limit, total)
+		devices = devices[start:end]
+	}
+	return devices, total, nil
+}
+
+func (s *MemoryStore) Summarize(ctx context.Context, tenantID, deviceID string, start, end time.Time) (*Summary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sum := &Summary{}
+	s.eachNewest(tenantID, deviceID, nil, &end, func(m *models.DeviceMetric) bool {
+		if !m.Timestamp.After(start) {
+			return false
+		}
+		sum.Readings++
+		if m.EnergyDeltaKWh != nil {
+			sum.EnergyKWh += *m.EnergyDeltaKWh
+		}
+		ts := m.Timestamp
+		if sum.Last == nil {
+			sum.Last = &ts
+		}
+		sum.First = &ts
+		return true
+	})
+	return sum, nil
+}
+
+// eachNewest 須持有讀取鎖；依時間戳由新到舊走訪區間 [start, end] 內的讀值，fn 回傳 false 時停止
+func (s *MemoryStore) eachNewest(tenantID, deviceID string, start, end *time.Time, fn func(m *models.DeviceMetric) bool) {
+	dev := s.devices[deviceKey{tenantID, deviceID}]
+	if dev == nil {
+		return
+	}
+	for i := len(dev.readings) - 1; i >= 0; i-- {
+		m := &dev.readings[i]
+		if end != nil && m.Timestamp.After(*end) {
+			continue
+		}
+		if start != nil && m.Timestamp.Before(*start) {
+			return
+		}
+		if !fn(m) {
+			return
+		}
+	}
+}
+
+// fieldValue 取出時間序列欄位的值；未回報的核心欄位與推導功能上線前的資料沒有值
+func fieldValue(m *models.DeviceMetric, field string) (float64, bool) {
+	switch field {
+	case "voltage":
+		return optionalValue(m.Voltage)
+	case "current":
+		return optionalValue(m.Current)
+	case "temperature":
+		return optionalValue(m.Temperature)
+	case "power_w":
+		return optionalValue(m.PowerW)
+	case "energy_kwh":
+		return optionalValue(m.EnergyKWh)
+	}
+	v, ok := m.Fields[field]
+	return v, ok
+}
+
+func optionalValue(p *float64) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	return *p, true
+}
+
+// cloneMetric 複製 map 與指標欄位，避免保存的資料與呼叫端共用
+func cloneMetric(m models.DeviceMetric) models.DeviceMetric {
+	m.Fields = cloneFields(m.Fields)
+	m.AnomalyFields = cloneFields(m.AnomalyFields)
+	for _, p := range []**float64{&m.Voltage, &m.Current, &m.Temperature, &m.PowerW, &m.EnergyDeltaKWh, &m.EnergyKWh, &m.AnomalyScore, &m.Latitude, &m.Longitude} {
+		if *p != nil {
+			*p = floatPtr(**p)
+		}
+	}
+	for _, p := range []**time.Time{&m.ReceivedAt, &m.DeviceTimestamp} {
+		if *p != nil {
+			t := **p
+			*p = &t
+		}
+	}
+	return m
+}
+
+func cloneFields(fields map[string]float64) map[string]float64 {
+	if len(fields) == 0 {
+		return nil
+	}
+	c := make(map[string]float64, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+func floatPtr(v float64) *float64 { return &v }
@@ -0,0 +1,135 @@
+package metricstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/models"
+)
+
+func reading(deviceID, status string, ts time.Time, voltage float64) *models.DeviceMetric {
+	return &models.DeviceMetric{TenantID: "t1", DeviceID: deviceID, Status: status, Timestamp: ts, Voltage: &voltage, Current: floatPtr(1)}
+}
+
+func TestMemoryStoreQueries(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	delta := 0.5
+
+	late := reading("m1", "normal", t0.Add(time.Minute), 221)
+	late.Fields = map[string]float64{"frequency": 60, "pf": 0.9}
+	late.IsAnomaly, late.EnergyDeltaKWh = true, &delta
+	for _, m := range []*models.DeviceMetric{
+		reading("m1", "normal", t0, 220),
+		reading("m1", "warning", t0.Add(2*time.Minute), 222),
+		reading("m2", "error", t0.Add(time.Hour), 230),
+		{TenantID: "t2", DeviceID: "m1", Status: "normal", Timestamp: t0.Add(24 * time.Hour)},
+	} {
+		if err := s.Insert(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 延遲到達的讀值依時間戳排序，不影響最新一筆
+	if err := s.Insert(ctx, late); err != nil || late.ID == 0 {
+		t.Fatalf("寫入應回填 ID: id=%d err=%v", late.ID, err)
+	}
+	late.Fields["frequency"] = 0 // 寫入後修改不影響已保存的資料
+
+	latest, err := s.Latest(ctx, "t1", "m1")
+	if err != nil || *latest.Voltage != 222 {
+		t.Fatalf("最新一筆應為 222V，得到 %+v err=%v", latest, err)
+	}
+	if _, err := s.Latest(ctx, "t1", "missing"); err != ErrNotFound {
+		t.Errorf("沒有讀值應回傳 ErrNotFound，得到 %v", err)
+	}
+
+	list, _ := s.Range(ctx, RangeQuery{TenantID: "t1", DeviceID: "m1", Limit: 2, Offset: 1, Fields: []string{"frequency"}})
+	if len(list) != 2 || *list[0].Voltage != 221 || *list[1].Voltage != 220 {
+		t.Fatalf("應依時間戳由新到舊分頁，得到 %+v", list)
+	}
+	if len(list[0].Fields) != 1 || list[0].Fields["frequency"] != 60 {
+		t.Errorf("只應回傳指定的欄位且不受寫入後修改影響，得到 %v", list[0].Fields)
+	}
+	end := t0.Add(90 * time.Second)
+	if list, _ := s.Range(ctx, RangeQuery{TenantID: "t1", DeviceID: "m1", EndTime: &end, Limit: 10, OnlyAnomalies: true}); len(list) != 1 {
+		t.Errorf("應只有 1 筆異常讀值，得到 %d", len(list))
+	}
+
+	series, _ := s.Series(ctx, SeriesQuery{TenantID: "t1", DeviceID: "m1", Field: "frequency", Limit: 10})
+	if len(series) != 1 || series[0].Value != 60 {
+		t.Errorf("只有帶該欄位的讀值列入序列，得到 %+v", series)
+	}
+
+	sum, _ := s.Summarize(ctx, "t1", "m1", t0, t0.Add(2*time.Minute))
+	if sum.Readings != 2 || sum.EnergyKWh != 0.5 || !sum.First.Equal(t0.Add(time.Minute)) || !sum.Last.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("區間 (start, end] 彙總不符: %+v", sum)
+	}
+
+	devices, total, _ := s.ListDevices(ctx, DeviceQuery{TenantID: "t1", Sort: SortLastUpdated, Desc: true, Limit: 1})
+	if total != 2 || len(devices) != 1 || devices[0].DeviceID != "m2" {
+		t.Errorf("應依最後更新時間由新到舊，得到 total=%d %+v", total, devices)
+	}
+	devices, total, _ = s.ListDevices(ctx, DeviceQuery{TenantID: "t1", Limit: 10, Offset: 5})
+	if total != 2 || len(devices) != 0 {
+		t.Errorf("offset 超過最後一頁時 total 仍應為符合條件的設備數，得到 total=%d %+v", total, devices)
+	}
+	devices, total, _ = s.ListDevices(ctx, DeviceQuery{TenantID: "t1", Status: "warning"})
+	if total != 1 || devices[0].DeviceID != "m1" || *devices[0].Voltage != 222 {
+		t.Errorf("應以最新一筆的狀態篩選，得到 %+v", devices)
+	}
+	if _, _, err := s.ListDevices(ctx, DeviceQuery{TenantID: "t1", Sort: "voltage"}); err != ErrInvalidSort {
+		t.Errorf("不支援的排序欄位應回傳 ErrInvalidSort，得到 %v", err)
+	}
+
+	byDevice, _ := s.LatestByDevice(ctx, "t1", []string{"m1", "m2", "missing"})
+	if len(byDevice) != 2 || *byDevice["m2"].Voltage != 230 {
+		t.Errorf("沒有讀值的設備不應列入，得到 %+v", byDevice)
+	}
+}
+
+func TestMemoryStoreInsertBatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Insert(ctx, reading("b1", "normal", t0.Add(time.Hour), 230)); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []*models.DeviceMetric{
+		reading("b1", "warning", t0.Add(2*time.Hour), 231),
+		reading("b2", "normal", t0, 220),
+		reading("b1", "error", t0, 219), // 比已保存的還舊，不應覆蓋最新狀態
+		reading("b2", "warning", t0.Add(time.Minute), 221),
+	}
+	batch[1].Fields = map[string]float64{"pf": 0.9}
+	if err := s.InsertBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range batch {
+		if m.ID != i+2 || m.CreatedAt.IsZero() {
+			t.Errorf("第 %d 筆應回填 ID %d 與寫入時間，得到 id=%d created=%v", i, i+2, m.ID, m.CreatedAt)
+		}
+	}
+	if batch[1].Fields["pf"] != 0.9 {
+		t.Errorf("批次寫入不應清除自訂欄位，得到 %v", batch[1].Fields)
+	}
+	if list, _ := s.Range(ctx, RangeQuery{TenantID: "t1", DeviceID: "b1", Limit: 10}); len(list) != 3 || *list[2].Voltage != 219 {
+		t.Errorf("b1 應有 3 筆且最舊為 219V，得到 %+v", list)
+	}
+
+	devices, total, _ := s.ListDevices(ctx, DeviceQuery{TenantID: "t1"})
+	if total != 2 || len(devices) != 2 {
+		t.Fatalf("應有 2 個設備，得到 %d", total)
+	}
+	for _, d := range devices {
+		want := map[string]string{"b1": "warning", "b2": "warning"}[d.DeviceID]
+		if d.LatestStatus != want {
+			t.Errorf("%s 最新狀態應為 %s，得到 %s", d.DeviceID, want, d.LatestStatus)
+		}
+	}
+	if devices[0].DeviceID == "b1" && !devices[0].LastUpdated.Equal(t0.Add(2*time.Hour)) {
+		t.Errorf("b1 最後更新時間應為批次中最新一筆，得到 %v", devices[0].LastUpdated)
+	}
+}
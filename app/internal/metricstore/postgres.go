@@ -0,0 +1,493 @@
+package metricstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// PostgresStore 以 device_metrics 保存讀值，設備清單讀取 device_state 並合併 devices 的登記資料。
+// 歷史、序列、清單與彙總查詢在支援讀寫分離時導向 replica；最新一筆讀取 primary
+type PostgresStore struct {
+	db interfaces.DBClient
+}
+
+// NewPostgresStore 建立 Postgres 版的 Store
+func NewPostgresStore(db interfaces.DBClient) Store {
+	return &PostgresStore{db: db}
+}
+
+var sortColumns = map[string]string{
+	"":              "",
+	SortDeviceID:    "st.device_id",
+	SortLastUpdated: "st.last_updated",
+	SortStatus:      "st.latest_status",
+}
+
+// insertColumns 寫入的欄位，與 insertArgs 的順序一致
+const insertColumns = `tenant_id, device_id, voltage, current, temperature, status, fields, timestamp,
+	power_w, energy_delta_kwh, energy_kwh, anomaly_score, is_anomaly, anomaly_fields, is_late, received_at, device_timestamp,
+	latitude, longitude`
+
+// returningColumns 寫入後回讀經 DB 正規化的值（例如 DECIMAL 的精度），與 scanInserted 的順序一致
+const returningColumns = `id, tenant_id, device_id, voltage, current, temperature, status, timestamp, created_at,
+	power_w, energy_delta_kwh, energy_kwh, anomaly_score, is_anomaly, is_late, received_at, device_timestamp,
+	latitude, longitude`
+
+// Insert 以單一語句寫入讀值並更新 device_state，兩者同時成功或失敗，設備清單不會停留在舊狀態
+func (p *PostgresStore) Insert(ctx context.Context, m *models.DeviceMetric) error {
+	args, err := insertArgs(m)
+	if err != nil {
+		return err
+	}
+	query := `
+		WITH ins AS (
+			INSERT INTO device_metrics (` + insertColumns + `) VALUES (` + placeholders(1, len(args)) + `)
+			RETURNING ` + returningColumns + `
+		), state AS (` + upsertState + ` SELECT tenant_id, device_id, id, timestamp, status, voltage, current, temperature FROM ins` + upsertStateConflict + `)
+		SELECT ` + returningColumns + ` FROM ins`
+	return scanInserted(p.db.QueryRow(query, args...), m)
+}
+
+// insertBatchSize 單一語句最多寫入的筆數；每筆 20 個參數，低於 Postgres 單一語句 65535 個參數的上限
+const insertBatchSize = 1000
+
+// InsertBatch 以多列 INSERT 寫入，每 insertBatchSize 筆一個語句；同一語句的讀值與 device_state 同時成功或失敗，
+// 後面的語句失敗時前面已寫入的讀值不會復原，錯誤中附上已寫入的筆數
+func (p *PostgresStore) InsertBatch(ctx context.Context, ms []*models.DeviceMetric) error {
+	for start := 0; start < len(ms); start += insertBatchSize {
+		if err := p.insertChunk(ms[start:min(start+insertBatchSize, len(ms))]); err != nil {
+			if start > 0 {
+				return fmt.Errorf("已寫入 %d 筆後失敗: %w", start, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// insertChunk 以單一語句寫入多筆讀值，並以每個設備時間戳最新的一筆更新 device_state。
+// ID 先由 sequence 取得再寫入，回讀的資料依 ID 對應回 ms，不依賴 RETURNING 的順序
+func (p *PostgresStore) insertChunk(ms []*models.DeviceMetric) error {
+	ids, err := p.nextIDs(len(ms))
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]*models.DeviceMetric, len(ms))
+	values := make([]string, len(ms))
+	var args []interface{}
+	for i, m := range ms {
+		a, err := insertArgs(m)
+		if err != nil {
+			return err
+		}
+		a = append([]interface{}{ids[i]}, a...)
+		values[i] = "(" + placeholders(len(args)+1, len(a)) + ")"
+		args = append(args, a...)
+		byID[ids[i]] = m
+	}
+	rows, err := p.db.Query(`
+		WITH ins AS (
+			INSERT INTO device_metrics (id, `+insertColumns+`) VALUES `+strings.Join(values, ", ")+`
+			RETURNING `+returningColumns+`
+		), newest AS (
+			SELECT DISTINCT ON (tenant_id, device_id) * FROM ins ORDER BY tenant_id, device_id, timestamp DESC, id DESC
+		), state AS (`+upsertState+` SELECT tenant_id, device_id, id, timestamp, status, voltage, current, temperature FROM newest`+upsertStateConflict+`)
+		SELECT `+returningColumns+` FROM ins`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	scanned := 0
+	for rows.Next() {
+		var got models.DeviceMetric
+		if err := scanInserted(rows, &got); err != nil {
+			return err
+		}
+		m, ok := byID[got.ID]
+		if !ok {
+			return fmt.Errorf("寫入回傳未預期的 id %d", got.ID)
+		}
+		got.Fields, got.AnomalyFields = m.Fields, m.AnomalyFields
+		*m = got
+		scanned++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if scanned != len(ms) {
+		return fmt.Errorf("寫入 %d 筆但回傳 %d 筆", len(ms), scanned)
+	}
+	return nil
+}
+
+// nextIDs 預先取得 n 個 device_metrics 的 ID
+func (p *PostgresStore) nextIDs(n int) ([]int, error) {
+	rows, err := p.db.Query(`SELECT nextval(pg_get_serial_sequence('device_metrics', 'id')) FROM generate_series(1, $1)`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int, 0, n)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// upsertState 與 upsertStateConflict 維護設備清單使用的最新狀態；以讀值時間戳比較，延遲或補傳的舊讀值不會覆蓋
+const upsertState = `
+			INSERT INTO device_state (tenant_id, device_id, metric_id, last_updated, latest_status, voltage, current, temperature)`
+
+const upsertStateConflict = `
+			ON CONFLICT (tenant_id, device_id) DO UPDATE
+			SET metric_id = EXCLUDED.metric_id, last_updated = EXCLUDED.last_updated, latest_status = EXCLUDED.latest_status,
+				voltage = EXCLUDED.voltage, current = EXCLUDED.current, temperature = EXCLUDED.temperature,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE device_state.last_updated <= EXCLUDED.last_updated
+		`
+
+func (p *PostgresStore) Range(ctx context.Context, q RangeQuery) ([]models.DeviceMetric, error) {
+	query := `SELECT ` + deviceMetricColumns + ` FROM device_metrics WHERE tenant_id = $1 AND device_id = $2`
+	if q.OnlyAnomalies {
+		query += " AND is_anomaly"
+	}
+	args := []interface{}{q.TenantID, q.DeviceID}
+	query += timeRange(&args, q.StartTime, q.EndTime)
+	query += " ORDER BY timestamp DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := p.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.DeviceMetric
+	for rows.Next() {
+		d, err := scanDeviceMetric(rows, q.Fields)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *d)
+	}
+	return list, rows.Err()
+}
+
+func (p *PostgresStore) Series(ctx context.Context, q SeriesQuery) ([]models.SeriesPoint, error) {
+	// 核心欄位直接讀取欄位，其他欄位讀取 JSONB（名稱以參數傳入，不拼接進 SQL）
+	valueExpr, fieldFilter := "(fields->>$3)::double precision", " AND fields ? $3"
+	args := []interface{}{q.TenantID, q.DeviceID, q.Field}
+	if isCoreField(q.Field) || isDerivedField(q.Field) {
+		// 核心欄位可能未回報，推導功能上線前的資料沒有推導值
+		valueExpr, fieldFilter = q.Field, " AND "+q.Field+" IS NOT NULL"
+		args = args[:2]
+	}
+
+	query := "SELECT timestamp, " + valueExpr + " FROM device_metrics WHERE tenant_id = $1 AND device_id = $2" + fieldFilter
+	query += timeRange(&args, q.StartTime, q.EndTime)
+	query += " ORDER BY timestamp DESC LIMIT $" + strconv.Itoa(len(args)+1)
+	args = append(args, q.Limit)
+
+	rows, err := p.reader().Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.SeriesPoint
+	for rows.Next() {
+		var pt models.SeriesPoint
+		if err := rows.Scan(&pt.Timestamp, &pt.Value); err != nil {
+			return nil, err
+		}
+		list = append(list, pt)
+	}
+	return list, rows.Err()
+}
+
+func (p *PostgresStore) Latest(ctx context.Context, tenantID, deviceID string) (*models.DeviceMetric, error) {
+	m, err := scanDeviceMetric(p.db.QueryRow(`
+		SELECT `+deviceMetricColumns+`
+		FROM device_metrics
+		WHERE tenant_id = $1 AND device_id = $2
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, tenantID, deviceID), nil)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// LatestByDevice 每個設備以索引查詢最新一筆，不掃描整個 device_metrics
+func (p *PostgresStore) LatestByDevice(ctx context.Context, tenantID string, deviceIDs []string) (map[string]models.DeviceMetric, error) {
+	latest := make(map[string]models.DeviceMetric, len(deviceIDs))
+	if len(deviceIDs) == 0 {
+		return latest, nil
+	}
+	rows, err := p.reader().Query(`
+		SELECT `+deviceMetricColumns+` FROM device_metrics m
+		JOIN unnest($2::VARCHAR[]) AS ids(device_id) ON true
+		WHERE m.id = (
+			SELECT id FROM device_metrics
+			WHERE tenant_id = $1 AND device_id = ids.device_id
+			ORDER BY timestamp DESC LIMIT 1
+		)
+	`, tenantID, pq.Array(deviceIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanDeviceMetric(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		latest[m.DeviceID] = *m
+	}
+	return latest, rows.Err()
+}
+
+// ListDevices 由 device_state 取得各設備最新狀態，不掃描 device_metrics；
+// 分頁時另外計算總數，offset 超過最後一頁時 total 仍為符合條件的設備數
+func (p *PostgresStore) ListDevices(ctx context.Context, q DeviceQuery) ([]models.DeviceListResponse, int, error) {
+	sortColumn, ok := sortColumns[q.Sort]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+	from := `
+		FROM device_state st
+		LEFT JOIN devices d ON d.tenant_id = st.tenant_id AND d.device_id = st.device_id
+		WHERE st.tenant_id = $1
+	`
+	args := []interface{}{q.TenantID}
+	add := func(cond string, v interface{}) string {
+		args = append(args, v)
+		return strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1)
+	}
+	if len(q.AnyTags) > 0 {
+		from += add(" AND d.tags && ?", pq.Array(q.AnyTags))
+	}
+	if q.Status != "" {
+		from += add(" AND st.latest_status = ?", q.Status)
+	}
+	if q.Site != "" {
+		from += add(" AND d.site = ?", q.Site)
+	}
+	if b := q.BBox; b != nil {
+		from += add(" AND d.latitude BETWEEN ?", b.MinLat) + add(" AND ?", b.MaxLat)
+		if b.CrossesAntimeridian() {
+			from += add(" AND (d.longitude >= ?", b.MinLon) + add(" OR d.longitude <= ?)", b.MaxLon)
+		} else {
+			from += add(" AND d.longitude BETWEEN ?", b.MinLon) + add(" AND ?", b.MaxLon)
+		}
+	}
+	filterArgs := len(args)
+
+	query := `
+		SELECT
+			st.device_id,
+			st.last_updated,
+			st.latest_status,
+			st.voltage,
+			st.current,
+			st.temperature,
+			COALESCE(d.tags, '{}'),
+			COALESCE(d.device_type, ''),
+			d.latitude,
+			d.longitude,
+			COALESCE(d.site, '')
+	` + from
+	direction := " ASC"
+	if q.Desc {
+		direction = " DESC"
+	}
+	if sortColumn != "" {
+		query += " ORDER BY " + sortColumn + direction + ", st.device_id"
+	} else {
+		query += " ORDER BY st.device_id"
+	}
+	if q.Limit > 0 {
+		query += add(" LIMIT ?", q.Limit) + add(" OFFSET ?", q.Offset)
+	}
+
+	rows, err := p.reader().Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	devices := []models.DeviceListResponse{}
+	for rows.Next() {
+		var d models.DeviceListResponse
+		if err := rows.Scan(&d.DeviceID, &d.LastUpdated, &d.LatestStatus, &d.Voltage, &d.Current, &d.Temperature,
+			pq.Array(&d.Tags), &d.DeviceType, &d.Latitude, &d.Longitude, &d.Site); err != nil {
+			return nil, 0, err
+		}
+		devices = append(devices, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if q.Limit <= 0 {
+		return devices, len(devices), nil
+	}
+
+	var total int
+	if err := p.reader().QueryRow(`SELECT COUNT(*)`+from, args[:filterArgs]...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return devices, total, nil
+}
+
+func (p *PostgresStore) Summarize(ctx context.Context, tenantID, deviceID string, start, end time.Time) (*Summary, error) {
+	s := &Summary{}
+	var first, last sql.NullTime
+	err := p.reader().QueryRow(`
+		SELECT COALESCE(SUM(energy_delta_kwh), 0), COUNT(*), MIN(timestamp), MAX(timestamp)
+		FROM device_metrics
+		WHERE tenant_id = $1 AND device_id = $2 AND timestamp > $3 AND timestamp <= $4
+	`, tenantID, deviceID, start, end).Scan(&s.EnergyKWh, &s.Readings, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+	if first.Valid {
+		s.First = &first.Time
+	}
+	if last.Valid {
+		s.Last = &last.Time
+	}
+	return s, nil
+}
+
+// reader 唯讀查詢使用的連線；db 支援讀寫分離時導向 replica，可接受些許複寫延遲
+func (p *PostgresStore) reader() interfaces.DBClient {
+	if r, ok := p.db.(interfaces.ReadRoutingDBClient); ok {
+		return r.Reader()
+	}
+	return p.db
+}
+
+// timeRange 附加時間區間條件（兩端皆包含）
+func timeRange(args *[]interface{}, start, end *time.Time) string {
+	cond := ""
+	if start != nil {
+		*args = append(*args, *start)
+		cond += " AND timestamp >= $" + strconv.Itoa(len(*args))
+	}
+	if end != nil {
+		*args = append(*args, *end)
+		cond += " AND timestamp <= $" + strconv.Itoa(len(*args))
+	}
+	return cond
+}
+
+// placeholders 產生 $from 起的 n 個參數位置
+func placeholders(from, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = "$" + strconv.Itoa(from+i)
+	}
+	return strings.Join(p, ", ")
+}
+
+// insertArgs 依 insertColumns 的順序取出寫入值；空的 JSONB 欄位寫入 '{}' 與 NULL
+func insertArgs(m *models.DeviceMetric) ([]interface{}, error) {
+	fieldsJSON := []byte("{}")
+	if len(m.Fields) > 0 {
+		var err error
+		if fieldsJSON, err = json.Marshal(m.Fields); err != nil {
+			return nil, err
+		}
+	}
+	var anomalyFields interface{}
+	if len(m.AnomalyFields) > 0 {
+		b, err := json.Marshal(m.AnomalyFields)
+		if err != nil {
+			return nil, err
+		}
+		anomalyFields = string(b)
+	}
+	return []interface{}{m.TenantID, m.DeviceID, m.Voltage, m.Current, m.Temperature, m.Status, string(fieldsJSON), m.Timestamp,
+		m.PowerW, m.EnergyDeltaKWh, m.EnergyKWh, m.AnomalyScore, m.IsAnomaly, anomalyFields, m.IsLate, m.ReceivedAt, m.DeviceTimestamp,
+		m.Latitude, m.Longitude}, nil
+}
+
+// scanInserted 讀取 returningColumns；JSONB 欄位沿用寫入的值
+func scanInserted(row rowScanner, m *models.DeviceMetric) error {
+	return row.Scan(&m.ID, &m.TenantID, &m.DeviceID, &m.Voltage, &m.Current,
+		&m.Temperature, &m.Status, &m.Timestamp, &m.CreatedAt,
+		&m.PowerW, &m.EnergyDeltaKWh, &m.EnergyKWh, &m.AnomalyScore, &m.IsAnomaly, &m.IsLate,
+		&m.ReceivedAt, &m.DeviceTimestamp, &m.Latitude, &m.Longitude)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// deviceMetricColumns 與 scanDeviceMetric 的欄位順序一致
+const deviceMetricColumns = `id, tenant_id, device_id, voltage, current, temperature, status, fields, timestamp, created_at,
+	power_w, energy_delta_kwh, energy_kwh, anomaly_score, is_anomaly, anomaly_fields, is_late, received_at, device_timestamp, latitude, longitude`
+
+// scanDeviceMetric 讀取 deviceMetricColumns；onlyFields 非空時只保留指定的其他量測欄位
+func scanDeviceMetric(row rowScanner, onlyFields []string) (*models.DeviceMetric, error) {
+	var d models.DeviceMetric
+	var fieldsJSON, anomalyJSON []byte
+	if err := row.Scan(&d.ID, &d.TenantID, &d.DeviceID, &d.Voltage, &d.Current,
+		&d.Temperature, &d.Status, &fieldsJSON, &d.Timestamp, &d.CreatedAt,
+		&d.PowerW, &d.EnergyDeltaKWh, &d.EnergyKWh, &d.AnomalyScore, &d.IsAnomaly, &anomalyJSON,
+		&d.IsLate, &d.ReceivedAt, &d.DeviceTimestamp, &d.Latitude, &d.Longitude); err != nil {
+		return nil, err
+	}
+	var err error
+	if d.Fields, err = decodeFields(fieldsJSON, onlyFields); err != nil {
+		return nil, err
+	}
+	if d.AnomalyFields, err = decodeFields(anomalyJSON, nil); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// decodeFields 解析 JSONB 欄位；only 非空時只保留指定欄位
+func decodeFields(raw []byte, only []string) (map[string]float64, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var fields map[string]float64
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return projectFields(fields, only), nil
+}
+
+// projectFields only 非空時只保留指定欄位；沒有欄位時回傳 nil
+func projectFields(fields map[string]float64, only []string) map[string]float64 {
+	if len(only) > 0 {
+		projected := make(map[string]float64, len(only))
+		for _, name := range only {
+			if v, ok := fields[name]; ok {
+				projected[name] = v
+			}
+		}
+		fields = projected
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,104 @@
+package metricstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"iot-data-collection/app/internal/geo"
+	"iot-data-collection/app/internal/models"
+)
+
+// ErrNotFound 設備尚無任何讀值
+var ErrNotFound = errors.New("metric not found")
+
+// ErrInvalidSort 不支援的設備清單排序欄位
+var ErrInvalidSort = errors.New("invalid device sort")
+
+// 設備清單的排序欄位
+const (
+	SortDeviceID    = "device_id"
+	SortLastUpdated = "last_updated"
+	SortStatus      = "status"
+)
+
+// RangeQuery 單一設備在時間區間內的讀值，依時間戳由新到舊；區間兩端皆包含，未設定時不限制
+type RangeQuery struct {
+	TenantID      string
+	DeviceID      string
+	StartTime     *time.Time
+	EndTime       *time.Time
+	Limit         int
+	Offset        int
+	Fields        []string // 非空時只回傳指定的其他量測欄位
+	OnlyAnomalies bool
+}
+
+// SeriesQuery 單一欄位的時間序列；Field 可為核心欄位、推導欄位或設備類型宣告的欄位，呼叫端須先檢查名稱格式
+type SeriesQuery struct {
+	TenantID  string
+	DeviceID  string
+	Field     string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+}
+
+// DeviceQuery 租戶內各設備最新狀態的清單；各篩選條件可同時使用
+type DeviceQuery struct {
+	TenantID string
+	AnyTags  []string
+	Status   string
+	Site     string
+	BBox     *geo.BBox
+	Sort     string // 見 Sort*；空字串時依 device ID
+	Desc     bool
+	Limit    int // 0 表示不分頁
+	Offset   int
+}
+
+// Summary 區間內讀值的彙總
+type Summary struct {
+	Readings  int
+	EnergyKWh float64 // 各筆電能增量的加總
+	First     *time.Time
+	Last      *time.Time
+}
+
+// Store 保存設備讀值並提供查詢。寫入同時維護設備清單使用的最新狀態，延遲或補傳的舊讀值不會覆蓋較新的狀態
+type Store interface {
+	// Insert 寫入一筆讀值，並回填 ID 與寫入時間
+	Insert(ctx context.Context, m *models.DeviceMetric) error
+	// InsertBatch 一次寫入多筆讀值並回填 ID 與寫入時間；各設備的最新狀態只依該批時間戳最新的一筆更新
+	InsertBatch(ctx context.Context, ms []*models.DeviceMetric) error
+	Range(ctx context.Context, q RangeQuery) ([]models.DeviceMetric, error)
+	Series(ctx context.Context, q SeriesQuery) ([]models.SeriesPoint, error)
+	// Latest 設備時間戳最新的一筆；尚無讀值時回傳 ErrNotFound
+	Latest(ctx context.Context, tenantID, deviceID string) (*models.DeviceMetric, error)
+	// LatestByDevice 多個設備各自最新的一筆，沒有讀值的設備不列入
+	LatestByDevice(ctx context.Context, tenantID string, deviceIDs []string) (map[string]models.DeviceMetric, error)
+	// ListDevices 回傳一頁設備與符合條件的總數
+	ListDevices(ctx context.Context, q DeviceQuery) ([]models.DeviceListResponse, int, error)
+	// Summarize 彙總區間 (start, end] 內的讀值
+	Summarize(ctx context.Context, tenantID, deviceID string, start, end time.Time) (*Summary, error)
+}
+
+// isCoreField 是否為以獨立欄位儲存的核心量測值
+func isCoreField(name string) bool {
+	for _, f := range models.CoreMetricFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isDerivedField 是否為 worker 推導的欄位
+func isDerivedField(name string) bool {
+	for _, f := range models.DerivedMetricFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
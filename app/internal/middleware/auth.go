@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader 設備與服務帳號傳遞 API key 的 HTTP header
+const APIKeyHeader = "X-API-Key"
+
+// AdminTokenHeader 管理 API 使用的 token header
+const AdminTokenHeader = "X-Admin-Token"
+
+// MethodAdminToken 以共享管理 token 通過驗證的呼叫者
+const MethodAdminToken = "admin_token"
+
+// APIKeyResolver 以 API key 查詢 key 資訊與租戶（由 service.TenantService 實作）
+type APIKeyResolver interface {
+	ResolveAPIKey(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+// DeviceTagLookup 查詢設備標籤（由 service.DeviceService 實作）
+type DeviceTagLookup interface {
+	GetDeviceTags(ctx context.Context, tenantID, deviceID string) ([]string, error)
+}
+
+// Authenticate 驗證呼叫者並決定所屬租戶：
+//   - Authorization: Bearer <JWT>：以 verifier 驗證，租戶取自 tenant claim
+//   - X-API-Key：租戶 API key，視為該租戶的 operator
+//   - 皆未提供：requireCredentials 為 false 時以匿名身分歸屬預設租戶
+func Authenticate(resolver APIKeyResolver, verifier *auth.Verifier, requireCredentials bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var p *auth.Principal
+		if bearer, ok := bearerToken(c.GetHeader("Authorization")); ok {
+			if verifier == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "未啟用 JWT 驗證"})
+				return
+			}
+			claims, err := verifier.Verify(bearer)
+			if err != nil {
+				msg := "無效的存取權杖"
+				if errors.Is(err, auth.ErrTokenExpired) {
+					msg = "存取權杖已過期"
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": msg})
+				return
+			}
+			if p, err = auth.PrincipalFromClaims(claims); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "存取權杖必須指定 tenant"})
+				return
+			}
+		} else if key := c.GetHeader(APIKeyHeader); key != "" {
+			apiKey, err := resolver.ResolveAPIKey(ctx, key)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "無效的 API key"})
+					return
+				}
+				logger.FromContext(ctx).Error("resolve api key failed", logger.Err(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "無法驗證 API key"})
+				return
+			}
+			p = &auth.Principal{
+				Subject:  "api_key:" + strconv.Itoa(apiKey.ID),
+				TenantID: apiKey.TenantID,
+				Method:   auth.MethodAPIKey,
+				Roles:    []auth.Role{auth.RoleOperator},
+				APIKeyID: apiKey.ID,
+			}
+		} else if requireCredentials {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "缺少 API key 或存取權杖"})
+			return
+		} else {
+			p = &auth.Principal{TenantID: tenant.DefaultTenantID, Method: auth.MethodAnonymous}
+		}
+
+		l := logger.FromContext(ctx).With(slog.String(logger.KeyTenantID, p.TenantID))
+		if p.Subject != "" {
+			l = l.With(slog.String("subject", p.Subject))
+		}
+		ctx = tenant.WithTenant(ctx, p.TenantID)
+		ctx = auth.WithPrincipal(ctx, p)
+		c.Request = c.Request.WithContext(logger.WithContext(ctx, l))
+		c.Next()
+	}
+}
+
+// Authorizer 依角色與設備標籤授權；Enabled 為 false（未設定 JWT 金鑰）時不做角色檢查，
+// 維持導入 RBAC 前讀取端點公開的行為，但 admin 端點仍需以 API key 驗證，不對匿名呼叫者開放
+type Authorizer struct {
+	Enabled bool
+	Devices DeviceTagLookup
+}
+
+// RequireRole 要求呼叫者至少具有 role 角色
+func (a *Authorizer) RequireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.PrincipalFromContext(c.Request.Context())
+		if !a.Enabled && role != auth.RoleAdmin {
+			c.Next()
+			return
+		}
+		if p == nil || p.Method == auth.MethodAnonymous {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "需要登入"})
+			return
+		}
+		if a.Enabled && !p.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":         "權限不足",
+				"required_role": role,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireDeviceAccess 檢查呼叫者的設備標籤限制是否涵蓋 :deviceId
+func (a *Authorizer) RequireDeviceAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := auth.PrincipalFromContext(c.Request.Context())
+		if !a.Enabled || p == nil || len(p.DeviceTags) == 0 {
+			c.Next()
+			return
+		}
+		deviceID := c.Param("deviceId")
+		tags, err := a.Devices.GetDeviceTags(c.Request.Context(), p.TenantID, deviceID)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Error("lookup device tags failed", logger.Err(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "無法驗證設備權限"})
+			return
+		}
+		if !p.CanAccessTags(tags) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":     "無權存取該設備",
+				"device_id": deviceID,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminAccess 保護管理 API：接受共享管理 token，或（啟用 RBAC 時）具 admin 角色的呼叫者。
+// 需放在 Authenticate 之後
+func (a *Authorizer) AdminAccess(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := c.GetHeader(AdminTokenHeader)
+		if token != "" && got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			p := &auth.Principal{TenantID: tenant.DefaultTenantID, Method: MethodAdminToken, Roles: []auth.Role{auth.RoleAdmin}, Platform: true}
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+			c.Next()
+			return
+		}
+
+		p := auth.PrincipalFromContext(c.Request.Context())
+		if !a.Enabled || p == nil || p.Method == auth.MethodAnonymous {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "需要管理權限"})
+			return
+		}
+		if !p.HasRole(auth.RoleAdmin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":         "權限不足",
+				"required_role": auth.RoleAdmin,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return strings.TrimSpace(header[len(prefix):]), true
+	}
+	return "", false
+}
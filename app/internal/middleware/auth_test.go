@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeResolver map[string]string
+
+func (f fakeResolver) ResolveAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	if id, ok := f[key]; ok {
+		return &models.APIKey{ID: 1, TenantID: id}, nil
+	}
+	return nil, service.ErrInvalidAPIKey
+}
+
+func newTenantTestRouter(requireAPIKey bool, gotTenant *string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Authenticate(fakeResolver{"key-a": "tenant-a"}, nil, requireAPIKey))
+	r.GET("/ping", func(c *gin.Context) {
+		*gotTenant, _ = tenant.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestAuthenticate_ResolvesAPIKey(t *testing.T) {
+	var got string
+	r := newTenantTestRouter(true, &got)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(APIKeyHeader, "key-a")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || got != "tenant-a" {
+		t.Errorf("期望 200 與 tenant-a，得到 %d / %q", w.Code, got)
+	}
+}
+
+func TestAuthenticate_InvalidAPIKey(t *testing.T) {
+	var got string
+	r := newTenantTestRouter(false, &got)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(APIKeyHeader, "wrong")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("期望 401，得到 %d", w.Code)
+	}
+}
+
+func TestAuthenticate_MissingAPIKey(t *testing.T) {
+	var got string
+	w := httptest.NewRecorder()
+	newTenantTestRouter(true, &got).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("必須帶 API key 時期望 401，得到 %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	newTenantTestRouter(false, &got).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if w.Code != http.StatusOK || got != tenant.DefaultTenantID {
+		t.Errorf("未強制 API key 時期望歸屬預設租戶，得到 %d / %q", w.Code, got)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authz := &Authorizer{Enabled: true}
+
+	cases := []struct {
+		name      string
+		principal *auth.Principal
+		want      int
+	}{
+		{"匿名", &auth.Principal{Method: auth.MethodAnonymous}, http.StatusUnauthorized},
+		{"viewer 無法寫入", &auth.Principal{Method: auth.MethodJWT, Roles: []auth.Role{auth.RoleViewer}}, http.StatusForbidden},
+		{"operator 可寫入", &auth.Principal{Method: auth.MethodJWT, Roles: []auth.Role{auth.RoleOperator}}, http.StatusOK},
+		{"admin 涵蓋 operator", &auth.Principal{Method: auth.MethodJWT, Roles: []auth.Role{auth.RoleAdmin}}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), tc.principal))
+			})
+			r.POST("/write", authz.RequireRole(auth.RoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/write", nil))
+			if w.Code != tc.want {
+				t.Errorf("期望 %d，得到 %d", tc.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireRoleWithoutRBAC(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authz := &Authorizer{Enabled: false}
+
+	cases := []struct {
+		name      string
+		principal *auth.Principal
+		role      auth.Role
+		want      int
+	}{
+		{"匿名可讀取", &auth.Principal{Method: auth.MethodAnonymous}, auth.RoleViewer, http.StatusOK},
+		{"匿名不可使用 admin 端點", &auth.Principal{Method: auth.MethodAnonymous}, auth.RoleAdmin, http.StatusUnauthorized},
+		{"API key 可使用 admin 端點", &auth.Principal{Method: auth.MethodAPIKey, Roles: []auth.Role{auth.RoleOperator}}, auth.RoleAdmin, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), tc.principal))
+			})
+			r.POST("/write", authz.RequireRole(tc.role), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/write", nil))
+			if w.Code != tc.want {
+				t.Errorf("期望 %d，得到 %d", tc.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceTypeLookup 查詢設備類型（由 service.DeviceService 實作）
+type DeviceTypeLookup interface {
+	GetDeviceType(ctx context.Context, tenantID, deviceID string) (string, error)
+}
+
+// RateLimit 對設備資料回報套用兩層 token bucket：每個設備一個、每個呼叫端（API key / JWT subject / IP）一個。
+// 回應帶有 RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset（取較嚴格的 bucket），超過限制回傳 429。
+// Redis 無法使用時放行（fail open），避免限流器本身造成資料遺失。policy 於每次請求時取得，替換後立即生效
+func RateLimit(limiter ratelimit.Limiter, policies ratelimit.PolicySource, devices DeviceTypeLookup, counter ratelimit.ThrottleCounter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy *ratelimit.Policy
+		if policies != nil {
+			policy = policies.Current()
+		}
+		if policy == nil || !policy.Enabled {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		log := logger.FromContext(ctx)
+
+		p := auth.PrincipalFromContext(ctx)
+		tenantID, clientKey, apiKeyID := "", "ip:"+c.ClientIP(), 0
+		if p != nil {
+			tenantID = p.TenantID
+			apiKeyID = p.APIKeyID
+			if p.Subject != "" {
+				clientKey = p.Subject
+			}
+		}
+		deviceID := c.Param("deviceId")
+
+		deviceType := ""
+		if deviceID != "" && len(policy.DeviceTypeOverrides) > 0 {
+			t, err := devices.GetDeviceType(ctx, tenantID, deviceID)
+			if err != nil {
+				log.Warn("lookup device type for rate limit failed", logger.Err(err))
+			}
+			deviceType = t
+		}
+
+		var results []*ratelimit.Result
+		deviceThrottled := false
+		if limit := policy.DeviceLimit(tenantID, deviceID, deviceType); deviceID != "" && !limit.Unlimited() {
+			res, err := limiter.Allow(ctx, "device:"+tenantID+":"+deviceID, limit)
+			if err != nil {
+				log.Warn("device rate limit check failed, allowing request", logger.Err(err))
+			} else {
+				results = append(results, res)
+				deviceThrottled = !res.Allowed
+			}
+		}
+		if limit := policy.ClientLimit(apiKeyID); !limit.Unlimited() {
+			res, err := limiter.Allow(ctx, "client:"+tenantID+":"+clientKey, limit)
+			if err != nil {
+				log.Warn("client rate limit check failed, allowing request", logger.Err(err))
+			} else {
+				results = append(results, res)
+			}
+		}
+
+		strictest, allowed := mergeResults(results)
+		if strictest != nil {
+			setRateLimitHeaders(c, strictest)
+		}
+		if allowed {
+			c.Next()
+			return
+		}
+
+		if deviceThrottled {
+			if err := counter.Incr(ctx, tenantID, deviceID); err != nil {
+				log.Warn("increment throttle counter failed", logger.Err(err))
+			}
+		}
+		retryAfter := int(math.Ceil(strictest.RetryAfter.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		log.Warn("request rate limited",
+			slog.String("client", clientKey),
+			slog.Bool("device_limited", deviceThrottled),
+			slog.Int("retry_after", retryAfter))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "請求過於頻繁，請稍後再試",
+			"retry_after": retryAfter,
+		})
+	}
+}
+
+// mergeResults 回傳最嚴格的結果：有被拒絕的 bucket 時取等待最久者，否則取剩餘最少者
+func mergeResults(results []*ratelimit.Result) (*ratelimit.Result, bool) {
+	var strictest *ratelimit.Result
+	allowed := true
+	for _, r := range results {
+		if !r.Allowed {
+			if allowed || strictest.RetryAfter < r.RetryAfter {
+				strictest = r
+			}
+			allowed = false
+			continue
+		}
+		if allowed && (strictest == nil || r.Remaining < strictest.Remaining) {
+			strictest = r
+		}
+	}
+	return strictest, allowed
+}
+
+func setRateLimitHeaders(c *gin.Context, r *ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(r.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(r.ResetAfter.Seconds()))))
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeLimiter 依 key 前綴決定是否放行
+type fakeLimiter struct {
+	deny map[string]bool
+}
+
+func (f *fakeLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (*ratelimit.Result, error) {
+	if f.deny[key] {
+		return &ratelimit.Result{Allowed: false, Limit: limit.Burst, RetryAfter: 1500 * time.Millisecond, ResetAfter: 3 * time.Second}, nil
+	}
+	return &ratelimit.Result{Allowed: true, Limit: limit.Burst, Remaining: limit.Burst - 1, ResetAfter: time.Second}, nil
+}
+
+type fakeCounter struct{ incr map[string]int }
+
+func (f *fakeCounter) Incr(ctx context.Context, tenantID, deviceID string) error {
+	f.incr[deviceID]++
+	return nil
+}
+
+func (f *fakeCounter) List(ctx context.Context, tenantID string) ([]ratelimit.DeviceThrottleCount, error) {
+	return nil, nil
+}
+
+func (f *fakeCounter) Reset(ctx context.Context, tenantID string) error { return nil }
+
+type fakeDeviceTypes struct{}
+
+func (fakeDeviceTypes) GetDeviceType(ctx context.Context, tenantID, deviceID string) (string, error) {
+	return "", nil
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := &ratelimit.Policy{
+		Enabled:       true,
+		DeviceDefault: ratelimit.Limit{Rate: 1, Burst: 5},
+		ClientDefault: ratelimit.Limit{Rate: 10, Burst: 100},
+	}
+	limiter := &fakeLimiter{deny: map[string]bool{"device::noisy": true}}
+	counter := &fakeCounter{incr: map[string]int{}}
+
+	r := gin.New()
+	r.POST("/devices/:deviceId/metrics", RateLimit(limiter, policy, fakeDeviceTypes{}, counter), func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/quiet/metrics", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("期望 202，得到 %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "5" || w.Header().Get("RateLimit-Remaining") != "4" {
+		t.Errorf("應回報較嚴格的設備 bucket，得到 limit=%s remaining=%s",
+			w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/noisy/metrics", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("期望 429，得到 %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "2" {
+		t.Errorf("期望 Retry-After: 2，得到 %q", w.Header().Get("Retry-After"))
+	}
+	if counter.incr["noisy"] != 1 {
+		t.Errorf("期望設備限流次數為 1，得到 %d", counter.incr["noisy"])
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"iot-data-collection/app/internal/idgen"
+	"iot-data-collection/app/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 用於傳遞 request ID 的 HTTP header
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey gin.Context 中存放 request ID 的 key
+const RequestIDKey = "request_id"
+
+// RequestID 為每個請求指定 request ID（沿用上游傳入的 X-Request-ID），
+// 並把帶有 request_id 欄位的 logger 放入 request context
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = idgen.New()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		l := slog.Default().With(slog.String(logger.KeyRequestID, requestID))
+		if deviceID := c.Param("deviceId"); deviceID != "" {
+			l = l.With(slog.String(logger.KeyDeviceID, deviceID))
+		}
+		ctx := logger.WithContext(c.Request.Context(), l)
+		ctx = logger.WithRequestID(ctx, requestID)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
+
+// AccessLog 以結構化格式記錄每個請求（取代 gin 預設的文字 logger）
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String(logger.KeyError, c.Errors.String()))
+		}
+		logger.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "http request", attrs...)
+	}
+}
+
+// Recovery 攔截 panic 並以結構化格式記錄，回傳 500
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logger.FromContext(c.Request.Context()).Error("panic recovered",
+			slog.Any("panic", recovered),
+			slog.String("path", c.FullPath()),
+		)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "伺服器內部錯誤"})
+	})
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"iot-data-collection/app/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID_PropagatesHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+
+	var gotID string
+	r.GET("/ping", func(c *gin.Context) {
+		gotID = logger.RequestIDFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	r.ServeHTTP(w, req)
+
+	if gotID != "abc-123" {
+		t.Errorf("期望 context 中的 request ID 為 abc-123，得到 %q", gotID)
+	}
+	if w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("期望回應 header 帶回 request ID，得到 %q", w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRequestID_GeneratesWhenMissing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	if len(w.Header().Get(RequestIDHeader)) != 32 {
+		t.Errorf("期望自動產生 32 字元 request ID，得到 %q", w.Header().Get(RequestIDHeader))
+	}
+}
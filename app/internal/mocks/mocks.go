@@ -42,6 +42,8 @@ type MockRedis struct {
 	SetErr       error
 	DelResult    int64
 	DelErr       error
+	SetIfNewerSkipped bool // true 時模擬版本較舊而未寫入
+	SetIfNewerErr     error
 }
 
 func (m *MockRedis) Ping(ctx context.Context) error {
@@ -52,6 +54,17 @@ func (m *MockRedis) Get(ctx context.Context, key string) (string, error) {
 	return m.GetResult, m.GetErr
 }
 
+func (m *MockRedis) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	if m.GetErr != nil {
+		return map[string]string{}, nil
+	}
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		result[key] = m.GetResult
+	}
+	return result, nil
+}
+
 func (m *MockRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return m.SetErr
 }
@@ -60,6 +73,13 @@ func (m *MockRedis) Del(ctx context.Context, keys ...string) error {
 	return m.DelErr
 }
 
+func (m *MockRedis) SetIfNewer(ctx context.Context, key string, value interface{}, version int64, expiration time.Duration) (bool, error) {
+	if m.SetIfNewerErr != nil {
+		return false, m.SetIfNewerErr
+	}
+	return !m.SetIfNewerSkipped, nil
+}
+
 // MockMetricQueue 模擬 MetricQueue，用於測試
 type MockMetricQueue struct {
 	PushErr error
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// AnomalySettings 設備的異常偵測設定（EWMA z-score）
+type AnomalySettings struct {
+	TenantID   string    `json:"tenant_id" db:"tenant_id"`
+	DeviceID   string    `json:"device_id" db:"device_id"`
+	Enabled    bool      `json:"enabled" db:"enabled"`
+	Alpha      float64   `json:"alpha" db:"alpha"`             // EWMA 平滑係數
+	Threshold  float64   `json:"threshold" db:"threshold"`     // |z| 超過此值視為異常
+	MinSamples int       `json:"min_samples" db:"min_samples"` // 暖機樣本數
+	Fields     []string  `json:"fields" db:"fields"`           // 偵測的欄位（核心欄位或設備類型宣告的欄位）
+	Alert      bool      `json:"alert" db:"alert"`             // 偵測到異常時是否送出告警
+	UpdatedAt  time.Time `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// PutAnomalySettingsRequest 未提供的數值參數使用預設值
+type PutAnomalySettingsRequest struct {
+	Enabled    bool     `json:"enabled"`
+	Alpha      float64  `json:"alpha" binding:"omitempty,gt=0,lte=1"`
+	Threshold  float64  `json:"threshold" binding:"omitempty,gt=0,lte=100"`
+	MinSamples int      `json:"min_samples" binding:"omitempty,gte=2,lte=100000"`
+	Fields     []string `json:"fields" binding:"max=32"`
+	Alert      *bool    `json:"alert"` // 預設 true
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 指令狀態：pending → delivered → succeeded / failed；未在期限內完成則為 expired
+const (
+	CommandStatusPending   = "pending"
+	CommandStatusDelivered = "delivered"
+	CommandStatusSucceeded = "succeeded"
+	CommandStatusFailed    = "failed"
+	CommandStatusExpired   = "expired"
+)
+
+// DeviceCommand 雲端對設備的指令（例如 reboot、set_interval、clear_fault）
+type DeviceCommand struct {
+	ID          int64           `json:"id" db:"id"`
+	TenantID    string          `json:"tenant_id" db:"tenant_id"`
+	DeviceID    string          `json:"device_id" db:"device_id"`
+	Name        string          `json:"name" db:"name"`
+	Payload     json.RawMessage `json:"payload,omitempty" db:"payload"`
+	Status      string          `json:"status" db:"status"`
+	Result      json.RawMessage `json:"result,omitempty" db:"result"` // 設備回報的執行結果
+	CreatedBy   string          `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at" db:"expires_at"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// CreateCommandRequest 建立指令；TTLSeconds 未提供時預設 1 小時，最長 7 天
+type CreateCommandRequest struct {
+	Name       string          `json:"name" binding:"required,max=64"`
+	Payload    json.RawMessage `json:"payload"`
+	TTLSeconds int             `json:"ttl_seconds" binding:"omitempty,gte=1,lte=604800"`
+}
+
+// AckCommandRequest 設備回報指令執行結果
+type AckCommandRequest struct {
+	Status string          `json:"status" binding:"required,oneof=succeeded failed"`
+	Result json.RawMessage `json:"result"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// DeviceGroup 設備群組，可形成階層（例如站點 → 建物 → 配電盤）；每個設備最多屬於一個群組
+type DeviceGroup struct {
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
+	ID          string    `json:"id" db:"id"`
+	ParentID    string    `json:"parent_id,omitempty" db:"parent_id"`
+	Name        string    `json:"name" db:"name"`
+	Kind        string    `json:"kind,omitempty" db:"kind"` // 例如 site、building、panel，僅供顯示
+	DeviceCount int       `json:"device_count"`             // 直接指派到此群組的設備數（不含子群組）
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// PutDeviceGroupRequest 建立或更新群組；ParentID 為空表示最上層
+type PutDeviceGroupRequest struct {
+	Name     string `json:"name" binding:"required,max=255"`
+	Kind     string `json:"kind" binding:"max=32"`
+	ParentID string `json:"parent_id" binding:"max=64"`
+}
+
+// SetDeviceGroupRequest GroupID 為空表示移出群組
+type SetDeviceGroupRequest struct {
+	GroupID string `json:"group_id" binding:"max=64"`
+}
+
+// GroupSummary 群組內各設備最新一筆讀值的彙總
+type GroupSummary struct {
+	GroupID        string         `json:"group_id"`
+	Recursive      bool           `json:"recursive"` // 是否包含子群組的設備
+	Devices        int            `json:"devices"`
+	Reporting      int            `json:"reporting"`     // 有最新讀值的設備數
+	StatusCounts   map[string]int `json:"status_counts"` // 依最新狀態分類；尚無讀值的設備計入 unknown
+	TotalCurrent   float64        `json:"total_current"`
+	TotalPowerW    float64        `json:"total_power_w"`
+	AvgVoltage     *float64       `json:"avg_voltage,omitempty"`
+	MaxTemperature *float64       `json:"max_temperature,omitempty"`
+	MaxTempDevice  string         `json:"max_temperature_device,omitempty"`
+	OldestReading  *time.Time     `json:"oldest_reading,omitempty"` // 各設備最新讀值中最舊的一筆，用來判斷資料新鮮度
+	CacheHits      int            `json:"cache_hits"`               // 由最新值快取取得的設備數，其餘由 DB 補齊
+}
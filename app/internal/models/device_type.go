@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// 欄位資料型別
+const (
+	FieldTypeNumber  = "number"
+	FieldTypeInteger = "integer"
+)
+
+// CoreMetricFields 以獨立欄位儲存的核心量測值，其餘欄位存於 device_metrics.fields（JSONB）
+var CoreMetricFields = []string{"voltage", "current", "temperature"}
+
+// DerivedMetricFields 由 worker 推導並以獨立欄位儲存的值，可用於時間序列查詢
+var DerivedMetricFields = []string{"power_w", "energy_kwh"}
+
+// FieldSpec 設備類型宣告的量測欄位
+type FieldSpec struct {
+	Name     string   `json:"name" binding:"required,max=64"`
+	Type     string   `json:"type" binding:"required,oneof=number integer"`
+	Unit     string   `json:"unit,omitempty" binding:"max=32"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Required bool     `json:"required"`
+}
+
+// DeviceType 設備類型及其量測欄位 schema
+type DeviceType struct {
+	TenantID    string      `json:"tenant_id" db:"tenant_id"`
+	Name        string      `json:"name" db:"name"`
+	Description string      `json:"description" db:"description"`
+	Fields      []FieldSpec `json:"fields" db:"fields"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// Field 依名稱取得欄位定義
+func (t *DeviceType) Field(name string) (FieldSpec, bool) {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldSpec{}, false
+}
+
+type PutDeviceTypeRequest struct {
+	Description string      `json:"description" binding:"max=255"`
+	Fields      []FieldSpec `json:"fields" binding:"max=64,dive"`
+}
+
+// SeriesPoint 單一欄位的時間序列資料點
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// FleetSummary 租戶所有設備的總覽，供監控牆定期刷新
+type FleetSummary struct {
+	GeneratedAt    time.Time            `json:"generated_at"`
+	Devices        int                  `json:"devices"`
+	Online         int                  `json:"online"`
+	Offline        int                  `json:"offline"`       // 超過 OfflineAfter 未回報（或從未回報）的設備
+	OfflineAfter   string               `json:"offline_after"` // 離線判定門檻
+	StatusCounts   map[string]int       `json:"status_counts"` // 依最新狀態分類；尚無讀值的設備計入 unknown
+	Hottest        []FleetDeviceReading `json:"hottest"`
+	HighestCurrent []FleetDeviceReading `json:"highest_current"`
+	Ingested       FleetIngestion       `json:"ingested"`
+	CacheHits      int                  `json:"cache_hits"` // 由最新值快取取得的設備數
+}
+
+// FleetDeviceReading 排行中的單一設備
+type FleetDeviceReading struct {
+	DeviceID  string    `json:"device_id"`
+	Value     float64   `json:"value"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FleetIngestion 最近一小時與一天寫入的讀值筆數（依寫入時間）
+type FleetIngestion struct {
+	LastHour int64 `json:"last_hour"`
+	LastDay  int64 `json:"last_day"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 就緒檢查狀態
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded" // 部分功能受影響，仍可接收流量
+	HealthDown     = "down"
+)
+
+// 就緒檢查項目名稱，亦用於 HEALTH_CRITICAL_CHECKS
+const (
+	CheckPostgres        = "postgres"
+	CheckPostgresReplica = "postgres_replica"
+	CheckRedis           = "redis"
+	CheckQueue           = "queue"
+	CheckWorker          = "worker"
+	CheckMigrations      = "migrations"
+)
+
+// ReadinessCheckNames 所有就緒檢查項目
+var ReadinessCheckNames = []string{CheckPostgres, CheckPostgresReplica, CheckRedis, CheckQueue, CheckWorker, CheckMigrations}
+
+// ReadinessReport /readyz 的回應：任一關鍵（critical）項目 down 時整體為 down，其餘項目異常時為 degraded
+type ReadinessReport struct {
+	Status    string            `json:"status"`
+	Message   string            `json:"message,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Checks    []DependencyCheck `json:"checks"`
+}
+
+// DependencyCheck 單一相依項目的檢查結果
+type DependencyCheck struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMS float64                `json:"latency_ms"`
+	Message   string                 `json:"message,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
@@ -3,26 +3,110 @@ package models
 import "time"
 
 type DeviceMetric struct {
-	ID          int       `json:"id" db:"id"`
-	DeviceID    string    `json:"device_id" db:"device_id"`
-	Voltage     float64   `json:"voltage" db:"voltage"`
-	Current     float64   `json:"current" db:"current"`
-	Temperature float64   `json:"temperature" db:"temperature"`
-	Status      string    `json:"status" db:"status"`
-	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ID          int                `json:"id" db:"id"`
+	TenantID    string             `json:"tenant_id" db:"tenant_id"`
+	DeviceID    string             `json:"device_id" db:"device_id"`
+	Voltage     *float64           `json:"voltage,omitempty" db:"voltage"` // 核心量測值；設備類型未要求時可為 null
+	Current     *float64           `json:"current,omitempty" db:"current"`
+	Temperature *float64           `json:"temperature,omitempty" db:"temperature"`
+	Status      string             `json:"status" db:"status"`
+	Fields      map[string]float64 `json:"fields,omitempty" db:"fields"` // 設備類型宣告的其他量測欄位
+	// 由 worker 推導的欄位；推導功能上線前的資料為 null
+	PowerW         *float64 `json:"power_w,omitempty" db:"power_w"`
+	EnergyDeltaKWh *float64 `json:"energy_delta_kwh,omitempty" db:"energy_delta_kwh"`
+	EnergyKWh      *float64 `json:"energy_kwh,omitempty" db:"energy_kwh"`
+	// 異常偵測結果；未啟用偵測或暖機中的讀值 AnomalyScore 為 null
+	AnomalyScore    *float64           `json:"anomaly_score,omitempty" db:"anomaly_score"`
+	IsAnomaly       bool               `json:"is_anomaly" db:"is_anomaly"`
+	AnomalyFields   map[string]float64 `json:"anomaly_fields,omitempty" db:"anomaly_fields"` // 各欄位的 z-score
+	IsLate          bool               `json:"is_late" db:"is_late"`                         // 超過容許延遲才到達
+	Timestamp       time.Time          `json:"timestamp" db:"timestamp"`
+	ReceivedAt      *time.Time         `json:"received_at,omitempty" db:"received_at"`           // 伺服器接收時間
+	DeviceTimestamp *time.Time         `json:"device_timestamp,omitempty" db:"device_timestamp"` // 時間戳被校正時為設備回報的原始時間
+	Latitude        *float64           `json:"latitude,omitempty" db:"latitude"`
+	Longitude       *float64           `json:"longitude,omitempty" db:"longitude"`
+	CreatedAt       time.Time          `json:"created_at" db:"created_at"`
 }
 
+// EnergyReport 設備在區間內的用電量
+type EnergyReport struct {
+	DeviceID    string     `json:"device_id"`
+	Period      string     `json:"period,omitempty"` // day / week / month / year；自訂區間時為空
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	EnergyKWh   float64    `json:"energy_kwh"`
+	Readings    int        `json:"readings"`
+	FirstReadAt *time.Time `json:"first_read_at,omitempty"`
+	LastReadAt  *time.Time `json:"last_read_at,omitempty"`
+}
+
+type ResetEnergyResponse struct {
+	DeviceID string    `json:"device_id"`
+	ResetAt  time.Time `json:"reset_at"`
+}
+
+// CreateDeviceMetricRequest 設備回報資料；核心量測值是否必填依設備類型 schema 決定（未設定類型時皆為必填），
+// 數值範圍依設備的驗證設定檔在 service 層檢查
 type CreateDeviceMetricRequest struct {
-	Voltage     float64 `json:"voltage" binding:"required,min=100,max=240"`
-	Current     float64 `json:"current" binding:"required,min=0,max=100"`
-	Temperature float64 `json:"temperature" binding:"required,min=0,max=100"`
-	Status      string  `json:"status" binding:"required,oneof=normal warning error"`
-	Timestamp   string  `json:"timestamp,omitempty"`
+	Voltage     *float64           `json:"voltage,omitempty"`
+	Current     *float64           `json:"current,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Status      string             `json:"status" binding:"required,oneof=normal warning error"`
+	Timestamp   string             `json:"timestamp,omitempty"`
+	Fields      map[string]float64 `json:"fields,omitempty" binding:"max=64"` // 依設備類型 schema 驗證的其他量測欄位
+	// 行動設備回報的位置，須同時提供經緯度
+	Latitude  *float64 `json:"latitude,omitempty" binding:"omitempty,gte=-90,lte=90,required_with=Longitude"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"omitempty,gte=-180,lte=180,required_with=Latitude"`
 }
 
 type DeviceListResponse struct {
 	DeviceID     string    `json:"device_id"`
 	LastUpdated  time.Time `json:"last_updated"`
 	LatestStatus string    `json:"latest_status"`
+	Voltage      *float64  `json:"voltage,omitempty"` // 最新一筆的讀值
+	Current      *float64  `json:"current,omitempty"`
+	Temperature  *float64  `json:"temperature,omitempty"`
+	Tags         []string  `json:"tags"`
+	DeviceType   string    `json:"device_type"`
+	Latitude     *float64  `json:"latitude,omitempty"`
+	Longitude    *float64  `json:"longitude,omitempty"`
+	Site         string    `json:"site,omitempty"`
+	DistanceM    *float64  `json:"distance_m,omitempty"` // 半徑查詢時與中心點的距離（公尺）
+}
+
+type SetDeviceTypeRequest struct {
+	DeviceType string `json:"device_type" binding:"max=64"`
+}
+
+type SetDeviceTagsRequest struct {
+	Tags []string `json:"tags" binding:"required,max=32,dive,max=64"`
+}
+
+type Tenant struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateTenantRequest struct {
+	ID   string `json:"id" binding:"required,max=64"`
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type APIKey struct {
+	ID        int        `json:"id" db:"id"`
+	TenantID  string     `json:"tenant_id" db:"tenant_id"`
+	Name      string     `json:"name" db:"name"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"max=255"`
+}
+
+// CreateAPIKeyResponse 建立 API key 的回應，明文 key 只會在此回傳一次
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
 }
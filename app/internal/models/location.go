@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// DeviceLocation 設備位置；固定設備由管理者設定，行動設備由回報資料中最新的座標更新
+type DeviceLocation struct {
+	DeviceID  string     `json:"device_id" db:"device_id"`
+	Latitude  *float64   `json:"latitude" db:"latitude"`
+	Longitude *float64   `json:"longitude" db:"longitude"`
+	Site      string     `json:"site,omitempty" db:"site"` // 例如變電站名稱
+	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"location_updated_at"`
+}
+
+type SetDeviceLocationRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"required,gte=-90,lte=90"`
+	Longitude *float64 `json:"longitude" binding:"required,gte=-180,lte=180"`
+	Site      string   `json:"site" binding:"max=128"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 隔離資料的來源
+const (
+	QuarantineSourceAPI    = "api"    // 接收端驗證失敗
+	QuarantineSourceWorker = "worker" // 寫入 DB 時違反限制
+)
+
+// 隔離原因
+const (
+	QuarantineReasonInvalidPayload = "invalid_payload" // JSON 格式或必填欄位錯誤
+	QuarantineReasonValidation     = "validation"      // 超出驗證設定檔範圍或不符 schema
+	QuarantineReasonConstraint     = "constraint"      // DB CHECK / 數值溢位
+)
+
+// 隔離資料的處理狀態
+const (
+	QuarantineStatusPending     = "pending"
+	QuarantineStatusReinjecting = "reinjecting" // 已認領、重新注入中
+	QuarantineStatusReinjected  = "reinjected"
+	QuarantineStatusDiscarded   = "discarded"
+)
+
+// QuarantinedMetric 被拒絕的原始回報資料，保留供診斷與修正後重新注入
+type QuarantinedMetric struct {
+	ID               int64           `json:"id" db:"id"`
+	TenantID         string          `json:"tenant_id" db:"tenant_id"`
+	DeviceID         string          `json:"device_id" db:"device_id"`
+	Source           string          `json:"source" db:"source"`
+	Reason           string          `json:"reason" db:"reason"`
+	Errors           json.RawMessage `json:"errors" db:"errors"`   // 逐欄位錯誤或 DB 錯誤訊息
+	Payload          json.RawMessage `json:"payload" db:"payload"` // 原始內容；非合法 JSON 時以字串保存
+	RequestID        string          `json:"request_id,omitempty" db:"request_id"`
+	ReceivedAt       time.Time       `json:"received_at" db:"received_at"`
+	Status           string          `json:"status" db:"status"`
+	CorrectedPayload json.RawMessage `json:"corrected_payload,omitempty" db:"corrected_payload"`
+	ResolvedAt       *time.Time      `json:"resolved_at,omitempty" db:"resolved_at"`
+	ResolvedBy       string          `json:"resolved_by,omitempty" db:"resolved_by"`
+}
+
+// ReinjectQuarantineRequest 重新注入隔離資料；未提供 payload 時沿用原始內容
+type ReinjectQuarantineRequest struct {
+	Payload *CreateDeviceMetricRequest `json:"payload"`
+}
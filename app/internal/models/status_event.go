@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// DeviceStatusEvent 設備狀態轉換（例如 normal → warning）
+type DeviceStatusEvent struct {
+	ID         int64  `json:"id" db:"id"`
+	TenantID   string `json:"tenant_id" db:"tenant_id"`
+	DeviceID   string `json:"device_id" db:"device_id"`
+	FromStatus string `json:"from_status" db:"from_status"` // 設備首次回報時為空
+	ToStatus   string `json:"to_status" db:"to_status"`
+	// ChangedAt 為觸發轉換的讀值時間戳
+	ChangedAt time.Time `json:"changed_at" db:"changed_at"`
+	// PreviousDurationMS 前一個狀態持續的時間；首次回報時為 null
+	PreviousDurationMS *int64    `json:"previous_duration_ms,omitempty" db:"previous_duration_ms"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+}
+
+// StatusAvailability 設備在區間內各狀態的停留時間與可用率
+type StatusAvailability struct {
+	DeviceID  string    `json:"device_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// ObservedSeconds 區間內狀態已知的時間；設備首次回報前的時間不計入
+	ObservedSeconds float64            `json:"observed_seconds"`
+	TimeInState     map[string]float64 `json:"time_in_state"`    // 各狀態的秒數
+	StatePercent    map[string]float64 `json:"state_percent"`    // 各狀態佔 ObservedSeconds 的百分比
+	AvailabilityPct *float64           `json:"availability_pct"` // 非 error 狀態佔 ObservedSeconds 的百分比；無觀測時間時為 null
+	Transitions     int                `json:"transitions"`      // 區間內的狀態轉換次數
+	CurrentStatus   string             `json:"current_status,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"iot-data-collection/app/internal/twin"
+)
+
+// DeviceTwin 設備孿生文件：desired 由操作人員設定，reported 由設備回報或資料寫入時更新；
+// 兩側各自有版本號，內容有變更時遞增
+type DeviceTwin struct {
+	TenantID          string        `json:"tenant_id" db:"tenant_id"`
+	DeviceID          string        `json:"device_id" db:"device_id"`
+	Desired           twin.Document `json:"desired" db:"desired"`
+	DesiredVersion    int64         `json:"desired_version" db:"desired_version"`
+	DesiredUpdatedAt  *time.Time    `json:"desired_updated_at,omitempty" db:"desired_updated_at"`
+	Reported          twin.Document `json:"reported" db:"reported"`
+	ReportedVersion   int64         `json:"reported_version" db:"reported_version"`
+	ReportedUpdatedAt *time.Time    `json:"reported_updated_at,omitempty" db:"reported_updated_at"`
+}
+
+// TwinDelta desired 中尚未反映在 reported 的設定
+type TwinDelta struct {
+	DeviceID        string        `json:"device_id"`
+	DesiredVersion  int64         `json:"desired_version"`
+	ReportedVersion int64         `json:"reported_version"`
+	Delta           twin.Document `json:"delta"`
+	InSync          bool          `json:"in_sync"`
+}
+
+// PatchTwinRequest 以 JSON Merge Patch 更新 desired 或 reported；
+// Version 有值時只在目前版本相同時套用（樂觀鎖），否則回傳 409
+type PatchTwinRequest struct {
+	Patch   twin.Document `json:"patch" binding:"required"`
+	Version *int64        `json:"version"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// 驗證設定檔的套用範圍
+const (
+	ProfileScopeDeviceType = "device-type"
+	ProfileScopeDevice     = "device"
+	ProfileScopeDefault    = "default" // 未設定任何設定檔時使用的內建範圍
+)
+
+// Range 欄位的有效範圍，nil 表示不限制
+type Range struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// ValidationProfile 套用於設備類型或單一設備的量測值範圍設定，
+// Rules 的 key 為欄位名稱（核心欄位或設備類型宣告的欄位）
+type ValidationProfile struct {
+	TenantID  string           `json:"tenant_id" db:"tenant_id"`
+	Scope     string           `json:"scope" db:"scope"`
+	Target    string           `json:"target" db:"target"`
+	Rules     map[string]Range `json:"rules" db:"rules"`
+	UpdatedAt time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+type PutValidationProfileRequest struct {
+	Rules map[string]Range `json:"rules" binding:"required,max=64"`
+}
+
+// EffectiveValidationProfile 設備實際套用的範圍與來源
+type EffectiveValidationProfile struct {
+	DeviceID string           `json:"device_id"`
+	Source   string           `json:"source"` // device / device-type / default
+	Target   string           `json:"target,omitempty"`
+	Rules    map[string]Range `json:"rules"`
+}
@@ -9,16 +9,20 @@ import (
 	redisdriver "github.com/redis/go-redis/v9"
 )
 
-// MetricQueueKey Redis 中儲存 metric 任務的 List key（供 worker 消費用）
-const MetricQueueKey = "iot:metric:tasks"
+// MetricQueueKey Redis 中儲存 metric 任務的 List key（供 worker 消費用）；
+// 以 {iot:metric} 作為 hash tag，Redis Cluster 下佇列相關的 key 都位於同一 slot
+const MetricQueueKey = "{iot:metric}:tasks"
 
-// RedisMetricQueue 使用 Redis List 實作的 MetricQueue
+// LegacyMetricQueueKey 改用 hash tag 前的佇列 key；升級期間舊版 API 寫入的任務由 worker 在閒置時取出處理
+const LegacyMetricQueueKey = "iot:metric:tasks"
+
+// RedisMetricQueue 使用 Redis List 實作的 MetricQueue，並實作 MetricQueueInspector
 type RedisMetricQueue struct {
-	client *redisdriver.Client
+	client redisdriver.Cmdable
 }
 
 // NewRedisMetricQueue 建立 Redis 版的 MetricQueue
-func NewRedisMetricQueue(client *redisdriver.Client) interfaces.MetricQueue {
+func NewRedisMetricQueue(client redisdriver.Cmdable) interfaces.MetricQueue {
 	return &RedisMetricQueue{client: client}
 }
 
@@ -30,3 +34,16 @@ func (q *RedisMetricQueue) Push(ctx context.Context, task *interfaces.MetricTask
 	}
 	return q.client.LPush(ctx, MetricQueueKey, data).Err()
 }
+
+// Len 積壓的任務數（包含舊 key 中尚未處理的任務）
+func (q *RedisMetricQueue) Len(ctx context.Context) (int64, error) {
+	n, err := q.client.LLen(ctx, MetricQueueKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	legacy, err := q.client.LLen(ctx, LegacyMetricQueueKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	return n + legacy, nil
+}
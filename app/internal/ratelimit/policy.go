@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"iot-data-collection/app/internal/config"
+)
+
+// Policy 決定各 bucket 套用的 Limit。
+// 設備 bucket 優先順序：單一設備設定 > 設備類型設定 > 預設值；
+// 呼叫端 bucket：單一 API key 設定 > 預設值
+type Policy struct {
+	Enabled             bool
+	DeviceDefault       Limit
+	DeviceOverrides     map[string]Limit // key 為 "tenantID/deviceID"，見 DeviceKey
+	DeviceTypeOverrides map[string]Limit // key 為設備類型
+	ClientDefault       Limit
+	APIKeyOverrides     map[int]Limit // key 為 API key ID
+}
+
+// PolicySource 提供目前生效的 Policy；*Policy 本身即為固定不變的來源
+type PolicySource interface {
+	Current() *Policy
+}
+
+// Current 實作 PolicySource
+func (p *Policy) Current() *Policy {
+	return p
+}
+
+// DynamicPolicy 可於執行期間替換的 Policy（例如收到 SIGHUP 重新載入設定）
+type DynamicPolicy struct {
+	p atomic.Pointer[Policy]
+}
+
+// NewDynamicPolicy 以初始 Policy 建立 DynamicPolicy
+func NewDynamicPolicy(p *Policy) *DynamicPolicy {
+	d := &DynamicPolicy{}
+	d.p.Store(p)
+	return d
+}
+
+// Current 實作 PolicySource
+func (d *DynamicPolicy) Current() *Policy {
+	return d.p.Load()
+}
+
+// Store 替換 Policy，之後的請求立即套用
+func (d *DynamicPolicy) Store(p *Policy) {
+	d.p.Store(p)
+}
+
+// NewPolicyFromConfig 由設定建立 Policy
+func NewPolicyFromConfig(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		Enabled:       cfg.RateLimitEnabled,
+		DeviceDefault: Limit{Rate: cfg.RateLimitDeviceRate, Burst: cfg.RateLimitDeviceBurst},
+		ClientDefault: Limit{Rate: cfg.RateLimitClientRate, Burst: cfg.RateLimitClientBurst},
+	}
+	var err error
+	if p.DeviceOverrides, err = ParseOverrides(cfg.RateLimitDeviceOverrides); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_DEVICE_OVERRIDES: %w", err)
+	}
+	// device ID 只在租戶內唯一，必須指定租戶，避免覆寫套用到其他租戶的同名設備
+	for k := range p.DeviceOverrides {
+		tenantID, deviceID, ok := strings.Cut(k, "/")
+		if !ok || tenantID == "" || deviceID == "" {
+			return nil, fmt.Errorf("RATE_LIMIT_DEVICE_OVERRIDES: 設備必須以 tenantID/deviceID 指定: %q", k)
+		}
+	}
+	if p.DeviceTypeOverrides, err = ParseOverrides(cfg.RateLimitDeviceTypeOverrides); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_DEVICE_TYPE_OVERRIDES: %w", err)
+	}
+	apiKeyOverrides, err := ParseOverrides(cfg.RateLimitAPIKeyOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_API_KEY_OVERRIDES: %w", err)
+	}
+	p.APIKeyOverrides = make(map[int]Limit, len(apiKeyOverrides))
+	for k, v := range apiKeyOverrides {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_API_KEY_OVERRIDES: API key ID 必須為整數: %q", k)
+		}
+		p.APIKeyOverrides[id] = v
+	}
+	return p, nil
+}
+
+// DeviceKey 單一設備覆寫的 key
+func DeviceKey(tenantID, deviceID string) string {
+	return tenantID + "/" + deviceID
+}
+
+// DeviceLimit 取得設備 bucket 的 Limit
+func (p *Policy) DeviceLimit(tenantID, deviceID, deviceType string) Limit {
+	if l, ok := p.DeviceOverrides[DeviceKey(tenantID, deviceID)]; ok {
+		return l
+	}
+	if deviceType != "" {
+		if l, ok := p.DeviceTypeOverrides[deviceType]; ok {
+			return l
+		}
+	}
+	return p.DeviceDefault
+}
+
+// ClientLimit 取得呼叫端 bucket 的 Limit；apiKeyID 為 0 表示非 API key 呼叫者
+func (p *Policy) ClientLimit(apiKeyID int) Limit {
+	if apiKeyID != 0 {
+		if l, ok := p.APIKeyOverrides[apiKeyID]; ok {
+			return l
+		}
+	}
+	return p.ClientDefault
+}
+
+// ParseOverrides 解析 "name=rate:burst,name2=rate:burst" 格式的設定，rate 為每秒請求數（可為小數）
+func ParseOverrides(s string) (map[string]Limit, error) {
+	out := make(map[string]Limit)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("格式錯誤: %q（應為 name=rate:burst）", item)
+		}
+		l, err := ParseLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", item, err)
+		}
+		out[strings.TrimSpace(name)] = l
+	}
+	return out, nil
+}
+
+// ParseLimit 解析 "rate:burst" 格式
+func ParseLimit(spec string) (Limit, error) {
+	rateStr, burstStr, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok {
+		return Limit{}, fmt.Errorf("格式錯誤: %q（應為 rate:burst）", spec)
+	}
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 {
+		return Limit{}, fmt.Errorf("無效的 rate: %q", rateStr)
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("無效的 burst: %q", burstStr)
+	}
+	return Limit{Rate: rate, Burst: burst}, nil
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"iot-data-collection/app/internal/config"
+)
+
+func TestParseOverrides(t *testing.T) {
+	m, err := ParseOverrides("device-001=0.5:5, meter-3p=10:50")
+	if err != nil {
+		t.Fatalf("期望解析成功，得到 %v", err)
+	}
+	if m["device-001"] != (Limit{Rate: 0.5, Burst: 5}) || m["meter-3p"] != (Limit{Rate: 10, Burst: 50}) {
+		t.Errorf("解析結果不符預期: %+v", m)
+	}
+
+	for _, bad := range []string{"device-001", "device-001=5", "=1:2", "x=a:1", "x=1:-1"} {
+		if _, err := ParseOverrides(bad); err == nil {
+			t.Errorf("%q 應解析失敗", bad)
+		}
+	}
+}
+
+func TestPolicy_DeviceLimitPrecedence(t *testing.T) {
+	p := &Policy{
+		DeviceDefault:       Limit{Rate: 2, Burst: 20},
+		DeviceOverrides:     map[string]Limit{"acme/device-001": {Rate: 1, Burst: 1}},
+		DeviceTypeOverrides: map[string]Limit{"meter": {Rate: 5, Burst: 10}},
+	}
+
+	if got := p.DeviceLimit("acme", "device-001", "meter"); got != (Limit{Rate: 1, Burst: 1}) {
+		t.Errorf("單一設備設定應優先，得到 %+v", got)
+	}
+	if got := p.DeviceLimit("other", "device-001", ""); got != p.DeviceDefault {
+		t.Errorf("其他租戶的同名設備不應套用覆寫，得到 %+v", got)
+	}
+	if got := p.DeviceLimit("acme", "device-002", "meter"); got != (Limit{Rate: 5, Burst: 10}) {
+		t.Errorf("應套用設備類型設定，得到 %+v", got)
+	}
+	if got := p.DeviceLimit("acme", "device-002", ""); got != p.DeviceDefault {
+		t.Errorf("應套用預設值，得到 %+v", got)
+	}
+}
+
+func TestNewPolicyFromConfig_DeviceOverrideRequiresTenant(t *testing.T) {
+	p, err := NewPolicyFromConfig(&config.Config{RateLimitDeviceOverrides: "acme/device-001=0.5:5"})
+	if err != nil {
+		t.Fatalf("期望解析成功，得到 %v", err)
+	}
+	if got := p.DeviceLimit("acme", "device-001", ""); got != (Limit{Rate: 0.5, Burst: 5}) {
+		t.Errorf("應套用租戶內的設備覆寫，得到 %+v", got)
+	}
+
+	for _, bad := range []string{"device-001=0.5:5", "/device-001=0.5:5", "acme/=0.5:5"} {
+		if _, err := NewPolicyFromConfig(&config.Config{RateLimitDeviceOverrides: bad}); err == nil {
+			t.Errorf("%q 未指定租戶應回傳錯誤", bad)
+		}
+	}
+}
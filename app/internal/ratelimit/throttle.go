@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// ThrottledKeyPrefix 每個租戶各設備被限流次數的 Redis hash（跨 replica 共用）
+const ThrottledKeyPrefix = "iot:ratelimit:throttled:"
+
+// DeviceThrottleCount 單一設備被限流的累計次數
+type DeviceThrottleCount struct {
+	DeviceID  string `json:"device_id"`
+	Throttled int64  `json:"throttled"`
+}
+
+// ThrottleCounter 記錄與查詢設備被限流的次數
+type ThrottleCounter interface {
+	Incr(ctx context.Context, tenantID, deviceID string) error
+	List(ctx context.Context, tenantID string) ([]DeviceThrottleCount, error)
+	Reset(ctx context.Context, tenantID string) error
+}
+
+// RedisThrottleCounter 以 Redis hash 實作的 ThrottleCounter
+type RedisThrottleCounter struct {
+	client redisdriver.Cmdable
+}
+
+// NewRedisThrottleCounter 建立 Redis 版的 ThrottleCounter
+func NewRedisThrottleCounter(client redisdriver.Cmdable) ThrottleCounter {
+	return &RedisThrottleCounter{client: client}
+}
+
+func (c *RedisThrottleCounter) Incr(ctx context.Context, tenantID, deviceID string) error {
+	return c.client.HIncrBy(ctx, ThrottledKeyPrefix+tenantID, deviceID, 1).Err()
+}
+
+// List 依被限流次數由多到少排序
+func (c *RedisThrottleCounter) List(ctx context.Context, tenantID string) ([]DeviceThrottleCount, error) {
+	m, err := c.client.HGetAll(ctx, ThrottledKeyPrefix+tenantID).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]DeviceThrottleCount, 0, len(m))
+	for deviceID, v := range m {
+		n, _ := strconv.ParseInt(v, 10, 64)
+		list = append(list, DeviceThrottleCount{DeviceID: deviceID, Throttled: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Throttled != list[j].Throttled {
+			return list[i].Throttled > list[j].Throttled
+		}
+		return list[i].DeviceID < list[j].DeviceID
+	})
+	return list, nil
+}
+
+func (c *RedisThrottleCounter) Reset(ctx context.Context, tenantID string) error {
+	return c.client.Del(ctx, ThrottledKeyPrefix+tenantID).Err()
+}
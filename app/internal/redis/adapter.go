@@ -4,16 +4,17 @@ import (
 	"context"
 	"time"
 
+	"iot-data-collection/app/internal/cache"
 	"iot-data-collection/app/internal/interfaces"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisAdapter struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func NewRedisAdapter(client *redis.Client) interfaces.RedisClient {
+func NewRedisAdapter(client redis.UniversalClient) interfaces.RedisClient {
 	return &RedisAdapter{client: client}
 }
 
@@ -25,10 +26,64 @@ func (a *RedisAdapter) Get(ctx context.Context, key string) (string, error) {
 	return a.client.Get(ctx, key).Result()
 }
 
+// GetMulti 以 pipeline 逐一 GET（而非 MGET），key 分散在不同 slot 時也適用
+func (a *RedisAdapter) GetMulti(ctx context.Context, keys []string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := a.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		if v, err := cmd.Result(); err == nil {
+			result[keys[i]] = v
+		}
+	}
+	return result, nil
+}
+
 func (a *RedisAdapter) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return a.client.Set(ctx, key, value, expiration).Err()
 }
 
+// Del 多個 key 時以 pipeline 逐一刪除；cluster 模式下 key 可能位於不同 slot，無法以單一 DEL 刪除
 func (a *RedisAdapter) Del(ctx context.Context, keys ...string) error {
-	return a.client.Del(ctx, keys...).Err()
+	if len(keys) <= 1 {
+		return a.client.Del(ctx, keys...).Err()
+	}
+	_, err := a.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+// setIfNewerScript KEYS[1] 值、KEYS[2] 版本；ARGV[1] 值、ARGV[2] 版本、ARGV[3] TTL（毫秒）
+var setIfNewerScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[2]))
+if cur and cur > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+func (a *RedisAdapter) SetIfNewer(ctx context.Context, key string, value interface{}, version int64, expiration time.Duration) (bool, error) {
+	n, err := setIfNewerScript.Run(ctx, a.client, []string{key, cache.VersionKey(key)},
+		value, version, expiration.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
 }
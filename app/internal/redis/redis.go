@@ -2,7 +2,11 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"iot-data-collection/app/internal/config"
@@ -10,20 +14,75 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// NewRedisConnection 依 REDIS_MODE 建立單機、Sentinel 或 Cluster 連線
+func NewRedisConnection(cfg *config.Config) (redis.UniversalClient, error) {
+	opts, err := universalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-func NewRedisConnection(cfg *config.Config) (*redis.Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", cfg.RedisHost, cfg.RedisPort),
-		Password: "", 
-		DB:       0, 
-	})
+	var rdb redis.UniversalClient
+	switch cfg.RedisMode {
+	case "sentinel":
+		rdb = redis.NewFailoverClient(opts.Failover())
+	case "cluster":
+		rdb = redis.NewClusterClient(opts.Cluster())
+	default:
+		rdb = redis.NewClient(opts.Simple())
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("無法連線到 Redis: %w", err)
 	}
 
 	return rdb, nil
 }
+
+func universalOptions(cfg *config.Config) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.RedisAddrList(),
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		DB:               cfg.RedisDB,
+		MasterName:       cfg.RedisSentinelMaster,
+		SentinelUsername: cfg.RedisSentinelUsername,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		PoolSize:         cfg.RedisPoolSize,
+		MinIdleConns:     cfg.RedisMinIdleConns,
+		DialTimeout:      cfg.RedisDialTimeout,
+		ReadTimeout:      cfg.RedisReadTimeout,
+		WriteTimeout:     cfg.RedisWriteTimeout,
+	}
+	if cfg.RedisTLSEnabled {
+		tlsConfig, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+func tlsConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.RedisTLSServerName,
+		InsecureSkipVerify: cfg.RedisTLSSkipVerify,
+	}
+	if cfg.RedisTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.RedisTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("讀取 Redis CA 檔失敗: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("Redis CA 檔中沒有有效的憑證")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/config"
+)
+
+func TestUniversalOptions(t *testing.T) {
+	cfg := &config.Config{
+		RedisHost:          "cache",
+		RedisPort:          "6379",
+		RedisAddrs:         "node-1:6379, node-2:6379",
+		RedisUsername:      "app",
+		RedisPassword:      "secret",
+		RedisDB:            2,
+		RedisPoolSize:      50,
+		RedisReadTimeout:   time.Second,
+		RedisTLSEnabled:    true,
+		RedisTLSServerName: "redis.example.com",
+	}
+	opts, err := universalOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Addrs) != 2 || opts.Addrs[1] != "node-2:6379" {
+		t.Errorf("節點位址解析不符: %v", opts.Addrs)
+	}
+	if opts.Username != "app" || opts.Password != "secret" || opts.DB != 2 || opts.PoolSize != 50 {
+		t.Errorf("連線設定不符: %+v", opts)
+	}
+	if opts.TLSConfig == nil || opts.TLSConfig.ServerName != "redis.example.com" {
+		t.Errorf("應啟用 TLS: %+v", opts.TLSConfig)
+	}
+
+	cfg.RedisAddrs, cfg.RedisTLSEnabled = "", false
+	if opts, _ := universalOptions(cfg); len(opts.Addrs) != 1 || opts.Addrs[0] != "cache:6379" || opts.TLSConfig != nil {
+		t.Errorf("未設定 REDIS_ADDRS 時應使用 host:port 且不啟用 TLS: %v %v", opts.Addrs, opts.TLSConfig)
+	}
+}
+
+func TestTLSConfigInvalidCA(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tlsConfig(&config.Config{RedisTLSEnabled: true, RedisTLSCAFile: caFile}); err == nil {
+		t.Error("CA 檔沒有有效憑證時應回傳錯誤")
+	}
+	if _, err := tlsConfig(&config.Config{RedisTLSEnabled: true, RedisTLSCAFile: caFile + ".missing"}); err == nil {
+		t.Error("CA 檔不存在時應回傳錯誤")
+	}
+}
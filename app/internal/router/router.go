@@ -1,37 +1,211 @@
 package router
 
 import (
-	"database/sql"
+	"context"
 
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/command"
+	"iot-data-collection/app/internal/config"
+	"iot-data-collection/app/internal/database"
 	"iot-data-collection/app/internal/handlers"
 	"iot-data-collection/app/internal/interfaces"
-	"iot-data-collection/app/internal/redis"
+	"iot-data-collection/app/internal/latedata"
+	"iot-data-collection/app/internal/localcache"
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/middleware"
+	"iot-data-collection/app/internal/ratelimit"
 	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/twin"
 
 	"github.com/gin-gonic/gin"
 	redisdriver "github.com/redis/go-redis/v9"
 )
 
-func SetupRouter(db *sql.DB, rdb *redisdriver.Client, metricQueue interfaces.MetricQueue) *gin.Engine {
-	r := gin.Default()
-	redisAdapter := redis.NewRedisAdapter(rdb)
-	metricSvc := service.NewDeviceMetricService(db, redisAdapter, metricQueue)
+// SetupRouter 建立路由；verifier 為 nil 時停用 JWT 與角色權限控管。
+// 限流與時間戳政策於每次請求時取得，傳入 Dynamic 版本即可熱更新
+func SetupRouter(
+	cfg *config.Config,
+	db *database.DB,
+	metricStore metricstore.Store,
+	rdb redisdriver.UniversalClient,
+	redisAdapter interfaces.RedisClient,
+	metricQueue interfaces.MetricQueue,
+	verifier *auth.Verifier,
+	rateLimitPolicy ratelimit.PolicySource,
+	clockSkewPolicy clockskew.PolicySource,
+	workerHeartbeat interfaces.Heartbeat,
+	shuttingDown func() bool,
+	longPolls context.Context,
+) *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.Recovery(), middleware.RequestID(), middleware.AccessLog())
+	tenantSvc := service.NewTenantService(db, redisAdapter)
+	deviceSvc := service.NewDeviceService(db, redisAdapter)
+	deviceTypeSvc := service.NewDeviceTypeService(db, redisAdapter, deviceSvc)
+	profileSvc := service.NewValidationProfileService(db, redisAdapter, deviceSvc)
+	clockSkewSvc := service.NewClockSkewService(clockSkewPolicy, clockskew.NewRedisStore(rdb))
+	// memory store 的開發模式不連線 Postgres，回報資料不查詢設備類型與驗證設定檔，改用預設驗證範圍
+	metricTypes, metricProfiles := deviceTypeSvc, profileSvc
+	if db.Offline() {
+		metricTypes, metricProfiles = nil, nil
+	}
+	metricSvc := service.NewDeviceMetricService(metricStore, redisAdapter, metricQueue, metricTypes, metricProfiles, clockSkewSvc)
+	quarantineSvc := service.NewQuarantineService(db, metricSvc)
+	anomalySvc := service.NewAnomalyService(db, redisAdapter)
+	// 設備孿生長輪詢由 desired 更新的廣播喚醒；伺服器開始關閉時長輪詢結束，訂閱也一併停止
+	twinHub := twin.NewHub(rdb)
+	twinHub.Start(longPolls)
+	twinSvc := service.NewTwinService(db, twinHub)
+	commandSvc := service.NewCommandService(db, command.NewRedisQueue(rdb), cfg.CommandDeliveryLease)
+	groupSvc := service.NewGroupService(db, metricStore, redisAdapter)
+	statusEventSvc := service.NewStatusEventService(db)
+	fleetSvc := service.NewFleetService(db, metricStore, redisAdapter, cfg.FleetOfflineAfter, cfg.FleetSummaryTTL)
+	throttle := ratelimit.NewRedisThrottleCounter(rdb)
+	healthOpts := handlers.HealthOptions{
+		Worker:           workerHeartbeat,
+		Migrations:       db,
+		Critical:         cfg.HealthCriticalCheckList(),
+		Timeout:          cfg.HealthCheckTimeout,
+		QueueBacklogWarn: int64(cfg.HealthQueueBacklogWarn),
+		WorkerMaxAge:     cfg.HealthWorkerMaxAge,
+		ShuttingDown:     shuttingDown,
+	}
+	if q, ok := metricQueue.(interfaces.MetricQueueInspector); ok {
+		healthOpts.Queue = q
+	}
 	h := &handlers.Handlers{
-		HealthHandler: handlers.NewHealthHandler(db, redisAdapter),
-		MetricSvc:     metricSvc,
+		HealthHandler:  handlers.NewHealthHandler(db, redisAdapter, healthOpts),
+		MetricSvc:      metricSvc,
+		TenantSvc:      tenantSvc,
+		DeviceSvc:      deviceSvc,
+		DeviceTypeSvc:  deviceTypeSvc,
+		ProfileSvc:     profileSvc,
+		QuarantineSvc:  quarantineSvc,
+		AnomalySvc:     anomalySvc,
+		Throttle:       throttle,
+		Late:           latedata.NewRedisCounter(rdb),
+		ClockSkewSvc:   clockSkewSvc,
+		TwinSvc:        twinSvc,
+		CommandSvc:     commandSvc,
+		GroupSvc:       groupSvc,
+		FleetSvc:       fleetSvc,
+		StatusEventSvc: statusEventSvc,
+		LongPolls:      longPolls,
+	}
+	if tiered, ok := redisAdapter.(*localcache.Tiered); ok {
+		h.LocalCache = tiered
 	}
+	authz := &middleware.Authorizer{Enabled: verifier != nil, Devices: deviceSvc}
+	rateLimit := middleware.RateLimit(ratelimit.NewRedisLimiter(rdb), rateLimitPolicy, deviceSvc, throttle)
 
 	r.GET("/health", h.HealthCheck)
+	r.GET("/livez", h.Livez)   // 存活檢查：不檢查外部相依
+	r.GET("/readyz", h.Readyz) // 就緒檢查：各相依狀態、延遲、佇列積壓、worker 心跳與 schema 版本
 
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", middleware.Authenticate(tenantSvc, verifier, cfg.RequireAPIKey))
 	{
 		devices := v1.Group("/devices")
 		{
-			devices.GET("", h.GetDevices)                                    // GET /api/v1/devices - 列出所有設備
-			devices.POST("/:deviceId/metrics", h.CreateDeviceMetric)          // POST /api/v1/devices/{deviceId}/metrics - 接收設備資料回報
-			devices.GET("/:deviceId/metrics", h.GetDeviceMetrics)             // GET /api/v1/devices/{deviceId}/metrics - 查詢歷史資料
-			devices.GET("/:deviceId/latest", h.GetDeviceLatest)               // GET /api/v1/devices/{deviceId}/latest - 取得最新一筆資料
+			viewer := devices.Group("", authz.RequireRole(auth.RoleViewer))
+			viewer.GET("", h.GetDevices) // GET /api/v1/devices - 列出所有設備（依呼叫者的設備標籤過濾，可依狀態、站點、bbox 或半徑篩選）
+
+			device := devices.Group("/:deviceId", authz.RequireDeviceAccess())
+			{
+				device.POST("/metrics", authz.RequireRole(auth.RoleOperator), rateLimit, h.CreateDeviceMetric)          // POST /api/v1/devices/{deviceId}/metrics - 接收設備資料回報（限流）
+				device.GET("/metrics", authz.RequireRole(auth.RoleViewer), h.GetDeviceMetrics)                          // GET /api/v1/devices/{deviceId}/metrics - 查詢歷史資料
+				device.GET("/series", authz.RequireRole(auth.RoleViewer), h.GetDeviceSeries)                            // GET /api/v1/devices/{deviceId}/series?field= - 查詢單一欄位的時間序列
+				device.GET("/latest", authz.RequireRole(auth.RoleViewer), h.GetDeviceLatest)                            // GET /api/v1/devices/{deviceId}/latest - 取得最新一筆資料
+				device.GET("/energy", authz.RequireRole(auth.RoleViewer), h.GetDeviceEnergy)                            // GET /api/v1/devices/{deviceId}/energy - 區間或日曆區間用電量
+				device.POST("/energy/reset", authz.RequireRole(auth.RoleAdmin), h.ResetDeviceEnergy)                    // POST /api/v1/devices/{deviceId}/energy/reset - 累積電能歸零
+				device.GET("/anomalies", authz.RequireRole(auth.RoleViewer), h.GetDeviceAnomalies)                      // GET /api/v1/devices/{deviceId}/anomalies - 查詢異常讀值
+				device.GET("/anomaly-detection", authz.RequireRole(auth.RoleViewer), h.GetAnomalySettings)              // GET /api/v1/devices/{deviceId}/anomaly-detection - 取得異常偵測設定
+				device.PUT("/anomaly-detection", authz.RequireRole(auth.RoleAdmin), h.PutAnomalySettings)               // PUT /api/v1/devices/{deviceId}/anomaly-detection - 設定異常偵測
+				device.DELETE("/anomaly-detection/baseline", authz.RequireRole(auth.RoleAdmin), h.ResetAnomalyBaseline) // DELETE /api/v1/devices/{deviceId}/anomaly-detection/baseline - 重設偵測基準
+				device.GET("/status-events", authz.RequireRole(auth.RoleViewer), h.GetDeviceStatusEvents)               // GET /api/v1/devices/{deviceId}/status-events - 狀態轉換紀錄
+				device.GET("/availability", authz.RequireRole(auth.RoleViewer), h.GetDeviceAvailability)                // GET /api/v1/devices/{deviceId}/availability - 各狀態停留時間與可用率
+				device.GET("/clock-skew", authz.RequireRole(auth.RoleViewer), h.GetDeviceClockSkew)                     // GET /api/v1/devices/{deviceId}/clock-skew - 設備時鐘偏差統計
+				device.DELETE("/clock-skew", authz.RequireRole(auth.RoleAdmin), h.ResetDeviceClockSkew)                 // DELETE /api/v1/devices/{deviceId}/clock-skew - 清除時鐘偏差統計
+				device.POST("/commands", authz.RequireRole(auth.RoleOperator), h.CreateDeviceCommand)                   // POST /api/v1/devices/{deviceId}/commands - 建立指令
+				device.GET("/commands", authz.RequireRole(auth.RoleViewer), h.GetDeviceCommands)                        // GET /api/v1/devices/{deviceId}/commands - 指令歷史
+				device.POST("/commands/pull", authz.RequireRole(auth.RoleOperator), h.PullDeviceCommands)               // POST /api/v1/devices/{deviceId}/commands/pull - 設備取出待執行的指令
+				device.GET("/commands/:commandId", authz.RequireRole(auth.RoleViewer), h.GetDeviceCommand)              // GET /api/v1/devices/{deviceId}/commands/{commandId} - 取得單一指令
+				device.POST("/commands/:commandId/ack", authz.RequireRole(auth.RoleOperator), h.AckDeviceCommand)       // POST /api/v1/devices/{deviceId}/commands/{commandId}/ack - 回報執行結果
+				device.GET("/twin", authz.RequireRole(auth.RoleViewer), h.GetDeviceTwin)                                // GET /api/v1/devices/{deviceId}/twin - 取得設備孿生文件
+				device.PATCH("/twin/desired", authz.RequireRole(auth.RoleOperator), h.PatchDeviceTwinDesired)           // PATCH /api/v1/devices/{deviceId}/twin/desired - 更新 desired 狀態
+				device.PATCH("/twin/reported", authz.RequireRole(auth.RoleOperator), h.PatchDeviceTwinReported)         // PATCH /api/v1/devices/{deviceId}/twin/reported - 設備回報目前狀態
+				device.GET("/twin/delta", authz.RequireRole(auth.RoleViewer), h.GetDeviceTwinDelta)                     // GET /api/v1/devices/{deviceId}/twin/delta - 尚未套用的設定（支援長輪詢）
+				device.GET("/location", authz.RequireRole(auth.RoleViewer), h.GetDeviceLocation)                        // GET /api/v1/devices/{deviceId}/location - 取得設備位置
+				device.PUT("/location", authz.RequireRole(auth.RoleAdmin), h.SetDeviceLocation)                         // PUT /api/v1/devices/{deviceId}/location - 設定設備位置與站點
+				device.PUT("/group", authz.RequireRole(auth.RoleAdmin), h.SetDeviceGroup)                               // PUT /api/v1/devices/{deviceId}/group - 指派設備群組
+				device.GET("/tags", authz.RequireRole(auth.RoleViewer), h.GetDeviceTags)                                // GET /api/v1/devices/{deviceId}/tags - 取得設備標籤
+				device.PUT("/tags", authz.RequireRole(auth.RoleAdmin), h.SetDeviceTags)                                 // PUT /api/v1/devices/{deviceId}/tags - 設定設備標籤
+				device.GET("/validation-profile", authz.RequireRole(auth.RoleViewer), h.GetDeviceValidationProfile)     // GET /api/v1/devices/{deviceId}/validation-profile - 設備實際套用的驗證範圍
+				device.GET("/quarantine", authz.RequireRole(auth.RoleViewer), h.GetQuarantinedMetrics)                  // GET /api/v1/devices/{deviceId}/quarantine - 查詢該設備的隔離資料
+				device.PUT("/type", authz.RequireRole(auth.RoleAdmin), h.SetDeviceType)                                 // PUT /api/v1/devices/{deviceId}/type - 設定設備類型
+			}
+		}
+
+		groups := v1.Group("/groups")
+		{
+			groups.GET("", authz.RequireRole(auth.RoleViewer), h.GetDeviceGroups)                        // GET /api/v1/groups - 列出群組
+			groups.GET("/:groupId", authz.RequireRole(auth.RoleViewer), h.GetDeviceGroup)                // GET /api/v1/groups/{groupId} - 取得群組
+			groups.PUT("/:groupId", authz.RequireRole(auth.RoleAdmin), h.PutDeviceGroup)                 // PUT /api/v1/groups/{groupId} - 建立或更新群組
+			groups.DELETE("/:groupId", authz.RequireRole(auth.RoleAdmin), h.DeleteDeviceGroup)           // DELETE /api/v1/groups/{groupId} - 刪除群組
+			groups.GET("/:groupId/devices", authz.RequireRole(auth.RoleViewer), h.GetDeviceGroupDevices) // GET /api/v1/groups/{groupId}/devices - 群組內的設備
+			groups.GET("/:groupId/summary", authz.RequireRole(auth.RoleViewer), h.GetDeviceGroupSummary) // GET /api/v1/groups/{groupId}/summary - 群組彙總
+		}
+
+		v1.GET("/fleet/summary", authz.RequireRole(auth.RoleViewer), h.GetFleetSummary) // GET /api/v1/fleet/summary - 設備總覽（短暫快取，供監控牆刷新）
+
+		deviceTypes := v1.Group("/device-types")
+		{
+			deviceTypes.GET("", authz.RequireRole(auth.RoleViewer), h.GetDeviceTypes)               // GET /api/v1/device-types - 列出設備類型
+			deviceTypes.GET("/:typeName", authz.RequireRole(auth.RoleViewer), h.GetDeviceType)      // GET /api/v1/device-types/{typeName} - 取得設備類型 schema
+			deviceTypes.PUT("/:typeName", authz.RequireRole(auth.RoleAdmin), h.PutDeviceType)       // PUT /api/v1/device-types/{typeName} - 建立或更新設備類型 schema
+			deviceTypes.DELETE("/:typeName", authz.RequireRole(auth.RoleAdmin), h.DeleteDeviceType) // DELETE /api/v1/device-types/{typeName} - 刪除設備類型
+		}
+
+		profiles := v1.Group("/validation-profiles")
+		{
+			profiles.GET("", authz.RequireRole(auth.RoleViewer), h.GetValidationProfiles)                    // GET /api/v1/validation-profiles - 列出驗證設定檔
+			profiles.GET("/:scope/:target", authz.RequireRole(auth.RoleViewer), h.GetValidationProfile)      // GET /api/v1/validation-profiles/{scope}/{target} - 取得驗證設定檔
+			profiles.PUT("/:scope/:target", authz.RequireRole(auth.RoleAdmin), h.PutValidationProfile)       // PUT /api/v1/validation-profiles/{scope}/{target} - 建立或更新驗證設定檔
+			profiles.DELETE("/:scope/:target", authz.RequireRole(auth.RoleAdmin), h.DeleteValidationProfile) // DELETE /api/v1/validation-profiles/{scope}/{target} - 刪除驗證設定檔
+		}
+
+		quarantine := v1.Group("/quarantine")
+		{
+			quarantine.GET("", authz.RequireRole(auth.RoleViewer), h.GetQuarantinedMetrics)                     // GET /api/v1/quarantine - 查詢隔離資料
+			quarantine.GET("/:id", authz.RequireRole(auth.RoleViewer), h.GetQuarantinedMetric)                  // GET /api/v1/quarantine/{id} - 取得單筆隔離資料
+			quarantine.POST("/:id/reinject", authz.RequireRole(auth.RoleOperator), h.ReinjectQuarantinedMetric) // POST /api/v1/quarantine/{id}/reinject - 修正後重新注入
+			quarantine.POST("/:id/discard", authz.RequireRole(auth.RoleOperator), h.DiscardQuarantinedMetric)   // POST /api/v1/quarantine/{id}/discard - 捨棄隔離資料
+		}
+
+		lateData := v1.Group("/late-data")
+		{
+			lateData.GET("", authz.RequireRole(auth.RoleViewer), h.GetLateDataCounts)     // GET /api/v1/late-data - 各設備延遲與亂序筆數
+			lateData.DELETE("", authz.RequireRole(auth.RoleAdmin), h.ResetLateDataCounts) // DELETE /api/v1/late-data - 清除延遲資料統計
 		}
+
+		v1.GET("/clock-skew", authz.RequireRole(auth.RoleViewer), h.GetClockSkew) // GET /api/v1/clock-skew - 各設備時鐘偏差統計
+
+		rateLimits := v1.Group("/rate-limits")
+		{
+			rateLimits.GET("/throttled", authz.RequireRole(auth.RoleViewer), h.GetThrottledDevices)     // GET /api/v1/rate-limits/throttled - 各設備被限流次數
+			rateLimits.DELETE("/throttled", authz.RequireRole(auth.RoleAdmin), h.ResetThrottledDevices) // DELETE /api/v1/rate-limits/throttled - 清除限流統計
+		}
+	}
+
+	// 管理 API 另外接受 X-Admin-Token，因此不強制 API key
+	admin := r.Group("/api/v1/admin", middleware.Authenticate(tenantSvc, verifier, false), authz.AdminAccess(cfg.AdminToken))
+	{
+		admin.POST("/tenants", h.CreateTenant)                                   // POST /api/v1/admin/tenants - 建立租戶
+		admin.GET("/tenants", h.GetTenants)                                      // GET /api/v1/admin/tenants - 列出租戶
+		admin.POST("/tenants/:tenantId/api-keys", h.CreateTenantAPIKey)          // POST /api/v1/admin/tenants/{tenantId}/api-keys - 建立 API key
+		admin.GET("/tenants/:tenantId/api-keys", h.GetTenantAPIKeys)             // GET /api/v1/admin/tenants/{tenantId}/api-keys - 列出 API key
+		admin.DELETE("/tenants/:tenantId/api-keys/:keyId", h.RevokeTenantAPIKey) // DELETE /api/v1/admin/tenants/{tenantId}/api-keys/{keyId} - 撤銷 API key
+		admin.GET("/cache/stats", h.GetCacheStats)                               // GET /api/v1/admin/cache/stats - 本機與 Redis 快取層命中統計
 	}
 
 	return r
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/config"
+	"iot-data-collection/app/internal/database"
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/middleware"
+	"iot-data-collection/app/internal/mocks"
+	"iot-data-collection/app/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// 未設定 JWT 金鑰時 admin 端點不可匿名呼叫，但租戶 API key 仍可使用
+func TestAdminRoutesWithoutJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("POSTGRES_USER", "test")
+	t.Setenv("POSTGRES_PASSWORD", "test")
+	cfg, err := config.LoadFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := database.NewOfflineConnection(cfg)
+	rdb := redisdriver.NewClient(&redisdriver.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// API key 由快取解析，不需連線資料庫
+	cache := &mocks.MockRedis{GetResult: `{"id":1,"tenant_id":"default"}`}
+	r := SetupRouter(cfg, db, metricstore.NewMemoryStore(), rdb, cache, &mocks.MockMetricQueue{}, nil,
+		&ratelimit.Policy{}, &clockskew.Policy{}, nil, func() bool { return false }, ctx)
+
+	routes := []struct{ method, path string }{
+		{http.MethodDelete, "/api/v1/device-types/meter"},
+		{http.MethodPut, "/api/v1/validation-profiles/device/m1"},
+		{http.MethodPost, "/api/v1/devices/m1/energy/reset"},
+		{http.MethodPut, "/api/v1/devices/m1/tags"},
+		{http.MethodDelete, "/api/v1/late-data"},
+		{http.MethodDelete, "/api/v1/rate-limits/throttled"},
+	}
+	for _, rt := range routes {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(rt.method, rt.path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s 匿名呼叫應回傳 401，得到 %d", rt.method, rt.path, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(rt.method, rt.path, nil)
+		req.Header.Set(middleware.APIKeyHeader, "key")
+		r.ServeHTTP(w, req)
+		if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+			t.Errorf("%s %s 帶 API key 應通過授權，得到 %d", rt.method, rt.path, w.Code)
+		}
+	}
+
+	// 讀取端點維持公開
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/device-types", nil))
+	if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+		t.Errorf("讀取端點不應要求登入，得到 %d", w.Code)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"iot-data-collection/app/internal/anomaly"
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// AnomalyService 設備異常偵測的設定與評估；EWMA 基準狀態存於 Redis，
+// 由 worker 依序更新（同一設備的讀值假設由單一 worker 處理）
+type AnomalyService interface {
+	GetSettings(ctx context.Context, tenantID, deviceID string) (*models.AnomalySettings, error)
+	PutSettings(ctx context.Context, tenantID, deviceID string, req models.PutAnomalySettingsRequest) (*models.AnomalySettings, error)
+	// ResetBaseline 清除 EWMA 基準，設備重新暖機（例如設備維修或搬遷後）
+	ResetBaseline(ctx context.Context, tenantID, deviceID string) error
+	// Evaluate 以目前的基準計算讀值的異常分數，不保存基準；設備未啟用偵測時 Result 為 nil
+	Evaluate(ctx context.Context, tenantID, deviceID string, values map[string]float64) (*AnomalyEvaluation, error)
+	// CommitBaseline 保存納入讀值後的基準；讀值寫入成功後才呼叫，寫入失敗或被隔離的讀值不影響基準
+	CommitBaseline(ctx context.Context, tenantID, deviceID string, baseline anomaly.State) error
+}
+
+// AnomalyEvaluation Evaluate 的結果；Baseline 為納入本筆讀值後的基準（未啟用偵測時為 nil）
+type AnomalyEvaluation struct {
+	Result   *anomaly.Result
+	Settings *models.AnomalySettings
+	Baseline anomaly.State
+}
+
+type anomalyServiceImpl struct {
+	db  interfaces.DBClient
+	rdb interfaces.RedisClient
+}
+
+// NewAnomalyService 建立 AnomalyService
+func NewAnomalyService(db interfaces.DBClient, rdb interfaces.RedisClient) AnomalyService {
+	return &anomalyServiceImpl{db: db, rdb: rdb}
+}
+
+// defaultAnomalySettings 未設定的設備：停用偵測，參數為預設值
+func defaultAnomalySettings(tenantID, deviceID string) *models.AnomalySettings {
+	return &models.AnomalySettings{
+		TenantID:   tenantID,
+		DeviceID:   deviceID,
+		Alpha:      anomaly.DefaultAlpha,
+		Threshold:  anomaly.DefaultThreshold,
+		MinSamples: anomaly.DefaultMinSamples,
+		Fields:     append([]string(nil), models.CoreMetricFields...),
+		Alert:      true,
+	}
+}
+
+// GetSettings 取得設備的偵測設定（優先讀快取）；未設定時回傳停用的預設值
+func (s *anomalyServiceImpl) GetSettings(ctx context.Context, tenantID, deviceID string) (*models.AnomalySettings, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	cacheKey := cache.AnomalySettingsKey(tenantID, deviceID)
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		var st models.AnomalySettings
+		if jsonErr := json.Unmarshal([]byte(cached), &st); jsonErr == nil {
+			return &st, nil
+		}
+	}
+
+	st := &models.AnomalySettings{}
+	err := s.db.QueryRow(`
+		SELECT tenant_id, device_id, enabled, alpha, threshold, min_samples, fields, alert, updated_at
+		FROM anomaly_settings
+		WHERE tenant_id = $1 AND device_id = $2
+	`, tenantID, deviceID).Scan(&st.TenantID, &st.DeviceID, &st.Enabled, &st.Alpha, &st.Threshold,
+		&st.MinSamples, pq.Array(&st.Fields), &st.Alert, &st.UpdatedAt)
+	if err == sql.ErrNoRows {
+		st = defaultAnomalySettings(tenantID, deviceID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if jsonBytes, err := json.Marshal(st); err == nil {
+		if err := s.rdb.Set(ctx, cacheKey, string(jsonBytes), cache.AnomalySettingsTTL()); err != nil {
+			logger.FromContext(ctx).Warn("cache anomaly settings failed", logger.Err(err))
+		}
+	}
+	return st, nil
+}
+
+func (s *anomalyServiceImpl) PutSettings(ctx context.Context, tenantID, deviceID string, req models.PutAnomalySettingsRequest) (*models.AnomalySettings, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	st := defaultAnomalySettings(tenantID, deviceID)
+	st.Enabled = req.Enabled
+	if req.Alpha > 0 {
+		st.Alpha = req.Alpha
+	}
+	if req.Threshold > 0 {
+		st.Threshold = req.Threshold
+	}
+	if req.MinSamples > 0 {
+		st.MinSamples = req.MinSamples
+	}
+	if req.Alert != nil {
+		st.Alert = *req.Alert
+	}
+	if len(req.Fields) > 0 {
+		var errs []FieldError
+		seen := map[string]bool{}
+		st.Fields = st.Fields[:0]
+		for _, name := range req.Fields {
+			if !fieldNamePattern.MatchString(name) {
+				errs = append(errs, FieldError{Field: "fields", Message: "無效的欄位名稱: " + name})
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				st.Fields = append(st.Fields, name)
+			}
+		}
+		if len(errs) > 0 {
+			return nil, &ValidationError{Errors: errs}
+		}
+	}
+
+	err := s.db.QueryRow(`
+		INSERT INTO anomaly_settings (tenant_id, device_id, enabled, alpha, threshold, min_samples, fields, alert, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, alpha = EXCLUDED.alpha, threshold = EXCLUDED.threshold,
+			min_samples = EXCLUDED.min_samples, fields = EXCLUDED.fields, alert = EXCLUDED.alert,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`, tenantID, deviceID, st.Enabled, st.Alpha, st.Threshold, st.MinSamples, pq.Array(st.Fields), st.Alert).Scan(&st.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rdb.Del(ctx, cache.AnomalySettingsKey(tenantID, deviceID)); err != nil {
+		logger.FromContext(ctx).Warn("invalidate anomaly settings cache failed", logger.Err(err))
+	}
+	logger.FromContext(ctx).Info("anomaly settings updated",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID),
+		slog.Bool("enabled", st.Enabled))
+	return st, nil
+}
+
+func (s *anomalyServiceImpl) ResetBaseline(ctx context.Context, tenantID, deviceID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	return s.rdb.Del(ctx, cache.AnomalyStateKey(tenantID, deviceID))
+}
+
+func (s *anomalyServiceImpl) Evaluate(ctx context.Context, tenantID, deviceID string, values map[string]float64) (*AnomalyEvaluation, error) {
+	st, err := s.GetSettings(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !st.Enabled {
+		return &AnomalyEvaluation{Settings: st}, nil
+	}
+
+	state := anomaly.State{}
+	if cached, err := s.rdb.Get(ctx, cache.AnomalyStateKey(tenantID, deviceID)); err == nil {
+		if jsonErr := json.Unmarshal([]byte(cached), &state); jsonErr != nil {
+			logger.FromContext(ctx).Warn("decode anomaly state failed, rebuilding baseline", logger.Err(jsonErr))
+			state = anomaly.State{}
+		}
+	}
+
+	res := anomaly.Detect(state, anomaly.Settings{
+		Alpha:      st.Alpha,
+		Threshold:  st.Threshold,
+		MinSamples: st.MinSamples,
+		Fields:     st.Fields,
+	}, values)
+	return &AnomalyEvaluation{Result: &res, Settings: st, Baseline: state}, nil
+}
+
+func (s *anomalyServiceImpl) CommitBaseline(ctx context.Context, tenantID, deviceID string, baseline anomaly.State) error {
+	jsonBytes, err := json.Marshal(baseline)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, cache.AnomalyStateKey(tenantID, deviceID), string(jsonBytes), cache.AnomalyStateTTL())
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/logger"
+)
+
+// ClockSkewService 依政策檢查設備時間戳，並維護各設備的時鐘偏差統計
+type ClockSkewService interface {
+	// Check 判定設備時間戳並記錄統計；統計寫入失敗只記錄日誌，不影響判定
+	Check(ctx context.Context, tenantID, deviceID string, deviceTS, receivedAt time.Time) clockskew.Decision
+	Policy() clockskew.Policy
+	GetStats(ctx context.Context, tenantID, deviceID string) (*clockskew.Stats, error)
+	ListStats(ctx context.Context, tenantID string) ([]clockskew.Stats, error)
+	ResetStats(ctx context.Context, tenantID, deviceID string) error
+}
+
+type clockSkewServiceImpl struct {
+	policies clockskew.PolicySource
+	store    clockskew.Store
+}
+
+// NewClockSkewService 建立 ClockSkewService；policies 為 nil 時一律接受，store 為 nil 時不保存統計
+func NewClockSkewService(policies clockskew.PolicySource, store clockskew.Store) ClockSkewService {
+	return &clockSkewServiceImpl{policies: policies, store: store}
+}
+
+// current 目前生效的政策，每次判定時取得以支援熱更新
+func (s *clockSkewServiceImpl) current() *clockskew.Policy {
+	if s.policies == nil {
+		return nil
+	}
+	return s.policies.Current()
+}
+
+func (s *clockSkewServiceImpl) Check(ctx context.Context, tenantID, deviceID string, deviceTS, receivedAt time.Time) clockskew.Decision {
+	d := s.current().Evaluate(deviceTS, receivedAt)
+	log := logger.FromContext(ctx)
+	if d.Action != clockskew.ActionAccept {
+		log.Warn("device timestamp outside clock skew bounds",
+			slog.String(logger.KeyTenantID, tenantID),
+			slog.String(logger.KeyDeviceID, deviceID),
+			slog.String("action", d.Action),
+			slog.Duration("skew", d.Skew))
+	}
+	if s.store != nil {
+		if err := s.store.Observe(ctx, tenantID, deviceID, func(st *clockskew.Stats) {
+			st.Observe(d, receivedAt)
+		}); err != nil {
+			log.Warn("record clock skew failed", logger.Err(err))
+		}
+	}
+	return d
+}
+
+func (s *clockSkewServiceImpl) Policy() clockskew.Policy {
+	p := s.current()
+	if p == nil {
+		return clockskew.Policy{Mode: clockskew.ModeOff}
+	}
+	return *p
+}
+
+func (s *clockSkewServiceImpl) GetStats(ctx context.Context, tenantID, deviceID string) (*clockskew.Stats, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if s.store == nil {
+		return &clockskew.Stats{DeviceID: deviceID}, nil
+	}
+	return s.store.Get(ctx, tenantID, deviceID)
+}
+
+func (s *clockSkewServiceImpl) ListStats(ctx context.Context, tenantID string) ([]clockskew.Stats, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if s.store == nil {
+		return []clockskew.Stats{}, nil
+	}
+	return s.store.List(ctx, tenantID)
+}
+
+func (s *clockSkewServiceImpl) ResetStats(ctx context.Context, tenantID, deviceID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Reset(ctx, tenantID, deviceID)
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"iot-data-collection/app/internal/command"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultCommandTTL 未指定 TTL 時指令的有效時間
+	DefaultCommandTTL = time.Hour
+	// maxCommandPayload 指令 payload 的大小上限
+	maxCommandPayload = 8 << 10
+	// maxCommandPull 單次取出的指令數上限
+	maxCommandPull = 50
+	// DefaultCommandDeliveryLease 未指定時，指令送出後等待設備回報結果的時間，逾時未回報即重送
+	DefaultCommandDeliveryLease = 2 * time.Minute
+)
+
+var commandNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// EnqueueCommandInput 建立指令的輸入
+type EnqueueCommandInput struct {
+	TenantID  string
+	DeviceID  string
+	Name      string
+	Payload   json.RawMessage
+	TTL       time.Duration // 0 表示使用 DefaultCommandTTL
+	CreatedBy string
+}
+
+// ListCommandsInput 查詢指令歷史的輸入
+type ListCommandsInput struct {
+	TenantID string
+	DeviceID string
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+// CommandService 雲端對設備的指令：建立後寫入 DB 並放入設備的 Redis 佇列，
+// 設備取出時標記為 delivered，回報結果後為 succeeded / failed；逾期未完成的指令在查詢或取出時標記為 expired。
+// 送出後超過租約時間仍未回報結果的指令會再次送出（至少一次），設備需以指令 ID 去除重複
+type CommandService interface {
+	Enqueue(ctx context.Context, in EnqueueCommandInput) (*models.DeviceCommand, error)
+	// Pull 取出設備待執行與租約到期待重送的指令（最多 limit 筆）並標記為 delivered
+	Pull(ctx context.Context, tenantID, deviceID string, limit int) ([]models.DeviceCommand, error)
+	Ack(ctx context.Context, tenantID, deviceID string, id int64, req models.AckCommandRequest) (*models.DeviceCommand, error)
+	GetCommand(ctx context.Context, tenantID, deviceID string, id int64) (*models.DeviceCommand, error)
+	ListCommands(ctx context.Context, in ListCommandsInput) ([]models.DeviceCommand, error)
+}
+
+type commandServiceImpl struct {
+	db    interfaces.DBClient
+	queue command.Queue
+	lease time.Duration
+}
+
+// NewCommandService 建立 CommandService；lease <= 0 時使用 DefaultCommandDeliveryLease
+func NewCommandService(db interfaces.DBClient, queue command.Queue, lease time.Duration) CommandService {
+	if lease <= 0 {
+		lease = DefaultCommandDeliveryLease
+	}
+	return &commandServiceImpl{db: db, queue: queue, lease: lease}
+}
+
+const commandColumns = `id, tenant_id, device_id, name, payload, status, result, created_by,
+	created_at, expires_at, delivered_at, completed_at`
+
+func (s *commandServiceImpl) Enqueue(ctx context.Context, in EnqueueCommandInput) (*models.DeviceCommand, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	var errs []FieldError
+	if !commandNamePattern.MatchString(in.Name) {
+		errs = append(errs, FieldError{Field: "name", Message: "指令名稱須為小寫英文字母開頭，只能包含小寫英數字、底線、點與連字號"})
+	}
+	var payload interface{}
+	if len(in.Payload) > 0 && string(in.Payload) != "null" {
+		if len(in.Payload) > maxCommandPayload {
+			errs = append(errs, FieldError{Field: "payload", Message: "指令內容超過 8KB 上限"})
+		}
+		payload = string(in.Payload)
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	ttl := in.TTL
+	if ttl <= 0 {
+		ttl = DefaultCommandTTL
+	}
+
+	row := s.db.QueryRow(`
+		INSERT INTO device_commands (tenant_id, device_id, name, payload, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + $6 * INTERVAL '1 millisecond')
+		RETURNING `+commandColumns,
+		in.TenantID, in.DeviceID, in.Name, payload, in.CreatedBy, ttl.Milliseconds())
+	cmd, err := scanCommand(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.queue.Push(ctx, in.TenantID, in.DeviceID, cmd.ID, ttl); err != nil {
+		// 佇列寫入失敗時刪除指令，避免留下設備永遠取不到的 pending 指令
+		if _, delErr := s.db.Exec(`DELETE FROM device_commands WHERE id = $1`, cmd.ID); delErr != nil {
+			logger.FromContext(ctx).Error("remove unqueued command failed", logger.Err(delErr), slog.Int64("command_id", cmd.ID))
+		}
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("device command enqueued",
+		slog.String(logger.KeyTenantID, in.TenantID),
+		slog.String(logger.KeyDeviceID, in.DeviceID),
+		slog.Int64("command_id", cmd.ID),
+		slog.String("command", in.Name))
+	return cmd, nil
+}
+
+func (s *commandServiceImpl) Pull(ctx context.Context, tenantID, deviceID string, limit int) ([]models.DeviceCommand, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if limit <= 0 || limit > maxCommandPull {
+		limit = maxCommandPull
+	}
+	if err := s.expire(tenantID, deviceID); err != nil {
+		return nil, err
+	}
+
+	// 先重送租約已過期（送出後未在時間內回報結果，例如回應未送達設備）的指令，再從佇列取新的指令
+	list, err := s.redeliver(tenantID, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if n := limit - len(list); n > 0 {
+		ids, err := s.queue.Pop(ctx, tenantID, deviceID, n)
+		if err != nil {
+			return nil, err
+		}
+		delivered, err := s.deliver(ctx, tenantID, deviceID, ids)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, delivered...)
+	}
+	// UPDATE ... RETURNING 不保證順序，依入列順序（ID 遞增）回傳
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// redeliver 取出送出超過租約時間仍未回報結果的指令，更新送出時間後再次送出
+func (s *commandServiceImpl) redeliver(tenantID, deviceID string, limit int) ([]models.DeviceCommand, error) {
+	rows, err := s.db.Query(`
+		UPDATE device_commands
+		SET delivered_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM device_commands
+			WHERE tenant_id = $1 AND device_id = $2 AND status = 'delivered'
+				AND delivered_at <= CURRENT_TIMESTAMP - $3 * INTERVAL '1 millisecond'
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		) AND status = 'delivered'
+		RETURNING `+commandColumns,
+		tenantID, deviceID, s.lease.Milliseconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommands(rows)
+}
+
+// deliver 將自佇列取出的指令標記為 delivered；任何失敗都放回佇列，指令不會因此遺失
+func (s *commandServiceImpl) deliver(ctx context.Context, tenantID, deviceID string, ids []int64) ([]models.DeviceCommand, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`
+		UPDATE device_commands
+		SET status = 'delivered', delivered_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND device_id = $2 AND id = ANY($3) AND status = 'pending'
+		RETURNING `+commandColumns,
+		tenantID, deviceID, pq.Array(ids))
+	if err != nil {
+		s.requeue(ctx, tenantID, deviceID, ids)
+		return nil, err
+	}
+	list, err := scanCommands(rows)
+	if err != nil {
+		// UPDATE 已生效，改回 pending 後放回佇列；改回失敗時由租約到期後重送
+		if _, resetErr := s.db.Exec(`
+			UPDATE device_commands SET status = 'pending', delivered_at = NULL
+			WHERE tenant_id = $1 AND device_id = $2 AND id = ANY($3) AND status = 'delivered'
+		`, tenantID, deviceID, pq.Array(ids)); resetErr != nil {
+			logger.FromContext(ctx).Error("reset undelivered commands failed", logger.Err(resetErr))
+			return nil, err
+		}
+		s.requeue(ctx, tenantID, deviceID, ids)
+		return nil, err
+	}
+	return list, nil
+}
+
+// requeue 取出後未能送出時放回佇列，下次再送
+func (s *commandServiceImpl) requeue(ctx context.Context, tenantID, deviceID string, ids []int64) {
+	if err := s.queue.Requeue(ctx, tenantID, deviceID, ids); err != nil {
+		logger.FromContext(ctx).Error("requeue device commands failed", logger.Err(err),
+			slog.String(logger.KeyTenantID, tenantID),
+			slog.String(logger.KeyDeviceID, deviceID))
+	}
+}
+
+func (s *commandServiceImpl) Ack(ctx context.Context, tenantID, deviceID string, id int64, req models.AckCommandRequest) (*models.DeviceCommand, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if err := s.expire(tenantID, deviceID); err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if len(req.Result) > 0 && string(req.Result) != "null" {
+		if len(req.Result) > maxCommandPayload {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "result", Message: "執行結果超過 8KB 上限"}}}
+		}
+		result = string(req.Result)
+	}
+
+	// 設備可能未經 Pull 直接由其他管道收到指令，pending 也接受回報
+	row := s.db.QueryRow(`
+		UPDATE device_commands
+		SET status = $4, result = $5, completed_at = CURRENT_TIMESTAMP,
+			delivered_at = COALESCE(delivered_at, CURRENT_TIMESTAMP)
+		WHERE tenant_id = $1 AND device_id = $2 AND id = $3 AND status IN ('pending', 'delivered')
+		RETURNING `+commandColumns,
+		tenantID, deviceID, id, req.Status, result)
+	cmd, err := scanCommand(row)
+	if err == sql.ErrNoRows {
+		if _, getErr := s.GetCommand(ctx, tenantID, deviceID, id); getErr != nil {
+			return nil, getErr
+		}
+		return nil, ErrCommandCompleted
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("device command acknowledged",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID),
+		slog.Int64("command_id", id),
+		slog.String("status", req.Status))
+	return cmd, nil
+}
+
+func (s *commandServiceImpl) GetCommand(ctx context.Context, tenantID, deviceID string, id int64) (*models.DeviceCommand, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if err := s.expire(tenantID, deviceID); err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow(`SELECT `+commandColumns+` FROM device_commands WHERE tenant_id = $1 AND device_id = $2 AND id = $3`,
+		tenantID, deviceID, id)
+	cmd, err := scanCommand(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrCommandNotFound
+	}
+	return cmd, err
+}
+
+func (s *commandServiceImpl) ListCommands(ctx context.Context, in ListCommandsInput) ([]models.DeviceCommand, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if err := s.expire(in.TenantID, in.DeviceID); err != nil {
+		return nil, err
+	}
+	limit := listLimit(in.Limit)
+	offset := in.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `SELECT ` + commandColumns + ` FROM device_commands WHERE tenant_id = $1 AND device_id = $2`
+	args := []interface{}{in.TenantID, in.DeviceID}
+	if in.Status != "" {
+		args = append(args, in.Status)
+		query += " AND status = $" + strconv.Itoa(len(args))
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommands(rows)
+}
+
+// expire 將設備逾期未完成的指令標記為 expired（查詢時順便處理，不需背景排程）
+func (s *commandServiceImpl) expire(tenantID, deviceID string) error {
+	_, err := s.db.Exec(`
+		UPDATE device_commands
+		SET status = 'expired', completed_at = expires_at
+		WHERE tenant_id = $1 AND device_id = $2 AND status IN ('pending', 'delivered') AND expires_at <= CURRENT_TIMESTAMP
+	`, tenantID, deviceID)
+	return err
+}
+
+// scanCommands 讀取所有列並關閉 rows
+func scanCommands(rows *sql.Rows) ([]models.DeviceCommand, error) {
+	defer rows.Close()
+	list := []models.DeviceCommand{}
+	for rows.Next() {
+		cmd, err := scanCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *cmd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func scanCommand(row rowScanner) (*models.DeviceCommand, error) {
+	var cmd models.DeviceCommand
+	var payload, result []byte
+	var deliveredAt, completedAt sql.NullTime
+	if err := row.Scan(&cmd.ID, &cmd.TenantID, &cmd.DeviceID, &cmd.Name, &payload, &cmd.Status, &result,
+		&cmd.CreatedBy, &cmd.CreatedAt, &cmd.ExpiresAt, &deliveredAt, &completedAt); err != nil {
+		return nil, err
+	}
+	if len(payload) > 0 {
+		cmd.Payload = json.RawMessage(payload)
+	}
+	if len(result) > 0 {
+		cmd.Result = json.RawMessage(result)
+	}
+	if deliveredAt.Valid {
+		cmd.DeliveredAt = &deliveredAt.Time
+	}
+	if completedAt.Valid {
+		cmd.CompletedAt = &completedAt.Time
+	}
+	return &cmd, nil
+}
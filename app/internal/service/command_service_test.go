@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEnqueueCommandValidation(t *testing.T) {
+	svc := NewCommandService(nil, nil, 0)
+	_, err := svc.Enqueue(context.Background(), EnqueueCommandInput{
+		TenantID: "t1",
+		DeviceID: "d1",
+		Name:     "Reboot Now",
+		Payload:  json.RawMessage(`"` + strings.Repeat("x", maxCommandPayload) + `"`),
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("期望名稱與 payload 驗證失敗，得到 %v", err)
+	}
+
+	for _, name := range []string{"reboot", "set_interval", "fw.update-2"} {
+		if !commandNamePattern.MatchString(name) {
+			t.Errorf("%s 應為合法的指令名稱", name)
+		}
+	}
+}
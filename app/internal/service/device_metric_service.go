@@ -2,13 +2,19 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
-	"strconv"
+	"errors"
+	"log/slog"
+	"sort"
 	"time"
 
 	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/geo"
+	"iot-data-collection/app/internal/idgen"
 	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/metricstore"
 	"iot-data-collection/app/internal/models"
 
 	"golang.org/x/sync/singleflight"
@@ -16,173 +22,287 @@ import (
 
 // SubmitMetricInput 提交 metric 的輸入
 type SubmitMetricInput struct {
+	TenantID    string
 	DeviceID    string
-	Voltage     float64
-	Current     float64
-	Temperature float64
+	Voltage     *float64 // 核心量測值；未回報時為 nil，是否必填依設備類型 schema 決定
+	Current     *float64
+	Temperature *float64
 	Status      string
 	Timestamp   string // 空字串表示使用當下時間
+	Fields      map[string]float64
+	Latitude    *float64 // 行動設備回報的位置，須同時提供
+	Longitude   *float64
+	// ReceivedAt 重新注入隔離資料時帶入原始接收時間；非 nil 時不做時鐘偏差檢查，也不計入偏差統計
+	ReceivedAt *time.Time
 }
 
 // GetMetricsInput 查詢歷史 metrics 的輸入
 type GetMetricsInput struct {
+	TenantID  string
 	DeviceID  string
 	StartTime *time.Time
 	EndTime   *time.Time
 	Limit     int
 	Offset    int
+	Fields    []string // 非空時只回傳指定的其他量測欄位
+
+	OnlyAnomalies bool // 只回傳被判定為異常的讀值
+}
+
+// GetSeriesInput 查詢單一欄位時間序列的輸入，Field 可為核心欄位或設備類型宣告的欄位
+type GetSeriesInput struct {
+	TenantID  string
+	DeviceID  string
+	Field     string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+}
+
+// GetEnergyInput 查詢區間用電量的輸入，區間為 (StartTime, EndTime]
+type GetEnergyInput struct {
+	TenantID  string
+	DeviceID  string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// ListDevicesInput 列出設備的輸入；各篩選條件可同時使用
+type ListDevicesInput struct {
+	TenantID string
+	AnyTags  []string // 非空時只列出帶有任一標籤的設備
+	Status   string   // 最新一筆的狀態
+	Site     string
+	BBox     *geo.BBox   // 位置在矩形範圍內
+	Within   *geo.Circle // 位置在半徑內，附上與中心點的距離；未指定排序時依距離由近到遠排序
+	Sort     string      // 排序欄位，見 DeviceSort*；空字串時依 device ID（半徑查詢時依距離）
+	Desc     bool
+	Limit    int // 0 表示不分頁，回傳全部符合的設備
+	Offset   int
+}
+
+// 設備清單的排序欄位
+const (
+	DeviceSortDeviceID    = metricstore.SortDeviceID
+	DeviceSortLastUpdated = metricstore.SortLastUpdated
+	DeviceSortStatus      = metricstore.SortStatus
+	DeviceSortDistance    = "distance" // 僅限半徑查詢
+)
+
+// ListDevicesResult 設備清單的一頁與符合條件的總數
+type ListDevicesResult struct {
+	Devices []models.DeviceListResponse
+	Total   int
 }
 
 // GetLatestResult 取得最新一筆的結果（含資料來源）
 type GetLatestResult struct {
 	Data   models.DeviceMetric
-	Source string // "cache" 或 "database"
+	Source string // "memory"（程序內快取）、"cache"（Redis）或 "database"
 }
 
 // DeviceMetricService 設備指標的業務邏輯介面
 type DeviceMetricService interface {
 	SubmitMetric(ctx context.Context, in SubmitMetricInput) error
 	GetMetrics(ctx context.Context, in GetMetricsInput) ([]models.DeviceMetric, error)
-	GetLatest(ctx context.Context, deviceID string) (*GetLatestResult, error)
-	ListDevices(ctx context.Context) ([]models.DeviceListResponse, error)
+	GetSeries(ctx context.Context, in GetSeriesInput) ([]models.SeriesPoint, error)
+	GetLatest(ctx context.Context, tenantID, deviceID string) (*GetLatestResult, error)
+	GetEnergy(ctx context.Context, in GetEnergyInput) (*models.EnergyReport, error)
+	ListDevices(ctx context.Context, in ListDevicesInput) (*ListDevicesResult, error)
 }
 
 // deviceMetricServiceImpl 實作
 type deviceMetricServiceImpl struct {
-	db          interfaces.DBClient
+	store       metricstore.Store
 	rdb         interfaces.RedisClient
 	metricQueue interfaces.MetricQueue
+	deviceTypes DeviceTypeService
+	profiles    ValidationProfileService
+	clockSkew   ClockSkewService
 	sf          singleflight.Group
 }
 
 // NewDeviceMetricService 建立 DeviceMetricService
 func NewDeviceMetricService(
-	db interfaces.DBClient,
+	store metricstore.Store,
 	rdb interfaces.RedisClient,
 	metricQueue interfaces.MetricQueue,
+	deviceTypes DeviceTypeService,
+	profiles ValidationProfileService,
+	clockSkew ClockSkewService,
 ) DeviceMetricService {
 	return &deviceMetricServiceImpl{
-		db:          db,
+		store:       store,
 		rdb:         rdb,
 		metricQueue: metricQueue,
+		deviceTypes: deviceTypes,
+		profiles:    profiles,
+		clockSkew:   clockSkew,
 	}
 }
 
 func (s *deviceMetricServiceImpl) SubmitMetric(ctx context.Context, in SubmitMetricInput) error {
-	timestampStr := in.Timestamp
+	if in.TenantID == "" {
+		return ErrTenantRequired
+	}
+	receivedAt := time.Now()
+	if in.ReceivedAt != nil {
+		receivedAt = *in.ReceivedAt
+	}
+	timestampStr, deviceTimestamp := in.Timestamp, ""
 	if timestampStr != "" {
-		if _, err := time.Parse(time.RFC3339, timestampStr); err != nil {
+		ts, err := time.Parse(time.RFC3339, timestampStr)
+		if err != nil {
 			return ErrInvalidTimestamp
 		}
+		// 與接收時間比對設備時鐘；超出容許範圍時依政策拒絕或以接收時間取代。
+		// 重新注入的資料已在原始接收時檢查過，再檢查會把補處理的時間差誤判為偏差
+		if s.clockSkew != nil && in.ReceivedAt == nil {
+			switch d := s.clockSkew.Check(ctx, in.TenantID, in.DeviceID, ts, receivedAt); d.Action {
+			case clockskew.ActionReject:
+				return &ValidationError{Errors: []FieldError{{Field: "timestamp", Message: "時間戳與伺服器時間差距過大（偏差 " + d.Skew.Round(time.Second).String() + "）"}}}
+			case clockskew.ActionCorrect:
+				timestampStr, deviceTimestamp = d.Timestamp.UTC().Format(time.RFC3339Nano), in.Timestamp
+			}
+		}
 	} else {
-		timestampStr = time.Now().Format(time.RFC3339)
+		timestampStr = receivedAt.Format(time.RFC3339)
+	}
+
+	var schema *models.DeviceType
+	if s.deviceTypes != nil {
+		var err error
+		if schema, err = s.deviceTypes.SchemaForDevice(ctx, in.TenantID, in.DeviceID); err != nil {
+			return err
+		}
+	}
+	rules := DefaultValidationRules()
+	if s.profiles != nil {
+		eff, err := s.profiles.EffectiveProfile(ctx, in.TenantID, in.DeviceID)
+		if err != nil {
+			return err
+		}
+		rules = eff.Rules
+	}
+
+	core := coreValues(in.Voltage, in.Current, in.Temperature)
+	values := make(map[string]float64, len(core)+len(in.Fields))
+	for name, v := range core {
+		if v != nil {
+			values[name] = *v
+		}
+	}
+	for name, v := range in.Fields {
+		values[name] = v
+	}
+	errs := validateCoreFields(schema, core)
+	errs = append(errs, validateRanges(rules, values)...)
+	errs = append(errs, validateFields(schema, in.Fields)...)
+	errs = append(errs, validateLocation(in.Latitude, in.Longitude)...)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
 	}
 
 	task := &interfaces.MetricTask{
+		TaskID:      idgen.New(),
+		RequestID:   logger.RequestIDFromContext(ctx),
+		TenantID:    in.TenantID,
 		DeviceID:    in.DeviceID,
 		Voltage:     in.Voltage,
 		Current:     in.Current,
 		Temperature: in.Temperature,
 		Status:      in.Status,
 		Timestamp:   timestampStr,
+		ReceivedAt:  receivedAt.UTC().Format(time.RFC3339Nano),
+		DeviceTime:  deviceTimestamp,
+		Fields:      in.Fields,
+		Latitude:    in.Latitude,
+		Longitude:   in.Longitude,
 	}
+	log := logger.FromContext(ctx).With(
+		slog.String(logger.KeyTenantID, in.TenantID),
+		slog.String(logger.KeyDeviceID, in.DeviceID),
+		slog.String(logger.KeyTaskID, task.TaskID),
+	)
 	if err := s.metricQueue.Push(ctx, task); err != nil {
+		log.Error("enqueue metric task failed", logger.Err(err))
 		return err
 	}
+	log.Debug("metric task enqueued")
 	return nil
 }
 
 func (s *deviceMetricServiceImpl) GetMetrics(ctx context.Context, in GetMetricsInput) ([]models.DeviceMetric, error) {
-	limit := in.Limit
-	if limit <= 0 || limit > 1000 {
-		limit = 100
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
 	}
+	limit := listLimit(in.Limit)
 	offset := in.Offset
 	if offset < 0 {
 		offset = 0
 	}
 
-	query := `
-		SELECT id, device_id, voltage, current, temperature, status, timestamp, created_at 
-		FROM device_metrics 
-		WHERE device_id = $1
-	`
-	args := []interface{}{in.DeviceID}
-	argIndex := 2
-
-	if in.StartTime != nil {
-		query += " AND timestamp >= $" + strconv.Itoa(argIndex)
-		args = append(args, *in.StartTime)
-		argIndex++
-	}
-	if in.EndTime != nil {
-		query += " AND timestamp <= $" + strconv.Itoa(argIndex)
-		args = append(args, *in.EndTime)
-		argIndex++
-	}
-
-	query += " ORDER BY timestamp DESC LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
+	return s.store.Range(ctx, metricstore.RangeQuery{
+		TenantID:      in.TenantID,
+		DeviceID:      in.DeviceID,
+		StartTime:     in.StartTime,
+		EndTime:       in.EndTime,
+		Limit:         limit,
+		Offset:        offset,
+		Fields:        in.Fields,
+		OnlyAnomalies: in.OnlyAnomalies,
+	})
+}
 
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, err
+func (s *deviceMetricServiceImpl) GetSeries(ctx context.Context, in GetSeriesInput) ([]models.SeriesPoint, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
 	}
-	defer rows.Close()
-
-	var list []models.DeviceMetric
-	for rows.Next() {
-		var d models.DeviceMetric
-		if err := rows.Scan(&d.ID, &d.DeviceID, &d.Voltage, &d.Current,
-			&d.Temperature, &d.Status, &d.Timestamp, &d.CreatedAt); err != nil {
-			return nil, err
-		}
-		list = append(list, d)
+	if !fieldNamePattern.MatchString(in.Field) {
+		return nil, ErrInvalidInput
 	}
-	return list, nil
+	return s.store.Series(ctx, metricstore.SeriesQuery{
+		TenantID:  in.TenantID,
+		DeviceID:  in.DeviceID,
+		Field:     in.Field,
+		StartTime: in.StartTime,
+		EndTime:   in.EndTime,
+		Limit:     seriesLimit(in.Limit),
+	})
 }
 
-func (s *deviceMetricServiceImpl) GetLatest(ctx context.Context, deviceID string) (*GetLatestResult, error) {
-	cacheKey := cache.LatestMetricKey(deviceID)
+func (s *deviceMetricServiceImpl) GetLatest(ctx context.Context, tenantID, deviceID string) (*GetLatestResult, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	cacheKey := cache.LatestMetricKey(tenantID, deviceID)
 
-	cached, err := s.rdb.Get(ctx, cacheKey)
-	if err == nil {
-		var data models.DeviceMetric
-		if jsonErr := json.Unmarshal([]byte(cached), &data); jsonErr == nil {
-			return &GetLatestResult{Data: data, Source: "cache"}, nil
-		}
+	if result := s.cachedLatest(ctx, cacheKey); result != nil {
+		return result, nil
 	}
 
-	sfKey := "GetLatest:" + deviceID
+	sfKey := "GetLatest:" + tenantID + ":" + deviceID
 	v, err, _ := s.sf.Do(sfKey, func() (interface{}, error) {
-		cached2, err2 := s.rdb.Get(ctx, cacheKey)
-		if err2 == nil {
-			var data models.DeviceMetric
-			if jsonErr := json.Unmarshal([]byte(cached2), &data); jsonErr == nil {
-				return &GetLatestResult{Data: data, Source: "cache"}, nil
-			}
+		if result := s.cachedLatest(ctx, cacheKey); result != nil {
+			return result, nil
 		}
 
-		query := `
-			SELECT id, device_id, voltage, current, temperature, status, timestamp, created_at 
-			FROM device_metrics 
-			WHERE device_id = $1
-			ORDER BY timestamp DESC
-			LIMIT 1
-		`
-		var data models.DeviceMetric
-		err2 = s.db.QueryRow(query, deviceID).Scan(
-			&data.ID, &data.DeviceID, &data.Voltage, &data.Current,
-			&data.Temperature, &data.Status, &data.Timestamp, &data.CreatedAt)
+		row, err2 := s.store.Latest(ctx, tenantID, deviceID)
 		if err2 != nil {
-			if err2 == sql.ErrNoRows {
+			if errors.Is(err2, metricstore.ErrNotFound) {
 				return nil, ErrDeviceNotFound
 			}
 			return nil, err2
 		}
+		data := *row
 
 		if jsonBytes, jsonErr := json.Marshal(data); jsonErr == nil {
-			s.rdb.Set(ctx, cacheKey, string(jsonBytes), cache.LatestMetricTTL)
+			// 以讀值時間戳比較，避免覆蓋 worker 同時寫入的較新資料
+			if _, setErr := s.rdb.SetIfNewer(ctx, cacheKey, string(jsonBytes), data.Timestamp.UnixMilli(), cache.LatestMetricTTL()); setErr != nil {
+				logger.FromContext(ctx).Warn("refill latest metric cache failed",
+					slog.String(logger.KeyTenantID, tenantID),
+					slog.String(logger.KeyDeviceID, deviceID), logger.Err(setErr))
+			}
 		}
 
 		return &GetLatestResult{Data: data, Source: "database"}, nil
@@ -194,28 +314,203 @@ func (s *deviceMetricServiceImpl) GetLatest(ctx context.Context, deviceID string
 	return v.(*GetLatestResult), nil
 }
 
-func (s *deviceMetricServiceImpl) ListDevices(ctx context.Context) ([]models.DeviceListResponse, error) {
-	query := `
-		SELECT DISTINCT ON (device_id) 
-			device_id, 
-			timestamp as last_updated,
-			status as latest_status
-		FROM device_metrics
-		ORDER BY device_id, timestamp DESC
-	`
-	rows, err := s.db.Query(query)
+// cachedLatest 讀取最新值快取；有程序內快取層且由本機命中時 Source 為 "memory"
+func (s *deviceMetricServiceImpl) cachedLatest(ctx context.Context, cacheKey string) *GetLatestResult {
+	var cached string
+	var err error
+	source := "cache"
+	if tiered, ok := s.rdb.(interfaces.TieredRedisClient); ok {
+		var fromMemory bool
+		if cached, fromMemory, err = tiered.GetTiered(ctx, cacheKey); fromMemory {
+			source = "memory"
+		}
+	} else {
+		cached, err = s.rdb.Get(ctx, cacheKey)
+	}
+	if err != nil {
+		return nil
+	}
+	var data models.DeviceMetric
+	if json.Unmarshal([]byte(cached), &data) != nil {
+		return nil
+	}
+	return &GetLatestResult{Data: data, Source: source}
+}
+
+// ListDevices 由 worker 寫入時維護的各設備最新狀態取得清單，不掃描歷史讀值
+func (s *deviceMetricServiceImpl) ListDevices(ctx context.Context, in ListDevicesInput) (*ListDevicesResult, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	q := metricstore.DeviceQuery{
+		TenantID: in.TenantID,
+		AnyTags:  in.AnyTags,
+		Status:   in.Status,
+		Site:     in.Site,
+		BBox:     in.BBox,
+		Sort:     in.Sort,
+		Desc:     in.Desc,
+	}
+	if in.Limit > 0 {
+		q.Limit, q.Offset = listLimit(in.Limit), max(in.Offset, 0)
+	}
+	// 半徑查詢先以外接矩形粗篩，在 Go 精算距離後再分頁
+	byDistance := false
+	if in.Within != nil {
+		b := in.Within.BBox()
+		q.BBox, q.Limit, q.Offset = &b, 0, 0
+		if in.Sort == DeviceSortDistance || in.Sort == "" {
+			q.Sort, byDistance = "", true
+		}
+	}
+	devices, total, err := s.store.ListDevices(ctx, q)
+	if errors.Is(err, metricstore.ErrInvalidSort) {
+		return nil, ErrInvalidInput
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if in.Within == nil {
+		return &ListDevicesResult{Devices: devices, Total: total}, nil
+	}
+
+	result := &ListDevicesResult{Devices: []models.DeviceListResponse{}}
+	for _, d := range devices {
+		if d.Latitude == nil || d.Longitude == nil {
+			continue
+		}
+		dist, ok := in.Within.Contains(geo.Point{Lat: *d.Latitude, Lon: *d.Longitude})
+		if !ok {
+			continue
+		}
+		d.DistanceM = &dist
+		result.Devices = append(result.Devices, d)
+	}
+	if byDistance {
+		sort.SliceStable(result.Devices, func(i, j int) bool {
+			if in.Desc {
+				return *result.Devices[i].DistanceM > *result.Devices[j].DistanceM
+			}
+			return *result.Devices[i].DistanceM < *result.Devices[j].DistanceM
+		})
+	}
+	result.Total = len(result.Devices)
+	if in.Limit > 0 {
+		result.Devices = paginate(result.Devices, max(in.Offset, 0), listLimit(in.Limit))
+	}
+	return result, nil
+}
+
+// paginate 取出 [offset, offset+limit) 的範圍
+func paginate(list []models.DeviceListResponse, offset, limit int) []models.DeviceListResponse {
+	if offset >= len(list) {
+		return []models.DeviceListResponse{}
+	}
+	end := offset + limit
+	if end > len(list) {
+		end = len(list)
+	}
+	return list[offset:end]
+}
+
+// GetEnergy 加總區間內各筆讀值的電能增量；以增量加總而非累積值相減，因此不受歸零影響
+func (s *deviceMetricServiceImpl) GetEnergy(ctx context.Context, in GetEnergyInput) (*models.EnergyReport, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if !in.EndTime.After(in.StartTime) {
+		return nil, ErrInvalidInput
+	}
+
+	sum, err := s.store.Summarize(ctx, in.TenantID, in.DeviceID, in.StartTime, in.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EnergyReport{
+		DeviceID:    in.DeviceID,
+		StartTime:   in.StartTime,
+		EndTime:     in.EndTime,
+		EnergyKWh:   sum.EnergyKWh,
+		Readings:    sum.Readings,
+		FirstReadAt: sum.First,
+		LastReadAt:  sum.Last,
+	}, nil
+}
+
+// validateLocation 經緯度須同時提供且在合法範圍內
+func validateLocation(lat, lon *float64) []FieldError {
+	switch {
+	case lat == nil && lon == nil:
+		return nil
+	case lat == nil:
+		return []FieldError{{Field: "latitude", Message: "提供 longitude 時 latitude 為必填"}}
+	case lon == nil:
+		return []FieldError{{Field: "longitude", Message: "提供 latitude 時 longitude 為必填"}}
+	}
+	if !(geo.Point{Lat: *lat, Lon: *lon}).Valid() {
+		return []FieldError{{Field: "location", Message: "經緯度超出範圍（緯度 ±90、經度 ±180）"}}
+	}
+	return nil
+}
+
+// reader 唯讀查詢（歷史資料、設備清單、彙總）使用的連線；db 支援讀寫分離時導向 replica，可接受些許複寫延遲
+func reader(db interfaces.DBClient) interfaces.DBClient {
+	if r, ok := db.(interfaces.ReadRoutingDBClient); ok {
+		return r.Reader()
+	}
+	return db
+}
+
+// latestMetrics 取得多個設備各自最新一筆讀值：先讀最新值快取，未命中的設備由 store 讀取並回填快取；
+// 回傳結果與快取命中數，沒有任何讀值的設備不列入結果
+func latestMetrics(ctx context.Context, store metricstore.Store, rdb interfaces.RedisClient, tenantID string, deviceIDs []string) (map[string]models.DeviceMetric, int, error) {
+	latest := make(map[string]models.DeviceMetric, len(deviceIDs))
+	keys := make([]string, len(deviceIDs))
+	for i, id := range deviceIDs {
+		keys[i] = cache.LatestMetricKey(tenantID, id)
+	}
+	cached, err := rdb.GetMulti(ctx, keys)
+	if err != nil {
+		logger.FromContext(ctx).Warn("read latest metric cache failed, falling back to database", logger.Err(err))
+		cached = map[string]string{}
+	}
+	var misses []string
+	for i, id := range deviceIDs {
+		var m models.DeviceMetric
+		if v, ok := cached[keys[i]]; ok && json.Unmarshal([]byte(v), &m) == nil {
+			latest[id] = m
+			continue
+		}
+		misses = append(misses, id)
+	}
+	cacheHits := len(latest)
+	if len(misses) == 0 {
+		return latest, cacheHits, nil
+	}
+
+	found, err := store.LatestByDevice(ctx, tenantID, misses)
+	if err != nil {
+		return nil, 0, err
+	}
+	for id, m := range found {
+		latest[id] = m
+		// 與 GetLatest 相同以讀值時間戳比較，避免覆蓋 worker 同時寫入的較新資料
+		if jsonBytes, err := json.Marshal(m); err == nil {
+			if _, err := rdb.SetIfNewer(ctx, cache.LatestMetricKey(tenantID, id), string(jsonBytes),
+				m.Timestamp.UnixMilli(), cache.LatestMetricTTL()); err != nil {
+				logger.FromContext(ctx).Warn("refill latest metric cache failed", logger.Err(err))
+			}
+		}
+	}
+	return latest, cacheHits, nil
+}
 
-	var list []models.DeviceListResponse
-	for rows.Next() {
-		var d models.DeviceListResponse
-		if err := rows.Scan(&d.DeviceID, &d.LastUpdated, &d.LatestStatus); err != nil {
-			return nil, err
+// isCoreField 是否為以獨立欄位儲存的核心量測值
+func isCoreField(name string) bool {
+	for _, f := range models.CoreMetricFields {
+		if f == name {
+			return true
 		}
-		list = append(list, d)
 	}
-	return list, nil
+	return false
 }
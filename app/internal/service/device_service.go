@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/geo"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// DeviceService 設備登記資料（標籤、類型等）的管理
+type DeviceService interface {
+	GetDeviceTags(ctx context.Context, tenantID, deviceID string) ([]string, error)
+	DevicesWithAnyTag(ctx context.Context, tenantID string, tags []string) (map[string]bool, error)
+	SetDeviceTags(ctx context.Context, tenantID, deviceID string, tags []string) ([]string, error)
+	GetDeviceType(ctx context.Context, tenantID, deviceID string) (string, error)
+	SetDeviceType(ctx context.Context, tenantID, deviceID, deviceType string) error
+	ResetEnergy(ctx context.Context, tenantID, deviceID string) (time.Time, error)
+	GetLocation(ctx context.Context, tenantID, deviceID string) (*models.DeviceLocation, error)
+	SetLocation(ctx context.Context, tenantID, deviceID string, req models.SetDeviceLocationRequest) (*models.DeviceLocation, error)
+}
+
+type deviceServiceImpl struct {
+	db  interfaces.DBClient
+	rdb interfaces.RedisClient
+}
+
+// NewDeviceService 建立 DeviceService
+func NewDeviceService(db interfaces.DBClient, rdb interfaces.RedisClient) DeviceService {
+	return &deviceServiceImpl{db: db, rdb: rdb}
+}
+
+// GetDeviceTags 取得設備標籤；設備尚未登記時回傳空清單
+func (s *deviceServiceImpl) GetDeviceTags(ctx context.Context, tenantID, deviceID string) ([]string, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	rows, err := s.db.Query(`SELECT tags FROM devices WHERE tenant_id = $1 AND device_id = $2`, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	if rows.Next() {
+		if err := rows.Scan(pq.Array(&tags)); err != nil {
+			return nil, err
+		}
+	}
+	return tags, rows.Err()
+}
+
+// DevicesWithAnyTag 列出租戶內帶有任一標籤的設備，供以設備標籤限制的呼叫者過濾租戶層級的統計
+func (s *deviceServiceImpl) DevicesWithAnyTag(ctx context.Context, tenantID string, tags []string) (map[string]bool, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	rows, err := s.db.Query(`SELECT device_id FROM devices WHERE tenant_id = $1 AND tags && $2`, tenantID, pq.Array(tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		devices[id] = true
+	}
+	return devices, rows.Err()
+}
+
+// SetDeviceTags 覆寫設備標籤，設備不存在時一併登記
+func (s *deviceServiceImpl) SetDeviceTags(ctx context.Context, tenantID, deviceID string, tags []string) ([]string, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	normalized := normalizeTags(tags)
+	query := `
+		INSERT INTO devices (tenant_id, device_id, tags) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE SET tags = EXCLUDED.tags
+	`
+	if _, err := s.db.Exec(query, tenantID, deviceID, pq.Array(normalized)); err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("device tags updated",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID),
+		slog.Any("tags", normalized))
+	return normalized, nil
+}
+
+// GetDeviceType 取得設備類型（優先讀快取）；未登記或未設定類型時回傳空字串
+func (s *deviceServiceImpl) GetDeviceType(ctx context.Context, tenantID, deviceID string) (string, error) {
+	if tenantID == "" {
+		return "", ErrTenantRequired
+	}
+	cacheKey := cache.DeviceTypeKey(tenantID, deviceID)
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		return cached, nil
+	}
+
+	rows, err := s.db.Query(`SELECT device_type FROM devices WHERE tenant_id = $1 AND device_id = $2`, tenantID, deviceID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var deviceType string
+	if rows.Next() {
+		if err := rows.Scan(&deviceType); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	// 未登記的設備也快取空字串，避免新設備每次回報都查 DB
+	if err := s.rdb.Set(ctx, cacheKey, deviceType, cache.DeviceTypeTTL()); err != nil {
+		logger.FromContext(ctx).Warn("cache device type failed", logger.Err(err))
+	}
+	return deviceType, nil
+}
+
+// SetDeviceType 設定設備類型，設備不存在時一併登記
+func (s *deviceServiceImpl) SetDeviceType(ctx context.Context, tenantID, deviceID, deviceType string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	query := `
+		INSERT INTO devices (tenant_id, device_id, device_type) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE SET device_type = EXCLUDED.device_type
+	`
+	if _, err := s.db.Exec(query, tenantID, deviceID, deviceType); err != nil {
+		return err
+	}
+	if err := s.rdb.Del(ctx, cache.DeviceTypeKey(tenantID, deviceID)); err != nil {
+		logger.FromContext(ctx).Warn("invalidate device type cache failed", logger.Err(err))
+	}
+	logger.FromContext(ctx).Info("device type updated",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID),
+		slog.String("device_type", deviceType))
+	return nil
+}
+
+// normalizeTags 去除空白、重複並排序
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ResetEnergy 將設備累積電能歸零（例如更換電表），之後的讀值自 0 重新累積
+func (s *deviceServiceImpl) ResetEnergy(ctx context.Context, tenantID, deviceID string) (time.Time, error) {
+	if tenantID == "" {
+		return time.Time{}, ErrTenantRequired
+	}
+	var resetAt time.Time
+	err := s.db.QueryRow(`
+		INSERT INTO devices (tenant_id, device_id, energy_reset_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE SET energy_reset_at = EXCLUDED.energy_reset_at
+		RETURNING energy_reset_at
+	`, tenantID, deviceID).Scan(&resetAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	logger.FromContext(ctx).Info("device energy reset",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID))
+	return resetAt, nil
+}
+
+// GetLocation 尚未登記或未設定位置時經緯度為 null
+func (s *deviceServiceImpl) GetLocation(ctx context.Context, tenantID, deviceID string) (*models.DeviceLocation, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	loc := &models.DeviceLocation{DeviceID: deviceID}
+	err := s.db.QueryRow(`
+		SELECT latitude, longitude, site, location_updated_at FROM devices WHERE tenant_id = $1 AND device_id = $2
+	`, tenantID, deviceID).Scan(&loc.Latitude, &loc.Longitude, &loc.Site, &loc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return loc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+// SetLocation 設定固定設備的位置與站點
+func (s *deviceServiceImpl) SetLocation(ctx context.Context, tenantID, deviceID string, req models.SetDeviceLocationRequest) (*models.DeviceLocation, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if req.Latitude == nil || req.Longitude == nil || !(geo.Point{Lat: *req.Latitude, Lon: *req.Longitude}).Valid() {
+		return nil, ErrInvalidInput
+	}
+	loc := &models.DeviceLocation{DeviceID: deviceID}
+	err := s.db.QueryRow(`
+		INSERT INTO devices (tenant_id, device_id, latitude, longitude, site, location_updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE
+		SET latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, site = EXCLUDED.site,
+			location_updated_at = EXCLUDED.location_updated_at
+		RETURNING latitude, longitude, site, location_updated_at
+	`, tenantID, deviceID, *req.Latitude, *req.Longitude, strings.TrimSpace(req.Site)).Scan(&loc.Latitude, &loc.Longitude, &loc.Site, &loc.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("device location updated",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID))
+	return loc, nil
+}
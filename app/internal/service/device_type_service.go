@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"sort"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+)
+
+var (
+	deviceTypeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+	fieldNamePattern      = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+)
+
+// reservedFieldNames 不可作為自訂欄位名稱（metric 本身的屬性與推導值）；
+// 核心欄位可以宣告，用來指定是否必填與數值範圍，但仍以頂層欄位回報
+var reservedFieldNames = map[string]bool{
+	"status": true, "timestamp": true, "device_id": true, "tenant_id": true,
+	"power_w": true, "energy_delta_kwh": true, "energy_kwh": true,
+}
+
+// DeviceTypeService 設備類型與量測欄位 schema 的管理
+type DeviceTypeService interface {
+	ListDeviceTypes(ctx context.Context, tenantID string) ([]models.DeviceType, error)
+	GetDeviceType(ctx context.Context, tenantID, name string) (*models.DeviceType, error)
+	PutDeviceType(ctx context.Context, tenantID, name, description string, fields []models.FieldSpec) (*models.DeviceType, error)
+	DeleteDeviceType(ctx context.Context, tenantID, name string) error
+	// SchemaForDevice 取得設備所屬類型的 schema；設備未設定類型時回傳 nil
+	SchemaForDevice(ctx context.Context, tenantID, deviceID string) (*models.DeviceType, error)
+}
+
+type deviceTypeServiceImpl struct {
+	db      interfaces.DBClient
+	rdb     interfaces.RedisClient
+	devices DeviceService
+}
+
+// NewDeviceTypeService 建立 DeviceTypeService
+func NewDeviceTypeService(db interfaces.DBClient, rdb interfaces.RedisClient, devices DeviceService) DeviceTypeService {
+	return &deviceTypeServiceImpl{db: db, rdb: rdb, devices: devices}
+}
+
+func (s *deviceTypeServiceImpl) ListDeviceTypes(ctx context.Context, tenantID string) ([]models.DeviceType, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	query := `
+		SELECT tenant_id, name, description, fields, created_at, updated_at
+		FROM device_types
+		WHERE tenant_id = $1
+		ORDER BY name
+	`
+	rows, err := s.db.Query(query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.DeviceType
+	for rows.Next() {
+		var t models.DeviceType
+		var fieldsJSON []byte
+		if err := rows.Scan(&t.TenantID, &t.Name, &t.Description, &fieldsJSON, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(fieldsJSON, &t.Fields); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *deviceTypeServiceImpl) GetDeviceType(ctx context.Context, tenantID, name string) (*models.DeviceType, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	cacheKey := cache.DeviceTypeSchemaKey(tenantID, name)
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		var t models.DeviceType
+		if jsonErr := json.Unmarshal([]byte(cached), &t); jsonErr == nil {
+			return &t, nil
+		}
+	}
+
+	query := `
+		SELECT tenant_id, name, description, fields, created_at, updated_at
+		FROM device_types
+		WHERE tenant_id = $1 AND name = $2
+	`
+	var t models.DeviceType
+	var fieldsJSON []byte
+	if err := s.db.QueryRow(query, tenantID, name).Scan(
+		&t.TenantID, &t.Name, &t.Description, &fieldsJSON, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDeviceTypeNotFound
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(fieldsJSON, &t.Fields); err != nil {
+		return nil, err
+	}
+
+	if jsonBytes, err := json.Marshal(t); err == nil {
+		if err := s.rdb.Set(ctx, cacheKey, string(jsonBytes), cache.DeviceTypeSchemaTTL()); err != nil {
+			logger.FromContext(ctx).Warn("cache device type schema failed", logger.Err(err))
+		}
+	}
+	return &t, nil
+}
+
+func (s *deviceTypeServiceImpl) PutDeviceType(ctx context.Context, tenantID, name, description string, fields []models.FieldSpec) (*models.DeviceType, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if errs := validateSchema(name, fields); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	if fields == nil {
+		fields = []models.FieldSpec{}
+	}
+	fieldsJSON, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO device_types (tenant_id, name, description, fields) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, name) DO UPDATE
+		SET description = EXCLUDED.description, fields = EXCLUDED.fields, updated_at = CURRENT_TIMESTAMP
+		RETURNING tenant_id, name, description, created_at, updated_at
+	`
+	t := models.DeviceType{Fields: fields}
+	if err := s.db.QueryRow(query, tenantID, name, description, string(fieldsJSON)).Scan(
+		&t.TenantID, &t.Name, &t.Description, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, tenantID, name)
+	logger.FromContext(ctx).Info("device type saved",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String("device_type", name),
+		slog.Int("field_count", len(fields)))
+	return &t, nil
+}
+
+func (s *deviceTypeServiceImpl) DeleteDeviceType(ctx context.Context, tenantID, name string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	res, err := s.db.Exec(`DELETE FROM device_types WHERE tenant_id = $1 AND name = $2`, tenantID, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrDeviceTypeNotFound
+	}
+	s.invalidate(ctx, tenantID, name)
+	return nil
+}
+
+func (s *deviceTypeServiceImpl) SchemaForDevice(ctx context.Context, tenantID, deviceID string) (*models.DeviceType, error) {
+	typeName, err := s.devices.GetDeviceType(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if typeName == "" {
+		return nil, nil
+	}
+	t, err := s.GetDeviceType(ctx, tenantID, typeName)
+	if err == ErrDeviceTypeNotFound {
+		// 設備指定了尚未定義的類型，視同沒有 schema
+		return nil, nil
+	}
+	return t, err
+}
+
+func (s *deviceTypeServiceImpl) invalidate(ctx context.Context, tenantID, name string) {
+	if err := s.rdb.Del(ctx, cache.DeviceTypeSchemaKey(tenantID, name)); err != nil {
+		logger.FromContext(ctx).Warn("invalidate device type schema cache failed", logger.Err(err))
+	}
+}
+
+// validateSchema 檢查類型名稱與欄位定義
+func validateSchema(name string, fields []models.FieldSpec) []FieldError {
+	var errs []FieldError
+	if !deviceTypeNamePattern.MatchString(name) {
+		errs = append(errs, FieldError{Field: "name", Message: "類型名稱僅能包含英數字、底線、點與連字號，長度 1-64"})
+	}
+	seen := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		path := fmt.Sprintf("fields[%d]", i)
+		switch {
+		case !fieldNamePattern.MatchString(f.Name):
+			errs = append(errs, FieldError{Field: path + ".name", Message: "欄位名稱須為小寫英文開頭，僅含小寫英數字與底線"})
+		case reservedFieldNames[f.Name]:
+			errs = append(errs, FieldError{Field: path + ".name", Message: "欄位名稱 " + f.Name + " 為保留字"})
+		case seen[f.Name]:
+			errs = append(errs, FieldError{Field: path + ".name", Message: "欄位名稱 " + f.Name + " 重複"})
+		}
+		seen[f.Name] = true
+		if f.Type != models.FieldTypeNumber && f.Type != models.FieldTypeInteger {
+			errs = append(errs, FieldError{Field: path + ".type", Message: "type 只能是 number 或 integer"})
+		}
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			errs = append(errs, FieldError{Field: path + ".min", Message: "min 不可大於 max"})
+		}
+	}
+	return errs
+}
+
+// coreValues 以欄位名稱對應核心量測值
+func coreValues(voltage, current, temperature *float64) map[string]*float64 {
+	return map[string]*float64{"voltage": voltage, "current": current, "temperature": temperature}
+}
+
+// validateCoreFields 驗證核心量測值：設備未設定類型時三者皆為必填（與類型功能上線前相同）；
+// 有類型時只有 schema 宣告為必填者才必填，宣告的型別與範圍也一併檢查，未宣告者為選填
+func validateCoreFields(schema *models.DeviceType, core map[string]*float64) []FieldError {
+	var errs []FieldError
+	for _, name := range models.CoreMetricFields {
+		v := core[name]
+		if schema == nil {
+			if v == nil {
+				errs = append(errs, FieldError{Field: name, Message: "必填欄位缺失"})
+			}
+			continue
+		}
+		spec, ok := schema.Field(name)
+		if !ok {
+			continue
+		}
+		if v == nil {
+			if spec.Required {
+				errs = append(errs, FieldError{Field: name, Message: "必填欄位缺失"})
+			}
+			continue
+		}
+		errs = append(errs, checkFieldValue(name, spec, *v)...)
+	}
+	return errs
+}
+
+// checkFieldValue 依欄位定義檢查數值的型別與範圍
+func checkFieldValue(path string, spec models.FieldSpec, v float64) []FieldError {
+	value := v
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return []FieldError{{Field: path, Message: "數值無效", Value: &value}}
+	}
+	var errs []FieldError
+	if spec.Type == models.FieldTypeInteger && v != math.Trunc(v) {
+		errs = append(errs, FieldError{Field: path, Message: "必須為整數", Value: &value})
+	}
+	if spec.Min != nil && v < *spec.Min {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("不可小於 %g%s", *spec.Min, spec.Unit), Value: &value})
+	}
+	if spec.Max != nil && v > *spec.Max {
+		errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("不可大於 %g%s", *spec.Max, spec.Unit), Value: &value})
+	}
+	return errs
+}
+
+// validateFields 依設備類型 schema 驗證回報的其他量測欄位；schema 為 nil 時不接受任何其他欄位
+func validateFields(schema *models.DeviceType, fields map[string]float64) []FieldError {
+	var errs []FieldError
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := fields[name]
+		path := "fields." + name
+		if isCoreField(name) {
+			errs = append(errs, FieldError{Field: path, Message: name + " 須以頂層欄位回報"})
+			continue
+		}
+		if schema == nil {
+			errs = append(errs, FieldError{Field: path, Message: "設備未設定類型，不接受其他量測欄位"})
+			continue
+		}
+		spec, ok := schema.Field(name)
+		if !ok {
+			errs = append(errs, FieldError{Field: path, Message: "設備類型 " + schema.Name + " 未宣告此欄位"})
+			continue
+		}
+		errs = append(errs, checkFieldValue(path, spec, v)...)
+	}
+
+	if schema != nil {
+		for _, spec := range schema.Fields {
+			if isCoreField(spec.Name) {
+				continue
+			}
+			if _, ok := fields[spec.Name]; spec.Required && !ok {
+				errs = append(errs, FieldError{Field: "fields." + spec.Name, Message: "必填欄位缺失"})
+			}
+		}
+	}
+	return errs
+}
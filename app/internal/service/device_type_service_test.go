@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"iot-data-collection/app/internal/models"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func TestValidateFields(t *testing.T) {
+	schema := &models.DeviceType{
+		Name: "env-sensor",
+		Fields: []models.FieldSpec{
+			{Name: "humidity", Type: models.FieldTypeNumber, Unit: "%", Min: ptr(0), Max: ptr(100), Required: true},
+			{Name: "vibration_count", Type: models.FieldTypeInteger},
+		},
+	}
+
+	if errs := validateFields(schema, map[string]float64{"humidity": 55.5, "vibration_count": 3}); len(errs) != 0 {
+		t.Errorf("期望驗證通過，得到 %+v", errs)
+	}
+
+	errs := validateFields(schema, map[string]float64{"humidity": 120, "vibration_count": 1.5, "unknown": 1})
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	for _, field := range []string{"fields.humidity", "fields.vibration_count", "fields.unknown"} {
+		if !got[field] {
+			t.Errorf("期望 %s 驗證失敗，得到 %+v", field, errs)
+		}
+	}
+
+	if errs := validateFields(schema, nil); len(errs) != 1 || errs[0].Field != "fields.humidity" {
+		t.Errorf("期望必填欄位缺失錯誤，得到 %+v", errs)
+	}
+	if errs := validateFields(nil, map[string]float64{"humidity": 1}); len(errs) != 1 {
+		t.Errorf("未設定類型的設備不應接受其他欄位，得到 %+v", errs)
+	}
+	if errs := validateFields(schema, map[string]float64{"humidity": 50, "voltage": 220}); len(errs) != 1 || errs[0].Field != "fields.voltage" {
+		t.Errorf("核心欄位不應放在 fields，得到 %+v", errs)
+	}
+}
+
+func TestValidateCoreFields(t *testing.T) {
+	if errs := validateCoreFields(nil, coreValues(ptr(220), nil, ptr(30))); len(errs) != 1 || errs[0].Field != "current" {
+		t.Errorf("未設定類型的設備三個核心欄位皆為必填，得到 %+v", errs)
+	}
+
+	sensor := &models.DeviceType{Name: "env-sensor", Fields: []models.FieldSpec{
+		{Name: "temperature", Type: models.FieldTypeNumber, Min: ptr(-40), Max: ptr(85), Required: true},
+		{Name: "humidity", Type: models.FieldTypeNumber},
+	}}
+	if errs := validateCoreFields(sensor, coreValues(nil, nil, ptr(25))); len(errs) != 0 {
+		t.Errorf("schema 未宣告的核心欄位應為選填，得到 %+v", errs)
+	}
+	if errs := validateCoreFields(sensor, coreValues(ptr(220), nil, nil)); len(errs) != 1 || errs[0].Field != "temperature" {
+		t.Errorf("schema 宣告為必填的核心欄位缺失應失敗，得到 %+v", errs)
+	}
+	if errs := validateCoreFields(sensor, coreValues(nil, nil, ptr(120))); len(errs) != 1 {
+		t.Errorf("應依 schema 的範圍檢查核心欄位，得到 %+v", errs)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	errs := validateSchema("meter-3p", []models.FieldSpec{
+		{Name: "frequency", Type: models.FieldTypeNumber, Min: ptr(45), Max: ptr(65)},
+		{Name: "status", Type: models.FieldTypeNumber},
+		{Name: "frequency", Type: models.FieldTypeNumber},
+		{Name: "power_factor", Type: models.FieldTypeNumber, Min: ptr(1), Max: ptr(0)},
+	})
+	if len(errs) != 3 {
+		t.Errorf("期望 3 個錯誤（保留字、重複、min>max），得到 %+v", errs)
+	}
+}
@@ -1,9 +1,51 @@
 package service
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var (
-	ErrDeviceNotFound  = errors.New("device not found")
-	ErrInvalidInput    = errors.New("invalid input")
-	ErrInvalidTimestamp = errors.New("invalid timestamp format")
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidTimestamp    = errors.New("invalid timestamp format")
+	ErrTenantRequired      = errors.New("tenant is required")
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantExists        = errors.New("tenant already exists")
+	ErrInvalidAPIKey       = errors.New("invalid api key")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrDeviceTypeNotFound  = errors.New("device type not found")
+	ErrProfileNotFound     = errors.New("validation profile not found")
+	ErrQuarantineNotFound  = errors.New("quarantined metric not found")
+	ErrQuarantineResolved  = errors.New("quarantined metric already resolved")
+	ErrTwinVersionConflict = errors.New("device twin version conflict")
+	ErrCommandNotFound     = errors.New("device command not found")
+	ErrCommandCompleted    = errors.New("device command already completed or expired")
+	ErrGroupNotFound       = errors.New("device group not found")
+	ErrGroupNotEmpty       = errors.New("device group has child groups or devices")
+	ErrGroupCycle          = errors.New("device group parent would create a cycle")
 )
+
+// FieldError 單一欄位的驗證錯誤
+type FieldError struct {
+	Field   string   `json:"field"`
+	Message string   `json:"message"`
+	Value   *float64 `json:"value,omitempty"`
+}
+
+// ValidationError 資料驗證失敗，列出所有不符合的欄位；errors.Is(err, ErrInvalidInput) 為 true
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
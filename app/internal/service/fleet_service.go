@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultFleetTopN 排行預設筆數
+	DefaultFleetTopN = 5
+	// maxFleetTopN 排行筆數上限
+	maxFleetTopN = 50
+)
+
+// FleetSummaryInput 車隊總覽的輸入
+type FleetSummaryInput struct {
+	TenantID string
+	TopN     int
+	AnyTags  []string // 非空時只納入帶有任一標籤的設備
+}
+
+// FleetService 租戶層級的設備總覽；結果短暫快取，監控牆頻繁刷新時不會每次重算
+type FleetService interface {
+	// Summary 回傳總覽與資料來源（"cache" 或 "database"）
+	Summary(ctx context.Context, in FleetSummaryInput) (*models.FleetSummary, string, error)
+}
+
+type fleetServiceImpl struct {
+	db           interfaces.DBClient
+	store        metricstore.Store
+	rdb          interfaces.RedisClient
+	offlineAfter time.Duration
+	ttl          time.Duration
+	sf           singleflight.Group
+}
+
+// NewFleetService 建立 FleetService；設備清單與寫入量由 db 統計，最新讀值由 store 取得。
+// offlineAfter 為離線判定門檻，ttl 為總覽的快取時間
+func NewFleetService(db interfaces.DBClient, store metricstore.Store, rdb interfaces.RedisClient, offlineAfter, ttl time.Duration) FleetService {
+	return &fleetServiceImpl{db: db, store: store, rdb: rdb, offlineAfter: offlineAfter, ttl: ttl}
+}
+
+func (s *fleetServiceImpl) Summary(ctx context.Context, in FleetSummaryInput) (*models.FleetSummary, string, error) {
+	if in.TenantID == "" {
+		return nil, "", ErrTenantRequired
+	}
+	if in.TopN <= 0 {
+		in.TopN = DefaultFleetTopN
+	}
+	if in.TopN > maxFleetTopN {
+		in.TopN = maxFleetTopN
+	}
+
+	tags := append([]string(nil), in.AnyTags...)
+	sort.Strings(tags)
+	cacheKey := cache.FleetSummaryKey(in.TenantID, "top"+strconv.Itoa(in.TopN)+":"+strings.Join(tags, ","))
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		var summary models.FleetSummary
+		if json.Unmarshal([]byte(cached), &summary) == nil {
+			return &summary, "cache", nil
+		}
+	}
+
+	// 同一份總覽同時只計算一次
+	v, err, _ := s.sf.Do(cacheKey, func() (interface{}, error) {
+		summary, err := s.build(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		if jsonBytes, err := json.Marshal(summary); err == nil {
+			if err := s.rdb.Set(ctx, cacheKey, string(jsonBytes), s.ttl); err != nil {
+				logger.FromContext(ctx).Warn("cache fleet summary failed", logger.Err(err))
+			}
+		}
+		return summary, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return v.(*models.FleetSummary), "database", nil
+}
+
+// fleetDevice 設備登記資料中總覽需要的欄位
+type fleetDevice struct {
+	id       string
+	lastSeen *time.Time
+}
+
+func (s *fleetServiceImpl) build(ctx context.Context, in FleetSummaryInput) (*models.FleetSummary, error) {
+	query := `SELECT device_id, last_seen_at FROM devices WHERE tenant_id = $1`
+	args := []interface{}{in.TenantID}
+	if len(in.AnyTags) > 0 {
+		query += " AND tags && $2"
+		args = append(args, pq.Array(in.AnyTags))
+	}
+	rows, err := reader(s.db).Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var devices []fleetDevice
+	for rows.Next() {
+		var d fleetDevice
+		if err := rows.Scan(&d.id, &d.lastSeen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.id
+	}
+	latest, cacheHits, err := latestMetrics(ctx, s.store, s.rdb, in.TenantID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summary := summarizeFleet(devices, latest, now, s.offlineAfter, in.TopN)
+	summary.CacheHits = cacheHits
+
+	// 以寫入時間計算，補傳的舊讀值也算在最近寫入量內
+	ingestQuery := `
+		SELECT COUNT(*) FILTER (WHERE m.created_at >= $2), COUNT(*)
+		FROM device_metrics m
+		WHERE m.tenant_id = $1 AND m.created_at >= $3`
+	ingestArgs := []interface{}{in.TenantID, now.Add(-time.Hour), now.Add(-24 * time.Hour)}
+	if len(in.AnyTags) > 0 {
+		ingestQuery += ` AND EXISTS (SELECT 1 FROM devices d
+			WHERE d.tenant_id = m.tenant_id AND d.device_id = m.device_id AND d.tags && $4)`
+		ingestArgs = append(ingestArgs, pq.Array(in.AnyTags))
+	}
+	if err := reader(s.db).QueryRow(ingestQuery, ingestArgs...).Scan(&summary.Ingested.LastHour, &summary.Ingested.LastDay); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// summarizeFleet 計算狀態分布、離線數與溫度 / 電流排行
+func summarizeFleet(devices []fleetDevice, latest map[string]models.DeviceMetric, now time.Time, offlineAfter time.Duration, topN int) *models.FleetSummary {
+	summary := &models.FleetSummary{
+		GeneratedAt:  now,
+		Devices:      len(devices),
+		OfflineAfter: offlineAfter.String(),
+		StatusCounts: map[string]int{"normal": 0, "warning": 0, "error": 0, statusUnknown: 0},
+	}
+	readings := make([]models.DeviceMetric, 0, len(latest))
+	for _, d := range devices {
+		if d.lastSeen == nil || now.Sub(*d.lastSeen) > offlineAfter {
+			summary.Offline++
+		} else {
+			summary.Online++
+		}
+		m, ok := latest[d.id]
+		if !ok {
+			summary.StatusCounts[statusUnknown]++
+			continue
+		}
+		summary.StatusCounts[m.Status]++
+		readings = append(readings, m)
+	}
+
+	summary.Hottest = topReadings(readings, topN, func(m models.DeviceMetric) *float64 { return m.Temperature })
+	summary.HighestCurrent = topReadings(readings, topN, func(m models.DeviceMetric) *float64 { return m.Current })
+	return summary
+}
+
+// topReadings 依 value 由大到小取前 n 筆，同值依 device ID 排序；未回報該值的讀值不列入
+func topReadings(readings []models.DeviceMetric, n int, value func(models.DeviceMetric) *float64) []models.FleetDeviceReading {
+	var sorted []models.DeviceMetric
+	for _, m := range readings {
+		if value(m) != nil {
+			sorted = append(sorted, m)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		vi, vj := *value(sorted[i]), *value(sorted[j])
+		if vi != vj {
+			return vi > vj
+		}
+		return sorted[i].DeviceID < sorted[j].DeviceID
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	top := make([]models.FleetDeviceReading, len(sorted))
+	for i, m := range sorted {
+		top[i] = models.FleetDeviceReading{DeviceID: m.DeviceID, Value: *value(m), Status: m.Status, Timestamp: m.Timestamp}
+	}
+	return top
+}
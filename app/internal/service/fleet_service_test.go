@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/models"
+)
+
+func TestSummarizeFleet(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	stale := now.Add(-time.Hour)
+	devices := []fleetDevice{
+		{id: "panel-1", lastSeen: &recent},
+		{id: "panel-2", lastSeen: &recent},
+		{id: "panel-3", lastSeen: &stale},
+		{id: "panel-4"},
+	}
+	latest := map[string]models.DeviceMetric{
+		"panel-1": {DeviceID: "panel-1", Current: ptr(10), Temperature: ptr(40), Status: "normal", Timestamp: recent},
+		"panel-2": {DeviceID: "panel-2", Current: ptr(30), Temperature: ptr(75), Status: "error", Timestamp: recent},
+		"panel-3": {DeviceID: "panel-3", Current: ptr(20), Temperature: ptr(75), Status: "warning", Timestamp: stale},
+	}
+	s := summarizeFleet(devices, latest, now, 10*time.Minute, 2)
+
+	if s.Devices != 4 || s.Online != 2 || s.Offline != 2 {
+		t.Errorf("線上 / 離線設備數不符: %+v", s)
+	}
+	if s.StatusCounts["normal"] != 1 || s.StatusCounts["warning"] != 1 || s.StatusCounts["error"] != 1 || s.StatusCounts[statusUnknown] != 1 {
+		t.Errorf("狀態統計不符: %v", s.StatusCounts)
+	}
+	// 同溫度依設備 ID 排序
+	if len(s.Hottest) != 2 || s.Hottest[0].DeviceID != "panel-2" || s.Hottest[1].DeviceID != "panel-3" {
+		t.Errorf("溫度排行不符: %+v", s.Hottest)
+	}
+	if len(s.HighestCurrent) != 2 || s.HighestCurrent[0].DeviceID != "panel-2" || s.HighestCurrent[0].Value != 30 {
+		t.Errorf("電流排行不符: %+v", s.HighestCurrent)
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var groupIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// statusUnknown 群組彙總中尚無讀值的設備
+const statusUnknown = "unknown"
+
+// GroupDevicesInput 查詢群組設備或彙總的輸入
+type GroupDevicesInput struct {
+	TenantID  string
+	GroupID   string
+	Recursive bool     // 包含所有子群組的設備
+	AnyTags   []string // 非空時只納入帶有任一標籤的設備
+}
+
+// GroupService 設備群組階層與群組層級的彙總
+type GroupService interface {
+	ListGroups(ctx context.Context, tenantID string) ([]models.DeviceGroup, error)
+	GetGroup(ctx context.Context, tenantID, groupID string) (*models.DeviceGroup, error)
+	PutGroup(ctx context.Context, tenantID, groupID string, req models.PutDeviceGroupRequest) (*models.DeviceGroup, error)
+	// DeleteGroup 只能刪除沒有子群組與設備的群組
+	DeleteGroup(ctx context.Context, tenantID, groupID string) error
+	// AssignDevice 將設備指派到群組；groupID 為空時移出群組
+	AssignDevice(ctx context.Context, tenantID, deviceID, groupID string) error
+	ListGroupDevices(ctx context.Context, in GroupDevicesInput) ([]string, error)
+	// Summary 以最新值快取彙總群組內設備的目前讀值，快取未命中的設備才讀取 store
+	Summary(ctx context.Context, in GroupDevicesInput) (*models.GroupSummary, error)
+}
+
+type groupServiceImpl struct {
+	db    interfaces.DBClient
+	store metricstore.Store
+	rdb   interfaces.RedisClient
+}
+
+// NewGroupService 建立 GroupService；群組與指派保存在 db，彙總的最新讀值由 store 取得
+func NewGroupService(db interfaces.DBClient, store metricstore.Store, rdb interfaces.RedisClient) GroupService {
+	return &groupServiceImpl{db: db, store: store, rdb: rdb}
+}
+
+func (s *groupServiceImpl) ListGroups(ctx context.Context, tenantID string) ([]models.DeviceGroup, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	rows, err := s.db.Query(`
+		SELECT g.tenant_id, g.id, COALESCE(g.parent_id, ''), g.name, g.kind, g.created_at, g.updated_at,
+			(SELECT COUNT(*) FROM devices d WHERE d.tenant_id = g.tenant_id AND d.group_id = g.id)
+		FROM device_groups g
+		WHERE g.tenant_id = $1
+		ORDER BY g.id
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.DeviceGroup{}
+	for rows.Next() {
+		var g models.DeviceGroup
+		if err := rows.Scan(&g.TenantID, &g.ID, &g.ParentID, &g.Name, &g.Kind, &g.CreatedAt, &g.UpdatedAt, &g.DeviceCount); err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+func (s *groupServiceImpl) GetGroup(ctx context.Context, tenantID, groupID string) (*models.DeviceGroup, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	var g models.DeviceGroup
+	err := s.db.QueryRow(`
+		SELECT g.tenant_id, g.id, COALESCE(g.parent_id, ''), g.name, g.kind, g.created_at, g.updated_at,
+			(SELECT COUNT(*) FROM devices d WHERE d.tenant_id = g.tenant_id AND d.group_id = g.id)
+		FROM device_groups g
+		WHERE g.tenant_id = $1 AND g.id = $2
+	`, tenantID, groupID).Scan(&g.TenantID, &g.ID, &g.ParentID, &g.Name, &g.Kind, &g.CreatedAt, &g.UpdatedAt, &g.DeviceCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (s *groupServiceImpl) PutGroup(ctx context.Context, tenantID, groupID string, req models.PutDeviceGroupRequest) (*models.DeviceGroup, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	var errs []FieldError
+	if !groupIDPattern.MatchString(groupID) {
+		errs = append(errs, FieldError{Field: "id", Message: "群組 ID 只能包含英數字、底線、點與連字號，最長 64 字元"})
+	}
+	parentID := strings.TrimSpace(req.ParentID)
+	if parentID == groupID && parentID != "" {
+		errs = append(errs, FieldError{Field: "parent_id", Message: "不能將群組設為自己的上層"})
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	var parent interface{}
+	if parentID != "" {
+		if _, err := s.GetGroup(ctx, tenantID, parentID); err != nil {
+			if err == ErrGroupNotFound {
+				return nil, &ValidationError{Errors: []FieldError{{Field: "parent_id", Message: "上層群組不存在"}}}
+			}
+			return nil, err
+		}
+		// 上層不能是自己的子孫，否則形成循環
+		var cycle bool
+		if err := s.db.QueryRow(`
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM device_groups WHERE tenant_id = $1 AND id = $2
+				UNION
+				SELECT g.id, g.parent_id FROM device_groups g
+				JOIN ancestors a ON g.id = a.parent_id
+				WHERE g.tenant_id = $1
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $3)
+		`, tenantID, parentID, groupID).Scan(&cycle); err != nil {
+			return nil, err
+		}
+		if cycle {
+			return nil, ErrGroupCycle
+		}
+		parent = parentID
+	}
+
+	if _, err := s.db.Exec(`
+		INSERT INTO device_groups (tenant_id, id, parent_id, name, kind)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, id) DO UPDATE
+		SET parent_id = EXCLUDED.parent_id, name = EXCLUDED.name, kind = EXCLUDED.kind, updated_at = CURRENT_TIMESTAMP
+	`, tenantID, groupID, parent, strings.TrimSpace(req.Name), strings.TrimSpace(req.Kind)); err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("device group saved",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String("group_id", groupID),
+		slog.String("parent_id", parentID))
+	return s.GetGroup(ctx, tenantID, groupID)
+}
+
+func (s *groupServiceImpl) DeleteGroup(ctx context.Context, tenantID, groupID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	res, err := s.db.Exec(`
+		DELETE FROM device_groups g
+		WHERE g.tenant_id = $1 AND g.id = $2
+			AND NOT EXISTS (SELECT 1 FROM device_groups c WHERE c.tenant_id = g.tenant_id AND c.parent_id = g.id)
+			AND NOT EXISTS (SELECT 1 FROM devices d WHERE d.tenant_id = g.tenant_id AND d.group_id = g.id)
+	`, tenantID, groupID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := s.GetGroup(ctx, tenantID, groupID); err != nil {
+			return err
+		}
+		return ErrGroupNotEmpty
+	}
+	logger.FromContext(ctx).Info("device group deleted",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String("group_id", groupID))
+	return nil
+}
+
+func (s *groupServiceImpl) AssignDevice(ctx context.Context, tenantID, deviceID, groupID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	var group interface{}
+	if groupID != "" {
+		if _, err := s.GetGroup(ctx, tenantID, groupID); err != nil {
+			return err
+		}
+		group = groupID
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO devices (tenant_id, device_id, group_id) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE SET group_id = EXCLUDED.group_id
+	`, tenantID, deviceID, group)
+	return err
+}
+
+func (s *groupServiceImpl) ListGroupDevices(ctx context.Context, in GroupDevicesInput) ([]string, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if _, err := s.GetGroup(ctx, in.TenantID, in.GroupID); err != nil {
+		return nil, err
+	}
+
+	groups := `SELECT $2::VARCHAR AS id`
+	if in.Recursive {
+		groups = `WITH RECURSIVE subtree AS (
+				SELECT id FROM device_groups WHERE tenant_id = $1 AND id = $2
+				UNION
+				SELECT g.id FROM device_groups g JOIN subtree t ON g.parent_id = t.id WHERE g.tenant_id = $1
+			)
+			SELECT id FROM subtree`
+	}
+	query := `SELECT d.device_id FROM devices d WHERE d.tenant_id = $1 AND d.group_id IN (` + groups + `)`
+	args := []interface{}{in.TenantID, in.GroupID}
+	if len(in.AnyTags) > 0 {
+		query += " AND d.tags && $3"
+		args = append(args, pq.Array(in.AnyTags))
+	}
+	query += " ORDER BY d.device_id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *groupServiceImpl) Summary(ctx context.Context, in GroupDevicesInput) (*models.GroupSummary, error) {
+	deviceIDs, err := s.ListGroupDevices(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, cacheHits, err := latestMetrics(ctx, s.store, s.rdb, in.TenantID, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := aggregateLatest(deviceIDs, latest)
+	summary.GroupID, summary.Recursive, summary.CacheHits = in.GroupID, in.Recursive, cacheHits
+	return summary, nil
+}
+
+// aggregateLatest 彙總各設備的最新讀值；latest 中沒有的設備計入 unknown
+func aggregateLatest(deviceIDs []string, latest map[string]models.DeviceMetric) *models.GroupSummary {
+	s := &models.GroupSummary{
+		Devices:      len(deviceIDs),
+		StatusCounts: map[string]int{"normal": 0, "warning": 0, "error": 0, statusUnknown: 0},
+	}
+	var voltageSum float64
+	voltageCount := 0
+	for _, id := range deviceIDs {
+		m, ok := latest[id]
+		if !ok {
+			s.StatusCounts[statusUnknown]++
+			continue
+		}
+		s.Reporting++
+		s.StatusCounts[m.Status]++
+		if m.Current != nil {
+			s.TotalCurrent += *m.Current
+		}
+		if m.PowerW != nil {
+			s.TotalPowerW += *m.PowerW
+		} else if m.Voltage != nil && m.Current != nil {
+			s.TotalPowerW += *m.Voltage * *m.Current
+		}
+		if m.Voltage != nil {
+			voltageSum += *m.Voltage
+			voltageCount++
+		}
+		if m.Temperature != nil && (s.MaxTemperature == nil || *m.Temperature > *s.MaxTemperature) {
+			t := *m.Temperature
+			s.MaxTemperature, s.MaxTempDevice = &t, id
+		}
+		if s.OldestReading == nil || m.Timestamp.Before(*s.OldestReading) {
+			ts := m.Timestamp
+			s.OldestReading = &ts
+		}
+	}
+	if voltageCount > 0 {
+		avg := voltageSum / float64(voltageCount)
+		s.AvgVoltage = &avg
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/models"
+)
+
+func TestAggregateLatest(t *testing.T) {
+	now := time.Now()
+	power := 5000.0
+	latest := map[string]models.DeviceMetric{
+		"panel-1": {DeviceID: "panel-1", Voltage: ptr(220), Current: ptr(10), Temperature: ptr(40), Status: "normal", Timestamp: now},
+		"panel-2": {DeviceID: "panel-2", Voltage: ptr(230), Current: ptr(20), Temperature: ptr(75), Status: "error", Timestamp: now.Add(-time.Minute), PowerW: &power},
+	}
+	s := aggregateLatest([]string{"panel-1", "panel-2", "panel-3"}, latest)
+
+	if s.Devices != 3 || s.Reporting != 2 {
+		t.Errorf("設備數不符: %+v", s)
+	}
+	if s.StatusCounts["normal"] != 1 || s.StatusCounts["error"] != 1 || s.StatusCounts[statusUnknown] != 1 {
+		t.Errorf("狀態統計不符: %v", s.StatusCounts)
+	}
+	if s.TotalCurrent != 30 || s.TotalPowerW != 2200+5000 {
+		t.Errorf("電流或功率加總不符: %v %v", s.TotalCurrent, s.TotalPowerW)
+	}
+	if s.MaxTemperature == nil || *s.MaxTemperature != 75 || s.MaxTempDevice != "panel-2" {
+		t.Errorf("最高溫度不符: %v %s", s.MaxTemperature, s.MaxTempDevice)
+	}
+	if s.AvgVoltage == nil || *s.AvgVoltage != 225 {
+		t.Errorf("平均電壓不符: %v", s.AvgVoltage)
+	}
+	if s.OldestReading == nil || !s.OldestReading.Equal(now.Add(-time.Minute)) {
+		t.Errorf("最舊讀值時間不符: %v", s.OldestReading)
+	}
+
+	empty := aggregateLatest(nil, nil)
+	if empty.AvgVoltage != nil || empty.MaxTemperature != nil || empty.Devices != 0 {
+		t.Errorf("空群組不應有彙總值: %+v", empty)
+	}
+}
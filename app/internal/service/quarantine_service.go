@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// maxQuarantinePayload 單筆隔離資料保存的原始內容上限，超過時截斷
+const maxQuarantinePayload = 64 << 10
+
+// quarantineClaimTimeout 重新注入認領後未完成（例如程序中斷）的資料，超過此時間可再次認領
+const quarantineClaimTimeout = 5 * time.Minute
+
+// QuarantineInput 寫入隔離區的輸入
+type QuarantineInput struct {
+	TenantID  string
+	DeviceID  string
+	Source    string // models.QuarantineSource*
+	Reason    string // models.QuarantineReason*
+	Errors    interface{}
+	Payload   []byte
+	RequestID string
+}
+
+// ListQuarantineInput 查詢隔離資料的輸入
+type ListQuarantineInput struct {
+	TenantID  string
+	DeviceID  string
+	Source    string
+	Reason    string
+	Status    string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+	Offset    int
+	AnyTags   []string // 非空時只列出帶有任一標籤的設備
+}
+
+// QuarantineService 被拒絕回報資料的保存、查詢與重新注入
+type QuarantineService interface {
+	Quarantine(ctx context.Context, in QuarantineInput) (int64, error)
+	ListQuarantined(ctx context.Context, in ListQuarantineInput) ([]models.QuarantinedMetric, error)
+	GetQuarantined(ctx context.Context, tenantID string, id int64) (*models.QuarantinedMetric, error)
+	Reinject(ctx context.Context, tenantID string, id int64, fixed *models.CreateDeviceMetricRequest, resolvedBy string) (*models.QuarantinedMetric, error)
+	Discard(ctx context.Context, tenantID string, id int64, resolvedBy string) (*models.QuarantinedMetric, error)
+}
+
+type quarantineServiceImpl struct {
+	db      interfaces.DBClient
+	metrics DeviceMetricService
+}
+
+// NewQuarantineService 建立 QuarantineService；metrics 為 nil 時只能寫入與查詢，不支援重新注入
+func NewQuarantineService(db interfaces.DBClient, metrics DeviceMetricService) QuarantineService {
+	return &quarantineServiceImpl{db: db, metrics: metrics}
+}
+
+const quarantineColumns = `id, tenant_id, device_id, source, reason, errors, payload, request_id,
+	received_at, status, corrected_payload, resolved_at, resolved_by`
+
+// Quarantine 保存被拒絕的原始內容，回傳隔離資料 ID
+func (s *quarantineServiceImpl) Quarantine(ctx context.Context, in QuarantineInput) (int64, error) {
+	if in.TenantID == "" {
+		return 0, ErrTenantRequired
+	}
+	errorsJSON := []byte("[]")
+	if in.Errors != nil {
+		b, err := json.Marshal(in.Errors)
+		if err != nil {
+			return 0, err
+		}
+		errorsJSON = b
+	}
+
+	var id int64
+	err := s.db.QueryRow(`
+		INSERT INTO metric_quarantine (tenant_id, device_id, source, reason, errors, payload, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, in.TenantID, in.DeviceID, in.Source, in.Reason, string(errorsJSON), string(quarantinePayload(in.Payload)), in.RequestID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	logger.FromContext(ctx).Info("metric quarantined",
+		slog.String(logger.KeyTenantID, in.TenantID),
+		slog.String(logger.KeyDeviceID, in.DeviceID),
+		slog.Int64("quarantine_id", id),
+		slog.String("source", in.Source),
+		slog.String("reason", in.Reason))
+	return id, nil
+}
+
+func (s *quarantineServiceImpl) ListQuarantined(ctx context.Context, in ListQuarantineInput) ([]models.QuarantinedMetric, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	limit := listLimit(in.Limit)
+	offset := in.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `SELECT ` + quarantineColumns + ` FROM metric_quarantine q WHERE q.tenant_id = $1`
+	args := []interface{}{in.TenantID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		query += " AND " + cond + " $" + strconv.Itoa(len(args))
+	}
+	if in.DeviceID != "" {
+		add("q.device_id =", in.DeviceID)
+	}
+	if in.Source != "" {
+		add("q.source =", in.Source)
+	}
+	if in.Reason != "" {
+		add("q.reason =", in.Reason)
+	}
+	if in.Status != "" {
+		add("q.status =", in.Status)
+	}
+	if in.StartTime != nil {
+		add("q.received_at >=", *in.StartTime)
+	}
+	if in.EndTime != nil {
+		add("q.received_at <=", *in.EndTime)
+	}
+	if len(in.AnyTags) > 0 {
+		args = append(args, pq.Array(in.AnyTags))
+		query += ` AND EXISTS (SELECT 1 FROM devices d
+			WHERE d.tenant_id = q.tenant_id AND d.device_id = q.device_id AND d.tags && $` + strconv.Itoa(len(args)) + `)`
+	}
+	query += " ORDER BY q.received_at DESC, q.id DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.QuarantinedMetric{}
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *q)
+	}
+	return list, rows.Err()
+}
+
+func (s *quarantineServiceImpl) GetQuarantined(ctx context.Context, tenantID string, id int64) (*models.QuarantinedMetric, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	row := s.db.QueryRow(`SELECT `+quarantineColumns+` FROM metric_quarantine WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	q, err := scanQuarantined(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuarantineNotFound
+	}
+	return q, err
+}
+
+// Reinject 以修正後（或原始）的內容重新走一次正常的驗證與佇列流程，成功後標記為已重新注入；
+// 仍未通過驗證時回傳 *ValidationError，隔離資料維持 pending。
+// 送出前先以 UPDATE 原子地認領（pending → reinjecting），並行的重新注入只有一個會送出，送出失敗時還原為 pending
+func (s *quarantineServiceImpl) Reinject(ctx context.Context, tenantID string, id int64, fixed *models.CreateDeviceMetricRequest, resolvedBy string) (*models.QuarantinedMetric, error) {
+	if s.metrics == nil {
+		return nil, ErrInvalidInput
+	}
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	q, err := s.claim(tenantID, id, resolvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := s.reinjectClaimed(ctx, q, fixed, resolvedBy)
+	if err != nil {
+		if _, relErr := s.transition(tenantID, id, models.QuarantineStatusReinjecting, models.QuarantineStatusPending, nil, ""); relErr != nil {
+			logger.FromContext(ctx).Error("release quarantine claim failed", logger.Err(relErr), slog.Int64("quarantine_id", id))
+		}
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("quarantined metric reinjected",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, q.DeviceID),
+		slog.Int64("quarantine_id", id))
+	return resolved, nil
+}
+
+// reinjectClaimed 送出已認領的隔離資料並標記為已重新注入
+func (s *quarantineServiceImpl) reinjectClaimed(ctx context.Context, q *models.QuarantinedMetric, fixed *models.CreateDeviceMetricRequest, resolvedBy string) (*models.QuarantinedMetric, error) {
+	req := fixed
+	if req == nil {
+		req = &models.CreateDeviceMetricRequest{}
+		if err := json.Unmarshal(q.Payload, req); err != nil {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "payload", Message: "原始內容無法解析，請提供修正後的 payload"}}}
+		}
+	}
+	in, errs := submitInputFromRequest(q.TenantID, q.DeviceID, req)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	in.ReceivedAt = &q.ReceivedAt
+	corrected, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.metrics.SubmitMetric(ctx, in); err != nil {
+		return nil, err
+	}
+	return s.transition(q.TenantID, q.ID, models.QuarantineStatusReinjecting, models.QuarantineStatusReinjected, corrected, resolvedBy)
+}
+
+// claim 將 pending 的資料標記為 reinjecting 並回傳；resolved_at 記錄認領時間，
+// 認領後程序中斷而卡在 reinjecting 超過 quarantineClaimTimeout 的資料可再次認領
+func (s *quarantineServiceImpl) claim(tenantID string, id int64, resolvedBy string) (*models.QuarantinedMetric, error) {
+	row := s.db.QueryRow(`
+		UPDATE metric_quarantine
+		SET status = 'reinjecting', resolved_at = CURRENT_TIMESTAMP, resolved_by = $3
+		WHERE tenant_id = $1 AND id = $2
+			AND (status = 'pending' OR (status = 'reinjecting' AND resolved_at < CURRENT_TIMESTAMP - $4::float8 * INTERVAL '1 second'))
+		RETURNING `+quarantineColumns,
+		tenantID, id, resolvedBy, quarantineClaimTimeout.Seconds())
+	q, err := scanQuarantined(row)
+	if err == sql.ErrNoRows {
+		return nil, s.notPending(tenantID, id)
+	}
+	return q, err
+}
+
+// Discard 標記隔離資料為捨棄，不再重新注入
+func (s *quarantineServiceImpl) Discard(ctx context.Context, tenantID string, id int64, resolvedBy string) (*models.QuarantinedMetric, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	return s.transition(tenantID, id, models.QuarantineStatusPending, models.QuarantineStatusDiscarded, nil, resolvedBy)
+}
+
+// transition 只更新狀態仍為 from 的資料，避免同一筆被重複處理；回到 pending 時清除處理記錄
+func (s *quarantineServiceImpl) transition(tenantID string, id int64, from, to string, corrected []byte, resolvedBy string) (*models.QuarantinedMetric, error) {
+	var correctedArg interface{}
+	if corrected != nil {
+		correctedArg = string(corrected)
+	}
+	row := s.db.QueryRow(`
+		UPDATE metric_quarantine
+		SET status = $4, corrected_payload = $5, resolved_by = $6,
+			resolved_at = CASE WHEN $4 = 'pending' THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE tenant_id = $1 AND id = $2 AND status = $3
+		RETURNING `+quarantineColumns,
+		tenantID, id, from, to, correctedArg, resolvedBy)
+	q, err := scanQuarantined(row)
+	if err == sql.ErrNoRows {
+		return nil, s.notPending(tenantID, id)
+	}
+	return q, err
+}
+
+// notPending 區分資料不存在與已被處理
+func (s *quarantineServiceImpl) notPending(tenantID string, id int64) error {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM metric_quarantine WHERE tenant_id = $1 AND id = $2)`, tenantID, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrQuarantineResolved
+	}
+	return ErrQuarantineNotFound
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanQuarantined(row rowScanner) (*models.QuarantinedMetric, error) {
+	var q models.QuarantinedMetric
+	var errorsJSON, payload []byte
+	var corrected sql.NullString
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&q.ID, &q.TenantID, &q.DeviceID, &q.Source, &q.Reason, &errorsJSON, &payload,
+		&q.RequestID, &q.ReceivedAt, &q.Status, &corrected, &resolvedAt, &q.ResolvedBy); err != nil {
+		return nil, err
+	}
+	q.Errors = json.RawMessage(errorsJSON)
+	q.Payload = json.RawMessage(payload)
+	if corrected.Valid {
+		q.CorrectedPayload = json.RawMessage(corrected.String)
+	}
+	if resolvedAt.Valid {
+		q.ResolvedAt = &resolvedAt.Time
+	}
+	return &q, nil
+}
+
+// quarantinePayload 合法 JSON 原樣保存，其餘（含截斷後的內容）以 JSON 字串保存
+func quarantinePayload(raw []byte) []byte {
+	if len(raw) <= maxQuarantinePayload && json.Valid(raw) {
+		return raw
+	}
+	if len(raw) > maxQuarantinePayload {
+		raw = raw[:maxQuarantinePayload]
+	}
+	b, _ := json.Marshal(string(raw))
+	return b
+}
+
+// submitInputFromRequest 將回報內容轉為 SubmitMetricInput，並檢查 binding 標籤涵蓋的必填與列舉；
+// 核心量測值是否必填依設備類型決定，由 SubmitMetric 檢查
+func submitInputFromRequest(tenantID, deviceID string, req *models.CreateDeviceMetricRequest) (SubmitMetricInput, []FieldError) {
+	var errs []FieldError
+	in := SubmitMetricInput{
+		TenantID:    tenantID,
+		DeviceID:    deviceID,
+		Voltage:     req.Voltage,
+		Current:     req.Current,
+		Temperature: req.Temperature,
+		Status:      req.Status,
+		Timestamp:   req.Timestamp,
+		Fields:      req.Fields,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+	}
+	switch req.Status {
+	case "normal", "warning", "error":
+	case "":
+		errs = append(errs, FieldError{Field: "status", Message: "必填欄位缺失"})
+	default:
+		errs = append(errs, FieldError{Field: "status", Message: "必須為下列其中之一: normal warning error"})
+	}
+	return in, errs
+}
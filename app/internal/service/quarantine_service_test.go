@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/models"
+)
+
+func TestQuarantinePayload(t *testing.T) {
+	valid := []byte(`{"voltage": 400}`)
+	if got := quarantinePayload(valid); string(got) != string(valid) {
+		t.Errorf("合法 JSON 應原樣保存，得到 %s", got)
+	}
+
+	got := quarantinePayload([]byte(`{"voltage": 4`))
+	var s string
+	if err := json.Unmarshal(got, &s); err != nil || s != `{"voltage": 4` {
+		t.Errorf("非法 JSON 應以字串保存，得到 %s", got)
+	}
+
+	got = quarantinePayload([]byte(strings.Repeat("x", maxQuarantinePayload+10)))
+	if err := json.Unmarshal(got, &s); err != nil || len(s) != maxQuarantinePayload {
+		t.Errorf("超過上限應截斷，得到長度 %d", len(s))
+	}
+}
+
+func TestSubmitInputFromRequest(t *testing.T) {
+	in, errs := submitInputFromRequest("t1", "d1", &models.CreateDeviceMetricRequest{
+		Voltage: ptr(400), Current: ptr(10), Temperature: ptr(30), Status: "normal",
+	})
+	if len(errs) != 0 || *in.Voltage != 400 || in.TenantID != "t1" || in.DeviceID != "d1" {
+		t.Errorf("期望轉換成功，得到 %+v %+v", in, errs)
+	}
+
+	// 核心量測值是否必填依設備類型決定，由 SubmitMetric 檢查
+	in, errs = submitInputFromRequest("t1", "d1", &models.CreateDeviceMetricRequest{Voltage: ptr(220), Status: "broken"})
+	if len(errs) != 1 || errs[0].Field != "status" || in.Current != nil {
+		t.Errorf("期望只有 status 驗證失敗且未回報的欄位為 nil，得到 %+v %+v", in, errs)
+	}
+}
+
+type capturingQueue struct{ tasks []*interfaces.MetricTask }
+
+func (q *capturingQueue) Push(ctx context.Context, task *interfaces.MetricTask) error {
+	q.tasks = append(q.tasks, task)
+	return nil
+}
+
+// TestSubmitMetricReinjectKeepsTimestamp 重新注入帶原始接收時間，不因補處理的時間差被時鐘偏差政策改寫
+func TestSubmitMetricReinjectKeepsTimestamp(t *testing.T) {
+	policy, _ := clockskew.NewPolicy(clockskew.ModeCorrect, 5*time.Minute, time.Hour)
+	q := &capturingQueue{}
+	svc := NewDeviceMetricService(nil, nil, q, nil, nil, NewClockSkewService(policy, nil))
+
+	receivedAt := time.Now().Add(-72 * time.Hour).UTC()
+	ts := receivedAt.Add(-time.Minute).Format(time.RFC3339)
+	in := SubmitMetricInput{TenantID: "acme", DeviceID: "meter-1", Status: "normal", Voltage: ptr(220), Current: ptr(1), Temperature: ptr(25), Timestamp: ts, ReceivedAt: &receivedAt}
+	if err := svc.SubmitMetric(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	task := q.tasks[0]
+	if task.Timestamp != ts || task.DeviceTime != "" || task.ReceivedAt != receivedAt.Format(time.RFC3339Nano) {
+		t.Errorf("應保留原始時間戳與接收時間，得到 timestamp=%s device_time=%s received_at=%s", task.Timestamp, task.DeviceTime, task.ReceivedAt)
+	}
+
+	in.ReceivedAt = nil
+	if err := svc.SubmitMetric(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	if q.tasks[1].DeviceTime != ts {
+		t.Errorf("一般回報超出範圍時應依政策校正，得到 %+v", q.tasks[1])
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import "sync/atomic"
+
+// QueryLimits 查詢類 API 的筆數設定：未指定 limit 或超過上限時改用預設筆數；Series 為時間序列查詢
+type QueryLimits struct {
+	Default       int
+	Max           int
+	SeriesDefault int
+	SeriesMax     int
+}
+
+// DefaultQueryLimits 未設定時使用的筆數
+func DefaultQueryLimits() QueryLimits {
+	return QueryLimits{Default: 100, Max: 1000, SeriesDefault: 1000, SeriesMax: 10000}
+}
+
+var queryLimits atomic.Pointer[QueryLimits]
+
+func init() {
+	SetQueryLimits(DefaultQueryLimits())
+}
+
+// SetQueryLimits 替換目前的筆數設定（例如收到 SIGHUP 重新載入設定）
+func SetQueryLimits(l QueryLimits) {
+	queryLimits.Store(&l)
+}
+
+// CurrentQueryLimits 目前生效的筆數設定
+func CurrentQueryLimits() QueryLimits {
+	return *queryLimits.Load()
+}
+
+// listLimit 將清單查詢的 limit 限制在設定範圍內
+func listLimit(limit int) int {
+	l := queryLimits.Load()
+	if limit <= 0 || limit > l.Max {
+		return l.Default
+	}
+	return limit
+}
+
+// seriesLimit 將時間序列查詢的 limit 限制在設定範圍內
+func seriesLimit(limit int) int {
+	l := queryLimits.Load()
+	if limit <= 0 || limit > l.SeriesMax {
+		return l.SeriesDefault
+	}
+	return limit
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+)
+
+// DefaultAvailabilityWindow 未指定起始時間時計算可用率的區間
+const DefaultAvailabilityWindow = 24 * time.Hour
+
+// ListStatusEventsInput 查詢狀態轉換的輸入
+type ListStatusEventsInput struct {
+	TenantID  string
+	DeviceID  string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+	Offset    int
+}
+
+// StatusEventService 設備狀態轉換紀錄與停留時間統計
+type StatusEventService interface {
+	// Record 以讀值狀態與設備目前狀態比較，有變化時記錄轉換；無變化或讀值早於目前狀態的起始時間時回傳 nil
+	Record(ctx context.Context, tenantID, deviceID, status string, at time.Time) (*models.DeviceStatusEvent, error)
+	ListEvents(ctx context.Context, in ListStatusEventsInput) ([]models.DeviceStatusEvent, error)
+	Availability(ctx context.Context, tenantID, deviceID string, start, end *time.Time) (*models.StatusAvailability, error)
+}
+
+type statusEventServiceImpl struct {
+	db interfaces.DBClient
+}
+
+// NewStatusEventService 建立 StatusEventService
+func NewStatusEventService(db interfaces.DBClient) StatusEventService {
+	return &statusEventServiceImpl{db: db}
+}
+
+const statusEventColumns = `id, tenant_id, device_id, COALESCE(from_status, ''), to_status, changed_at, previous_duration_ms, created_at`
+
+func (s *statusEventServiceImpl) Record(ctx context.Context, tenantID, deviceID, status string, at time.Time) (*models.DeviceStatusEvent, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	// 鎖定設備列後比較並更新目前狀態，多個 worker 同時處理同一設備時只會記錄一次轉換
+	query := `
+		WITH prev AS (
+			SELECT current_status, status_since FROM devices
+			WHERE tenant_id = $1 AND device_id = $2
+			FOR UPDATE
+		), changed AS (
+			UPDATE devices d SET current_status = $3::varchar, status_since = $4::timestamp
+			FROM prev
+			WHERE d.tenant_id = $1 AND d.device_id = $2
+				AND prev.current_status IS DISTINCT FROM $3::varchar
+				AND (prev.status_since IS NULL OR prev.status_since <= $4::timestamp)
+			RETURNING prev.current_status AS from_status, prev.status_since AS since
+		)
+		INSERT INTO device_status_events (tenant_id, device_id, from_status, to_status, changed_at, previous_duration_ms)
+		SELECT $1, $2, from_status, $3::varchar, $4::timestamp,
+			(EXTRACT(EPOCH FROM ($4::timestamp - since)) * 1000)::BIGINT
+		FROM changed
+		RETURNING ` + statusEventColumns
+	ev, err := scanStatusEvent(s.db.QueryRow(query, tenantID, deviceID, status, at))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("device status changed",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String(logger.KeyDeviceID, deviceID),
+		slog.String("from_status", ev.FromStatus),
+		slog.String("to_status", ev.ToStatus))
+	return ev, nil
+}
+
+func (s *statusEventServiceImpl) ListEvents(ctx context.Context, in ListStatusEventsInput) ([]models.DeviceStatusEvent, error) {
+	if in.TenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	limit := listLimit(in.Limit)
+	offset := in.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `SELECT ` + statusEventColumns + ` FROM device_status_events WHERE tenant_id = $1 AND device_id = $2`
+	args := []interface{}{in.TenantID, in.DeviceID}
+	if in.StartTime != nil {
+		args = append(args, *in.StartTime)
+		query += " AND changed_at >= $" + strconv.Itoa(len(args))
+	}
+	if in.EndTime != nil {
+		args = append(args, *in.EndTime)
+		query += " AND changed_at <= $" + strconv.Itoa(len(args))
+	}
+	query += " ORDER BY changed_at DESC, id DESC LIMIT $" + strconv.Itoa(len(args)+1) + " OFFSET $" + strconv.Itoa(len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := reader(s.db).Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.DeviceStatusEvent{}
+	for rows.Next() {
+		ev, err := scanStatusEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *ev)
+	}
+	return list, rows.Err()
+}
+
+// Availability 以區間開始前最後一次轉換為起始狀態，依序累計區間內各狀態的停留時間
+func (s *statusEventServiceImpl) Availability(ctx context.Context, tenantID, deviceID string, start, end *time.Time) (*models.StatusAvailability, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	now := time.Now()
+	to := now
+	if end != nil && end.Before(now) {
+		to = *end
+	}
+	from := to.Add(-DefaultAvailabilityWindow)
+	if start != nil {
+		from = *start
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidInput
+	}
+
+	var initial string
+	err := reader(s.db).QueryRow(`
+		SELECT to_status FROM device_status_events
+		WHERE tenant_id = $1 AND device_id = $2 AND changed_at <= $3
+		ORDER BY changed_at DESC, id DESC LIMIT 1
+	`, tenantID, deviceID, from).Scan(&initial)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := reader(s.db).Query(`
+		SELECT to_status, changed_at FROM device_status_events
+		WHERE tenant_id = $1 AND device_id = $2 AND changed_at > $3 AND changed_at < $4
+		ORDER BY changed_at, id
+	`, tenantID, deviceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []statusChange
+	for rows.Next() {
+		var ch statusChange
+		if err := rows.Scan(&ch.status, &ch.at); err != nil {
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := computeAvailability(from, to, initial, changes)
+	result.DeviceID = deviceID
+	return result, nil
+}
+
+// statusChange 計算停留時間所需的轉換資料
+type statusChange struct {
+	status string
+	at     time.Time
+}
+
+// computeAvailability 累計 [start, end) 內各狀態的停留時間；initial 為空表示區間開始時狀態未知，未知的時間不計入
+func computeAvailability(start, end time.Time, initial string, changes []statusChange) *models.StatusAvailability {
+	result := &models.StatusAvailability{
+		StartTime:   start,
+		EndTime:     end,
+		TimeInState: map[string]float64{},
+		Transitions: len(changes),
+	}
+	current, since := initial, start
+	for _, ch := range changes {
+		if current != "" {
+			result.TimeInState[current] += ch.at.Sub(since).Seconds()
+		}
+		current, since = ch.status, ch.at
+	}
+	if current != "" {
+		result.TimeInState[current] += end.Sub(since).Seconds()
+	}
+	result.CurrentStatus = current
+
+	for _, secs := range result.TimeInState {
+		result.ObservedSeconds += secs
+	}
+	result.StatePercent = make(map[string]float64, len(result.TimeInState))
+	if result.ObservedSeconds > 0 {
+		for state, secs := range result.TimeInState {
+			result.StatePercent[state] = secs / result.ObservedSeconds * 100
+		}
+		pct := (result.ObservedSeconds - result.TimeInState["error"]) / result.ObservedSeconds * 100
+		result.AvailabilityPct = &pct
+	}
+	return result
+}
+
+func scanStatusEvent(row rowScanner) (*models.DeviceStatusEvent, error) {
+	var ev models.DeviceStatusEvent
+	var duration sql.NullInt64
+	if err := row.Scan(&ev.ID, &ev.TenantID, &ev.DeviceID, &ev.FromStatus, &ev.ToStatus, &ev.ChangedAt, &duration, &ev.CreatedAt); err != nil {
+		return nil, err
+	}
+	if duration.Valid {
+		ev.PreviousDurationMS = &duration.Int64
+	}
+	return &ev, nil
+}
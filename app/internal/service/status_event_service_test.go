@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeAvailability(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	changes := []statusChange{
+		{status: "warning", at: start.Add(4 * time.Hour)},
+		{status: "error", at: start.Add(6 * time.Hour)},
+		{status: "normal", at: start.Add(7 * time.Hour)},
+	}
+
+	a := computeAvailability(start, end, "normal", changes)
+	if a.TimeInState["normal"] != 7*3600 || a.TimeInState["warning"] != 2*3600 || a.TimeInState["error"] != 3600 {
+		t.Errorf("各狀態停留時間不符: %v", a.TimeInState)
+	}
+	if a.AvailabilityPct == nil || *a.AvailabilityPct != 90 {
+		t.Errorf("可用率應為 90%%: %v", a.AvailabilityPct)
+	}
+	if a.Transitions != 3 || a.CurrentStatus != "normal" {
+		t.Errorf("轉換次數或目前狀態不符: %d %s", a.Transitions, a.CurrentStatus)
+	}
+
+	// 區間開始時狀態未知：首次回報前的時間不計入
+	unknown := computeAvailability(start, end, "", changes[1:])
+	if unknown.ObservedSeconds != 4*3600 || unknown.StatePercent["error"] != 25 {
+		t.Errorf("未知狀態的時間不應計入: %+v", unknown)
+	}
+
+	none := computeAvailability(start, end, "", nil)
+	if none.AvailabilityPct != nil || none.ObservedSeconds != 0 {
+		t.Errorf("沒有任何狀態時不應有可用率: %+v", none)
+	}
+}
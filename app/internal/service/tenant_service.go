@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/idgen"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+)
+
+// APIKeyPrefix 產生的 API key 前綴，方便在日誌或設定中辨識
+const APIKeyPrefix = "iotk_"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// TenantService 租戶與 API 憑證管理
+type TenantService interface {
+	CreateTenant(ctx context.Context, id, name string) (*models.Tenant, error)
+	ListTenants(ctx context.Context) ([]models.Tenant, error)
+	CreateAPIKey(ctx context.Context, tenantID, name string) (*models.CreateAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, tenantID string) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, tenantID string, keyID int) error
+	// ResolveAPIKey 以明文 API key 查出 key 的 ID 與所屬租戶
+	ResolveAPIKey(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+type tenantServiceImpl struct {
+	db  interfaces.DBClient
+	rdb interfaces.RedisClient
+}
+
+// NewTenantService 建立 TenantService
+func NewTenantService(db interfaces.DBClient, rdb interfaces.RedisClient) TenantService {
+	return &tenantServiceImpl{db: db, rdb: rdb}
+}
+
+func (s *tenantServiceImpl) CreateTenant(ctx context.Context, id, name string) (*models.Tenant, error) {
+	if !tenantIDPattern.MatchString(id) {
+		return nil, ErrInvalidInput
+	}
+	query := `
+		INSERT INTO tenants (id, name) VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, name, created_at
+	`
+	var t models.Tenant
+	if err := s.db.QueryRow(query, id, name).Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTenantExists
+		}
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("tenant created", slog.String(logger.KeyTenantID, t.ID))
+	return &t, nil
+}
+
+func (s *tenantServiceImpl) ListTenants(ctx context.Context) ([]models.Tenant, error) {
+	rows, err := s.db.Query(`SELECT id, name, created_at FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Tenant
+	for rows.Next() {
+		var t models.Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *tenantServiceImpl) CreateAPIKey(ctx context.Context, tenantID, name string) (*models.CreateAPIKeyResponse, error) {
+	if err := s.ensureTenant(tenantID); err != nil {
+		return nil, err
+	}
+
+	key := APIKeyPrefix + idgen.New()
+	query := `
+		INSERT INTO tenant_api_keys (tenant_id, name, key_hash) VALUES ($1, $2, $3)
+		RETURNING id, tenant_id, name, created_at
+	`
+	resp := &models.CreateAPIKeyResponse{Key: key}
+	if err := s.db.QueryRow(query, tenantID, name, hashAPIKey(key)).Scan(
+		&resp.ID, &resp.TenantID, &resp.Name, &resp.CreatedAt); err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("api key created",
+		slog.String(logger.KeyTenantID, tenantID), slog.Int("api_key_id", resp.ID))
+	return resp, nil
+}
+
+func (s *tenantServiceImpl) ListAPIKeys(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	if err := s.ensureTenant(tenantID); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT id, tenant_id, name, created_at, revoked_at
+		FROM tenant_api_keys
+		WHERE tenant_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		if err := rows.Scan(&k.ID, &k.TenantID, &k.Name, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (s *tenantServiceImpl) RevokeAPIKey(ctx context.Context, tenantID string, keyID int) error {
+	query := `
+		UPDATE tenant_api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL
+		RETURNING key_hash
+	`
+	var keyHash string
+	if err := s.db.QueryRow(query, keyID, tenantID).Scan(&keyHash); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	// 立即失效快取，避免已撤銷的 key 在 TTL 內仍可使用
+	if err := s.rdb.Del(ctx, cache.APIKeyTenantKey(keyHash)); err != nil {
+		logger.FromContext(ctx).Warn("invalidate api key cache failed",
+			slog.String(logger.KeyTenantID, tenantID), logger.Err(err))
+	}
+	logger.FromContext(ctx).Info("api key revoked",
+		slog.String(logger.KeyTenantID, tenantID), slog.Int("api_key_id", keyID))
+	return nil
+}
+
+func (s *tenantServiceImpl) ResolveAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	keyHash := hashAPIKey(key)
+	cacheKey := cache.APIKeyTenantKey(keyHash)
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		var k models.APIKey
+		if jsonErr := json.Unmarshal([]byte(cached), &k); jsonErr == nil && k.TenantID != "" {
+			return &k, nil
+		}
+	}
+
+	query := `
+		SELECT id, tenant_id, name, created_at
+		FROM tenant_api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`
+	var k models.APIKey
+	if err := s.db.QueryRow(query, keyHash).Scan(&k.ID, &k.TenantID, &k.Name, &k.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if jsonBytes, err := json.Marshal(k); err == nil {
+		if err := s.rdb.Set(ctx, cacheKey, string(jsonBytes), cache.APIKeyTenantTTL()); err != nil {
+			logger.FromContext(ctx).Warn("cache api key failed", logger.Err(err))
+		}
+	}
+	return &k, nil
+}
+
+func (s *tenantServiceImpl) ensureTenant(tenantID string) error {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM tenants WHERE id = $1)`, tenantID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTenantNotFound
+	}
+	return nil
+}
+
+// hashAPIKey 以 SHA-256 雜湊 API key，資料庫與快取只保存雜湊值
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/twin"
+)
+
+const (
+	// maxTwinDocument 單側文件序列化後的大小上限
+	maxTwinDocument = 32 << 10
+	// maxTwinWait 長輪詢最長等待時間
+	maxTwinWait = 60 * time.Second
+	// twinPatchAttempts 未指定版本時，並行更新衝突的重試次數
+	twinPatchAttempts = 5
+
+	twinDesired  = "desired"
+	twinReported = "reported"
+)
+
+// TwinService 設備孿生文件；尚未建立的設備回傳兩側皆為空、版本 0 的文件
+type TwinService interface {
+	GetTwin(ctx context.Context, tenantID, deviceID string) (*models.DeviceTwin, error)
+	PatchDesired(ctx context.Context, tenantID, deviceID string, req models.PatchTwinRequest) (*models.DeviceTwin, error)
+	PatchReported(ctx context.Context, tenantID, deviceID string, req models.PatchTwinRequest) (*models.DeviceTwin, error)
+	// MergeReported 資料寫入時更新 reported 的頂層欄位（例如 status），內容未變時不遞增版本
+	MergeReported(ctx context.Context, tenantID, deviceID string, values twin.Document) error
+	GetDelta(ctx context.Context, tenantID, deviceID string) (*models.TwinDelta, error)
+	// WaitDelta 長輪詢：等到 desired 版本大於 sinceVersion 或逾時後回傳目前的差異
+	WaitDelta(ctx context.Context, tenantID, deviceID string, sinceVersion int64, wait time.Duration) (*models.TwinDelta, error)
+}
+
+type twinServiceImpl struct {
+	db  interfaces.DBClient
+	hub *twin.Hub
+}
+
+// NewTwinService 建立 TwinService；hub 用來喚醒等待 desired 更新的長輪詢，nil 時只喚醒同一程序內的等待者
+func NewTwinService(db interfaces.DBClient, hub *twin.Hub) TwinService {
+	if hub == nil {
+		hub = twin.NewHub(nil)
+	}
+	return &twinServiceImpl{db: db, hub: hub}
+}
+
+func (s *twinServiceImpl) GetTwin(ctx context.Context, tenantID, deviceID string) (*models.DeviceTwin, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	t := &models.DeviceTwin{TenantID: tenantID, DeviceID: deviceID, Desired: twin.Document{}, Reported: twin.Document{}}
+	var desired, reported []byte
+	var desiredAt, reportedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT desired, desired_version, desired_updated_at, reported, reported_version, reported_updated_at
+		FROM device_twins
+		WHERE tenant_id = $1 AND device_id = $2
+	`, tenantID, deviceID).Scan(&desired, &t.DesiredVersion, &desiredAt, &reported, &t.ReportedVersion, &reportedAt)
+	if err == sql.ErrNoRows {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(desired, &t.Desired); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(reported, &t.Reported); err != nil {
+		return nil, err
+	}
+	if desiredAt.Valid {
+		t.DesiredUpdatedAt = &desiredAt.Time
+	}
+	if reportedAt.Valid {
+		t.ReportedUpdatedAt = &reportedAt.Time
+	}
+	return t, nil
+}
+
+func (s *twinServiceImpl) PatchDesired(ctx context.Context, tenantID, deviceID string, req models.PatchTwinRequest) (*models.DeviceTwin, error) {
+	return s.patch(ctx, tenantID, deviceID, twinDesired, req)
+}
+
+func (s *twinServiceImpl) PatchReported(ctx context.Context, tenantID, deviceID string, req models.PatchTwinRequest) (*models.DeviceTwin, error) {
+	return s.patch(ctx, tenantID, deviceID, twinReported, req)
+}
+
+// patch 讀取、合併後以版本號比對寫回（compare-and-set）；指定版本不符時回傳 ErrTwinVersionConflict，
+// 未指定版本時遇到並行更新會重試
+func (s *twinServiceImpl) patch(ctx context.Context, tenantID, deviceID, side string, req models.PatchTwinRequest) (*models.DeviceTwin, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	for k := range req.Patch {
+		if k == "" {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "patch", Message: "欄位名稱不能為空"}}}
+		}
+	}
+	if _, err := s.db.Exec(`
+		INSERT INTO device_twins (tenant_id, device_id) VALUES ($1, $2)
+		ON CONFLICT (tenant_id, device_id) DO NOTHING
+	`, tenantID, deviceID); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < twinPatchAttempts; attempt++ {
+		t, err := s.GetTwin(ctx, tenantID, deviceID)
+		if err != nil {
+			return nil, err
+		}
+		doc, version := t.Desired, t.DesiredVersion
+		if side == twinReported {
+			doc, version = t.Reported, t.ReportedVersion
+		}
+		if req.Version != nil && *req.Version != version {
+			return nil, ErrTwinVersionConflict
+		}
+		merged, changed := twin.Merge(doc, req.Patch)
+		if !changed {
+			return t, nil
+		}
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxTwinDocument {
+			return nil, &ValidationError{Errors: []FieldError{{Field: "patch", Message: "合併後的文件超過 32KB 上限"}}}
+		}
+
+		res, err := s.db.Exec(`
+			UPDATE device_twins
+			SET `+side+` = $3, `+side+`_version = `+side+`_version + 1, `+side+`_updated_at = CURRENT_TIMESTAMP
+			WHERE tenant_id = $1 AND device_id = $2 AND `+side+`_version = $4
+		`, tenantID, deviceID, string(b), version)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			if side == twinDesired {
+				if err := s.hub.Publish(ctx, tenantID, deviceID); err != nil {
+					logger.FromContext(ctx).Warn("publish twin desired update failed", logger.Err(err))
+				}
+			}
+			logger.FromContext(ctx).Info("device twin updated",
+				slog.String(logger.KeyTenantID, tenantID),
+				slog.String(logger.KeyDeviceID, deviceID),
+				slog.String("side", side),
+				slog.Int64("version", version+1))
+			return s.GetTwin(ctx, tenantID, deviceID)
+		}
+		if req.Version != nil {
+			return nil, ErrTwinVersionConflict
+		}
+	}
+	return nil, ErrTwinVersionConflict
+}
+
+func (s *twinServiceImpl) MergeReported(ctx context.Context, tenantID, deviceID string, values twin.Document) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO device_twins (tenant_id, device_id, reported, reported_version, reported_updated_at)
+		VALUES ($1, $2, $3, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE
+		SET reported = device_twins.reported || EXCLUDED.reported,
+			reported_version = device_twins.reported_version + 1,
+			reported_updated_at = CURRENT_TIMESTAMP
+		WHERE NOT device_twins.reported @> EXCLUDED.reported
+	`, tenantID, deviceID, string(b))
+	return err
+}
+
+func (s *twinServiceImpl) GetDelta(ctx context.Context, tenantID, deviceID string) (*models.TwinDelta, error) {
+	t, err := s.GetTwin(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	delta := twin.Delta(t.Desired, t.Reported)
+	return &models.TwinDelta{
+		DeviceID:        deviceID,
+		DesiredVersion:  t.DesiredVersion,
+		ReportedVersion: t.ReportedVersion,
+		Delta:           delta,
+		InSync:          len(delta) == 0,
+	}, nil
+}
+
+// WaitDelta 等待 desired 更新的通知，不輪詢 DB：被喚醒時重新讀取，逾時時做最後一次讀取
+// （補上 Pub/Sub 斷線期間漏接的通知）；ctx 取消（請求結束或伺服器關閉）時回傳最後讀到的差異
+func (s *twinServiceImpl) WaitDelta(ctx context.Context, tenantID, deviceID string, sinceVersion int64, wait time.Duration) (*models.TwinDelta, error) {
+	if wait > maxTwinWait {
+		wait = maxTwinWait
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		updated, cancel := s.hub.Wait(tenantID, deviceID)
+		d, err := s.GetDelta(ctx, tenantID, deviceID)
+		if err != nil || d.DesiredVersion > sinceVersion {
+			cancel()
+			return d, err
+		}
+		select {
+		case <-updated:
+			continue
+		case <-deadline.C:
+			cancel()
+			return s.GetDelta(ctx, tenantID, deviceID)
+		case <-ctx.Done():
+			cancel()
+			return d, nil
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+)
+
+// profileNotFoundMarker 快取「沒有設定檔」的結果，避免多數未設定的設備每次回報都查 DB
+const profileNotFoundMarker = "-"
+
+// defaultRules 未設定任何驗證設定檔時套用的核心欄位範圍，可由 SetDefaultValidationRules 於執行期間替換
+var defaultRules atomic.Pointer[map[string]models.Range]
+
+func init() {
+	SetDefaultValidationRules(map[string]models.Range{
+		"voltage":     {Min: float64Ptr(100), Max: float64Ptr(240)},
+		"current":     {Min: float64Ptr(0), Max: float64Ptr(100)},
+		"temperature": {Min: float64Ptr(0), Max: float64Ptr(100)},
+	})
+}
+
+// DefaultValidationRules 未設定任何驗證設定檔時套用的核心欄位範圍（回傳副本，呼叫端可自由修改）
+func DefaultValidationRules() map[string]models.Range {
+	rules := *defaultRules.Load()
+	out := make(map[string]models.Range, len(rules))
+	for k, v := range rules {
+		out[k] = v
+	}
+	return out
+}
+
+// SetDefaultValidationRules 替換預設範圍，之後的驗證立即套用
+func SetDefaultValidationRules(rules map[string]models.Range) {
+	defaultRules.Store(&rules)
+}
+
+// ValidationProfileService 管理設備類型 / 單一設備的量測值範圍設定
+type ValidationProfileService interface {
+	ListProfiles(ctx context.Context, tenantID string) ([]models.ValidationProfile, error)
+	GetProfile(ctx context.Context, tenantID, scope, target string) (*models.ValidationProfile, error)
+	PutProfile(ctx context.Context, tenantID, scope, target string, rules map[string]models.Range) (*models.ValidationProfile, error)
+	DeleteProfile(ctx context.Context, tenantID, scope, target string) error
+	// EffectiveProfile 合併預設值、設備類型與單一設備的設定（後者優先，逐欄位覆寫）
+	EffectiveProfile(ctx context.Context, tenantID, deviceID string) (*models.EffectiveValidationProfile, error)
+}
+
+type validationProfileServiceImpl struct {
+	db      interfaces.DBClient
+	rdb     interfaces.RedisClient
+	devices DeviceService
+}
+
+// NewValidationProfileService 建立 ValidationProfileService
+func NewValidationProfileService(db interfaces.DBClient, rdb interfaces.RedisClient, devices DeviceService) ValidationProfileService {
+	return &validationProfileServiceImpl{db: db, rdb: rdb, devices: devices}
+}
+
+func (s *validationProfileServiceImpl) ListProfiles(ctx context.Context, tenantID string) ([]models.ValidationProfile, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	query := `
+		SELECT tenant_id, scope, target, rules, updated_at
+		FROM validation_profiles
+		WHERE tenant_id = $1
+		ORDER BY scope, target
+	`
+	rows, err := s.db.Query(query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.ValidationProfile
+	for rows.Next() {
+		var p models.ValidationProfile
+		var rulesJSON []byte
+		if err := rows.Scan(&p.TenantID, &p.Scope, &p.Target, &rulesJSON, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(rulesJSON, &p.Rules); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (s *validationProfileServiceImpl) GetProfile(ctx context.Context, tenantID, scope, target string) (*models.ValidationProfile, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if !validProfileScope(scope) {
+		return nil, ErrInvalidInput
+	}
+	cacheKey := cache.ValidationProfileKey(tenantID, scope, target)
+	if cached, err := s.rdb.Get(ctx, cacheKey); err == nil {
+		if cached == profileNotFoundMarker {
+			return nil, ErrProfileNotFound
+		}
+		var p models.ValidationProfile
+		if jsonErr := json.Unmarshal([]byte(cached), &p); jsonErr == nil {
+			return &p, nil
+		}
+	}
+
+	query := `
+		SELECT tenant_id, scope, target, rules, updated_at
+		FROM validation_profiles
+		WHERE tenant_id = $1 AND scope = $2 AND target = $3
+	`
+	var p models.ValidationProfile
+	var rulesJSON []byte
+	err := s.db.QueryRow(query, tenantID, scope, target).Scan(&p.TenantID, &p.Scope, &p.Target, &rulesJSON, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		if setErr := s.rdb.Set(ctx, cacheKey, profileNotFoundMarker, cache.ValidationProfileTTL()); setErr != nil {
+			logger.FromContext(ctx).Warn("cache validation profile failed", logger.Err(setErr))
+		}
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rulesJSON, &p.Rules); err != nil {
+		return nil, err
+	}
+
+	if jsonBytes, err := json.Marshal(p); err == nil {
+		if err := s.rdb.Set(ctx, cacheKey, string(jsonBytes), cache.ValidationProfileTTL()); err != nil {
+			logger.FromContext(ctx).Warn("cache validation profile failed", logger.Err(err))
+		}
+	}
+	return &p, nil
+}
+
+func (s *validationProfileServiceImpl) PutProfile(ctx context.Context, tenantID, scope, target string, rules map[string]models.Range) (*models.ValidationProfile, error) {
+	if tenantID == "" {
+		return nil, ErrTenantRequired
+	}
+	if !validProfileScope(scope) || target == "" {
+		return nil, ErrInvalidInput
+	}
+	if errs := validateRules(rules); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO validation_profiles (tenant_id, scope, target, rules) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, scope, target) DO UPDATE
+		SET rules = EXCLUDED.rules, updated_at = CURRENT_TIMESTAMP
+		RETURNING tenant_id, scope, target, updated_at
+	`
+	p := models.ValidationProfile{Rules: rules}
+	if err := s.db.QueryRow(query, tenantID, scope, target, string(rulesJSON)).Scan(
+		&p.TenantID, &p.Scope, &p.Target, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, tenantID, scope, target)
+	logger.FromContext(ctx).Info("validation profile saved",
+		slog.String(logger.KeyTenantID, tenantID),
+		slog.String("scope", scope),
+		slog.String("target", target))
+	return &p, nil
+}
+
+func (s *validationProfileServiceImpl) DeleteProfile(ctx context.Context, tenantID, scope, target string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	if !validProfileScope(scope) {
+		return ErrInvalidInput
+	}
+	res, err := s.db.Exec(`DELETE FROM validation_profiles WHERE tenant_id = $1 AND scope = $2 AND target = $3`,
+		tenantID, scope, target)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrProfileNotFound
+	}
+	s.invalidate(ctx, tenantID, scope, target)
+	return nil
+}
+
+func (s *validationProfileServiceImpl) EffectiveProfile(ctx context.Context, tenantID, deviceID string) (*models.EffectiveValidationProfile, error) {
+	eff := &models.EffectiveValidationProfile{
+		DeviceID: deviceID,
+		Source:   models.ProfileScopeDefault,
+		Rules:    DefaultValidationRules(),
+	}
+
+	deviceType, err := s.devices.GetDeviceType(ctx, tenantID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if deviceType != "" {
+		p, err := s.GetProfile(ctx, tenantID, models.ProfileScopeDeviceType, deviceType)
+		if err != nil && err != ErrProfileNotFound {
+			return nil, err
+		}
+		if p != nil {
+			mergeRules(eff.Rules, p.Rules)
+			eff.Source, eff.Target = models.ProfileScopeDeviceType, deviceType
+		}
+	}
+
+	p, err := s.GetProfile(ctx, tenantID, models.ProfileScopeDevice, deviceID)
+	if err != nil && err != ErrProfileNotFound {
+		return nil, err
+	}
+	if p != nil {
+		mergeRules(eff.Rules, p.Rules)
+		eff.Source, eff.Target = models.ProfileScopeDevice, deviceID
+	}
+	return eff, nil
+}
+
+func (s *validationProfileServiceImpl) invalidate(ctx context.Context, tenantID, scope, target string) {
+	if err := s.rdb.Del(ctx, cache.ValidationProfileKey(tenantID, scope, target)); err != nil {
+		logger.FromContext(ctx).Warn("invalidate validation profile cache failed", logger.Err(err))
+	}
+}
+
+func validProfileScope(scope string) bool {
+	return scope == models.ProfileScopeDeviceType || scope == models.ProfileScopeDevice
+}
+
+// mergeRules 以 override 逐欄位覆寫 base
+func mergeRules(base, override map[string]models.Range) {
+	for name, r := range override {
+		base[name] = r
+	}
+}
+
+// validateRules 檢查設定檔中的欄位名稱與範圍
+func validateRules(rules map[string]models.Range) []FieldError {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []FieldError
+	for _, name := range names {
+		r := rules[name]
+		path := "rules." + name
+		if !fieldNamePattern.MatchString(name) {
+			errs = append(errs, FieldError{Field: path, Message: "欄位名稱須為小寫英文開頭，僅含小寫英數字與底線"})
+			continue
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			errs = append(errs, FieldError{Field: path, Message: "min 不可大於 max"})
+		}
+	}
+	return errs
+}
+
+// validateRanges 依設定檔檢查核心欄位與其他欄位的數值範圍
+func validateRanges(rules map[string]models.Range, values map[string]float64) []FieldError {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []FieldError
+	for _, name := range names {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		r := rules[name]
+		value := v
+		path := name
+		if !isCoreField(name) {
+			path = "fields." + name
+		}
+		if r.Min != nil && v < *r.Min {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("不可小於 %g", *r.Min), Value: &value})
+		}
+		if r.Max != nil && v > *r.Max {
+			errs = append(errs, FieldError{Field: path, Message: fmt.Sprintf("不可大於 %g", *r.Max), Value: &value})
+		}
+	}
+	return errs
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
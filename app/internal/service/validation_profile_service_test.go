@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"iot-data-collection/app/internal/models"
+)
+
+func TestMergeRulesAndValidateRanges(t *testing.T) {
+	rules := DefaultValidationRules()
+	mergeRules(rules, map[string]models.Range{
+		"voltage":  {Min: ptr(340), Max: ptr(440)},
+		"humidity": {Max: ptr(100)},
+	})
+
+	values := map[string]float64{"voltage": 400, "current": 20, "temperature": 35, "humidity": 50}
+	if errs := validateRanges(rules, values); len(errs) != 0 {
+		t.Errorf("400V 應通過三相電表設定檔，得到 %+v", errs)
+	}
+
+	values = map[string]float64{"voltage": 220, "current": -1, "temperature": 35, "humidity": 101}
+	errs := validateRanges(rules, values)
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	for _, field := range []string{"voltage", "current", "fields.humidity"} {
+		if !got[field] {
+			t.Errorf("期望 %s 驗證失敗，得到 %+v", field, errs)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("期望 3 個錯誤，得到 %+v", errs)
+	}
+}
@@ -0,0 +1,23 @@
+package tenant
+
+import "context"
+
+// DefaultTenantID 未啟用 API key 驗證時使用的預設租戶，
+// 也是既有資料（多租戶導入前寫入）所屬的租戶
+const DefaultTenantID = "default"
+
+type ctxKey struct{}
+
+// WithTenant 將租戶 ID 放入 context
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, tenantID)
+}
+
+// FromContext 取出 context 中的租戶 ID；第二個回傳值表示是否存在
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,101 @@
+package twin
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// DesiredChannel desired 狀態更新時廣播的 Pub/Sub channel，訊息內容為 "tenantID:deviceID"
+const DesiredChannel = "iot:twin:desired"
+
+type pubSubClient interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redisdriver.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redisdriver.PubSub
+}
+
+// Hub 喚醒等待 desired 更新的長輪詢；各 replica 以 Redis Pub/Sub 互相通知，
+// 等待中的請求不需各自輪詢 DB
+type Hub struct {
+	client  pubSubClient // nil 時只喚醒本機（單一 replica 或不需長輪詢的程序）
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+// NewHub 建立 Hub；client 為 nil 時只喚醒同一程序內的等待者
+func NewHub(client pubSubClient) *Hub {
+	return &Hub{client: client, waiters: map[string]map[chan struct{}]struct{}{}}
+}
+
+func hubKey(tenantID, deviceID string) string {
+	return tenantID + ":" + deviceID
+}
+
+// Wait 註冊等待設備下一次 desired 更新，回傳更新時關閉的 channel 與取消註冊的函式；
+// 應先註冊再讀取目前版本，避免讀取後、等待前的更新被漏接
+func (h *Hub) Wait(tenantID, deviceID string) (<-chan struct{}, func()) {
+	key := hubKey(tenantID, deviceID)
+	ch := make(chan struct{})
+	h.mu.Lock()
+	if h.waiters[key] == nil {
+		h.waiters[key] = map[chan struct{}]struct{}{}
+	}
+	h.waiters[key][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if set := h.waiters[key]; set != nil {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(h.waiters, key)
+			}
+		}
+	}
+}
+
+// Publish 通知設備的 desired 已更新：立即喚醒本機等待者，並廣播給其他 replica
+func (h *Hub) Publish(ctx context.Context, tenantID, deviceID string) error {
+	key := hubKey(tenantID, deviceID)
+	h.wake(key)
+	if h.client == nil {
+		return nil
+	}
+	return h.client.Publish(ctx, DesiredChannel, key).Err()
+}
+
+// Start 訂閱其他 replica 的更新廣播直到 ctx 取消；連線中斷期間漏接的通知由長輪詢逾時前的最後一次讀取補上
+func (h *Hub) Start(ctx context.Context) {
+	if h.client == nil {
+		return
+	}
+	go func() {
+		sub := h.client.Subscribe(ctx, DesiredChannel)
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("twin desired subscriber stopped")
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					slog.Warn("twin desired channel closed")
+					return
+				}
+				h.wake(msg.Payload)
+			}
+		}
+	}()
+}
+
+func (h *Hub) wake(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.waiters[key] {
+		close(ch)
+	}
+	delete(h.waiters, key)
+}
@@ -0,0 +1,90 @@
+// Package twin 設備孿生文件（desired / reported 狀態）的合併與差異計算
+package twin
+
+import "reflect"
+
+// Document 孿生文件的一側狀態（JSON 物件）
+type Document map[string]interface{}
+
+// Merge 以 JSON Merge Patch（RFC 7386）語意套用 patch：值為 null 時刪除鍵，物件遞迴合併，其餘取代；
+// 回傳新文件，不修改 doc，並回報內容是否有變更
+func Merge(doc, patch Document) (Document, bool) {
+	out := clone(doc)
+	changed := mergeInto(out, patch)
+	return out, changed
+}
+
+func mergeInto(dst, patch Document) bool {
+	changed := false
+	for k, v := range patch {
+		if v == nil {
+			if _, ok := dst[k]; ok {
+				delete(dst, k)
+				changed = true
+			}
+			continue
+		}
+		if sub, ok := asObject(v); ok {
+			cur, isObj := asObject(dst[k])
+			if !isObj {
+				cur = Document{}
+			}
+			subChanged := mergeInto(cur, sub)
+			if !isObj {
+				// 原本不存在或不是物件：即使 patch 內容為空也視為取代
+				subChanged = true
+			}
+			dst[k] = cur
+			changed = changed || subChanged
+			continue
+		}
+		if old, ok := dst[k]; !ok || !reflect.DeepEqual(old, v) {
+			dst[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Delta 列出 desired 中與 reported 不一致的部分（物件遞迴比較）；reported 多出的鍵不列入
+func Delta(desired, reported Document) Document {
+	delta := Document{}
+	for k, want := range desired {
+		have, ok := reported[k]
+		wantObj, wantIsObj := asObject(want)
+		haveObj, haveIsObj := asObject(have)
+		switch {
+		case !ok:
+			delta[k] = want
+		case wantIsObj && haveIsObj:
+			if sub := Delta(wantObj, haveObj); len(sub) > 0 {
+				delta[k] = sub
+			}
+		case !reflect.DeepEqual(want, have):
+			delta[k] = want
+		}
+	}
+	return delta
+}
+
+func asObject(v interface{}) (Document, bool) {
+	switch m := v.(type) {
+	case Document:
+		return m, true
+	case map[string]interface{}:
+		return Document(m), true
+	}
+	return nil, false
+}
+
+func clone(doc Document) Document {
+	out := make(Document, len(doc))
+	for k, v := range doc {
+		if sub, ok := asObject(v); ok {
+			out[k] = clone(sub)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package twin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	doc := Document{
+		"interval": 60.0,
+		"thresholds": map[string]interface{}{
+			"temperature": 80.0,
+			"voltage":     250.0,
+		},
+		"mode": "eco",
+	}
+	patch := Document{
+		"interval":   30.0,
+		"thresholds": map[string]interface{}{"voltage": 240.0},
+		"mode":       nil,
+	}
+	got, changed := Merge(doc, patch)
+	want := Document{
+		"interval":   30.0,
+		"thresholds": Document{"temperature": 80.0, "voltage": 240.0},
+	}
+	if !changed || !reflect.DeepEqual(got, want) {
+		t.Errorf("合併結果不符: %v (changed=%v)", got, changed)
+	}
+	if doc["interval"] != 60.0 {
+		t.Error("Merge 不應修改原文件")
+	}
+
+	if _, changed := Merge(got, Document{"interval": 30.0, "missing": nil}); changed {
+		t.Error("內容相同的 patch 不應視為變更")
+	}
+}
+
+func TestDelta(t *testing.T) {
+	desired := Document{
+		"interval":   30.0,
+		"thresholds": map[string]interface{}{"temperature": 80.0, "voltage": 240.0},
+		"firmware":   "1.2.0",
+	}
+	reported := Document{
+		"interval":   30.0,
+		"thresholds": map[string]interface{}{"temperature": 80.0, "voltage": 250.0},
+		"status":     "normal",
+	}
+	got := Delta(desired, reported)
+	want := Document{
+		"thresholds": Document{"voltage": 240.0},
+		"firmware":   "1.2.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("差異不符: %v", got)
+	}
+	if len(Delta(reported, reported)) != 0 {
+		t.Error("相同文件不應有差異")
+	}
+}
+
+// TestHubWakesWaiters desired 更新只喚醒同一設備的等待者，取消註冊後不再收到通知
+func TestHubWakesWaiters(t *testing.T) {
+	h := NewHub(nil)
+	woken, cancelWoken := h.Wait("acme", "meter-1")
+	defer cancelWoken()
+	other, cancelOther := h.Wait("acme", "meter-2")
+	defer cancelOther()
+	_, cancelGone := h.Wait("acme", "meter-1")
+	cancelGone()
+
+	if err := h.Publish(context.Background(), "acme", "meter-1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-woken:
+	default:
+		t.Error("同一設備的等待者應被喚醒")
+	}
+	select {
+	case <-other:
+		t.Error("其他設備的等待者不應被喚醒")
+	default:
+	}
+	if n := len(h.waiters); n != 1 {
+		t.Errorf("喚醒與取消註冊後只應剩下 meter-2 的等待者，剩下 %d 個設備", n)
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"iot-data-collection/app/internal/energy"
+	"iot-data-collection/app/internal/metricstore"
+)
+
+// readingPower 由電壓與電流推導功率；任一未回報時回傳 nil
+func readingPower(voltage, current *float64) *float64 {
+	if voltage == nil || current == nil {
+		return nil
+	}
+	p := energy.Power(*voltage, *current)
+	return &p
+}
+
+// deriveEnergy 依設備最新一筆讀值與歸零時間，計算本筆讀值的電能增量與累積電能；
+// latest 為寫入前 store 中最新一筆的時間戳（尚無資料時為 nil）。
+// powerW 為 nil（未回報電壓或電流）時只回傳 latest。累積電能自最近一筆有值的讀值延續，
+// 上一筆沒有功率時無法積分，增量為 0
+func (w *MetricWorker) deriveEnergy(ctx context.Context, tenantID, deviceID string, timestamp time.Time, powerW *float64) (deltaKWh, totalKWh float64, latest *time.Time, err error) {
+	last, err := w.Store.Latest(ctx, tenantID, deviceID)
+	if errors.Is(err, metricstore.ErrNotFound) {
+		return 0, 0, nil, nil
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	latest = &last.Timestamp
+	if powerW == nil {
+		return 0, 0, latest, nil
+	}
+
+	var total float64
+	totalAt := last.Timestamp
+	if last.EnergyKWh != nil {
+		total = *last.EnergyKWh
+	} else {
+		points, err := w.Store.Series(ctx, metricstore.SeriesQuery{TenantID: tenantID, DeviceID: deviceID, Field: "energy_kwh", Limit: 1})
+		if err != nil {
+			return 0, 0, latest, err
+		}
+		if len(points) > 0 {
+			total, totalAt = points[0].Value, points[0].Timestamp
+		}
+	}
+
+	var reset *time.Time
+	if w.DB != nil {
+		var resetAt sql.NullTime
+		err = w.DB.QueryRow(`SELECT energy_reset_at FROM devices WHERE tenant_id = $1 AND device_id = $2`, tenantID, deviceID).Scan(&resetAt)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, 0, latest, err
+		}
+		if resetAt.Valid {
+			reset = &resetAt.Time
+		}
+	}
+
+	prevPower := last.PowerW
+	if prevPower == nil {
+		prevPower = readingPower(last.Voltage, last.Current)
+	}
+	if prevPower == nil {
+		// 上一筆沒有功率：不積分，只延續累積電能
+		if reset != nil && reset.After(totalAt) && !reset.After(timestamp) {
+			return 0, 0, latest, nil
+		}
+		return 0, total, latest, nil
+	}
+	// 延續的累積電能早於上一筆時，兩者之間的歸零由此處理，上一筆之後的歸零由 Integrate 處理
+	if reset != nil && reset.After(totalAt) && !reset.After(last.Timestamp) {
+		total = 0
+	}
+	prev := energy.Reading{Timestamp: last.Timestamp, PowerW: *prevPower, EnergyKWh: total}
+	deltaKWh, totalKWh = energy.Integrate(&prev, timestamp, *powerW, reset)
+	return deltaKWh, totalKWh, latest, nil
+}
@@ -3,66 +3,468 @@ package worker
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"iot-data-collection/app/internal/alert"
+	"iot-data-collection/app/internal/anomaly"
 	"iot-data-collection/app/internal/cache"
 	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/latedata"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/metricstore"
 	"iot-data-collection/app/internal/models"
 	"iot-data-collection/app/internal/queue"
+	"iot-data-collection/app/internal/service"
+	"iot-data-collection/app/internal/tenant"
+	"iot-data-collection/app/internal/twin"
 
+	"github.com/lib/pq"
 	redisdriver "github.com/redis/go-redis/v9"
 )
 
-func RunMetricWorker(ctx context.Context, rdb *redisdriver.Client, db interfaces.DBClient, redisClient interfaces.RedisClient) {
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Metric worker 收到停止訊號，結束")
-			return
-		default:
-			result, err := rdb.BRPop(ctx, 5*time.Second, queue.MetricQueueKey).Result()
-			if err != nil || len(result) < 2 {
-				continue
-			}
+// MetricWorker 消費佇列寫入 Store。選用的相依為 nil 時略過對應功能：
+// DB 為 nil 時不登記設備、不更新設備位置，電能也不考慮歸零時間（開發模式只使用記憶體 store），
+// Quarantine 為 nil 時違反 DB 限制的任務直接丟棄，Anomaly 為 nil 時不做異常偵測，Alerts 為 nil 時不送告警，
+// LateCounter 為 nil 時不統計延遲與亂序筆數，Twins 為 nil 時不更新設備孿生的 reported 狀態，
+// StatusEvents 為 nil 時不記錄狀態轉換
+type MetricWorker struct {
+	Queue        redisdriver.Cmdable
+	Store        metricstore.Store
+	DB           interfaces.DBClient
+	Cache        interfaces.RedisClient
+	Quarantine   service.QuarantineService
+	Anomaly      service.AnomalyService
+	Alerts       alert.Notifier
+	LateWindow   time.Duration // 讀值時間戳早於接收時間（舊版任務為處理當下）超過此時間即標記為延遲，0 表示停用
+	LateCounter  latedata.Counter
+	Twins        service.TwinService
+	StatusEvents service.StatusEventService
+	PopTimeout   time.Duration // BRPOP 最長阻塞時間，未設定時為 5 秒
 
-			payload := result[1]
-			var task interfaces.MetricTask
-			if err := json.Unmarshal([]byte(payload), &task); err != nil {
-				log.Printf("metric worker: 解析任務失敗: %v", err)
-				continue
+	// 告警佇列：最多 AlertSenders 個 webhook 請求同時進行，每個最多 AlertTimeout；未設定時使用 default* 常數
+	AlertQueueSize int
+	AlertSenders   int
+	AlertTimeout   time.Duration
+
+	alerts     chan alert.Alert // 待送出的告警，由 Run 啟動的 AlertSenders 個 goroutine 消費
+	alertsOnce sync.Once
+	heartbeat  atomic.Int64 // 最近一次取任務的時間（UnixNano），供就緒檢查判斷 worker 是否卡住
+	// processFunc 測試用，nil 時為 process
+	processFunc func(ctx context.Context, payload string) error
+}
+
+// LastHeartbeat 實作 interfaces.Heartbeat
+func (w *MetricWorker) LastHeartbeat() time.Time {
+	n := w.heartbeat.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// 告警佇列的預設值
+const (
+	defaultAlertQueueSize = 1000
+	defaultAlertSenders   = 4
+	defaultAlertTimeout   = 10 * time.Second
+)
+
+// errStoreFailed 讀值未能寫入 DB（非資料本身違反限制），停止中時任務會放回佇列
+var errStoreFailed = errors.New("store metric failed")
+
+// Run 持續處理任務直到 ctx 取消，手上的任務與送出中的告警結束後才返回。
+// ctx 取消後不再取新任務，但手上的任務會以不受取消影響的 context 處理完；
+// 進行中的 BRPOP 也不會被中斷（中斷時 Redis 可能已取出任務而回應遺失），因此最多延遲 PopTimeout 才返回
+func (w *MetricWorker) Run(ctx context.Context) {
+	var senders sync.WaitGroup
+	stopAlerts := make(chan struct{})
+	if w.Alerts != nil {
+		senderCount := w.AlertSenders
+		if senderCount <= 0 {
+			senderCount = defaultAlertSenders
+		}
+		for i := 0; i < senderCount; i++ {
+			senders.Add(1)
+			go func() {
+				defer senders.Done()
+				w.sendAlerts(stopAlerts)
+			}()
+		}
+	}
+
+	w.consume(ctx)
+	close(stopAlerts)
+	senders.Wait()
+	slog.Info("metric worker stopped")
+}
+
+func (w *MetricWorker) consume(ctx context.Context) {
+	timeout := w.PopTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	workCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		w.heartbeat.Store(time.Now().UnixNano())
+		result, err := w.Queue.BRPop(workCtx, timeout, queue.MetricQueueKey).Result()
+		if err != nil || len(result) < 2 {
+			if err == redisdriver.Nil {
+				w.drainLegacyQueue(ctx, workCtx)
 			}
+			continue
+		}
+		w.handle(ctx, workCtx, result[1])
+	}
+}
 
-			timestamp, err := time.Parse(time.RFC3339, task.Timestamp)
-			if err != nil {
-				timestamp = time.Now()
+// drainLegacyQueue 處理舊 key 中剩餘的任務；BRPOP 多個 key 在 cluster 模式下可能跨 slot，因此分開以 RPOP 取出
+func (w *MetricWorker) drainLegacyQueue(ctx, workCtx context.Context) {
+	for ctx.Err() == nil {
+		payload, err := w.Queue.RPop(workCtx, queue.LegacyMetricQueueKey).Result()
+		if err != nil {
+			if err != redisdriver.Nil {
+				slog.Warn("pop legacy metric queue failed", logger.Err(err))
 			}
+			return
+		}
+		w.handle(ctx, workCtx, payload)
+	}
+}
+
+// handle 處理已取出的任務；停止中（ctx 已取消）且寫入失敗時放回佇列尾端，讓下一個取任務的 worker 優先處理
+func (w *MetricWorker) handle(ctx, workCtx context.Context, payload string) {
+	process := w.processFunc
+	if process == nil {
+		process = w.process
+	}
+	if err := process(workCtx, payload); err != nil && ctx.Err() != nil {
+		if rqErr := w.Queue.RPush(workCtx, queue.MetricQueueKey, payload).Err(); rqErr != nil {
+			slog.Error("requeue metric task on shutdown failed", logger.Err(rqErr), slog.String("payload", payload))
+			return
+		}
+		slog.Warn("metric task requeued on shutdown", logger.Err(err))
+	}
+}
+
+// process 處理單一任務；只有讀值未能寫入 DB 時回傳 errStoreFailed，其他錯誤（格式錯誤、隔離）都視為已處理
+func (w *MetricWorker) process(ctx context.Context, payload string) error {
+	var task interfaces.MetricTask
+	if err := json.Unmarshal([]byte(payload), &task); err != nil {
+		slog.Error("decode metric task failed", logger.Err(err))
+		return nil
+	}
+
+	// 多租戶導入前進入佇列的任務沒有 tenant_id，歸屬預設租戶
+	if task.TenantID == "" {
+		task.TenantID = tenant.DefaultTenantID
+	}
 
-			query := `
-				INSERT INTO device_metrics (device_id, voltage, current, temperature, status, timestamp)
-				VALUES ($1, $2, $3, $4, $5, $6)
-				RETURNING id, device_id, voltage, current, temperature, status, timestamp, created_at
-			`
-			var metric models.DeviceMetric
-			err = db.QueryRow(query, task.DeviceID, task.Voltage, task.Current, task.Temperature, task.Status, timestamp).Scan(
-				&metric.ID, &metric.DeviceID, &metric.Voltage, &metric.Current,
-				&metric.Temperature, &metric.Status, &metric.Timestamp, &metric.CreatedAt)
-			if err != nil {
-				log.Printf("metric worker: 寫入 DB 失敗 device=%s: %v", task.DeviceID, err)
-				continue
+	log := slog.Default().With(
+		slog.String(logger.KeyTaskID, task.TaskID),
+		slog.String(logger.KeyTenantID, task.TenantID),
+		slog.String(logger.KeyDeviceID, task.DeviceID),
+	)
+	if task.RequestID != "" {
+		log = log.With(slog.String(logger.KeyRequestID, task.RequestID))
+	}
+	ctx = logger.WithContext(ctx, log)
+
+	timestamp, err := time.Parse(time.RFC3339, task.Timestamp)
+	if err != nil {
+		timestamp = time.Now()
+	}
+	receivedAt, deviceTimestamp := optionalTime(task.ReceivedAt), optionalTime(task.DeviceTime)
+	// 以伺服器接收時間判定延遲，佇列積壓不會讓準時送達的讀值被標記為延遲；
+	// 沒有接收時間的舊版任務才以處理當下判定
+	arrivedAt := time.Now()
+	if receivedAt != nil {
+		arrivedAt = *receivedAt
+	}
+	isLate := latedata.IsLate(timestamp, arrivedAt, w.LateWindow)
+
+	// 推導功率與累積電能；延遲到達的讀值不計入電能，未回報電壓或電流時不推導
+	powerW := readingPower(task.Voltage, task.Current)
+	metric := models.DeviceMetric{
+		TenantID:        task.TenantID,
+		DeviceID:        task.DeviceID,
+		Voltage:         task.Voltage,
+		Current:         task.Current,
+		Temperature:     task.Temperature,
+		Status:          task.Status,
+		Fields:          task.Fields,
+		PowerW:          powerW,
+		IsLate:          isLate,
+		Timestamp:       timestamp,
+		ReceivedAt:      receivedAt,
+		DeviceTimestamp: deviceTimestamp,
+		Latitude:        task.Latitude,
+		Longitude:       task.Longitude,
+	}
+	deltaKWh, totalKWh, latest, err := w.deriveEnergy(ctx, task.TenantID, task.DeviceID, timestamp, powerW)
+	if err != nil {
+		log.Warn("derive energy failed, storing without energy", logger.Err(err))
+	} else if powerW != nil {
+		metric.EnergyDeltaKWh, metric.EnergyKWh = &deltaKWh, &totalKWh
+	}
+
+	// 異常偵測失敗不影響寫入；基準在寫入成功後才保存
+	eval := w.evaluateAnomaly(ctx, &task)
+	if eval != nil && eval.Result != nil && len(eval.Result.Fields) > 0 {
+		metric.AnomalyScore, metric.IsAnomaly = &eval.Result.Score, eval.Result.Anomalous
+		metric.AnomalyFields = eval.Result.Fields
+	}
+
+	err = w.Store.Insert(ctx, &metric)
+	if err != nil {
+		if pqErr, ok := constraintViolation(err); ok && w.Quarantine != nil {
+			log.Warn("metric violates db constraint, quarantining", logger.Err(err))
+			if _, qErr := w.Quarantine.Quarantine(ctx, service.QuarantineInput{
+				TenantID:  task.TenantID,
+				DeviceID:  task.DeviceID,
+				Source:    models.QuarantineSourceWorker,
+				Reason:    models.QuarantineReasonConstraint,
+				Errors:    []service.FieldError{{Field: constraintField(pqErr), Message: pqErr.Message}},
+				Payload:   []byte(payload),
+				RequestID: task.RequestID,
+			}); qErr != nil {
+				log.Error("quarantine metric failed", logger.Err(qErr))
 			}
+			return nil
+		}
+		log.Error("insert metric failed", logger.Err(err))
+		return fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+
+	if eval != nil && eval.Baseline != nil {
+		if err := w.Anomaly.CommitBaseline(ctx, task.TenantID, task.DeviceID, eval.Baseline); err != nil {
+			log.Warn("save anomaly baseline failed", logger.Err(err))
+		}
+	}
+
+	// 登記（或更新）租戶內的設備
+	w.registerDevice(ctx, &task, &metric)
+
+	// 最新值快取以讀值時間戳比較，延遲或補傳的舊讀值不會覆蓋較新的資料：
+	// 早於 DB 已知最新一筆的讀值不更新快取（快取可能已過期）；其餘以 SetIfNewer 原子比較，處理多個 worker 同時寫入
+	outOfOrder := latest != nil && metric.Timestamp.Before(*latest)
+	if !outOfOrder {
+		outOfOrder = !w.updateLatestCache(ctx, &metric)
+	}
+	w.countLate(ctx, &task, isLate, outOfOrder)
+
+	// 只以最新的讀值更新設備孿生，避免補傳的舊狀態覆蓋
+	if w.Twins != nil && !outOfOrder {
+		if err := w.Twins.MergeReported(ctx, task.TenantID, task.DeviceID, twin.Document{"status": task.Status}); err != nil {
+			log.Warn("update device twin reported state failed", logger.Err(err))
+		}
+	}
 
-			cacheKey := cache.LatestMetricKey(task.DeviceID)
-			if jsonBytes, err := json.Marshal(metric); err == nil {
-				if setErr := redisClient.Set(ctx, cacheKey, string(jsonBytes), cache.LatestMetricTTL); setErr != nil {
-					log.Printf("metric worker: 更新 cache 失敗 device=%s: %v，改為 invalidate", task.DeviceID, setErr)
-					redisClient.Del(ctx, cacheKey)
+	// 狀態轉換同樣只以最新的讀值判斷；補傳的舊讀值不會插入歷史轉換
+	if w.StatusEvents != nil && !outOfOrder {
+		if _, err := w.StatusEvents.Record(ctx, task.TenantID, task.DeviceID, task.Status, metric.Timestamp); err != nil {
+			log.Warn("record device status event failed", logger.Err(err))
+		}
+	}
+
+	if metric.IsAnomaly && eval.Settings.Alert {
+		w.sendAnomalyAlert(ctx, &metric, eval.Result)
+	}
+
+	log.Info("metric stored", slog.Int("metric_id", metric.ID))
+	return nil
+}
+
+// registerDevice 登記（或更新）租戶內的設備；行動設備以最新讀值的座標更新設備位置，補傳的舊讀值不覆蓋。
+// 沒有 DB（記憶體 store 的開發模式）時略過
+func (w *MetricWorker) registerDevice(ctx context.Context, task *interfaces.MetricTask, metric *models.DeviceMetric) {
+	if w.DB == nil {
+		return
+	}
+	log := logger.FromContext(ctx)
+	if _, err := w.DB.Exec(`
+		INSERT INTO devices (tenant_id, device_id, last_seen_at) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, device_id) DO UPDATE
+		SET last_seen_at = GREATEST(devices.last_seen_at, EXCLUDED.last_seen_at)
+	`, task.TenantID, task.DeviceID, metric.Timestamp); err != nil {
+		log.Warn("upsert device failed", logger.Err(err))
+	}
+	if task.Latitude != nil && task.Longitude != nil {
+		if _, err := w.DB.Exec(`
+			UPDATE devices SET latitude = $3, longitude = $4, location_updated_at = $5
+			WHERE tenant_id = $1 AND device_id = $2 AND (location_updated_at IS NULL OR location_updated_at <= $5)
+		`, task.TenantID, task.DeviceID, *task.Latitude, *task.Longitude, metric.Timestamp); err != nil {
+			log.Warn("update device location failed", logger.Err(err))
+		}
+	}
+}
+
+// updateLatestCache 回傳 false 表示快取中已有較新的讀值；寫入失敗時清除快取並視為已更新
+func (w *MetricWorker) updateLatestCache(ctx context.Context, metric *models.DeviceMetric) bool {
+	cacheKey := cache.LatestMetricKey(metric.TenantID, metric.DeviceID)
+	jsonBytes, err := json.Marshal(metric)
+	if err != nil {
+		w.Cache.Del(ctx, cacheKey, cache.VersionKey(cacheKey))
+		return true
+	}
+	stored, err := w.Cache.SetIfNewer(ctx, cacheKey, string(jsonBytes), metric.Timestamp.UnixMilli(), cache.LatestMetricTTL())
+	if err != nil {
+		logger.FromContext(ctx).Warn("update latest metric cache failed, invalidating", logger.Err(err))
+		w.Cache.Del(ctx, cacheKey, cache.VersionKey(cacheKey))
+		return true
+	}
+	return stored
+}
+
+// countLate 統計延遲與亂序（早於快取中最新一筆）的讀值
+func (w *MetricWorker) countLate(ctx context.Context, task *interfaces.MetricTask, isLate, outOfOrder bool) {
+	log := logger.FromContext(ctx)
+	if isLate {
+		log.Info("late metric stored", slog.String("timestamp", task.Timestamp))
+	}
+	if outOfOrder {
+		log.Debug("out-of-order metric, latest cache kept newer value", slog.String("timestamp", task.Timestamp))
+	}
+	if w.LateCounter == nil {
+		return
+	}
+	if isLate {
+		if err := w.LateCounter.IncrLate(ctx, task.TenantID, task.DeviceID); err != nil {
+			log.Warn("count late metric failed", logger.Err(err))
+		}
+	}
+	if outOfOrder {
+		if err := w.LateCounter.IncrOutOfOrder(ctx, task.TenantID, task.DeviceID); err != nil {
+			log.Warn("count out-of-order metric failed", logger.Err(err))
+		}
+	}
+}
+
+// evaluateAnomaly 以有回報的核心欄位與其他欄位計算異常分數；未啟用異常偵測或失敗時回傳 nil
+func (w *MetricWorker) evaluateAnomaly(ctx context.Context, task *interfaces.MetricTask) *service.AnomalyEvaluation {
+	if w.Anomaly == nil {
+		return nil
+	}
+	values := make(map[string]float64, 3+len(task.Fields))
+	for name, v := range map[string]*float64{"voltage": task.Voltage, "current": task.Current, "temperature": task.Temperature} {
+		if v != nil {
+			values[name] = *v
+		}
+	}
+	for name, v := range task.Fields {
+		values[name] = v
+	}
+	eval, err := w.Anomaly.Evaluate(ctx, task.TenantID, task.DeviceID, values)
+	if err != nil {
+		logger.FromContext(ctx).Warn("evaluate anomaly failed", logger.Err(err))
+		return nil
+	}
+	return eval
+}
+
+// sendAnomalyAlert 將告警放入佇列，由 Run 啟動的固定數量 goroutine 送出，避免 webhook 延遲拖慢寫入；
+// 佇列已滿（webhook 長時間無回應）時丟棄並記錄日誌
+func (w *MetricWorker) sendAnomalyAlert(ctx context.Context, metric *models.DeviceMetric, res *anomaly.Result) {
+	if w.Alerts == nil {
+		return
+	}
+	a := alert.Alert{
+		Type:      alert.TypeAnomaly,
+		TenantID:  metric.TenantID,
+		DeviceID:  metric.DeviceID,
+		Timestamp: metric.Timestamp,
+		Message:   fmt.Sprintf("設備 %s 讀值偏離基準（異常分數 %.2f）", metric.DeviceID, res.Score),
+		Details: map[string]interface{}{
+			"metric_id":      metric.ID,
+			"anomaly_score":  res.Score,
+			"anomaly_fields": res.Fields,
+		},
+	}
+	select {
+	case w.alertQueue() <- a:
+	default:
+		logger.FromContext(ctx).Warn("alert queue full, dropping anomaly alert", slog.Int("metric_id", metric.ID))
+	}
+}
+
+func (w *MetricWorker) alertQueue() chan alert.Alert {
+	w.alertsOnce.Do(func() {
+		size := w.AlertQueueSize
+		if size <= 0 {
+			size = defaultAlertQueueSize
+		}
+		w.alerts = make(chan alert.Alert, size)
+	})
+	return w.alerts
+}
+
+// sendAlerts 送出佇列中的告警；stop 關閉後送完剩餘的告警才返回
+func (w *MetricWorker) sendAlerts(stop <-chan struct{}) {
+	queue := w.alertQueue()
+	for {
+		select {
+		case a := <-queue:
+			w.notify(a)
+		case <-stop:
+			for {
+				select {
+				case a := <-queue:
+					w.notify(a)
+				default:
+					return
 				}
-			} else {
-				redisClient.Del(ctx, cacheKey)
 			}
-
-			log.Printf("metric worker: 已寫入 device=%s", task.DeviceID)
 		}
 	}
 }
+
+func (w *MetricWorker) notify(a alert.Alert) {
+	timeout := w.AlertTimeout
+	if timeout <= 0 {
+		timeout = defaultAlertTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := w.Alerts.Notify(ctx, a); err != nil {
+		slog.Warn("send anomaly alert failed", logger.Err(err),
+			slog.String(logger.KeyTenantID, a.TenantID), slog.String(logger.KeyDeviceID, a.DeviceID))
+	}
+}
+
+// optionalTime 解析任務中的選用時間欄位；舊版任務沒有該欄位或格式錯誤時為 nil
+func optionalTime(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// constraintViolation 判斷是否為資料本身造成、重試也不會成功的 DB 錯誤：
+// CHECK 違反（23514）或資料例外（22xxx，例如數值溢位）
+func constraintViolation(err error) (*pq.Error, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil, false
+	}
+	return pqErr, pqErr.Code == "23514" || pqErr.Code.Class() == "22"
+}
+
+// constraintField 盡量指出違反限制的欄位
+func constraintField(pqErr *pq.Error) string {
+	switch {
+	case pqErr.Column != "":
+		return pqErr.Column
+	case pqErr.Constraint != "":
+		return pqErr.Constraint
+	default:
+		return "payload"
+	}
+}
@@ -0,0 +1,357 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"iot-data-collection/app/internal/alert"
+	"iot-data-collection/app/internal/anomaly"
+	"iot-data-collection/app/internal/metricstore"
+	"iot-data-collection/app/internal/mocks"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/queue"
+	"iot-data-collection/app/internal/service"
+
+	redisdriver "github.com/redis/go-redis/v9"
+)
+
+// fakeQueue 以 slice 模擬 Redis list（index 0 為左端），只實作 worker 用到的指令
+type fakeQueue struct {
+	redisdriver.Cmdable
+
+	mu    sync.Mutex
+	items map[string][]string
+	// onBRPop 不為 nil 時於 BRPOP 取出任務前呼叫，用來模擬阻塞中的 BRPOP
+	onBRPop func(ctx context.Context)
+}
+
+func newFakeQueue(payloads ...string) *fakeQueue {
+	q := &fakeQueue{items: map[string][]string{}}
+	for _, p := range payloads {
+		q.items[queue.MetricQueueKey] = append([]string{p}, q.items[queue.MetricQueueKey]...)
+	}
+	return q
+}
+
+func (q *fakeQueue) pop(key string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := q.items[key]
+	if len(list) == 0 {
+		return "", false
+	}
+	q.items[key] = list[:len(list)-1]
+	return list[len(list)-1], true
+}
+
+func (q *fakeQueue) BRPop(ctx context.Context, timeout time.Duration, keys ...string) *redisdriver.StringSliceCmd {
+	if q.onBRPop != nil {
+		q.onBRPop(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return redisdriver.NewStringSliceResult(nil, err)
+	}
+	if p, ok := q.pop(keys[0]); ok {
+		return redisdriver.NewStringSliceResult([]string{keys[0], p}, nil)
+	}
+	time.Sleep(time.Millisecond)
+	return redisdriver.NewStringSliceResult(nil, redisdriver.Nil)
+}
+
+func (q *fakeQueue) RPop(ctx context.Context, key string) *redisdriver.StringCmd {
+	if p, ok := q.pop(key); ok {
+		return redisdriver.NewStringResult(p, nil)
+	}
+	return redisdriver.NewStringResult("", redisdriver.Nil)
+}
+
+func (q *fakeQueue) RPush(ctx context.Context, key string, values ...interface{}) *redisdriver.IntCmd {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, v := range values {
+		q.items[key] = append(q.items[key], fmt.Sprint(v))
+	}
+	return redisdriver.NewIntResult(int64(len(q.items[key])), nil)
+}
+
+func (q *fakeQueue) remaining() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.items[queue.MetricQueueKey]...)
+}
+
+// TestRunNoTaskLostOnShutdown 關閉時處理中的任務會完成，未取出的任務留在佇列，每筆剛好出現一次
+func TestRunNoTaskLostOnShutdown(t *testing.T) {
+	var pushed []string
+	for i := 0; i < 200; i++ {
+		pushed = append(pushed, fmt.Sprintf("task-%d", i))
+	}
+	q := newFakeQueue(pushed...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var handled []string
+	w := &MetricWorker{Queue: q, PopTimeout: time.Millisecond}
+	w.processFunc = func(pctx context.Context, payload string) error {
+		mu.Lock()
+		if len(handled) == 50 {
+			cancel()
+		}
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond) // 取消後仍在處理
+		if pctx.Err() != nil {
+			t.Errorf("處理中的任務不應被取消")
+		}
+		mu.Lock()
+		handled = append(handled, payload)
+		mu.Unlock()
+		return nil
+	}
+
+	w.Run(ctx)
+
+	seen := map[string]int{}
+	for _, p := range append(handled, q.remaining()...) {
+		seen[p]++
+	}
+	for _, p := range pushed {
+		if seen[p] != 1 {
+			t.Errorf("任務 %s 出現 %d 次，應剛好 1 次", p, seen[p])
+		}
+	}
+	if len(handled) >= len(pushed) {
+		t.Errorf("取消後應停止取新任務，已處理 %d 筆", len(handled))
+	}
+}
+
+// TestRunKeepsTaskFromInFlightPop 停止時進行中的 BRPOP 不會被中斷，已取出的任務照常處理
+func TestRunKeepsTaskFromInFlightPop(t *testing.T) {
+	q := newFakeQueue("task-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	q.onBRPop = func(popCtx context.Context) {
+		cancel() // BRPOP 阻塞期間收到關閉訊號
+	}
+
+	var handled []string
+	w := &MetricWorker{Queue: q, PopTimeout: time.Millisecond}
+	w.processFunc = func(_ context.Context, payload string) error {
+		handled = append(handled, payload)
+		return nil
+	}
+	w.Run(ctx)
+
+	if len(handled) != 1 || len(q.remaining()) != 0 {
+		t.Fatalf("已取出的任務應被處理，已處理 %v，佇列剩餘 %v", handled, q.remaining())
+	}
+}
+
+// TestRunRequeuesFailedTaskOnShutdown 停止中寫入失敗的任務放回佇列，由下一個 worker 優先處理
+func TestRunRequeuesFailedTaskOnShutdown(t *testing.T) {
+	q := newFakeQueue("task-1", "task-2")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var handled []string
+	w := &MetricWorker{Queue: q, PopTimeout: time.Millisecond}
+	w.processFunc = func(_ context.Context, payload string) error {
+		cancel()
+		handled = append(handled, payload)
+		return errStoreFailed
+	}
+	w.Run(ctx)
+
+	remaining := q.remaining()
+	if len(handled) != 1 {
+		t.Fatalf("取消後應只處理 1 筆，得到 %v", handled)
+	}
+	if len(remaining) != 2 || remaining[len(remaining)-1] != handled[0] {
+		t.Errorf("寫入失敗的任務應放回佇列右端，佇列為 %v", remaining)
+	}
+}
+
+// TestProcessWithMemoryStore 不需要 DB：讀值寫入記憶體 store，並以上一筆推導功率與累積電能
+func TestProcessWithMemoryStore(t *testing.T) {
+	store := metricstore.NewMemoryStore()
+	w := &MetricWorker{Store: store, Cache: &mocks.MockRedis{}}
+	ctx := context.Background()
+	for _, ts := range []string{"2026-03-01T08:00:00Z", "2026-03-01T08:06:00Z"} {
+		payload := `{"tenant_id":"acme","device_id":"meter-1","voltage":200,"current":5,"temperature":30,"status":"normal","timestamp":"` + ts + `"}`
+		if err := w.process(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := store.Latest(ctx, "acme", "meter-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.PowerW == nil || *latest.PowerW != 1000 {
+		t.Errorf("功率應為 1000W，得到 %v", latest.PowerW)
+	}
+	if latest.EnergyKWh == nil || *latest.EnergyKWh != 0.1 {
+		t.Errorf("6 分鐘 1000W 的累積電能應為 0.1kWh，得到 %v", latest.EnergyKWh)
+	}
+}
+
+type slowNotifier struct {
+	mu   sync.Mutex
+	sent int
+}
+
+func (n *slowNotifier) Notify(ctx context.Context, a alert.Alert) error {
+	time.Sleep(50 * time.Millisecond)
+	n.mu.Lock()
+	n.sent++
+	n.mu.Unlock()
+	return nil
+}
+
+// TestRunWaitsForPendingAlerts 停止時送出中的告警完成後 Run 才返回，關閉流程不會丟掉告警
+func TestRunWaitsForPendingAlerts(t *testing.T) {
+	notifier := &slowNotifier{}
+	w := &MetricWorker{Queue: newFakeQueue(), Alerts: notifier, PopTimeout: time.Millisecond}
+	w.sendAnomalyAlert(context.Background(), &models.DeviceMetric{TenantID: "acme", DeviceID: "meter-1"}, &anomaly.Result{Score: 5})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if notifier.sent != 1 {
+		t.Errorf("Run 返回前告警應已送出，已送出 %d 筆", notifier.sent)
+	}
+}
+
+// TestProcessLateRelativeToReceivedAt 延遲以接收時間判定：佇列積壓後才處理的準時讀值不標記為延遲
+func TestProcessLateRelativeToReceivedAt(t *testing.T) {
+	store := metricstore.NewMemoryStore()
+	w := &MetricWorker{Store: store, Cache: &mocks.MockRedis{}, LateWindow: 5 * time.Minute}
+	ctx := context.Background()
+	payloads := map[string]string{
+		"queued": `{"tenant_id":"acme","device_id":"queued","voltage":220,"current":1,"temperature":30,"status":"normal",` +
+			`"timestamp":"2026-03-01T08:00:00Z","received_at":"2026-03-01T08:00:02Z"}`,
+		"legacy": `{"tenant_id":"acme","device_id":"legacy","voltage":220,"current":1,"temperature":30,"status":"normal",` +
+			`"timestamp":"2026-03-01T08:00:00Z"}`,
+	}
+	for device, payload := range payloads {
+		if err := w.process(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+		m, err := store.Latest(ctx, "acme", device)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := device == "legacy"; m.IsLate != want {
+			t.Errorf("%s: is_late 應為 %v", device, want)
+		}
+	}
+}
+
+// TestProcessWithoutCoreFields 未回報電壓與電流的讀值照常寫入，不推導功率與電能
+func TestProcessWithoutCoreFields(t *testing.T) {
+	store := metricstore.NewMemoryStore()
+	w := &MetricWorker{Store: store, Cache: &mocks.MockRedis{}}
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"tenant_id":"acme","device_id":"env-1","voltage":220,"current":2,"temperature":30,"status":"normal","timestamp":"2026-03-01T08:00:00Z"}`,
+		`{"tenant_id":"acme","device_id":"env-1","temperature":31,"status":"normal","timestamp":"2026-03-01T08:01:00Z","fields":{"humidity":55}}`,
+	} {
+		if err := w.process(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := store.Latest(ctx, "acme", "env-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Voltage != nil || m.Current != nil || m.Temperature == nil || *m.Temperature != 31 {
+		t.Errorf("未回報的核心欄位應為 nil，得到 %+v", m)
+	}
+	if m.PowerW != nil || m.EnergyKWh != nil {
+		t.Errorf("缺少電壓或電流時不應推導功率與電能，得到 power=%v energy=%v", m.PowerW, m.EnergyKWh)
+	}
+}
+
+// TestEnergyCarriesOverUnpoweredReading 沒有電壓電流的讀值不中斷累積電能，也不以 0W 積分
+func TestEnergyCarriesOverUnpoweredReading(t *testing.T) {
+	store := metricstore.NewMemoryStore()
+	w := &MetricWorker{Store: store, Cache: &mocks.MockRedis{}}
+	ctx := context.Background()
+	for _, payload := range []string{
+		`{"tenant_id":"acme","device_id":"meter-1","voltage":200,"current":5,"status":"normal","timestamp":"2026-03-01T08:00:00Z"}`,
+		`{"tenant_id":"acme","device_id":"meter-1","voltage":200,"current":5,"status":"normal","timestamp":"2026-03-01T08:01:00Z"}`,
+		`{"tenant_id":"acme","device_id":"meter-1","temperature":30,"status":"normal","timestamp":"2026-03-01T08:02:00Z"}`,
+		`{"tenant_id":"acme","device_id":"meter-1","voltage":200,"current":5,"status":"normal","timestamp":"2026-03-01T08:03:00Z"}`,
+		`{"tenant_id":"acme","device_id":"meter-1","voltage":200,"current":5,"status":"normal","timestamp":"2026-03-01T08:04:00Z"}`,
+	} {
+		if err := w.process(ctx, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := store.Range(ctx, metricstore.RangeQuery{TenantID: "acme", DeviceID: "meter-1", Limit: 10})
+	if err != nil || len(list) != 5 {
+		t.Fatalf("應有 5 筆讀值，得到 %d err=%v", len(list), err)
+	}
+	// 1000W 持續 1 分鐘為 1/60 kWh；08:02 沒有功率，08:02→08:03 不計入
+	minute := 1000.0 / 60 / 1000
+	want := []float64{2 * minute, minute, minute} // 08:04、08:03、08:01
+	for i, m := range []models.DeviceMetric{list[0], list[1], list[3]} {
+		if m.EnergyKWh == nil || math.Abs(*m.EnergyKWh-want[i]) > 1e-9 {
+			t.Errorf("%s 累積電能應為 %v，得到 %v", m.Timestamp.Format("15:04"), want[i], m.EnergyKWh)
+		}
+	}
+	if list[1].EnergyDeltaKWh == nil || *list[1].EnergyDeltaKWh != 0 {
+		t.Errorf("上一筆沒有功率時增量應為 0，得到 %v", list[1].EnergyDeltaKWh)
+	}
+}
+
+type fakeAnomaly struct {
+	service.AnomalyService
+	commits int
+}
+
+func (f *fakeAnomaly) Evaluate(ctx context.Context, tenantID, deviceID string, values map[string]float64) (*service.AnomalyEvaluation, error) {
+	return &service.AnomalyEvaluation{
+		Result:   &anomaly.Result{},
+		Settings: &models.AnomalySettings{Enabled: true},
+		Baseline: anomaly.State{"voltage": {}},
+	}, nil
+}
+
+func (f *fakeAnomaly) CommitBaseline(ctx context.Context, tenantID, deviceID string, baseline anomaly.State) error {
+	f.commits++
+	return nil
+}
+
+type failingStore struct {
+	metricstore.Store
+	err error
+}
+
+func (s *failingStore) Insert(ctx context.Context, m *models.DeviceMetric) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.Store.Insert(ctx, m)
+}
+
+// TestProcessCommitsBaselineAfterInsert 寫入失敗的讀值不更新異常偵測基準
+func TestProcessCommitsBaselineAfterInsert(t *testing.T) {
+	detector := &fakeAnomaly{}
+	store := &failingStore{Store: metricstore.NewMemoryStore(), err: errors.New("connection refused")}
+	w := &MetricWorker{Store: store, Cache: &mocks.MockRedis{}, Anomaly: detector}
+	payload := `{"tenant_id":"acme","device_id":"meter-1","voltage":220,"current":1,"temperature":30,"status":"normal","timestamp":"2026-03-01T08:00:00Z"}`
+
+	if err := w.process(context.Background(), payload); !errors.Is(err, errStoreFailed) || detector.commits != 0 {
+		t.Fatalf("寫入失敗時不應保存基準，err=%v commits=%d", err, detector.commits)
+	}
+	store.err = nil
+	if err := w.process(context.Background(), payload); err != nil || detector.commits != 1 {
+		t.Errorf("寫入成功後應保存基準，err=%v commits=%d", err, detector.commits)
+	}
+}
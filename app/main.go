@@ -2,66 +2,190 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"iot-data-collection/app/internal/alert"
+	"iot-data-collection/app/internal/auth"
+	"iot-data-collection/app/internal/cache"
 	"iot-data-collection/app/internal/config"
 	"iot-data-collection/app/internal/database"
+	"iot-data-collection/app/internal/interfaces"
+	"iot-data-collection/app/internal/latedata"
+	"iot-data-collection/app/internal/localcache"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/metricstore"
 	"iot-data-collection/app/internal/queue"
 	"iot-data-collection/app/internal/redis"
 	"iot-data-collection/app/internal/router"
+	"iot-data-collection/app/internal/service"
 	"iot-data-collection/app/internal/worker"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("設定檔驗證失敗: %v", err)
+		slog.Error("config validation failed", logger.Err(err))
+		os.Exit(1)
+	}
+
+	slog.SetDefault(logger.New(cfg.LogLevel, cfg.LogFormat))
+	if path := os.Getenv(config.EnvConfigFile); path != "" {
+		slog.Info("config file loaded", slog.String("path", path))
+	}
+
+	rt := newRuntimeConfig()
+	if err := rt.apply(cfg); err != nil {
+		slog.Error("invalid config", logger.Err(err))
+		os.Exit(1)
 	}
 
-	db, err := database.NewPostgresConnection(cfg)
+	// memory store 的開發模式完全不連線 Postgres，讀值只存在記憶體，避免與資料庫混用造成資料分散
+	var db *database.DB
+	var metricStore metricstore.Store
+	if cfg.MetricStore == config.MetricStoreMemory {
+		db, err = database.NewOfflineConnection(cfg)
+		metricStore = metricstore.NewMemoryStore()
+		slog.Warn("using in-memory metric store without database, readings are lost on restart and not shared between replicas")
+	} else {
+		db, err = database.NewPostgresConnection(cfg)
+		metricStore = metricstore.NewPostgresStore(db)
+	}
 	if err != nil {
-		log.Fatalf("無法連線到資料庫: %v", err)
+		slog.Error("connect database failed", logger.Err(err))
+		os.Exit(1)
 	}
 	defer db.Close()
-	log.Println("資料庫連線成功")
+	if !db.Offline() {
+		slog.Info("database connected")
+	}
 
 	rdb, err := redis.NewRedisConnection(cfg)
 	if err != nil {
-		log.Fatalf("無法連線到 Redis: %v", err)
+		slog.Error("connect redis failed", logger.Err(err))
+		os.Exit(1)
 	}
 	defer rdb.Close()
-	log.Println("Redis 連線成功")
+	slog.Info("redis connected")
 
 	metricQueue := queue.NewRedisMetricQueue(rdb)
 
-	// 啟動背景 Worker 消費佇列並寫入 DB
+	// 啟動背景 Worker 消費佇列並寫入 metric store
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go worker.RunMetricWorker(ctx, rdb, db, redis.NewRedisAdapter(rdb))
+	go db.MonitorReplica(ctx, cfg.PostgresReplicaCheckInterval)
+	var redisAdapter interfaces.RedisClient = redis.NewRedisAdapter(rdb)
+	if cfg.LocalCacheEnabled {
+		tiered := localcache.NewTiered(redisAdapter, cfg.LocalCacheSize, cfg.LocalCacheTTL,
+			localcache.NewRedisInvalidator(rdb), cache.LatestMetricKeyPrefix)
+		tiered.Start(ctx)
+		redisAdapter = tiered
+		slog.Info("local cache tier enabled", slog.Int("size", cfg.LocalCacheSize), slog.Duration("ttl", cfg.LocalCacheTTL))
+	}
+	metricWorker := &worker.MetricWorker{
+		Queue:          rdb,
+		Store:          metricStore,
+		Cache:          redisAdapter,
+		Alerts:         alert.NewNotifierFromConfig(cfg.AlertWebhookURL),
+		LateWindow:     cfg.LateDataWindow,
+		LateCounter:    latedata.NewRedisCounter(rdb),
+		PopTimeout:     cfg.QueuePopTimeout,
+		AlertQueueSize: cfg.AlertQueueSize,
+		AlertSenders:   cfg.AlertSenders,
+		AlertTimeout:   cfg.AlertTimeout,
+	}
+	// memory store 模式不連線 Postgres，需要 Postgres 的功能停用，避免每筆讀值都記錄錯誤
+	if !db.Offline() {
+		metricWorker.DB = db
+		metricWorker.Quarantine = service.NewQuarantineService(db, nil) // worker 只寫入隔離區，重新注入由 API 處理
+		metricWorker.Anomaly = service.NewAnomalyService(db, redisAdapter)
+		metricWorker.Twins = service.NewTwinService(db, nil)
+		metricWorker.StatusEvents = service.NewStatusEventService(db)
+	}
+	// worker 使用獨立的 context，關閉時在 HTTP 停止後才通知，讓已接收的讀值都能被消費
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		metricWorker.Run(workerCtx)
+	}()
+
+	verifier, err := auth.NewVerifierFromConfig(cfg.JWTHS256Secret, cfg.JWTRSAPublicKeyFile, cfg.JWTIssuer, cfg.JWTAudience)
+	if err != nil {
+		slog.Error("load jwt verification key failed", logger.Err(err))
+		os.Exit(1)
+	}
+	if verifier == nil {
+		slog.Warn("jwt verification key not configured, role-based access control disabled")
+	}
+
+	var shuttingDown atomic.Bool
+	longPolls, cancelLongPolls := context.WithCancel(context.Background())
+	r := router.SetupRouter(cfg, db, metricStore, rdb, redisAdapter, metricQueue, verifier, rt.rateLimit, rt.clockSkew, metricWorker, shuttingDown.Load, longPolls)
 
-	r := router.SetupRouter(db, rdb, metricQueue)
+	// SIGHUP 重新載入設定檔與環境變數中可熱更新的欄位
+	go watchReload(ctx, cfg, rt)
 
 	// 啟動伺服器
 	port := cfg.AppPort
 	if port == "" {
 		port = "8080"
 	}
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	// srv.Shutdown 不會取消請求的 context；開始關閉時結束長輪詢，避免佔用整段 HTTP 關閉時間
+	srv.RegisterOnShutdown(cancelLongPolls)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+	slog.Info("server starting", slog.String("port", port))
 
-	log.Printf("伺服器啟動在 Port: %s", port)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-sigCh:
+		slog.Info("shutdown signal received", slog.String("signal", sig.String()))
+	case err := <-serveErr:
+		slog.Error("server stopped", slog.String("port", port), logger.Err(err))
+		// HTTP 已停止，仍等待 worker 處理完手上的任務再結束
+		if err := drainAll(context.Background(), []drainStep{
+			workerDrain(stopWorker, workerDone, cfg.ShutdownWorkerTimeout),
+		}); err != nil {
+			slog.Error("graceful shutdown incomplete", logger.Err(err))
+		}
+		os.Exit(1)
+	}
 
-	// 優雅關閉：收到 SIGINT/SIGTERM 時停止 worker 與 server
+	// 關閉期間再次收到訊號時立即結束
 	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-		log.Println("收到關閉訊號，停止服務...")
-		cancel()
+		sig := <-sigCh
+		slog.Warn("second shutdown signal received, exiting immediately", slog.String("signal", sig.String()))
+		os.Exit(1)
 	}()
 
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("伺服器啟動失敗 Port: %s, Error: %v", port, err)
+	// 優雅關閉：/readyz 先回報 down，等待負載平衡移除此 replica 後，
+	// 依序停止接收 HTTP 請求（各自的時間上限內）、等待 worker 處理完手上的任務，最後停止其餘背景工作
+	shuttingDown.Store(true)
+	if cfg.ShutdownDrainDelay > 0 {
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+	if err := drainAll(context.Background(), []drainStep{
+		httpDrain(srv, cfg.ShutdownTimeout),
+		workerDrain(stopWorker, workerDone, cfg.ShutdownWorkerTimeout),
+	}); err != nil {
+		slog.Error("graceful shutdown incomplete", logger.Err(err))
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server stopped", slog.String("port", port), logger.Err(err))
 	}
+	cancel()
+	slog.Info("shutdown complete")
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"iot-data-collection/app/internal/cache"
+	"iot-data-collection/app/internal/clockskew"
+	"iot-data-collection/app/internal/config"
+	"iot-data-collection/app/internal/logger"
+	"iot-data-collection/app/internal/models"
+	"iot-data-collection/app/internal/ratelimit"
+	"iot-data-collection/app/internal/service"
+)
+
+// runtimeConfig 執行期間可替換的設定（config 中標記 reload 的欄位）
+type runtimeConfig struct {
+	rateLimit *ratelimit.DynamicPolicy
+	clockSkew *clockskew.DynamicPolicy
+}
+
+func newRuntimeConfig() *runtimeConfig {
+	return &runtimeConfig{
+		rateLimit: ratelimit.NewDynamicPolicy(nil),
+		clockSkew: clockskew.NewDynamicPolicy(nil),
+	}
+}
+
+// apply 套用可熱更新的設定；政策無法建立時回傳錯誤且不做任何變更
+func (r *runtimeConfig) apply(cfg *config.Config) error {
+	rateLimitPolicy, err := ratelimit.NewPolicyFromConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	clockSkewPolicy, err := clockskew.NewPolicy(cfg.ClockSkewPolicy, cfg.ClockSkewMaxFuture, cfg.ClockSkewMaxPast)
+	if err != nil {
+		return fmt.Errorf("clock skew: %w", err)
+	}
+
+	logger.SetLevel(cfg.LogLevel)
+	r.rateLimit.Store(rateLimitPolicy)
+	r.clockSkew.Store(clockSkewPolicy)
+	cache.SetTTLs(cache.TTLs{
+		LatestMetric:      cfg.CacheLatestMetricTTL,
+		APIKeyTenant:      cfg.CacheAPIKeyTenantTTL,
+		DeviceType:        cfg.CacheDeviceTypeTTL,
+		DeviceTypeSchema:  cfg.CacheDeviceTypeSchemaTTL,
+		ValidationProfile: cfg.CacheValidationProfileTTL,
+		AnomalySettings:   cfg.CacheAnomalySettingsTTL,
+		AnomalyState:      cfg.CacheAnomalyStateTTL,
+	})
+	service.SetQueryLimits(service.QueryLimits{
+		Default:       cfg.QueryDefaultLimit,
+		Max:           cfg.QueryMaxLimit,
+		SeriesDefault: cfg.SeriesDefaultLimit,
+		SeriesMax:     cfg.SeriesMaxLimit,
+	})
+	service.SetDefaultValidationRules(map[string]models.Range{
+		"voltage":     {Min: &cfg.ValidationVoltageMin, Max: &cfg.ValidationVoltageMax},
+		"current":     {Min: &cfg.ValidationCurrentMin, Max: &cfg.ValidationCurrentMax},
+		"temperature": {Min: &cfg.ValidationTemperatureMin, Max: &cfg.ValidationTemperatureMax},
+	})
+	return nil
+}
+
+// watchReload 收到 SIGHUP 時重新載入設定並套用可熱更新的欄位；
+// 新設定不合法時維持原設定，需重啟才生效的變動只記錄警告
+func watchReload(ctx context.Context, current *config.Config, rt *runtimeConfig) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+		}
+
+		next, err := config.Load()
+		if err != nil {
+			slog.Error("config reload failed, keeping current config", logger.Err(err))
+			continue
+		}
+		merged, err := current.WithReloadable(next)
+		if err == nil {
+			err = rt.apply(merged)
+		}
+		if err != nil {
+			slog.Error("config reload failed, keeping current config", logger.Err(err))
+			continue
+		}
+
+		changes := current.Diff(next)
+		for _, ch := range changes {
+			if ch.Reloadable {
+				slog.Info("config value reloaded", slog.String("field", ch.Field), slog.String("old", ch.Old), slog.String("new", ch.New))
+			} else {
+				slog.Warn("config change requires restart", slog.String("field", ch.Field), slog.String("old", ch.Old), slog.String("new", ch.New))
+			}
+		}
+		current = merged
+		slog.Info("config reloaded", slog.Int("changes", len(changes)))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"iot-data-collection/app/internal/logger"
+)
+
+// drainStep 關閉流程中的一個子系統。之後新增的資料接收管道（例如 MQTT、gRPC 或本機暫存）
+// 應排在 worker 之前，確保已接收的讀值都先寫入佇列再停止消費
+type drainStep struct {
+	name    string
+	timeout time.Duration // 此步驟的時間上限，各步驟分開計時；0 表示只受 drainAll 的 ctx 限制
+	drain   func(ctx context.Context) error
+}
+
+// drainAll 依序關閉各子系統；某一步驟失敗或逾時仍繼續後面的步驟，最後回報未完成的子系統。
+// 每個步驟有自己的時間上限，前一步驟用完時間不會讓後面的步驟拿到已逾時的 context
+func drainAll(ctx context.Context, steps []drainStep) error {
+	var failed []string
+	for _, step := range steps {
+		start := time.Now()
+		if err := runStep(ctx, step); err != nil {
+			slog.Error("drain subsystem failed", slog.String("subsystem", step.name),
+				slog.Duration("elapsed", time.Since(start)), logger.Err(err))
+			failed = append(failed, step.name)
+			continue
+		}
+		slog.Info("subsystem drained", slog.String("subsystem", step.name), slog.Duration("elapsed", time.Since(start)))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("drain incomplete: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runStep(ctx context.Context, step drainStep) error {
+	if step.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.timeout)
+		defer cancel()
+	}
+	return step.drain(ctx)
+}
+
+// httpDrain 停止接受新連線並等待處理中的請求完成；回應 202 前讀值已寫入佇列，因此完成的請求不會遺失。
+// 長輪詢以 srv.RegisterOnShutdown 註冊的函式提前結束，不會佔用整段時間
+func httpDrain(srv *http.Server, timeout time.Duration) drainStep {
+	return drainStep{name: "http", timeout: timeout, drain: func(ctx context.Context) error {
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}}
+}
+
+// workerDrain 通知 worker 停止取新任務，並等待手上的任務與送出中的告警完成（或任務放回佇列）
+func workerDrain(stop context.CancelFunc, done <-chan struct{}, timeout time.Duration) drainStep {
+	return drainStep{name: "metric worker", timeout: timeout, drain: func(ctx context.Context) error {
+		stop()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("worker still processing: %w", ctx.Err())
+		}
+	}}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDrainAllCompletesAcceptedRequests 關閉時已進入的請求會完成並寫入佇列，之後 worker 才停止
+func TestDrainAllCompletesAcceptedRequests(t *testing.T) {
+	var mu sync.Mutex
+	var queued []string
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond) // 關閉開始時仍在處理
+		mu.Lock()
+		queued = append(queued, "reading")
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	resp := make(chan int, 1)
+	go func() {
+		res, err := http.Post("http://"+ln.Addr().String()+"/metrics", "application/json", nil)
+		if err != nil {
+			resp <- 0
+			return
+		}
+		res.Body.Close()
+		resp <- res.StatusCode
+	}()
+	<-started
+
+	var order []string
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		<-workerCtx.Done()
+		mu.Lock()
+		order = append(order, "worker stopped")
+		if len(queued) != 1 {
+			t.Errorf("worker 停止前請求應已寫入佇列")
+		}
+		mu.Unlock()
+		close(workerDone)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := drainAll(ctx, []drainStep{httpDrain(srv, 0), workerDrain(stopWorker, workerDone, 0)}); err != nil {
+		t.Fatalf("關閉流程應完成: %v", err)
+	}
+	if code := <-resp; code != http.StatusAccepted {
+		t.Errorf("已進入的請求應回應 202，得到 %d", code)
+	}
+	if len(order) != 1 {
+		t.Errorf("worker 應已停止")
+	}
+}
+
+// TestDrainAllReportsTimeout 逾時的步驟會回報錯誤，但不影響後續步驟
+func TestDrainAllReportsTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := drainAll(ctx, []drainStep{
+		workerDrain(func() {}, make(chan struct{}), 0),
+		{name: "next", drain: func(context.Context) error { ran = true; return nil }},
+	})
+	if err == nil || !ran {
+		t.Errorf("應回報逾時並繼續後續步驟，err=%v ran=%v", err, ran)
+	}
+}
+
+// serveTest 以隨機埠啟動 srv，回傳呼叫 path 的函式（回應狀態碼送到 channel，連線失敗時為 0）
+func serveTest(t *testing.T, srv *http.Server) func(path string) <-chan int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	return func(path string) <-chan int {
+		resp := make(chan int, 1)
+		go func() {
+			res, err := http.Get("http://" + ln.Addr().String() + path)
+			if err != nil {
+				resp <- 0
+				return
+			}
+			res.Body.Close()
+			resp <- res.StatusCode
+		}()
+		return resp
+	}
+}
+
+// TestDrainAllWorkerBudgetIndependentOfHTTP 不理會關閉的請求用完 HTTP 的時間後，worker 仍有自己的時間把手上的任務處理完
+func TestDrainAllWorkerBudgetIndependentOfHTTP(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release // 長時間執行，且不因關閉而結束
+	})}
+	get := serveTest(t, srv)
+	get("/slow")
+	<-started
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	var finished bool
+	go func() {
+		defer close(workerDone)
+		<-workerCtx.Done()
+		time.Sleep(100 * time.Millisecond) // 停止時仍在處理已取出的任務
+		finished = true
+	}()
+
+	err := drainAll(context.Background(), []drainStep{
+		httpDrain(srv, 50*time.Millisecond),
+		workerDrain(stopWorker, workerDone, 5*time.Second),
+	})
+	if err == nil || !strings.Contains(err.Error(), "http") || strings.Contains(err.Error(), "worker") {
+		t.Errorf("只有 HTTP 步驟應逾時，得到 %v", err)
+	}
+	if !finished {
+		t.Errorf("HTTP 逾時後 worker 仍應處理完手上的任務")
+	}
+}
+
+// TestDrainAllEndsLongPolls 開始關閉時長輪詢立即結束並回應，不佔用 HTTP 關閉時間
+func TestDrainAllEndsLongPolls(t *testing.T) {
+	longPolls, cancelLongPolls := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-longPolls.Done():
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+		w.WriteHeader(http.StatusOK)
+	})}
+	srv.RegisterOnShutdown(cancelLongPolls)
+	resp := serveTest(t, srv)("/twin/delta?wait=60s")
+	<-started
+
+	start := time.Now()
+	if err := drainAll(context.Background(), []drainStep{httpDrain(srv, 5*time.Second)}); err != nil {
+		t.Fatalf("關閉流程應完成: %v", err)
+	}
+	if code := <-resp; code != http.StatusOK || time.Since(start) > time.Second {
+		t.Errorf("長輪詢應在關閉時立即回應，得到 %d，耗時 %v", code, time.Since(start))
+	}
+}